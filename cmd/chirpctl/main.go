@@ -0,0 +1,113 @@
+// Command chirpctl runs maintenance tasks against the configured database.
+//
+//	chirpctl migrate up        apply pending migrations
+//	chirpctl migrate down [n]  revert the last n migrations (default 1)
+//	chirpctl migrate status    list migrations and whether they are applied
+//
+// It reads the same config file and environment as the server.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/config"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/migrate"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/mysql"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/postgres"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+const usage = `usage:
+  chirpctl migrate up
+  chirpctl migrate down [n]
+  chirpctl migrate status`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "migrate" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := runMigrate(os.Args[2], os.Args[3:]); err != nil {
+		fmt.Fprintf(os.Stderr, "chirpctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runMigrate(cmd string, args []string) error {
+	cfg := config.Load()
+	var (
+		db       *sql.DB
+		migrator *migrate.Migrator
+		err      error
+	)
+	switch cfg.DBDriver {
+	case "mysql":
+		if db, err = mysql.Open(cfg.DBDSN, mysql.Pool{}); err == nil {
+			migrator, err = mysql.NewMigrator(db)
+		}
+	case "postgres":
+		if db, err = postgres.Open(cfg.DBDSN); err == nil {
+			migrator, err = postgres.NewMigrator(db)
+		}
+	case "sqlite":
+		if db, err = sqlite.Open(cfg.SQLitePath); err == nil {
+			migrator, err = sqlite.NewMigrator(db)
+		}
+	default:
+		return fmt.Errorf("unsupported DB_DRIVER: %s", cfg.DBDriver)
+	}
+	if err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch cmd {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[0])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range list {
+			state := "pending"
+			if st.AppliedAt != nil {
+				state = "applied " + st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if st.Modified {
+				state += " (modified since applied)"
+			}
+			if st.Unknown {
+				state += " (not in this build)"
+			}
+			fmt.Printf("%04d_%-30s %s\n", st.Version, st.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", cmd, usage)
+	}
+}
@@ -1,21 +1,34 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/zuquanzhi/Chirp/backend/internal/config"
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
 	handler "github.com/zuquanzhi/Chirp/backend/internal/handler/http"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/cached"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/migrate"
 	"github.com/zuquanzhi/Chirp/backend/internal/repository/mysql"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/postgres"
 	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
 	"github.com/zuquanzhi/Chirp/backend/internal/service"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+	"github.com/zuquanzhi/Chirp/backend/pkg/email"
 	"github.com/zuquanzhi/Chirp/backend/pkg/limiter"
 	"github.com/zuquanzhi/Chirp/backend/pkg/logger"
+	"github.com/zuquanzhi/Chirp/backend/pkg/oidc"
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis"
 	"github.com/zuquanzhi/Chirp/backend/pkg/sms"
 )
 
@@ -32,11 +45,35 @@ func main() {
 	// Init Infrastructure (DB, FS)
 	var db *sql.DB
 
+	var migrator *migrate.Migrator
+
+	maxOpen, err := strconv.Atoi(cfg.DBMaxOpenConns)
+	if err != nil || maxOpen < 0 {
+		log.Fatalf("invalid DB_MAX_OPEN_CONNS: %s", cfg.DBMaxOpenConns)
+	}
+	maxIdle, err := strconv.Atoi(cfg.DBMaxIdleConns)
+	if err != nil || maxIdle < 0 {
+		log.Fatalf("invalid DB_MAX_IDLE_CONNS: %s", cfg.DBMaxIdleConns)
+	}
+	connLifetime, err := time.ParseDuration(cfg.DBConnMaxLifetime)
+	if err != nil || connLifetime < 0 {
+		log.Fatalf("invalid DB_CONN_MAX_LIFETIME: %s", cfg.DBConnMaxLifetime)
+	}
+	pool := mysql.Pool{MaxOpenConns: maxOpen, MaxIdleConns: maxIdle, ConnMaxLifetime: connLifetime}
+
 	switch cfg.DBDriver {
 	case "mysql":
-		db, err = mysql.InitDB(cfg.DBDSN)
+		if db, err = mysql.Open(cfg.DBDSN, pool); err == nil {
+			migrator, err = mysql.NewMigrator(db)
+		}
+	case "postgres":
+		if db, err = postgres.Open(cfg.DBDSN); err == nil {
+			migrator, err = postgres.NewMigrator(db)
+		}
 	case "sqlite":
-		db, err = sqlite.InitDB(cfg.SQLitePath)
+		if db, err = sqlite.Open(cfg.SQLitePath); err == nil {
+			migrator, err = sqlite.NewMigrator(db)
+		}
 	default:
 		log.Fatalf("unsupported DB_DRIVER: %s", cfg.DBDriver)
 	}
@@ -45,50 +82,319 @@ func main() {
 	}
 	defer db.Close()
 
+	if cfg.DBDriver == "mysql" && cfg.DBReplicaDSNs != "" {
+		stickiness, err := time.ParseDuration(cfg.DBReplicaStickiness)
+		if err != nil || stickiness < 0 {
+			log.Fatalf("invalid DB_REPLICA_STICKINESS: %s", cfg.DBReplicaStickiness)
+		}
+		checkInterval, err := time.ParseDuration(cfg.DBReplicaCheckInterval)
+		if err != nil || checkInterval <= 0 {
+			log.Fatalf("invalid DB_REPLICA_CHECK_INTERVAL: %s", cfg.DBReplicaCheckInterval)
+		}
+		var dsns []string
+		for _, dsn := range strings.Split(cfg.DBReplicaDSNs, ",") {
+			if dsn = strings.TrimSpace(dsn); dsn != "" {
+				dsns = append(dsns, dsn)
+			}
+		}
+		replicaDBs, err := mysql.OpenReplicas(dsns, pool)
+		if err != nil {
+			log.Fatalf("init db replicas: %v", err)
+		}
+		replicas := dbtx.Route(db, replicaDBs, dbtx.ReplicaOptions{Stickiness: stickiness, CheckInterval: checkInterval})
+		defer replicas.Close()
+		log.Printf("Routing reads to %d MySQL replicas (%d healthy)", len(dsns), replicas.Healthy())
+	}
+
+	if cfg.MigrateOnStart == "true" {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalf("migrate db: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("applied migration %04d_%s", m.Version, m.Name)
+		}
+	} else {
+		pending, err := migrator.Pending(context.Background())
+		if err != nil {
+			log.Fatalf("check migrations: %v", err)
+		}
+		if pending > 0 {
+			log.Fatalf("%d schema migrations pending; run `chirpctl migrate up` or set MIGRATE_ON_START=true", pending)
+		}
+	}
+
 	if err := os.MkdirAll(cfg.UploadDir, 0o755); err != nil {
 		log.Fatalf("create uploads dir: %v", err)
 	}
 
 	// Init Repositories
 	var (
-		userRepo     domain.UserRepository
-		codeRepo     domain.VerificationCodeRepository
-		resourceRepo domain.ResourceRepository
+		userRepo        domain.UserRepository
+		codeRepo        domain.VerificationCodeRepository
+		twoFactorRepo   domain.TwoFactorRepository
+		identityRepo    domain.UserIdentityRepository
+		apiTokenRepo    domain.APITokenRepository
+		roleRepo        domain.RoleRepository
+		auditRepo       domain.AuditRepository
+		resourceRepo    domain.ResourceRepository
+		reviewRepo      domain.ReviewRepository
+		reportRepo      domain.ReportRepository
+		notifRepo       domain.NotificationRepository
+		reactionRepo    domain.ReactionRepository
+		commentRepo     domain.CommentRepository
+		collectionRepo  domain.CollectionRepository
+		analyticsRepo   domain.AnalyticsRepository
+		taxonomyRepo    domain.TaxonomyRepository
+		tagRepo         domain.TagRepository
+		smsDeliveryRepo domain.SMSDeliveryRepository
 	)
 
 	switch cfg.DBDriver {
 	case "mysql":
 		userRepo = mysql.NewUserRepository(db)
 		codeRepo = mysql.NewCodeRepository(db)
+		twoFactorRepo = mysql.NewTwoFactorRepository(db)
+		identityRepo = mysql.NewIdentityRepository(db)
+		apiTokenRepo = mysql.NewAPITokenRepository(db)
+		roleRepo = mysql.NewRoleRepository(db)
+		auditRepo = mysql.NewAuditRepository(db)
 		resourceRepo = mysql.NewResourceRepository(db)
+		reviewRepo = mysql.NewReviewRepository(db)
+		reportRepo = mysql.NewReportRepository(db)
+		notifRepo = mysql.NewNotificationRepository(db)
+		reactionRepo = mysql.NewReactionRepository(db)
+		commentRepo = mysql.NewCommentRepository(db)
+		collectionRepo = mysql.NewCollectionRepository(db)
+		analyticsRepo = mysql.NewAnalyticsRepository(db)
+		taxonomyRepo = mysql.NewTaxonomyRepository(db)
+		tagRepo = mysql.NewTagRepository(db)
+		smsDeliveryRepo = mysql.NewSMSDeliveryRepository(db)
+	case "postgres":
+		userRepo = postgres.NewUserRepository(db)
+		codeRepo = postgres.NewCodeRepository(db)
+		twoFactorRepo = postgres.NewTwoFactorRepository(db)
+		identityRepo = postgres.NewIdentityRepository(db)
+		apiTokenRepo = postgres.NewAPITokenRepository(db)
+		roleRepo = postgres.NewRoleRepository(db)
+		auditRepo = postgres.NewAuditRepository(db)
+		resourceRepo = postgres.NewResourceRepository(db)
+		reviewRepo = postgres.NewReviewRepository(db)
+		reportRepo = postgres.NewReportRepository(db)
+		notifRepo = postgres.NewNotificationRepository(db)
+		reactionRepo = postgres.NewReactionRepository(db)
+		commentRepo = postgres.NewCommentRepository(db)
+		collectionRepo = postgres.NewCollectionRepository(db)
+		analyticsRepo = postgres.NewAnalyticsRepository(db)
+		taxonomyRepo = postgres.NewTaxonomyRepository(db)
+		tagRepo = postgres.NewTagRepository(db)
+		smsDeliveryRepo = postgres.NewSMSDeliveryRepository(db)
 	case "sqlite":
 		userRepo = sqlite.NewUserRepository(db)
 		codeRepo = sqlite.NewCodeRepository(db)
+		twoFactorRepo = sqlite.NewTwoFactorRepository(db)
+		identityRepo = sqlite.NewIdentityRepository(db)
+		apiTokenRepo = sqlite.NewAPITokenRepository(db)
+		roleRepo = sqlite.NewRoleRepository(db)
+		auditRepo = sqlite.NewAuditRepository(db)
 		resourceRepo = sqlite.NewResourceRepository(db)
+		reviewRepo = sqlite.NewReviewRepository(db)
+		reportRepo = sqlite.NewReportRepository(db)
+		notifRepo = sqlite.NewNotificationRepository(db)
+		reactionRepo = sqlite.NewReactionRepository(db)
+		commentRepo = sqlite.NewCommentRepository(db)
+		collectionRepo = sqlite.NewCollectionRepository(db)
+		analyticsRepo = sqlite.NewAnalyticsRepository(db)
+		taxonomyRepo = sqlite.NewTaxonomyRepository(db)
+		tagRepo = sqlite.NewTagRepository(db)
+		smsDeliveryRepo = sqlite.NewSMSDeliveryRepository(db)
 	default:
 		log.Fatalf("unsupported DB_DRIVER: %s", cfg.DBDriver)
 	}
+	// Lets services commit several repository calls together
+	txManager := dbtx.NewManager(db)
+
+	// Redis client, created on first use by the backends that need it
+	var redisClient *redis.Client
+	useRedis := func() *redis.Client {
+		if redisClient == nil {
+			redisDB, err := strconv.Atoi(cfg.RedisDB)
+			if err != nil {
+				log.Fatalf("invalid REDIS_DB: %s", cfg.RedisDB)
+			}
+			redisClient = redis.NewClient(redis.Options{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: redisDB})
+			if err := redisClient.Ping(context.Background()); err != nil {
+				log.Fatalf("init redis: %v", err)
+			}
+		}
+		return redisClient
+	}
+	defer func() {
+		if redisClient != nil {
+			redisClient.Close()
+		}
+	}()
+
+	// Read-through cache for users and resources
+	var appCache cache.Cache
+	switch cfg.CacheBackend {
+	case "none":
+	case "memory":
+		size, err := strconv.Atoi(cfg.CacheSize)
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid CACHE_SIZE: %s", cfg.CacheSize)
+		}
+		appCache = cache.NewMemory(size)
+	case "redis":
+		appCache = cache.NewRedis(useRedis(), "chirp:cache:")
+	default:
+		log.Fatalf("unsupported CACHE_BACKEND: %s", cfg.CacheBackend)
+	}
+	if appCache != nil {
+		cacheTTL, err := time.ParseDuration(cfg.CacheTTL)
+		if err != nil || cacheTTL <= 0 {
+			log.Fatalf("invalid CACHE_TTL: %s", cfg.CacheTTL)
+		}
+		userRepo = cached.NewUserRepository(userRepo, appCache, cacheTTL)
+		resources := cached.NewResourceRepository(resourceRepo, appCache, cacheTTL)
+		resourceRepo = resources
+		reactionRepo = cached.NewReactionRepository(reactionRepo, resources)
+		commentRepo = cached.NewCommentRepository(commentRepo, resources)
+		collectionRepo = cached.NewCollectionRepository(collectionRepo, resources)
+		analyticsRepo = cached.NewAnalyticsRepository(analyticsRepo, resources)
+		taxonomyRepo = cached.NewTaxonomyRepository(taxonomyRepo, resources)
+		log.Printf("Using %s cache (ttl %s)", cfg.CacheBackend, cacheTTL)
+	}
+	// Rate limiters, one per policy in spec, in memory or shared through
+	// Redis. nil when spec is "none".
+	newRateLimiter := func(name, spec string) limiter.RateLimiter {
+		policies, err := limiter.ParsePolicies(spec)
+		if err != nil {
+			log.Fatalf("invalid %s rate limit: %v", name, err)
+		}
+		limiters := make([]limiter.RateLimiter, len(policies))
+		for i, p := range policies {
+			switch cfg.RateLimitBackend {
+			case "memory":
+				limiters[i] = limiter.NewInMemoryLimiter(p)
+			case "redis":
+				limiters[i] = limiter.NewRedisLimiter(useRedis(), "chirp:ratelimit:"+name+":"+p.String()+":", p)
+			default:
+				log.Fatalf("unsupported RATE_LIMIT_BACKEND: %s", cfg.RateLimitBackend)
+			}
+		}
+		switch len(limiters) {
+		case 0:
+			return nil
+		case 1:
+			return limiters[0]
+		}
+		return limiter.NewMultiLimiter(limiters...)
+	}
 
 	// Init Services
-	// Rate Limiter: 1 request per minute per phone number
-	rateLimiter := limiter.NewInMemoryLimiter(1, time.Minute)
+	// Rate Limiter: verification codes sent per phone number or email
+	rateLimiter := newRateLimiter("code", cfg.CodeRateLimit)
+	if rateLimiter != nil {
+		defer rateLimiter.Stop()
+	}
+	// Failed login / verification code attempts per account, phone and IP
+	attemptTracker := limiter.NewInMemoryAttemptTracker(limiter.DefaultAttemptPolicy)
 
-	// SMS Sender: Use Aliyun if configured, else Console
+	// Console senders log codes only when asked to, for local development
+	devEchoCodes := cfg.DevEchoCodes == "true"
+	if devEchoCodes {
+		log.Println("WARNING: DEV_ECHO_CODES is on; console senders log verification codes. Never enable it in production.")
+	}
+
+	// SMS Sender: the configured providers in turn, else Console. Every
+	// provider attempt is recorded for troubleshooting.
+	smsDeliverySvc := service.NewSMSDeliveryService(smsDeliveryRepo)
+	smsProviderNames := cfg.SMSProviders
+	if smsProviderNames == "" && cfg.AliyunAccessKeyID != "" {
+		smsProviderNames = "aliyun"
+	}
+	var smsProviders []sms.Provider
+	for _, name := range strings.Split(smsProviderNames, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "aliyun":
+			templates, err := sms.ParseTemplates(cfg.AliyunSMSTemplates)
+			if err != nil {
+				log.Fatalf("invalid ALIYUN_SMS_TEMPLATES: %v", err)
+			}
+			if _, ok := templates[sms.DefaultTemplate]; !ok && cfg.AliyunTemplateCode != "" {
+				templates[sms.DefaultTemplate] = cfg.AliyunTemplateCode
+			}
+			p, err := sms.NewAliyunSender(cfg.AliyunAccessKeyID, cfg.AliyunAccessKeySecret, cfg.AliyunSignName, templates)
+			if err != nil {
+				log.Fatalf("init aliyun sms: %v", err)
+			}
+			smsProviders = append(smsProviders, p)
+		case "tencent":
+			templates, err := sms.ParseTemplates(cfg.TencentSMSTemplates)
+			if err != nil {
+				log.Fatalf("invalid TENCENT_SMS_TEMPLATES: %v", err)
+			}
+			smsProviders = append(smsProviders, sms.NewTencentSender(cfg.TencentSecretID, cfg.TencentSecretKey, cfg.TencentSMSAppID, cfg.TencentSMSSignName, cfg.TencentSMSRegion, templates))
+		case "webhook":
+			if cfg.SMSWebhookURL == "" {
+				log.Fatalf("SMS_PROVIDERS includes webhook but SMS_WEBHOOK_URL is empty")
+			}
+			smsProviders = append(smsProviders, sms.NewWebhookSender(cfg.SMSWebhookURL, cfg.SMSWebhookSecret))
+		default:
+			log.Fatalf("unsupported SMS provider: %s", name)
+		}
+	}
+	smsStrategy := sms.Strategy(cfg.SMSStrategy)
+	if smsStrategy != sms.Failover && smsStrategy != sms.RoundRobin {
+		log.Fatalf("unsupported SMS_STRATEGY: %s", cfg.SMSStrategy)
+	}
 	var smsSender sms.Sender
-	if cfg.AliyunAccessKeyID != "" {
-		smsSender = sms.NewAliyunSender(
-			cfg.AliyunAccessKeyID,
-			cfg.AliyunAccessKeySecret,
-			cfg.AliyunSignName,
-			cfg.AliyunTemplateCode,
-		)
-		log.Println("Using Aliyun SMS Sender")
+	if len(smsProviders) > 0 {
+		smsSender = sms.NewMultiSender(smsStrategy, smsDeliverySvc, smsProviders...)
+		log.Printf("Using SMS providers: %s (%s)", smsProviderNames, smsStrategy)
 	} else {
-		smsSender = &sms.ConsoleSender{}
+		smsSender = &sms.ConsoleSender{EchoCodes: devEchoCodes}
 		log.Println("Using Console SMS Sender (Mock)")
 	}
 
-	authSvc := service.NewAuthService(userRepo, codeRepo, smsSender, rateLimiter, cfg.JWTSecret)
+	// Email Sender: Use SMTP if configured, else Console
+	var emailSender email.Sender
+	if cfg.SMTPHost != "" {
+		emailSender = email.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+		log.Println("Using SMTP Email Sender")
+	} else {
+		emailSender = &email.ConsoleSender{EchoCodes: devEchoCodes}
+		log.Println("Using Console Email Sender (Mock)")
+	}
+
+	auditSvc := service.NewAuditService(auditRepo)
+	authSvc := service.NewAuthService(userRepo, codeRepo, twoFactorRepo, smsSender, emailSender, rateLimiter, attemptTracker, auditSvc, txManager, cfg.JWTSecret)
+	taxonomySvc := service.NewTaxonomyService(taxonomyRepo, auditSvc)
+	authzSvc := service.NewAuthzService(roleRepo, userRepo, taxonomySvc, auditSvc)
+	tokenSvc := service.NewAPITokenService(apiTokenRepo, userRepo, authzSvc, auditSvc)
+	userAdminSvc := service.NewUserAdminService(userRepo, apiTokenRepo, authzSvc, auditSvc, txManager)
+
+	// SSO Providers
+	var oidcProviders []*service.OIDCProvider
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, &service.OIDCProvider{
+			Name: p.Name,
+			Client: oidc.NewProvider(oidc.Config{
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURL:  p.RedirectURL,
+				Scopes:       p.Scopes,
+			}),
+			StudentIDClaim: p.StudentIDClaim,
+			SchoolClaim:    p.SchoolClaim,
+			School:         p.School,
+		})
+		log.Printf("Using OIDC provider %s (%s)", p.Name, p.Issuer)
+	}
+	oidcSvc := service.NewOIDCService(authSvc, userRepo, identityRepo, oidcProviders, cfg.JWTSecret)
 
 	// Init Storage
 	var storage service.FileStorage
@@ -113,50 +419,190 @@ func main() {
 	if storageErr != nil {
 		log.Fatalf("failed to init storage: %v", storageErr)
 	}
-	resourceSvc := service.NewResourceService(resourceRepo, storage)
+	resourceSvc := service.NewResourceService(resourceRepo, storage, auditSvc, taxonomySvc, tagRepo, txManager, authzSvc)
+	reviewSvc := service.NewReviewService(reviewRepo, resourceRepo, authzSvc, taxonomySvc, auditSvc, txManager)
+	notifSvc := service.NewNotificationService(notifRepo)
+	reportHideThreshold, err := strconv.Atoi(cfg.ReportHideThreshold)
+	if err != nil || reportHideThreshold < 0 {
+		log.Fatalf("invalid REPORT_HIDE_THRESHOLD: %s", cfg.ReportHideThreshold)
+	}
+	reportSvc := service.NewReportService(reportRepo, resourceRepo, notifSvc, auditSvc, txManager, reportHideThreshold)
+	engagementSvc := service.NewEngagementService(reactionRepo, commentRepo, resourceRepo, authzSvc, auditSvc)
+	collectionSvc := service.NewCollectionService(collectionRepo, resourceRepo)
+	tagSvc := service.NewTagService(tagRepo, resourceRepo, authzSvc, auditSvc)
+	dedupWindow, err := time.ParseDuration(cfg.AnalyticsDedupWindow)
+	if err != nil || dedupWindow < 0 {
+		log.Fatalf("invalid ANALYTICS_DEDUP_WINDOW: %s", cfg.AnalyticsDedupWindow)
+	}
+	flushInterval, err := time.ParseDuration(cfg.AnalyticsFlushInterval)
+	if err != nil || flushInterval <= 0 {
+		log.Fatalf("invalid ANALYTICS_FLUSH_INTERVAL: %s", cfg.AnalyticsFlushInterval)
+	}
+	analyticsSvc := service.NewAnalyticsService(analyticsRepo, resourceRepo, authzSvc, dedupWindow, flushInterval)
 
 	// Init Handlers
 	authHandler := handler.NewAuthHandler(authSvc)
-	resourceHandler := handler.NewResourceHandler(resourceSvc)
+	oidcHandler := handler.NewOIDCHandler(oidcSvc)
+	resourceHandler := handler.NewResourceHandler(resourceSvc, analyticsSvc)
+	reviewHandler := handler.NewReviewHandler(reviewSvc)
+	reportHandler := handler.NewReportHandler(reportSvc)
+	notifHandler := handler.NewNotificationHandler(notifSvc)
+	engagementHandler := handler.NewEngagementHandler(engagementSvc)
+	collectionHandler := handler.NewCollectionHandler(collectionSvc)
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsSvc)
+	taxonomyHandler := handler.NewTaxonomyHandler(taxonomySvc)
+	tagHandler := handler.NewTagHandler(tagSvc)
+	tokenHandler := handler.NewAPITokenHandler(tokenSvc)
+	roleHandler := handler.NewRoleHandler(authzSvc)
+	userAdminHandler := handler.NewUserAdminHandler(userAdminSvc)
+	auditHandler := handler.NewAuditHandler(auditSvc)
+	smsDeliveryHandler := handler.NewSMSDeliveryHandler(smsDeliverySvc)
+
+	// Request rate limits per route group, keyed by user, API token or IP
+	trustedProxies, err := handler.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	authLimiter := newRateLimiter("auth", cfg.AuthRateLimit)
+	publicLimiter := newRateLimiter("public", cfg.PublicRateLimit)
+	apiLimiter := newRateLimiter("api", cfg.APIRateLimit)
+	uploadLimiter := newRateLimiter("upload", cfg.UploadRateLimit)
+	for _, l := range []limiter.RateLimiter{authLimiter, publicLimiter, apiLimiter, uploadLimiter} {
+		if l != nil {
+			defer l.Stop()
+		}
+	}
 
 	// Setup Router
 	r := mux.NewRouter()
 	r.Use(handler.RecoverMiddleware)
+	r.Use(handler.ClientIPMiddleware(trustedProxies))
+	r.Use(handler.RequestIDMiddleware)
 	r.Use(handler.LoggingMiddleware)
 
 	// Public Routes
-	r.HandleFunc("/signup", authHandler.Signup).Methods("POST")
-	r.HandleFunc("/login", authHandler.Login).Methods("POST")
+	authRoutes := r.NewRoute().Subrouter()
+	authRoutes.Use(handler.RateLimitMiddleware("auth", authLimiter))
+	authRoutes.HandleFunc("/signup", authHandler.Signup).Methods("POST")
+	authRoutes.HandleFunc("/login", authHandler.Login).Methods("POST")
 
 	// Phone Auth Routes
-	r.HandleFunc("/auth/send-code", authHandler.SendCode).Methods("POST")
-	r.HandleFunc("/signup/phone", authHandler.SignupPhone).Methods("POST")
-	r.HandleFunc("/login/phone", authHandler.LoginPhone).Methods("POST")
+	authRoutes.HandleFunc("/auth/send-code", authHandler.SendCode).Methods("POST")
+	authRoutes.HandleFunc("/signup/phone", authHandler.SignupPhone).Methods("POST")
+	authRoutes.HandleFunc("/login/phone", authHandler.LoginPhone).Methods("POST")
+	authRoutes.HandleFunc("/login/2fa", authHandler.LoginTwoFactor).Methods("POST")
+
+	// SSO Routes
+	authRoutes.HandleFunc("/auth/oidc/providers", oidcHandler.Providers).Methods("GET")
+	authRoutes.HandleFunc("/auth/oidc/{provider}/login", oidcHandler.Login).Methods("GET")
+	authRoutes.HandleFunc("/auth/oidc/{provider}/callback", oidcHandler.Callback).Methods("GET")
 
 	publicRes := r.PathPrefix("/api/public").Subrouter()
 	// Use OptionalAuthMiddleware to attach user info if token is present
-	publicRes.Use(handler.OptionalAuthMiddleware(authSvc, cfg.JWTSecret))
-	publicRes.HandleFunc("/resources", resourceHandler.Upload).Methods("POST")
+	publicRes.Use(handler.OptionalAuthMiddleware(authSvc, tokenSvc, cfg.JWTSecret))
+	publicRes.Use(handler.RateLimitMiddleware("public", publicLimiter))
+	publicRes.HandleFunc("/resources", handler.RateLimit("upload", uploadLimiter, handler.RequireScope(domain.ScopeResourcesWrite, resourceHandler.Upload))).Methods("POST")
 	publicRes.HandleFunc("/resources", resourceHandler.List).Methods("GET")
+	publicRes.HandleFunc("/resources/top-downloads", analyticsHandler.TopDownloads).Methods("GET")
+	publicRes.HandleFunc("/resources/{id}", resourceHandler.Get).Methods("GET")
 	publicRes.HandleFunc("/resources/{id}/download", resourceHandler.Download).Methods("GET")
+	publicRes.HandleFunc("/resources/{id}/engagement", engagementHandler.Summary).Methods("GET")
+	publicRes.HandleFunc("/resources/{id}/comments", engagementHandler.Comments).Methods("GET")
+	publicRes.HandleFunc("/collections/shared/{token}", collectionHandler.Shared).Methods("GET")
+	publicRes.HandleFunc("/collections/{id}", collectionHandler.Get).Methods("GET")
+	publicRes.HandleFunc("/users/{id}/collections", collectionHandler.ByUser).Methods("GET")
+	publicRes.HandleFunc("/subjects", taxonomyHandler.Subjects).Methods("GET")
+	publicRes.HandleFunc("/resource-types", taxonomyHandler.Types).Methods("GET")
+	publicRes.HandleFunc("/tags", tagHandler.Autocomplete).Methods("GET")
 
 	// Protected Routes (User Profile, etc.)
 	api := r.PathPrefix("/api").Subrouter()
-	api.Use(handler.AuthMiddleware(authSvc, cfg.JWTSecret))
+	api.Use(handler.AuthMiddleware(authSvc, tokenSvc, cfg.JWTSecret))
+	api.Use(handler.RateLimitMiddleware("api", apiLimiter))
 
-	api.HandleFunc("/me", authHandler.Me).Methods("GET")
-	api.HandleFunc("/me", authHandler.UpdateMe).Methods("PATCH")
+	api.HandleFunc("/me", handler.RequireScope(domain.ScopeProfileRead, authHandler.Me)).Methods("GET")
+	api.HandleFunc("/me", handler.RequireScope(domain.ScopeProfileWrite, authHandler.UpdateMe)).Methods("PATCH")
+	api.HandleFunc("/me/phone/send-code", authHandler.SendBindPhoneCode).Methods("POST")
+	api.HandleFunc("/me/phone", authHandler.BindPhone).Methods("POST")
+	api.HandleFunc("/me/email/send-code", authHandler.SendBindEmailCode).Methods("POST")
+	api.HandleFunc("/me/email", authHandler.BindEmail).Methods("POST")
+	api.HandleFunc("/me/2fa/enroll", authHandler.EnrollTwoFactor).Methods("POST")
+	api.HandleFunc("/me/2fa/verify", authHandler.ConfirmTwoFactor).Methods("POST")
+	api.HandleFunc("/me/2fa/disable", authHandler.DisableTwoFactor).Methods("POST")
+	api.HandleFunc("/me/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes).Methods("POST")
+	api.HandleFunc("/me/tokens", tokenHandler.Create).Methods("POST")
+	api.HandleFunc("/me/tokens", tokenHandler.List).Methods("GET")
+	api.HandleFunc("/me/tokens/{id}", tokenHandler.Revoke).Methods("DELETE")
+	api.HandleFunc("/me/notifications", handler.RequireScope(domain.ScopeProfileRead, notifHandler.List)).Methods("GET")
+	api.HandleFunc("/resources/{id}/reports", reportHandler.Create).Methods("POST")
+	api.HandleFunc("/resources/{id}/reviews", handler.RequireScope(domain.ScopeResourcesRead, reviewHandler.History)).Methods("GET")
+	api.HandleFunc("/resources/{id}/stats", handler.RequireScope(domain.ScopeResourcesRead, analyticsHandler.Daily)).Methods("GET")
+	api.HandleFunc("/resources/{id}/resubmit", handler.RateLimit("upload", uploadLimiter, handler.RequireScope(domain.ScopeResourcesWrite, resourceHandler.Resubmit))).Methods("POST")
+	api.HandleFunc("/resources/{id}/tags", handler.RequireScope(domain.ScopeResourcesWrite, tagHandler.SetResourceTags)).Methods("PUT")
+	api.HandleFunc("/resources/{id}/rating", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.Rate)).Methods("PUT")
+	api.HandleFunc("/resources/{id}/rating", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.Unrate)).Methods("DELETE")
+	api.HandleFunc("/resources/{id}/like", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.Like)).Methods("PUT")
+	api.HandleFunc("/resources/{id}/like", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.Unlike)).Methods("DELETE")
+	api.HandleFunc("/resources/{id}/comments", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.CreateComment)).Methods("POST")
+	api.HandleFunc("/comments/{id}", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.EditComment)).Methods("PATCH")
+	api.HandleFunc("/comments/{id}", handler.RequireScope(domain.ScopeResourcesWrite, engagementHandler.DeleteComment)).Methods("DELETE")
+	api.HandleFunc("/me/collections", handler.RequireScope(domain.ScopeResourcesRead, collectionHandler.Mine)).Methods("GET")
+	api.HandleFunc("/me/collections", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Create)).Methods("POST")
+	api.HandleFunc("/collections/{id}", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Update)).Methods("PATCH")
+	api.HandleFunc("/collections/{id}", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Delete)).Methods("DELETE")
+	api.HandleFunc("/collections/{id}/items", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Reorder)).Methods("PUT")
+	api.HandleFunc("/collections/{id}/items/{resourceId}", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.AddItem)).Methods("PUT")
+	api.HandleFunc("/collections/{id}/items/{resourceId}", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.RemoveItem)).Methods("DELETE")
+	api.HandleFunc("/collections/{id}/share", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Share)).Methods("POST")
+	api.HandleFunc("/collections/{id}/share", handler.RequireScope(domain.ScopeResourcesWrite, collectionHandler.Unshare)).Methods("DELETE")
 	// api.HandleFunc("/resources", resourceHandler.Upload).Methods("POST") // Moved to public for MVP 1.0
 
-	// Admin Routes (Review, etc.) - In real app, check for Admin role
+	// Admin Routes: each route declares the permission it needs
 	admin := r.PathPrefix("/api/admin").Subrouter()
-	admin.Use(handler.AuthMiddleware(authSvc, cfg.JWTSecret))
-	admin.Use(handler.AdminMiddleware)
-	admin.HandleFunc("/resources/{id}/review", resourceHandler.Review).Methods("POST")
-	admin.HandleFunc("/resources/duplicates", resourceHandler.CheckDuplicate).Methods("GET")
-
-	// Static files (optional, usually handled by Nginx)
-	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir(cfg.UploadDir))))
+	admin.Use(handler.AuthMiddleware(authSvc, tokenSvc, cfg.JWTSecret))
+	admin.Use(handler.RateLimitMiddleware("api", apiLimiter))
+	if cfg.RequireAdmin2FA == "true" {
+		// Anyone holding a permission the admin routes check, however it
+		// was granted, needs a second factor
+		admin.Use(handler.TwoFactorMiddleware(authzSvc,
+			domain.PermResourceReview, domain.PermReportTriage, domain.PermReviewPolicy, domain.PermTaxonomyManage,
+			domain.PermUserBan, domain.PermRoleManage, domain.PermAuditRead))
+	}
+	admin.HandleFunc("/resources/{id}/review", handler.RequireScope(domain.ScopeAdminReview,
+		handler.RequirePermission(authzSvc, domain.PermResourceReview, resourceHandler.ResourceSubject, reviewHandler.Review))).Methods("POST")
+	admin.HandleFunc("/resources", handler.RequireScope(domain.ScopeAdminReview,
+		handler.RequirePermission(authzSvc, domain.PermResourceReview, nil, resourceHandler.ReviewList))).Methods("GET")
+	admin.HandleFunc("/resources/duplicates", handler.RequireScope(domain.ScopeAdminReview,
+		handler.RequirePermission(authzSvc, domain.PermResourceReview, nil, resourceHandler.CheckDuplicate))).Methods("GET")
+	admin.HandleFunc("/reports", handler.RequirePermission(authzSvc, domain.PermReportTriage, nil, reportHandler.Queue)).Methods("GET")
+	admin.HandleFunc("/reports/resources/{id}", handler.RequirePermission(authzSvc, domain.PermReportTriage, nil, reportHandler.ListByResource)).Methods("GET")
+	admin.HandleFunc("/reports/resources/{id}/resolve", handler.RequirePermission(authzSvc, domain.PermReportTriage, nil, reportHandler.Resolve)).Methods("POST")
+	admin.HandleFunc("/review-policies", handler.RequirePermission(authzSvc, domain.PermReviewPolicy, nil, reviewHandler.Policies)).Methods("GET")
+	admin.HandleFunc("/review-policies/{subject}", handler.RequirePermission(authzSvc, domain.PermReviewPolicy, nil, reviewHandler.SetPolicy)).Methods("PUT")
+	admin.HandleFunc("/review-policies/{subject}", handler.RequirePermission(authzSvc, domain.PermReviewPolicy, nil, reviewHandler.DeletePolicy)).Methods("DELETE")
+	admin.HandleFunc("/subjects", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.CreateSubject)).Methods("POST")
+	admin.HandleFunc("/subjects/{id}", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.UpdateSubject)).Methods("PATCH")
+	admin.HandleFunc("/subjects/{id}", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.DeleteSubject)).Methods("DELETE")
+	admin.HandleFunc("/resource-types", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.CreateType)).Methods("POST")
+	admin.HandleFunc("/resource-types/{id}", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.UpdateType)).Methods("PATCH")
+	admin.HandleFunc("/resource-types/{id}", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.DeleteType)).Methods("DELETE")
+	admin.HandleFunc("/tags/{id}", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, tagHandler.Rename)).Methods("PATCH")
+	admin.HandleFunc("/tags/{id}/merge", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, tagHandler.Merge)).Methods("POST")
+	admin.HandleFunc("/taxonomy/backfill", handler.RequirePermission(authzSvc, domain.PermTaxonomyManage, nil, taxonomyHandler.Backfill)).Methods("POST")
+	admin.HandleFunc("/users", handler.RequirePermission(authzSvc, domain.PermUserBan, nil, userAdminHandler.List)).Methods("GET")
+	admin.HandleFunc("/users/{id}", handler.RequirePermission(authzSvc, domain.PermUserBan, nil, userAdminHandler.Get)).Methods("GET")
+	admin.HandleFunc("/users/{id}/role", handler.RequirePermission(authzSvc, domain.PermRoleManage, nil, userAdminHandler.SetRole)).Methods("PUT")
+	admin.HandleFunc("/users/{id}/suspend", handler.RequirePermission(authzSvc, domain.PermUserBan, nil, userAdminHandler.Suspend)).Methods("POST")
+	admin.HandleFunc("/users/{id}/unsuspend", handler.RequirePermission(authzSvc, domain.PermUserBan, nil, userAdminHandler.Unsuspend)).Methods("POST")
+	admin.HandleFunc("/users/{id}/logout", handler.RequirePermission(authzSvc, domain.PermUserBan, nil, userAdminHandler.ForceLogout)).Methods("POST")
+	admin.HandleFunc("/audit", handler.RequirePermission(authzSvc, domain.PermAuditRead, nil, auditHandler.List)).Methods("GET")
+	admin.HandleFunc("/audit/export", handler.RequirePermission(authzSvc, domain.PermAuditRead, nil, auditHandler.Export)).Methods("GET")
+	admin.HandleFunc("/audit/verify", handler.RequirePermission(authzSvc, domain.PermAuditRead, nil, auditHandler.Verify)).Methods("GET")
+	admin.HandleFunc("/sms/deliveries", handler.RequirePermission(authzSvc, domain.PermAuditRead, nil, smsDeliveryHandler.List)).Methods("GET")
+	admin.HandleFunc("/roles", handler.RequirePermission(authzSvc, domain.PermRoleManage, nil, roleHandler.Roles)).Methods("GET")
+	admin.HandleFunc("/users/{id}/roles", handler.RequirePermission(authzSvc, domain.PermRoleManage, nil, roleHandler.ListUserRoles)).Methods("GET")
+	admin.HandleFunc("/users/{id}/roles", handler.RequirePermission(authzSvc, domain.PermRoleManage, nil, roleHandler.AssignUserRole)).Methods("POST")
+	admin.HandleFunc("/users/{id}/roles/{role}", handler.RequirePermission(authzSvc, domain.PermRoleManage, nil, roleHandler.RevokeUserRole)).Methods("DELETE")
 
 	// Start Server
 	srv := &http.Server{
@@ -166,8 +612,22 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 	}
 
+	// Stop on SIGINT/SIGTERM so buffered analytics counts are written
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
 	log.Printf("Chirp server listening on %s", srv.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	analyticsSvc.Close()
+	log.Println("Chirp server stopped")
 }
@@ -20,6 +20,105 @@ type Config struct {
 	AliyunBucketName      string
 	AliyunSignName        string
 	AliyunTemplateCode    string
+	SMTPHost              string
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	SMTPFrom              string
+	// RequireAdmin2FA forces admins to sign in with a second factor ("true"/"false")
+	RequireAdmin2FA string
+	// ReportHideThreshold is the number of open reports that sends a
+	// published resource back to review ("0" disables)
+	ReportHideThreshold string
+	// AnalyticsDedupWindow is how long repeat downloads/views by the same
+	// user or IP count once, as a Go duration ("30m")
+	AnalyticsDedupWindow string
+	// AnalyticsFlushInterval is how often buffered counts are written ("10s")
+	AnalyticsFlushInterval string
+	// MigrateOnStart applies pending schema migrations when the server
+	// starts ("true"/"false"); when off, run `chirpctl migrate up` first
+	MigrateOnStart string
+	// DBMaxOpenConns, DBMaxIdleConns and DBConnMaxLifetime ("30m") size the
+	// MySQL connection pools; "0" keeps the database/sql default
+	DBMaxOpenConns    string
+	DBMaxIdleConns    string
+	DBConnMaxLifetime string
+	// DBReplicaDSNs is a comma-separated list of MySQL read replicas that
+	// serve resource listings and lookups
+	DBReplicaDSNs string
+	// DBReplicaStickiness is how long a user's reads stay on the primary
+	// after their own write ("5s")
+	DBReplicaStickiness string
+	// DBReplicaCheckInterval is how often replicas are health-checked ("10s")
+	DBReplicaCheckInterval string
+	// CacheBackend caches hot reads: "memory" (per process), "redis"
+	// (shared through RedisAddr) or "none"
+	CacheBackend string
+	// CacheTTL bounds how long a cached read is served ("30s")
+	CacheTTL string
+	// CacheSize is the most entries the memory backend holds
+	CacheSize string
+	// RedisAddr, RedisPassword and RedisDB locate the Redis-protocol server
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       string
+	// RateLimitBackend keeps rate limit counts in "memory" (per process)
+	// or "redis" (shared by all instances)
+	RateLimitBackend string
+	// CodeRateLimit limits verification codes sent per phone or email, as
+	// comma separated [algorithm:]limit/window policies
+	CodeRateLimit string
+	// AuthRateLimit, PublicRateLimit and APIRateLimit limit requests per
+	// client to the sign-in routes, /api/public and the authenticated API;
+	// UploadRateLimit additionally limits uploads and resubmissions
+	AuthRateLimit   string
+	PublicRateLimit string
+	APIRateLimit    string
+	UploadRateLimit string
+	// TrustedProxies lists the proxies (addresses or CIDR ranges) whose
+	// X-Forwarded-For header gives the client IP
+	TrustedProxies string
+	// SMSProviders lists the providers verification codes are sent
+	// through, in order: "aliyun", "tencent" and "webhook". Empty means
+	// Aliyun when its access key is set, else codes are only logged.
+	SMSProviders string
+	// SMSStrategy is "failover" (start with the first provider) or
+	// "round_robin"; either way a failed send moves on to the next one
+	SMSStrategy string
+	// AliyunSMSTemplates maps purposes to Aliyun template codes, e.g.
+	// "signup=SMS_1,login=SMS_2"; AliyunTemplateCode covers the rest
+	AliyunSMSTemplates string
+	TencentSecretID    string
+	TencentSecretKey   string
+	TencentSMSAppID    string
+	TencentSMSSignName string
+	TencentSMSRegion   string
+	// TencentSMSTemplates maps purposes to Tencent template IDs, with
+	// "default" covering the rest
+	TencentSMSTemplates string
+	// SMSWebhookURL receives codes as JSON POSTs signed with SMSWebhookSecret
+	SMSWebhookURL    string
+	SMSWebhookSecret string
+	// DevEchoCodes makes the console SMS and email senders, used when no
+	// provider is configured, log verification codes. Development only.
+	DevEchoCodes string
+	// OIDCProviders configures single sign-on providers (config file only)
+	OIDCProviders []OIDCProviderConfig
+}
+
+// OIDCProviderConfig describes an OpenID Connect identity provider.
+// Claim names default to "student_id" and "school"; School is used when the
+// provider does not send a school claim (e.g. a single-university IdP).
+type OIDCProviderConfig struct {
+	Name           string
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	StudentIDClaim string
+	SchoolClaim    string
+	School         string
 }
 
 func Load() *Config {
@@ -55,6 +154,52 @@ func Load() *Config {
 	cfg.AliyunSignName = firstNonEmpty(os.Getenv("ALIYUN_SIGN_NAME"), fileCfgValue(fileCfg, func(c *Config) string { return c.AliyunSignName }), "")
 	cfg.AliyunTemplateCode = firstNonEmpty(os.Getenv("ALIYUN_TEMPLATE_CODE"), fileCfgValue(fileCfg, func(c *Config) string { return c.AliyunTemplateCode }), "")
 
+	cfg.SMTPHost = firstNonEmpty(os.Getenv("SMTP_HOST"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMTPHost }), "")
+	cfg.SMTPPort = firstNonEmpty(os.Getenv("SMTP_PORT"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMTPPort }), "587")
+	cfg.SMTPUsername = firstNonEmpty(os.Getenv("SMTP_USERNAME"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMTPUsername }), "")
+	cfg.SMTPPassword = firstNonEmpty(os.Getenv("SMTP_PASSWORD"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMTPPassword }), "")
+	cfg.SMTPFrom = firstNonEmpty(os.Getenv("SMTP_FROM"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMTPFrom }), "")
+	cfg.RequireAdmin2FA = firstNonEmpty(os.Getenv("REQUIRE_ADMIN_2FA"), fileCfgValue(fileCfg, func(c *Config) string { return c.RequireAdmin2FA }), "false")
+	cfg.ReportHideThreshold = firstNonEmpty(os.Getenv("REPORT_HIDE_THRESHOLD"), fileCfgValue(fileCfg, func(c *Config) string { return c.ReportHideThreshold }), "3")
+	cfg.AnalyticsDedupWindow = firstNonEmpty(os.Getenv("ANALYTICS_DEDUP_WINDOW"), fileCfgValue(fileCfg, func(c *Config) string { return c.AnalyticsDedupWindow }), "30m")
+	cfg.AnalyticsFlushInterval = firstNonEmpty(os.Getenv("ANALYTICS_FLUSH_INTERVAL"), fileCfgValue(fileCfg, func(c *Config) string { return c.AnalyticsFlushInterval }), "10s")
+	cfg.MigrateOnStart = firstNonEmpty(os.Getenv("MIGRATE_ON_START"), fileCfgValue(fileCfg, func(c *Config) string { return c.MigrateOnStart }), "true")
+	cfg.DBMaxOpenConns = firstNonEmpty(os.Getenv("DB_MAX_OPEN_CONNS"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBMaxOpenConns }), "25")
+	cfg.DBMaxIdleConns = firstNonEmpty(os.Getenv("DB_MAX_IDLE_CONNS"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBMaxIdleConns }), "10")
+	cfg.DBConnMaxLifetime = firstNonEmpty(os.Getenv("DB_CONN_MAX_LIFETIME"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBConnMaxLifetime }), "30m")
+	cfg.DBReplicaDSNs = firstNonEmpty(os.Getenv("DB_REPLICA_DSNS"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBReplicaDSNs }), "")
+	cfg.DBReplicaStickiness = firstNonEmpty(os.Getenv("DB_REPLICA_STICKINESS"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBReplicaStickiness }), "5s")
+	cfg.DBReplicaCheckInterval = firstNonEmpty(os.Getenv("DB_REPLICA_CHECK_INTERVAL"), fileCfgValue(fileCfg, func(c *Config) string { return c.DBReplicaCheckInterval }), "10s")
+	cfg.CacheBackend = firstNonEmpty(os.Getenv("CACHE_BACKEND"), fileCfgValue(fileCfg, func(c *Config) string { return c.CacheBackend }), "memory")
+	cfg.CacheTTL = firstNonEmpty(os.Getenv("CACHE_TTL"), fileCfgValue(fileCfg, func(c *Config) string { return c.CacheTTL }), "30s")
+	cfg.CacheSize = firstNonEmpty(os.Getenv("CACHE_SIZE"), fileCfgValue(fileCfg, func(c *Config) string { return c.CacheSize }), "10000")
+	cfg.RedisAddr = firstNonEmpty(os.Getenv("REDIS_ADDR"), fileCfgValue(fileCfg, func(c *Config) string { return c.RedisAddr }), "127.0.0.1:6379")
+	cfg.RedisPassword = firstNonEmpty(os.Getenv("REDIS_PASSWORD"), fileCfgValue(fileCfg, func(c *Config) string { return c.RedisPassword }), "")
+	cfg.RedisDB = firstNonEmpty(os.Getenv("REDIS_DB"), fileCfgValue(fileCfg, func(c *Config) string { return c.RedisDB }), "0")
+	cfg.RateLimitBackend = firstNonEmpty(os.Getenv("RATE_LIMIT_BACKEND"), fileCfgValue(fileCfg, func(c *Config) string { return c.RateLimitBackend }), "memory")
+	cfg.CodeRateLimit = firstNonEmpty(os.Getenv("CODE_RATE_LIMIT"), fileCfgValue(fileCfg, func(c *Config) string { return c.CodeRateLimit }), "1/1m,sliding_log:10/24h")
+	cfg.AuthRateLimit = firstNonEmpty(os.Getenv("AUTH_RATE_LIMIT"), fileCfgValue(fileCfg, func(c *Config) string { return c.AuthRateLimit }), "20/1m")
+	cfg.PublicRateLimit = firstNonEmpty(os.Getenv("PUBLIC_RATE_LIMIT"), fileCfgValue(fileCfg, func(c *Config) string { return c.PublicRateLimit }), "120/1m")
+	cfg.APIRateLimit = firstNonEmpty(os.Getenv("API_RATE_LIMIT"), fileCfgValue(fileCfg, func(c *Config) string { return c.APIRateLimit }), "300/1m")
+	cfg.UploadRateLimit = firstNonEmpty(os.Getenv("UPLOAD_RATE_LIMIT"), fileCfgValue(fileCfg, func(c *Config) string { return c.UploadRateLimit }), "5/1m,sliding_log:50/24h")
+	cfg.TrustedProxies = firstNonEmpty(os.Getenv("TRUSTED_PROXIES"), fileCfgValue(fileCfg, func(c *Config) string { return c.TrustedProxies }), "")
+	cfg.SMSProviders = firstNonEmpty(os.Getenv("SMS_PROVIDERS"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMSProviders }), "")
+	cfg.SMSStrategy = firstNonEmpty(os.Getenv("SMS_STRATEGY"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMSStrategy }), "failover")
+	cfg.AliyunSMSTemplates = firstNonEmpty(os.Getenv("ALIYUN_SMS_TEMPLATES"), fileCfgValue(fileCfg, func(c *Config) string { return c.AliyunSMSTemplates }), "")
+	cfg.TencentSecretID = firstNonEmpty(os.Getenv("TENCENT_SECRET_ID"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSecretID }), "")
+	cfg.TencentSecretKey = firstNonEmpty(os.Getenv("TENCENT_SECRET_KEY"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSecretKey }), "")
+	cfg.TencentSMSAppID = firstNonEmpty(os.Getenv("TENCENT_SMS_APP_ID"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSMSAppID }), "")
+	cfg.TencentSMSSignName = firstNonEmpty(os.Getenv("TENCENT_SMS_SIGN_NAME"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSMSSignName }), "")
+	cfg.TencentSMSRegion = firstNonEmpty(os.Getenv("TENCENT_SMS_REGION"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSMSRegion }), "ap-guangzhou")
+	cfg.TencentSMSTemplates = firstNonEmpty(os.Getenv("TENCENT_SMS_TEMPLATES"), fileCfgValue(fileCfg, func(c *Config) string { return c.TencentSMSTemplates }), "")
+	cfg.SMSWebhookURL = firstNonEmpty(os.Getenv("SMS_WEBHOOK_URL"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMSWebhookURL }), "")
+	cfg.SMSWebhookSecret = firstNonEmpty(os.Getenv("SMS_WEBHOOK_SECRET"), fileCfgValue(fileCfg, func(c *Config) string { return c.SMSWebhookSecret }), "")
+	cfg.DevEchoCodes = firstNonEmpty(os.Getenv("DEV_ECHO_CODES"), fileCfgValue(fileCfg, func(c *Config) string { return c.DevEchoCodes }), "false")
+
+	if fileCfg != nil {
+		cfg.OIDCProviders = fileCfg.OIDCProviders
+	}
+
 	return cfg
 }
 
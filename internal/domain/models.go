@@ -2,24 +2,94 @@ package domain
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
+var (
+	ErrEmailTaken = errors.New("email already used")
+	ErrPhoneTaken = errors.New("phone number already used")
+	// ErrDuplicateReport is returned when a user reports a resource twice
+	ErrDuplicateReport = errors.New("resource already reported")
+	// ErrTagNameTaken is returned when renaming a tag onto another tag's name
+	ErrTagNameTaken = errors.New("tag name already used")
+)
+
 type ResourceStatus string
 
 const (
 	ResourceStatusPending  ResourceStatus = "PENDING"
 	ResourceStatusApproved ResourceStatus = "APPROVED"
 	ResourceStatusRejected ResourceStatus = "REJECTED"
+	// ResourceStatusChangesRequested waits for the uploader to resubmit
+	ResourceStatusChangesRequested ResourceStatus = "CHANGES_REQUESTED"
+)
+
+// ReviewDecision is a reviewer's verdict on one submission of a resource
+type ReviewDecision string
+
+const (
+	ReviewApprove        ReviewDecision = "APPROVE"
+	ReviewReject         ReviewDecision = "REJECT"
+	ReviewRequestChanges ReviewDecision = "REQUEST_CHANGES"
+)
+
+// Review reason codes, required when rejecting or requesting changes
+const (
+	ReasonDuplicate     = "duplicate"
+	ReasonCopyright     = "copyright"
+	ReasonWrongSubject  = "wrong_subject"
+	ReasonLowQuality    = "low_quality"
+	ReasonIncomplete    = "incomplete"
+	ReasonInappropriate = "inappropriate"
+	ReasonOther         = "other"
 )
 
+// ReviewReasonCodes lists every accepted review reason code
+var ReviewReasonCodes = []string{ReasonDuplicate, ReasonCopyright, ReasonWrongSubject, ReasonLowQuality, ReasonIncomplete, ReasonInappropriate, ReasonOther}
+
 type UserRole string
 
 const (
-	RoleUser  UserRole = "USER"
-	RoleAdmin UserRole = "ADMIN"
+	RoleUser      UserRole = "USER"
+	RoleAdmin     UserRole = "ADMIN"
+	RoleModerator UserRole = "MODERATOR"
+	RoleTA        UserRole = "TA" // course teaching assistant, normally scoped to a subject
+)
+
+// Permission names an action guarded by RBAC
+type Permission string
+
+const (
+	PermResourceReview  Permission = "resource.review"
+	PermUserBan         Permission = "user.ban"
+	PermRoleManage      Permission = "role.manage"
+	PermAuditRead       Permission = "audit.read"
+	PermReviewPolicy    Permission = "review.policy"
+	PermReportTriage    Permission = "report.triage"
+	PermCommentModerate Permission = "comment.moderate"
+	PermAnalyticsRead   Permission = "analytics.read"
+	PermTaxonomyManage  Permission = "taxonomy.manage"
 )
 
+// RolePermissions maps each role to the permissions it grants
+var RolePermissions = map[UserRole][]Permission{
+	RoleAdmin:     {PermResourceReview, PermUserBan, PermRoleManage, PermAuditRead, PermReviewPolicy, PermReportTriage, PermCommentModerate, PermAnalyticsRead, PermTaxonomyManage},
+	RoleModerator: {PermResourceReview, PermUserBan, PermReportTriage, PermCommentModerate},
+	RoleTA:        {PermResourceReview},
+}
+
+// Grants reports whether the role carries the permission
+func (r UserRole) Grants(p Permission) bool {
+	for _, perm := range RolePermissions[r] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
 // User represents a registered user
 type User struct {
 	ID          int64     `json:"id"`
@@ -34,6 +104,28 @@ type User struct {
 	Birthdate   string    `json:"birthdate,omitempty"`
 	Address     string    `json:"address,omitempty"`
 	Gender      string    `json:"gender,omitempty"`
+
+	// Suspension: SuspendedAt is set while suspended; a nil SuspendedUntil means indefinitely
+	SuspendedAt    *time.Time `json:"suspended_at,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	SuspendReason  string     `json:"suspend_reason,omitempty"`
+	// TokenVersion is signed into session tokens; a forced logout bumps it,
+	// rejecting every token signed with an earlier version
+	TokenVersion int64 `json:"-"`
+}
+
+// Suspended reports whether the account is suspended at the given time
+func (u *User) Suspended(now time.Time) bool {
+	return u.SuspendedAt != nil && (u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil))
+}
+
+// UserFilter narrows admin user listings
+type UserFilter struct {
+	Query     string // matched against name, email, phone number and school
+	Role      UserRole
+	Suspended bool // only currently suspended users
+	Limit     int
+	Offset    int
 }
 
 // Resource represents an uploaded file metadata
@@ -46,11 +138,322 @@ type Resource struct {
 	OriginalName string         `json:"original_name"` // original filename uploaded
 	Size         int64          `json:"size"`
 	FileHash     string         `json:"file_hash"` // SHA256 hash for duplicate check
-	Status       ResourceStatus `json:"status"`    // PENDING, APPROVED, REJECTED
+	Status       ResourceStatus `json:"status"`    // PENDING, APPROVED, REJECTED, CHANGES_REQUESTED
 	CreatedAt    time.Time      `json:"created_at"`
 	Subject      string         `json:"subject,omitempty"`
 	Type         string         `json:"type,omitempty"`
 	URL          string         `json:"url,omitempty"` // Public URL for the file
+	// SubjectID and TypeID point into the managed taxonomy; Subject and Type
+	// then hold the canonical slugs
+	SubjectID *int64 `json:"subject_id,omitempty"`
+	TypeID    *int64 `json:"type_id,omitempty"`
+	// Tags are the normalized tag names, loaded by the resource service
+	Tags []string `json:"tags,omitempty"`
+	// ReviewRound counts submissions; it starts at 1 and grows with each
+	// resubmission, so approvals from earlier rounds no longer count
+	ReviewRound int `json:"review_round"`
+
+	// Engagement aggregates, kept in step with the rating, like and comment tables
+	RatingAvg    float64 `json:"rating_avg"`
+	RatingCount  int     `json:"rating_count"`
+	LikeCount    int     `json:"like_count"`
+	CommentCount int     `json:"comment_count"`
+	// FavoriteCount is the number of users with the resource in a collection
+	FavoriteCount int `json:"favorite_count"`
+	// Download and view totals, written in batches by the analytics service
+	DownloadCount int `json:"download_count"`
+	ViewCount     int `json:"view_count"`
+}
+
+// ResourceSort orders resource listings
+type ResourceSort string
+
+const (
+	SortNewest    ResourceSort = "newest"
+	SortRating    ResourceSort = "rating"
+	SortLikes     ResourceSort = "likes"
+	SortComments  ResourceSort = "comments"
+	SortFavorites ResourceSort = "favorites"
+	SortDownloads ResourceSort = "downloads"
+)
+
+// ResourceFilter narrows resource listings. Zero values match everything;
+// an empty Sort lists newest first.
+type ResourceFilter struct {
+	Status ResourceStatus
+	Search string // matched against title and description
+	Sort   ResourceSort
+	// Tags keeps resources carrying any of the tags, or all of them when
+	// AllTags is set
+	Tags    []string
+	AllTags bool
+}
+
+// Tag is a free-form label on resources. Names are normalized to lower case
+// with dashes for spaces; ResourceCount is the number of tagged resources.
+type Tag struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	ResourceCount int       `json:"resource_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SubjectKind is a level of the subject hierarchy
+type SubjectKind string
+
+const (
+	SubjectSchool     SubjectKind = "school"
+	SubjectDepartment SubjectKind = "department"
+	SubjectCourse     SubjectKind = "course"
+)
+
+// TaxonomyScope tells subject and resource type aliases apart
+type TaxonomyScope string
+
+const (
+	TaxonomySubject TaxonomyScope = "subject"
+	TaxonomyType    TaxonomyScope = "type"
+)
+
+// Subject is a managed category: schools contain departments, departments
+// contain courses. Slug is the canonical value stored on resources; Names
+// holds display names by language ("zh", "en") and Aliases other spellings
+// that resolve to this subject.
+type Subject struct {
+	ID          int64             `json:"id"`
+	ParentID    *int64            `json:"parent_id,omitempty"`
+	Kind        SubjectKind       `json:"kind"`
+	Slug        string            `json:"slug"`
+	Name        string            `json:"name"`
+	Names       map[string]string `json:"names,omitempty"`
+	Aliases     []string          `json:"aliases,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DisplayName string            `json:"display_name,omitempty"`
+	Children    []*Subject        `json:"children,omitempty"`
+}
+
+// ResourceType is a managed kind of material such as "notes" or "exam"
+type ResourceType struct {
+	ID          int64             `json:"id"`
+	Slug        string            `json:"slug"`
+	Name        string            `json:"name"`
+	Names       map[string]string `json:"names,omitempty"`
+	Aliases     []string          `json:"aliases,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DisplayName string            `json:"display_name,omitempty"`
+}
+
+// ResourceEvent kinds counted by analytics
+type ResourceEvent string
+
+const (
+	EventDownload ResourceEvent = "download"
+	EventView     ResourceEvent = "view"
+)
+
+// ResourceDailyStat counts the downloads and views of a resource on one day
+// (UTC, formatted 2006-01-02)
+type ResourceDailyStat struct {
+	ResourceID int64  `json:"-"`
+	Day        string `json:"day"`
+	Downloads  int    `json:"downloads"`
+	Views      int    `json:"views"`
+}
+
+// ResourceCount pairs a resource with a count, e.g. for rankings
+type ResourceCount struct {
+	ResourceID int64
+	Count      int
+}
+
+type CollectionVisibility string
+
+const (
+	CollectionPrivate CollectionVisibility = "PRIVATE"
+	CollectionPublic  CollectionVisibility = "PUBLIC"
+)
+
+// Collection is a user's ordered list of resources. Private collections can
+// still be opened by anyone holding the share token.
+type Collection struct {
+	ID          int64                `json:"id"`
+	OwnerID     int64                `json:"owner_id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Visibility  CollectionVisibility `json:"visibility"`
+	ShareToken  string               `json:"share_token,omitempty"`
+	ItemCount   int                  `json:"item_count"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// CollectionItem places a resource in a collection. Items whose resource is
+// gone or no longer approved are Hidden and carry no Resource.
+type CollectionItem struct {
+	ResourceID int64     `json:"resource_id"`
+	Position   int       `json:"position"`
+	AddedAt    time.Time `json:"added_at"`
+	Hidden     bool      `json:"hidden,omitempty"`
+	Resource   *Resource `json:"resource,omitempty"`
+}
+
+// Comment is a remark on a resource. Replies set ParentID; deleted comments
+// keep their row so replies stay threaded but lose their content.
+type Comment struct {
+	ID         int64      `json:"id"`
+	ResourceID int64      `json:"resource_id"`
+	UserID     int64      `json:"user_id"`
+	ParentID   *int64     `json:"parent_id,omitempty"`
+	Content    string     `json:"content"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy  *int64     `json:"-"`
+	Replies    []*Comment `json:"replies,omitempty"`
+}
+
+// ResourceReview is one reviewer's decision on one round of a resource
+type ResourceReview struct {
+	ID         int64          `json:"id"`
+	ResourceID int64          `json:"resource_id"`
+	ReviewerID int64          `json:"reviewer_id"`
+	Round      int            `json:"round"`
+	Decision   ReviewDecision `json:"decision"`
+	ReasonCode string         `json:"reason_code,omitempty"`
+	Comment    string         `json:"comment,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// ReviewPolicy sets how many distinct approvals publish a resource of a
+// subject. Subjects without a policy need one approval.
+type ReviewPolicy struct {
+	Subject           string    `json:"subject"`
+	RequiredApprovals int       `json:"required_approvals"`
+	UpdatedBy         *int64    `json:"updated_by,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Report reason categories
+const (
+	ReportCopyright    = "copyright"
+	ReportWrongSubject = "wrong_subject"
+	ReportOffensive    = "offensive"
+	ReportSpam         = "spam"
+	ReportOther        = "other"
+)
+
+// ReportReasons lists every accepted report reason
+var ReportReasons = []string{ReportCopyright, ReportWrongSubject, ReportOffensive, ReportSpam, ReportOther}
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "OPEN"
+	ReportUpheld    ReportStatus = "UPHELD"    // the resource was taken down
+	ReportDismissed ReportStatus = "DISMISSED" // no violation found
+)
+
+// ResourceReport is a user's flag on a published resource. Each user may
+// report a resource once.
+type ResourceReport struct {
+	ID         int64        `json:"id"`
+	ResourceID int64        `json:"resource_id"`
+	ReporterID int64        `json:"reporter_id"`
+	Reason     string       `json:"reason"`
+	Detail     string       `json:"detail,omitempty"`
+	Status     ReportStatus `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ResolvedBy *int64       `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time   `json:"resolved_at,omitempty"`
+}
+
+// ReportGroup summarizes the open reports on one resource for triage
+type ReportGroup struct {
+	ResourceID     int64          `json:"resource_id"`
+	Title          string         `json:"title"`
+	Subject        string         `json:"subject,omitempty"`
+	Status         ResourceStatus `json:"status"`
+	OpenReports    int            `json:"open_reports"`
+	Reasons        map[string]int `json:"reasons"`
+	LastReportedAt time.Time      `json:"last_reported_at"`
+}
+
+// RoleAssignment grants a role to a user, optionally limited to one Subject.
+// An empty Subject applies everywhere.
+type RoleAssignment struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Role      UserRole  `json:"role"`
+	Subject   string    `json:"subject,omitempty"`
+	GrantedBy *int64    `json:"granted_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Audit log actions
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditProfileUpdate      = "user.profile_update"
+	AuditPhoneBind          = "user.phone_bind"
+	AuditEmailBind          = "user.email_bind"
+	AuditTwoFactorEnable    = "user.2fa_enable"
+	AuditTwoFactorDisable   = "user.2fa_disable"
+	AuditRecoveryCodesRenew = "user.2fa_recovery_codes"
+	AuditAPITokenCreate     = "api_token.create"
+	AuditAPITokenRevoke     = "api_token.revoke"
+	AuditResourceReview     = "resource.review"
+	AuditResourceResubmit   = "resource.resubmit"
+	AuditReviewPolicySet    = "review_policy.set"
+	AuditReviewPolicyDelete = "review_policy.delete"
+	AuditResourceAutoHide   = "resource.auto_hide"
+	AuditReportResolve      = "report.resolve"
+	AuditCommentDelete      = "comment.delete"
+	AuditTaxonomyCreate     = "taxonomy.create"
+	AuditTaxonomyUpdate     = "taxonomy.update"
+	AuditTaxonomyDelete     = "taxonomy.delete"
+	AuditTaxonomyBackfill   = "taxonomy.backfill"
+	AuditTagRename          = "tag.rename"
+	AuditTagMerge           = "tag.merge"
+	AuditRoleAssign         = "role.assign"
+	AuditRoleRevoke         = "role.revoke"
+	AuditUserRoleChange     = "user.role_change"
+	AuditUserSuspend        = "user.suspend"
+	AuditUserUnsuspend      = "user.unsuspend"
+	AuditUserForceLogout    = "user.force_logout"
+)
+
+// AuditEntry is one row of the append-only audit log. Hash covers PrevHash
+// and the entry's own fields, chaining every row to its predecessor so that
+// edits and deletions are detectable.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id,omitempty"` // nil for anonymous actions such as failed logins
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditFilter narrows audit log queries. Zero values match everything.
+type AuditFilter struct {
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	AfterID    int64 // only entries with a larger ID
+	BeforeID   int64 // only entries with a smaller ID
+	Ascending  bool  // oldest first; newest first by default
+	Limit      int
 }
 
 // Notification represents a system message
@@ -62,33 +465,365 @@ type Notification struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// SMSDelivery records one attempt to send a verification code through an
+// SMS provider, kept for troubleshooting codes that never arrive
+type SMSDelivery struct {
+	ID         int64     `json:"id"`
+	Phone      string    `json:"phone"`
+	Purpose    string    `json:"purpose"`
+	Provider   string    `json:"provider"`
+	Status     string    `json:"status"`               // "sent" or "failed"
+	MessageID  string    `json:"message_id,omitempty"` // the provider's ID for the message
+	RequestID  string    `json:"request_id,omitempty"` // the provider's ID for the API call
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SMSDeliveryFilter narrows delivery queries. Zero values match everything.
+type SMSDeliveryFilter struct {
+	Phone    string
+	Provider string
+	Status   string
+	BeforeID int64 // only deliveries with a smaller ID
+	Limit    int
+}
+
+// UserIdentity links a user to an account at an external identity provider (SSO)
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"` // "sub" claim at the provider
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Scopes grantable to personal API tokens
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeResourcesRead  = "resources:read"
+	ScopeResourcesWrite = "resources:write"
+	ScopeAdminReview    = "admin:review"
+)
+
+// APITokenScopes lists every scope a personal API token may carry
+var APITokenScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeResourcesRead, ScopeResourcesWrite, ScopeAdminReview}
+
+// APIToken is a personal access token for scripts and integrations.
+// Only the SHA-256 hash of the secret is stored.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the token, for display
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	MFA        bool       `json:"-"` // created from a session that passed two-factor auth
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TwoFactor holds a user's TOTP enrollment
+type TwoFactor struct {
+	UserID       int64     `json:"user_id"`
+	Secret       string    `json:"-"`
+	Enabled      bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"` // last accepted TOTP step, prevents replay
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // UserRepository defines methods for user persistence
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetByPhoneNumber(ctx context.Context, phone string) (*User, error)
+	// GetByID may leave Password empty when served from a cache; password
+	// checks look the user up by email or phone number
 	GetByID(ctx context.Context, id int64) (*User, error)
 	UpdateProfile(ctx context.Context, user *User) error
+	// UpdateEmail and UpdatePhoneNumber return ErrEmailTaken/ErrPhoneTaken
+	// when another user already holds the value
+	UpdateEmail(ctx context.Context, id int64, email string) error
+	UpdatePhoneNumber(ctx context.Context, id int64, phone string) error
+	// List returns one page of users matching the filter and the total match count
+	List(ctx context.Context, filter UserFilter) ([]User, int, error)
+	UpdateRole(ctx context.Context, id int64, role UserRole) error
+	// Suspend marks the user suspended until the given time, or indefinitely when until is nil
+	Suspend(ctx context.Context, id int64, reason string, until *time.Time) error
+	Unsuspend(ctx context.Context, id int64) error
+	// RevokeTokens rejects all session tokens issued so far by bumping
+	// TokenVersion
+	RevokeTokens(ctx context.Context, id int64) error
+}
+
+// RoleRepository defines methods for role assignments
+type RoleRepository interface {
+	// Assign stores the assignment; assigning an existing (user, role, subject) is a no-op
+	Assign(ctx context.Context, a *RoleAssignment) error
+	// Revoke removes the assignment, reporting whether it existed
+	Revoke(ctx context.Context, userID int64, role UserRole, subject string) (bool, error)
+	ListByUser(ctx context.Context, userID int64) ([]RoleAssignment, error)
 }
 
-// VerificationCodeRepository defines methods for OTP
+// AuditRepository stores the audit log. It has no update or delete methods.
+type AuditRepository interface {
+	// Append inserts the entry. It fails if another entry already has the
+	// same PrevHash, i.e. a concurrent writer extended the chain first.
+	Append(ctx context.Context, e *AuditEntry) error
+	// Last returns the most recent entry, or nil when the log is empty
+	Last(ctx context.Context) (*AuditEntry, error)
+	List(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+}
+
+// VerificationCodeRepository defines methods for OTP.
+// The phone argument is the delivery target: a phone number or, for email
+// verification, an email address.
 type VerificationCodeRepository interface {
 	Save(ctx context.Context, phone, code, purpose string, duration time.Duration) error
 	Get(ctx context.Context, phone, purpose string) (string, error)
 	Delete(ctx context.Context, phone, purpose string) error
+	// Consume deletes the unexpired code when it matches, reporting whether
+	// it did. Of concurrent callers presenting the same code one succeeds.
+	Consume(ctx context.Context, phone, code, purpose string) (bool, error)
+}
+
+// UserIdentityRepository defines methods for external identity links
+type UserIdentityRepository interface {
+	Create(ctx context.Context, identity *UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListByUser(ctx context.Context, userID int64) ([]UserIdentity, error)
+}
+
+// APITokenRepository defines methods for personal API tokens
+type APITokenRepository interface {
+	Create(ctx context.Context, token *APIToken) error
+	GetByHash(ctx context.Context, hash string) (*APIToken, error)
+	ListByUser(ctx context.Context, userID int64) ([]APIToken, error)
+	// Revoke marks the user's token revoked, reporting whether it existed
+	Revoke(ctx context.Context, userID, id int64) (bool, error)
+	// RevokeAll marks every live token of the user revoked, returning how many
+	RevokeAll(ctx context.Context, userID int64) (int64, error)
+	TouchLastUsed(ctx context.Context, id int64, at time.Time, ip string) error
+}
+
+// TwoFactorRepository defines methods for TOTP enrollments and recovery codes
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID int64) (*TwoFactor, error)
+	// Save inserts or replaces the enrollment for tf.UserID
+	Save(ctx context.Context, tf *TwoFactor) error
+	// Delete removes the enrollment and all recovery codes
+	Delete(ctx context.Context, userID int64) error
+	// ReplaceRecoveryCodes discards existing codes and stores the given hashes
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error
+	// UseRecoveryCode marks an unused code as used, reporting whether one matched
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error)
 }
 
 // ResourceRepository defines methods for resource persistence
 type ResourceRepository interface {
 	Create(ctx context.Context, resource *Resource) error
-	List(ctx context.Context, status ResourceStatus, search string) ([]Resource, error)
+	List(ctx context.Context, filter ResourceFilter) ([]Resource, error)
 	GetByID(ctx context.Context, id int64) (*Resource, error)
+	// GetByIDForUpdate is GetByID for write paths: it reads the primary,
+	// never a replica or cache, and locks the row until the transaction in
+	// ctx ends where the database supports it
+	GetByIDForUpdate(ctx context.Context, id int64) (*Resource, error)
 	UpdateStatus(ctx context.Context, id int64, status ResourceStatus) error
+	// Resubmit stores the edited metadata and file of res, sets it PENDING
+	// and stores its ReviewRound
+	Resubmit(ctx context.Context, res *Resource) error
+	// Reopen sets the resource PENDING in a new review round
+	Reopen(ctx context.Context, id int64) error
 	GetByHash(ctx context.Context, hash string) ([]Resource, error)
+	// ListByIDs returns the resources that exist among ids, in no particular order
+	ListByIDs(ctx context.Context, ids []int64) ([]Resource, error)
+}
+
+// ReviewRepository defines methods for review records and per-subject policies
+type ReviewRepository interface {
+	Create(ctx context.Context, review *ResourceReview) error
+	// ListByResource returns all reviews of the resource, oldest first
+	ListByResource(ctx context.Context, resourceID int64) ([]ResourceReview, error)
+	// GetPolicy returns the policy for the subject, or nil when there is none
+	GetPolicy(ctx context.Context, subject string) (*ReviewPolicy, error)
+	ListPolicies(ctx context.Context) ([]ReviewPolicy, error)
+	// SavePolicy inserts or replaces the policy for p.Subject
+	SavePolicy(ctx context.Context, p *ReviewPolicy) error
+	// DeletePolicy removes the policy, reporting whether it existed
+	DeletePolicy(ctx context.Context, subject string) (bool, error)
+}
+
+// ReportRepository defines methods for resource reports
+type ReportRepository interface {
+	// Create returns ErrDuplicateReport when the reporter already reported the resource
+	Create(ctx context.Context, report *ResourceReport) error
+	CountOpen(ctx context.Context, resourceID int64) (int, error)
+	// OpenGroups returns resources with open reports, most reported first
+	OpenGroups(ctx context.Context, limit, offset int) ([]ReportGroup, error)
+	ListByResource(ctx context.Context, resourceID int64) ([]ResourceReport, error)
+	// Resolve closes every open report on the resource and returns them
+	Resolve(ctx context.Context, resourceID int64, status ReportStatus, resolvedBy int64) ([]ResourceReport, error)
+}
+
+// ReactionRepository stores ratings and likes. Every write recomputes the
+// aggregates on the resource row.
+type ReactionRepository interface {
+	// SetRating inserts or replaces the user's rating of the resource
+	SetRating(ctx context.Context, resourceID, userID int64, stars int) error
+	// DeleteRating removes the user's rating, reporting whether it existed
+	DeleteRating(ctx context.Context, resourceID, userID int64) (bool, error)
+	// GetRating returns the user's rating, or 0 when there is none
+	GetRating(ctx context.Context, resourceID, userID int64) (int, error)
+	// Like is idempotent
+	Like(ctx context.Context, resourceID, userID int64) error
+	Unlike(ctx context.Context, resourceID, userID int64) error
+	HasLiked(ctx context.Context, resourceID, userID int64) (bool, error)
+}
+
+// CommentRepository stores resource comments. Deleting is a soft delete and
+// the resource comment count covers comments that are not deleted.
+type CommentRepository interface {
+	Create(ctx context.Context, c *Comment) error
+	GetByID(ctx context.Context, id int64) (*Comment, error)
+	// UpdateContent sets the content and EditedAt
+	UpdateContent(ctx context.Context, c *Comment) error
+	Delete(ctx context.Context, id int64, deletedBy int64) error
+	// ListByResource returns all comments of the resource, oldest first
+	ListByResource(ctx context.Context, resourceID int64) ([]Comment, error)
+}
+
+// CollectionRepository stores collections and their items. Item writes
+// recompute the favorite count of the resource.
+type CollectionRepository interface {
+	Create(ctx context.Context, c *Collection) error
+	// GetByID and GetByShareToken return nil when there is no such collection
+	GetByID(ctx context.Context, id int64) (*Collection, error)
+	GetByShareToken(ctx context.Context, token string) (*Collection, error)
+	// ListByOwner returns the owner's collections, most recently updated
+	// first; publicOnly skips private ones
+	ListByOwner(ctx context.Context, ownerID int64, publicOnly bool) ([]Collection, error)
+	// Update stores name, description, visibility and share token
+	Update(ctx context.Context, c *Collection) error
+	// Delete removes the collection and its items
+	Delete(ctx context.Context, id int64) error
+	// AddItem appends the resource, reporting false when it was already there
+	AddItem(ctx context.Context, collectionID, resourceID int64) (bool, error)
+	// RemoveItem reports whether the resource was in the collection
+	RemoveItem(ctx context.Context, collectionID, resourceID int64) (bool, error)
+	// Items returns the items in position order without Resource set
+	Items(ctx context.Context, collectionID int64) ([]CollectionItem, error)
+	// Reorder sets positions following resourceIDs, which must list every item
+	Reorder(ctx context.Context, collectionID int64, resourceIDs []int64) error
+}
+
+// TaxonomyRepository stores subjects, resource types and their aliases.
+// Aliases are unique within a scope.
+type TaxonomyRepository interface {
+	// ListSubjects returns every subject with its aliases, ordered by ID
+	ListSubjects(ctx context.Context) ([]Subject, error)
+	// GetSubject returns nil when there is no such subject
+	GetSubject(ctx context.Context, id int64) (*Subject, error)
+	CreateSubject(ctx context.Context, s *Subject) error
+	UpdateSubject(ctx context.Context, s *Subject) error
+	DeleteSubject(ctx context.Context, id int64) error
+	// SubjectUsage counts child subjects and resources referring to the subject
+	SubjectUsage(ctx context.Context, id int64) (children, resources int, err error)
+
+	ListTypes(ctx context.Context) ([]ResourceType, error)
+	GetType(ctx context.Context, id int64) (*ResourceType, error)
+	CreateType(ctx context.Context, t *ResourceType) error
+	UpdateType(ctx context.Context, t *ResourceType) error
+	DeleteType(ctx context.Context, id int64) error
+	TypeUsage(ctx context.Context, id int64) (resources int, err error)
+
+	// FindAlias returns the ID the alias points to, or 0
+	FindAlias(ctx context.Context, scope TaxonomyScope, alias string) (int64, error)
+	// SetAliases replaces the aliases of the target
+	SetAliases(ctx context.Context, scope TaxonomyScope, targetID int64, aliases []string) error
+
+	// UnmappedValues lists the distinct free-text values on resources that
+	// have no taxonomy ID yet
+	UnmappedValues(ctx context.Context, scope TaxonomyScope) ([]string, error)
+	// MapValue points resources carrying the free-text value at the term and
+	// replaces the text with its slug, returning the number of resources
+	MapValue(ctx context.Context, scope TaxonomyScope, value string, id int64, slug string) (int64, error)
+	// SubjectReferences lists the distinct subjects named by role
+	// assignments and review policies
+	SubjectReferences(ctx context.Context) ([]string, error)
+	// MapSubjectReferences renames the subject on role assignments and review
+	// policies to the slug. Assignments already held under the slug are
+	// dropped and a policy already set on it keeps the larger approval count.
+	// It returns the number of assignments and policies changed.
+	MapSubjectReferences(ctx context.Context, value, slug string) (roles, policies int64, err error)
+}
+
+// TagRepository stores tags and their links to resources. Tag counts are
+// recomputed whenever links change.
+type TagRepository interface {
+	// SetResourceTags replaces the resource's tags, creating missing tags
+	SetResourceTags(ctx context.Context, resourceID int64, names []string) error
+	// ForResources returns the tag names of each resource, sorted by name
+	ForResources(ctx context.Context, resourceIDs []int64) (map[int64][]string, error)
+	// Search returns tags in use whose name starts with prefix, most used first
+	Search(ctx context.Context, prefix string, limit int) ([]Tag, error)
+	// GetByID and GetByName return nil when there is no such tag
+	GetByID(ctx context.Context, id int64) (*Tag, error)
+	GetByName(ctx context.Context, name string) (*Tag, error)
+	// Rename returns ErrTagNameTaken when another tag already has the name
+	Rename(ctx context.Context, id int64, name string) error
+	// Merge moves every resource from one tag to another and deletes the first
+	Merge(ctx context.Context, fromID, intoID int64) error
+}
+
+// AnalyticsRepository stores per-day download and view counts
+type AnalyticsRepository interface {
+	// AddDaily adds the counts to the daily rows and to the resource totals
+	AddDaily(ctx context.Context, stats []ResourceDailyStat) error
+	// Daily returns the resource's rows from the given day on, oldest first
+	Daily(ctx context.Context, resourceID int64, fromDay string) ([]ResourceDailyStat, error)
+	// TopDownloads ranks approved resources by downloads since the given day
+	TopDownloads(ctx context.Context, fromDay string, limit int) ([]ResourceCount, error)
 }
 
 // NotificationRepository defines methods for notifications
 type NotificationRepository interface {
 	Create(ctx context.Context, notif *Notification) error
+	// List returns the user's notifications and system-wide ones, newest
+	// first; a nil userID lists only system-wide notifications
 	List(ctx context.Context, userID *int64) ([]Notification, error)
 }
+
+// SMSDeliveryRepository stores SMS delivery records
+type SMSDeliveryRepository interface {
+	Create(ctx context.Context, d *SMSDelivery) error
+	// List returns matching deliveries, newest first
+	List(ctx context.Context, filter SMSDeliveryFilter) ([]SMSDelivery, error)
+}
+
+// TxManager runs several repository calls in one database transaction.
+// Repositories used with the context passed to fn take part in it; fn's
+// error rolls it back, nil commits it, and a nested WithinTx joins the
+// outer transaction.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type sessionKey struct{}
+
+// WithSession marks ctx as acting for the signed-in user. Stores that read
+// from replicas use it to serve a user's reads from the primary right after
+// the user's own writes.
+func WithSession(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, sessionKey{}, userID)
+}
+
+// SessionFrom returns the user set by WithSession, or 0 if there is none
+func SessionFrom(ctx context.Context) int64 {
+	id, _ := ctx.Value(sessionKey{}).(int64)
+	return id
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type AnalyticsHandler struct {
+	svc *service.AnalyticsService
+}
+
+func NewAnalyticsHandler(svc *service.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{svc: svc}
+}
+
+// Daily returns the per-day download and view series. Query param: days
+// (default 30, max 365)
+func (h *AnalyticsHandler) Daily(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	days := 0
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "bad days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	series, err := h.svc.Daily(r.Context(), GetUserFromContext(r.Context()), id, days)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(series)
+}
+
+// TopDownloads lists the most downloaded resources of the last seven days.
+// Query param: limit (default 10, max 50)
+func (h *AnalyticsHandler) TopDownloads(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := h.svc.TopDownloads(r.Context(), limit)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	if list == nil {
+		list = []service.TopResource{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// writeAnalyticsError maps analytics errors to HTTP status codes
+func writeAnalyticsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrResourceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrInvalidStatsRange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("analytics request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
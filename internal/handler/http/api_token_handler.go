@@ -0,0 +1,100 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type APITokenHandler struct {
+	svc *service.APITokenService
+}
+
+func NewAPITokenHandler(svc *service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{svc: svc}
+}
+
+// Create issues a personal API token. The secret is only returned here.
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	mfa, _ := r.Context().Value(ctxKeyMFA).(bool)
+	t, secret, err := h.svc.Create(r.Context(), u, req.Name, req.Scopes, req.ExpiresAt, mfa)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyAPITokens) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*domain.APIToken
+		Token string `json:"token"`
+	}{t, secret})
+}
+
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	list, err := h.svc.List(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list api tokens failed: user=%d err=%v", u.ID, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []domain.APIToken{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.Revoke(r.Context(), u.ID, id); err != nil {
+		if errors.Is(err, service.ErrAPITokenNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("revoke api token failed: user=%d id=%d err=%v", u.ID, id, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,227 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type CollectionHandler struct {
+	svc *service.CollectionService
+}
+
+func NewCollectionHandler(svc *service.CollectionService) *CollectionHandler {
+	return &CollectionHandler{svc: svc}
+}
+
+func (h *CollectionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string                      `json:"name"`
+		Description string                      `json:"description"`
+		Visibility  domain.CollectionVisibility `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	c, err := h.svc.Create(r.Context(), GetUserFromContext(r.Context()), req.Name, req.Description, req.Visibility)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// Mine lists the signed-in user's collections
+func (h *CollectionHandler) Mine(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.Mine(r.Context(), GetUserFromContext(r.Context()))
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.Collection{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// ByUser lists another user's public collections
+func (h *CollectionHandler) ByUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	list, err := h.svc.PublicByUser(r.Context(), id)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.Collection{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *CollectionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	v, err := h.svc.Get(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// Shared opens a collection through its share link
+func (h *CollectionHandler) Shared(w http.ResponseWriter, r *http.Request) {
+	v, err := h.svc.Shared(r.Context(), GetUserFromContext(r.Context()), mux.Vars(r)["token"])
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *CollectionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Name        *string                      `json:"name"`
+		Description *string                      `json:"description"`
+		Visibility  *domain.CollectionVisibility `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	c, err := h.svc.Update(r.Context(), GetUserFromContext(r.Context()), id, service.CollectionEdit{
+		Name:        req.Name,
+		Description: req.Description,
+		Visibility:  req.Visibility,
+	})
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *CollectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.Delete(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CollectionHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	resourceID, ok := pathID(w, r, "resourceId")
+	if !ok {
+		return
+	}
+	c, err := h.svc.AddItem(r.Context(), GetUserFromContext(r.Context()), id, resourceID)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *CollectionHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	resourceID, ok := pathID(w, r, "resourceId")
+	if !ok {
+		return
+	}
+	if err := h.svc.RemoveItem(r.Context(), GetUserFromContext(r.Context()), id, resourceID); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reorder takes {"resource_ids": [...]} listing every item in the new order
+func (h *CollectionHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		ResourceIDs []int64 `json:"resource_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.Reorder(r.Context(), GetUserFromContext(r.Context()), id, req.ResourceIDs); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Share creates or rotates the share link token
+func (h *CollectionHandler) Share(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	c, err := h.svc.Share(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"share_token": c.ShareToken,
+		"path":        "/api/public/collections/shared/" + c.ShareToken,
+	})
+}
+
+func (h *CollectionHandler) Unshare(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.Unshare(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCollectionError maps collection errors to HTTP status codes
+func writeCollectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrCollectionNotFound), errors.Is(err, service.ErrResourceNotFound), errors.Is(err, service.ErrCollectionItemAbsent):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrNotCollectable), errors.Is(err, service.ErrTooManyCollections), errors.Is(err, service.ErrCollectionFull):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidCollection):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("collection request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type EngagementHandler struct {
+	svc *service.EngagementService
+}
+
+func NewEngagementHandler(svc *service.EngagementService) *EngagementHandler {
+	return &EngagementHandler{svc: svc}
+}
+
+// Summary returns rating, like and comment counts; signed-in viewers also
+// get their own rating and like
+func (h *EngagementHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.Summary(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EngagementHandler) Rate(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Stars int `json:"stars"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	e, err := h.svc.Rate(r.Context(), GetUserFromContext(r.Context()), id, req.Stars)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EngagementHandler) Unrate(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.Unrate(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EngagementHandler) Like(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.Like(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EngagementHandler) Unlike(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	e, err := h.svc.Unlike(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+// Comments returns the comment threads of a resource
+func (h *EngagementHandler) Comments(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	list, err := h.svc.Comments(r.Context(), id)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	if list == nil {
+		list = []*domain.Comment{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *EngagementHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		ParentID *int64 `json:"parent_id"`
+		Content  string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	c, err := h.svc.Comment(r.Context(), GetUserFromContext(r.Context()), id, req.ParentID, req.Content)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *EngagementHandler) EditComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	c, err := h.svc.EditComment(r.Context(), GetUserFromContext(r.Context()), id, req.Content)
+	if err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *EngagementHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteComment(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeEngagementError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathID parses a numeric path variable, answering 400 when it is malformed
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeEngagementError maps rating, like and comment errors to HTTP status codes
+func writeEngagementError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrResourceNotFound), errors.Is(err, service.ErrCommentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrSelfRating):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrNotEngageable), errors.Is(err, service.ErrCommentDeleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidRating), errors.Is(err, service.ErrInvalidComment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("engagement request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -2,11 +2,15 @@ package http
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,9 +20,22 @@ import (
 
 type contextKey string
 
-const ctxKeyUser contextKey = "user"
+const (
+	ctxKeyUser contextKey = "user"
+	// ctxKeyMFA marks requests whose token was issued after a second factor
+	ctxKeyMFA contextKey = "mfa"
+	// ctxKeyTokenUser holds the owner of a personal API token. It is only
+	// promoted to ctxKeyUser by RequireScope, so routes that do not declare
+	// a scope treat API token requests as unauthenticated.
+	ctxKeyTokenUser   contextKey = "token_user"
+	ctxKeyTokenScopes contextKey = "token_scopes"
+	ctxKeyTokenID     contextKey = "token_id"
+	// ctxKeyClientIP holds the address resolved by ClientIPMiddleware
+	ctxKeyClientIP contextKey = "client_ip"
+)
 
-func AuthMiddleware(authSvc *service.AuthService, jwtSecret string) func(http.Handler) http.Handler {
+// AuthMiddleware accepts JWT access tokens and personal API tokens
+func AuthMiddleware(authSvc *service.AuthService, tokenSvc *service.APITokenService, jwtSecret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := r.Header.Get("Authorization")
@@ -33,6 +50,20 @@ func AuthMiddleware(authSvc *service.AuthService, jwtSecret string) func(http.Ha
 				return
 			}
 
+			if service.IsAPIToken(tokenStr) {
+				u, t, err := tokenSvc.Authenticate(r.Context(), tokenStr, clientIP(r))
+				if err != nil {
+					http.Error(w, "invalid token", http.StatusUnauthorized)
+					return
+				}
+				if u.Suspended(time.Now()) {
+					http.Error(w, "account suspended", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withAPIToken(r.Context(), u, t)))
+				return
+			}
+
 			tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 				if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
 					return nil, jwt.ErrTokenUnverifiable
@@ -49,6 +80,11 @@ func AuthMiddleware(authSvc *service.AuthService, jwtSecret string) func(http.Ha
 				http.Error(w, "invalid token claims", http.StatusUnauthorized)
 				return
 			}
+			// Intermediate tokens (e.g. pending 2FA) are not access tokens
+			if typ, _ := claims["typ"].(string); typ != "" {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
 
 			sub := claims["sub"]
 			var uid int64
@@ -64,14 +100,25 @@ func AuthMiddleware(authSvc *service.AuthService, jwtSecret string) func(http.Ha
 				http.Error(w, "user not found", http.StatusUnauthorized)
 				return
 			}
+			if sessionRevoked(u, claims) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			if u.Suspended(time.Now()) {
+				http.Error(w, "account suspended", http.StatusForbidden)
+				return
+			}
 
+			mfa, _ := claims["mfa"].(bool)
 			ctx := context.WithValue(r.Context(), ctxKeyUser, u)
+			ctx = context.WithValue(ctx, ctxKeyMFA, mfa)
+			ctx = domain.WithSession(ctx, u.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func OptionalAuthMiddleware(authSvc *service.AuthService, jwtSecret string) func(http.Handler) http.Handler {
+func OptionalAuthMiddleware(authSvc *service.AuthService, tokenSvc *service.APITokenService, jwtSecret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := r.Header.Get("Authorization")
@@ -87,6 +134,16 @@ func OptionalAuthMiddleware(authSvc *service.AuthService, jwtSecret string) func
 				return
 			}
 
+			if service.IsAPIToken(tokenStr) {
+				u, t, err := tokenSvc.Authenticate(r.Context(), tokenStr, clientIP(r))
+				if err != nil || u.Suspended(time.Now()) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withAPIToken(r.Context(), u, t)))
+				return
+			}
+
 			tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 				if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
 					return nil, jwt.ErrTokenUnverifiable
@@ -105,6 +162,10 @@ func OptionalAuthMiddleware(authSvc *service.AuthService, jwtSecret string) func
 				next.ServeHTTP(w, r)
 				return
 			}
+			if typ, _ := claims["typ"].(string); typ != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
 
 			sub := claims["sub"]
 			var userID int64
@@ -116,12 +177,15 @@ func OptionalAuthMiddleware(authSvc *service.AuthService, jwtSecret string) func
 			}
 
 			u, err := authSvc.GetUserByID(r.Context(), userID)
-			if err != nil || u == nil {
+			if err != nil || u == nil || sessionRevoked(u, claims) || u.Suspended(time.Now()) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			mfa, _ := claims["mfa"].(bool)
 			ctx := context.WithValue(r.Context(), ctxKeyUser, u)
+			ctx = context.WithValue(ctx, ctxKeyMFA, mfa)
+			ctx = domain.WithSession(ctx, u.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -132,21 +196,257 @@ func GetUserFromContext(ctx context.Context) *domain.User {
 	return u
 }
 
-func AdminMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// sessionRevoked reports whether the token predates a forced logout, i.e.
+// was signed with an earlier token version. Tokens without sv are from
+// before versioning and count as version 0.
+func sessionRevoked(u *domain.User, claims jwt.MapClaims) bool {
+	sv, _ := claims["sv"].(float64)
+	return int64(sv) != u.TokenVersion
+}
+
+func withAPIToken(ctx context.Context, u *domain.User, t *domain.APIToken) context.Context {
+	ctx = context.WithValue(ctx, ctxKeyTokenUser, u)
+	ctx = context.WithValue(ctx, ctxKeyTokenScopes, t.Scopes)
+	ctx = context.WithValue(ctx, ctxKeyTokenID, t.ID)
+	ctx = domain.WithSession(ctx, u.ID)
+	return context.WithValue(ctx, ctxKeyMFA, t.MFA)
+}
+
+// authenticatedUser returns the caller whether it signed in with a session
+// token or a personal API token.
+func authenticatedUser(ctx context.Context) *domain.User {
+	if u := GetUserFromContext(ctx); u != nil {
+		return u
+	}
+	u, _ := ctx.Value(ctxKeyTokenUser).(*domain.User)
+	return u
+}
+
+// RequireScope opens a route to personal API tokens carrying scope. Session
+// tokens pass through unchanged; API tokens without the scope get 403.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := r.Context().Value(ctxKeyTokenUser).(*domain.User)
+		if !ok || GetUserFromContext(r.Context()) != nil {
+			next(w, r)
+			return
+		}
+		scopes, _ := r.Context().Value(ctxKeyTokenScopes).([]string)
+		for _, sc := range scopes {
+			if sc == scope {
+				next(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, u)))
+				return
+			}
+		}
+		http.Error(w, "insufficient scope", http.StatusForbidden)
+	}
+}
+
+// TwoFactorMiddleware rejects callers holding any of perms, from their
+// built-in role or a role assignment, whose token was not obtained with a
+// second factor. Mount it after AuthMiddleware on admin routes, passing the
+// permissions those routes require.
+func TwoFactorMiddleware(authz *service.AuthzService, perms ...domain.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u := authenticatedUser(r.Context())
+			if u == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if mfa, _ := r.Context().Value(ctxKeyMFA).(bool); mfa {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, perm := range perms {
+				ok, err := authz.CanAny(r.Context(), u, perm)
+				if err != nil {
+					log.Printf("permission check failed: user=%d perm=%s err=%v", u.ID, perm, err)
+					http.Error(w, "server error", http.StatusInternalServerError)
+					return
+				}
+				if ok {
+					http.Error(w, "two-factor authentication required", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SubjectFunc resolves the subject a request acts on, e.g. the subject of
+// the resource being reviewed.
+type SubjectFunc func(r *http.Request) (string, error)
+
+// RequirePermission admits callers holding perm. With a SubjectFunc the
+// permission must be global or cover the resolved subject; without one a
+// grant for any subject suffices. Wrap it in RequireScope when API tokens
+// may call the route.
+func RequirePermission(authz *service.AuthzService, perm domain.Permission, subjectOf SubjectFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		u := GetUserFromContext(r.Context())
 		if u == nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if u.Role != domain.RoleAdmin {
+
+		var ok bool
+		var err error
+		if subjectOf == nil {
+			ok, err = authz.CanAny(r.Context(), u, perm)
+		} else {
+			var subject string
+			if subject, err = subjectOf(r); err == nil {
+				ok, err = authz.Can(r.Context(), u, perm, subject)
+			}
+		}
+		if err != nil {
+			log.Printf("permission check failed: user=%d perm=%s err=%v", u.ID, perm, err)
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next(w, r)
+	}
+}
+
+// clientIP returns the address resolved by ClientIPMiddleware, or the
+// remote address of the request without the port.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxKeyClientIP).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIPMiddleware takes the client address of requests relayed by
+// trusted proxies from X-Forwarded-For. Mount it first so that logging,
+// auditing and rate limiting see the same address. Without trusted
+// proxies the header is ignored, since any client can send it.
+func ClientIPMiddleware(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := forwardedClient(remoteIP(r), r.Header.Values("X-Forwarded-For"), trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyClientIP, ip)))
+		})
+	}
+}
+
+// forwardedClient walks X-Forwarded-For from the nearest hop back while
+// the hops are trusted proxies, and returns the first address that is not
+// one. Entries further left were written by the client and are not
+// believed.
+func forwardedClient(remote string, header []string, trusted []*net.IPNet) string {
+	if !trustedProxy(remote, trusted) {
+		return remote
+	}
+	var hops []string
+	for _, h := range header {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if host, _, err := net.SplitHostPort(hop); err == nil {
+			hop = host
+		}
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			// A proxy we trust passed on garbage; stop at that proxy
+			break
+		}
+		client = ip.String()
+		if !trustedProxy(client, trusted) {
+			break
+		}
+	}
+	return client
+}
+
+func trustedProxy(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies reads a comma separated list of proxy addresses and
+// CIDR ranges, such as "10.0.0.0/8,127.0.0.1"
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", item)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q", item)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// RequestIDMiddleware tags each request with an ID, reusing a well-formed
+// X-Request-ID from the client or proxy, and makes it and the client IP
+// available to the audit log.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			b := make([]byte, 12)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := service.WithRequestInfo(r.Context(), service.RequestInfo{IP: clientIP(r), RequestID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
 // LoggingMiddleware records basic request info and response status.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -156,7 +456,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(rw, r)
 
 		duration := time.Since(start)
-		log.Printf("http request method=%s path=%s status=%d duration=%s", r.Method, r.URL.Path, rw.status, duration)
+		log.Printf("http request method=%s path=%s status=%d duration=%s request_id=%s", r.Method, r.URL.Path, rw.status, duration, service.RequestInfoFrom(r.Context()).RequestID)
 	})
 }
 
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+// staticRoles is a RoleRepository over a fixed list of assignments
+type staticRoles []domain.RoleAssignment
+
+func (s staticRoles) Assign(ctx context.Context, a *domain.RoleAssignment) error { return nil }
+
+func (s staticRoles) Revoke(ctx context.Context, userID int64, role domain.UserRole, subject string) (bool, error) {
+	return false, nil
+}
+
+func (s staticRoles) ListByUser(ctx context.Context, userID int64) ([]domain.RoleAssignment, error) {
+	var out []domain.RoleAssignment
+	for _, a := range s {
+		if a.UserID == userID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func TestTwoFactorMiddleware(t *testing.T) {
+	authz := service.NewAuthzService(staticRoles{
+		{UserID: 2, Role: domain.RoleAdmin},
+		{UserID: 3, Role: domain.RoleTA, Subject: "math"},
+	}, nil, nil, nil)
+	mw := TwoFactorMiddleware(authz, domain.PermResourceReview, domain.PermUserBan)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name string
+		user *domain.User
+		mfa  bool
+		want int
+	}{
+		{"built-in admin", &domain.User{ID: 1, Role: domain.RoleAdmin}, false, http.StatusForbidden},
+		{"built-in admin with 2FA", &domain.User{ID: 1, Role: domain.RoleAdmin}, true, http.StatusOK},
+		{"admin by assignment", &domain.User{ID: 2, Role: domain.RoleUser}, false, http.StatusForbidden},
+		{"subject TA", &domain.User{ID: 3, Role: domain.RoleUser}, false, http.StatusForbidden},
+		{"subject TA with 2FA", &domain.User{ID: 3, Role: domain.RoleUser}, true, http.StatusOK},
+		{"no admin permission", &domain.User{ID: 4, Role: domain.RoleUser}, false, http.StatusOK},
+	}
+	for _, tc := range tests {
+		ctx := context.WithValue(context.Background(), ctxKeyUser, tc.user)
+		ctx = context.WithValue(ctx, ctxKeyMFA, tc.mfa)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/reports", nil).WithContext(ctx))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestSessionRevoked(t *testing.T) {
+	u := &domain.User{ID: 1}
+	legacy := jwt.MapClaims{"sub": float64(1), "iat": float64(time.Now().Unix())}
+	if sessionRevoked(u, legacy) {
+		t.Error("token without sv rejected before any logout")
+	}
+
+	// A forced logout and a new login within the same second
+	u.TokenVersion = 1
+	if !sessionRevoked(u, legacy) || !sessionRevoked(u, jwt.MapClaims{"sv": float64(0), "iat": float64(time.Now().Unix())}) {
+		t.Error("token from before the logout accepted")
+	}
+	if sessionRevoked(u, jwt.MapClaims{"sv": float64(1), "iat": float64(time.Now().Unix())}) {
+		t.Error("token issued after the logout rejected")
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "chirp.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := sqlite.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	users := sqlite.NewUserRepository(db)
+	audit := service.NewAuditService(sqlite.NewAuditRepository(db))
+	authz := service.NewAuthzService(sqlite.NewRoleRepository(db), users, nil, audit)
+	tokens := service.NewAPITokenService(sqlite.NewAPITokenRepository(db), users, authz, audit)
+
+	dev := &domain.User{Name: "dev", Email: "dev@example.com"}
+	if err := users.Create(ctx, dev); err != nil {
+		t.Fatal(err)
+	}
+	issue := func(name string, scopes ...string) (*domain.APIToken, string) {
+		expiresAt := time.Now().Add(time.Hour)
+		tok, secret, err := tokens.Create(ctx, dev, name, scopes, &expiresAt, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok, secret
+	}
+	_, writer := issue("writer", domain.ScopeResourcesWrite)
+	_, reader := issue("reader", domain.ScopeResourcesRead)
+	revokedTok, revoked := issue("revoked", domain.ScopeResourcesWrite)
+	if err := tokens.Revoke(ctx, dev.ID, revokedTok.ID); err != nil {
+		t.Fatal(err)
+	}
+	expiredTok, expired := issue("expired", domain.ScopeResourcesWrite)
+	if _, err := db.Exec(`UPDATE api_tokens SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute), expiredTok.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	h := AuthMiddleware(nil, tokens, "secret")(RequireScope(domain.ScopeResourcesWrite, func(w http.ResponseWriter, r *http.Request) {
+		if GetUserFromContext(r.Context()) == nil {
+			t.Error("scoped handler reached without a user")
+		}
+	}))
+	tests := []struct {
+		name   string
+		secret string
+		want   int
+	}{
+		{"scope granted", writer, http.StatusOK},
+		{"missing scope", reader, http.StatusForbidden},
+		{"revoked token", revoked, http.StatusUnauthorized},
+		{"expired token", expired, http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/resources", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.secret)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type NotificationHandler struct {
+	svc *service.NotificationService
+}
+
+func NewNotificationHandler(svc *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{svc: svc}
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	list, err := h.svc.List(r.Context(), u.ID)
+	if err != nil {
+		log.Printf("list notifications failed: user=%d err=%v", u.ID, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []domain.Notification{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
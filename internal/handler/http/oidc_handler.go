@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+// oidcFlowCookie keeps the signed state/nonce/PKCE verifier between the
+// login redirect and the provider callback.
+const oidcFlowCookie = "chirp_oidc_flow"
+
+type OIDCHandler struct {
+	svc *service.OIDCService
+}
+
+func NewOIDCHandler(svc *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{svc: svc}
+}
+
+func (h *OIDCHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{"providers": h.svc.Providers()})
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+
+	authURL, flowToken, err := h.svc.Begin(r.Context(), provider)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProvider) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("oidc begin failed: provider=%s err=%v", provider, err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    flowToken,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the flow and returns the Chirp token
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	q := r.URL.Query()
+
+	// The flow cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Value: "", Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "sign-on denied: "+e, http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		http.Error(w, service.ErrInvalidOIDCFlow.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("code") == "" {
+		http.Error(w, "code required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.Complete(r.Context(), provider, q.Get("state"), q.Get("code"), cookie.Value)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidOIDCFlow):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrAccountSuspended):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			log.Printf("oidc callback failed: provider=%s err=%v", provider, err)
+			http.Error(w, "sign-on failed", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/limiter"
+)
+
+func TestForwardedClient(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote string
+		header []string
+		want   string
+	}{
+		{"direct client ignores the header", "203.0.113.9", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted proxy", "10.1.2.3", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entries left of the client", "10.1.2.3", []string{"1.1.1.1, 198.51.100.1, 192.0.2.1"}, "198.51.100.1"},
+		{"several headers", "192.0.2.1", []string{"1.1.1.1", "198.51.100.1:4711,10.9.9.9"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"no header", "10.1.2.3", nil, "10.1.2.3"},
+		{"garbage stops at the proxy", "10.1.2.3", []string{"198.51.100.1, unknown, 10.0.0.5"}, "10.0.0.5"},
+		{"IPv6", "2001:db8::1", []string{"[2001:db9::7]:443"}, "2001:db9::7"},
+	}
+	for _, tc := range tests {
+		if got := forwardedClient(tc.remote, tc.header, trusted); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("ParseTrustedProxies accepted an invalid range")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := limiter.NewInMemoryLimiter(limiter.Policy{Algorithm: limiter.FixedWindow, Limit: 2, Window: time.Minute})
+	defer l.Stop()
+	trusted, _ := ParseTrustedProxies("127.0.0.1")
+	h := ClientIPMiddleware(trusted)(RateLimitMiddleware("test", l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	do := func(forwarded string, ctx context.Context) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		r.RemoteAddr = "127.0.0.1:5555"
+		r.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	bg := context.Background()
+
+	w := do("198.51.100.1", bg)
+	if w.Code != http.StatusNoContent || w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != "1" || w.Header().Get("X-RateLimit-Reset") != "60" {
+		t.Fatalf("first request: %d %v", w.Code, w.Header())
+	}
+	do("198.51.100.1", bg)
+	w = do("198.51.100.1", bg)
+	var body struct {
+		Error      string `json:"error"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("third request: %d %v", w.Code, w.Header())
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Error == "" || body.RetryAfter != 60 {
+		t.Fatalf("429 body = %+v, %v", body, err)
+	}
+
+	// Other clients, users and API tokens have their own allowance
+	if w := do("198.51.100.2", bg); w.Code != http.StatusNoContent {
+		t.Errorf("another IP: %d", w.Code)
+	}
+	user := context.WithValue(bg, ctxKeyUser, &domain.User{ID: 7})
+	token := context.WithValue(bg, ctxKeyTokenID, int64(7))
+	for i := 0; i < 2; i++ {
+		if w := do("198.51.100.1", user); w.Code != http.StatusNoContent {
+			t.Errorf("signed-in user from a limited IP: %d", w.Code)
+		}
+		if w := do("198.51.100.1", token); w.Code != http.StatusNoContent {
+			t.Errorf("API token from a limited IP: %d", w.Code)
+		}
+	}
+	if w := do("198.51.100.3", user); w.Code != http.StatusTooManyRequests {
+		t.Errorf("user over the limit from a new IP: %d", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type ReportHandler struct {
+	svc *service.ReportService
+}
+
+func NewReportHandler(svc *service.ReportService) *ReportHandler {
+	return &ReportHandler{svc: svc}
+}
+
+func (h *ReportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	rp, err := h.svc.Report(r.Context(), GetUserFromContext(r.Context()), id, req.Reason, req.Detail)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rp)
+}
+
+// Queue lists reported resources for triage. Query params: page, page_size
+func (h *ReportHandler) Queue(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	list, err := h.svc.Queue(r.Context(), pageSize, (page-1)*pageSize)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.ReportGroup{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"resources": list,
+		"page":      page,
+		"reasons":   domain.ReportReasons,
+	})
+}
+
+func (h *ReportHandler) ListByResource(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	list, err := h.svc.ListByResource(r.Context(), id)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.ResourceReport{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *ReportHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Outcome string `json:"outcome"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	closed, err := h.svc.Resolve(r.Context(), GetUserFromContext(r.Context()), id, domain.ReportStatus(req.Outcome))
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(closed)
+}
+
+// writeReportError maps report errors to HTTP status codes
+func writeReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrResourceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrDuplicateReport), errors.Is(err, service.ErrNotReportable), errors.Is(err, service.ErrNoOpenReports):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidReport), errors.Is(err, service.ErrInvalidResolution):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("report request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,11 +14,12 @@ import (
 )
 
 type ResourceHandler struct {
-	svc *service.ResourceService
+	svc       *service.ResourceService
+	analytics *service.AnalyticsService
 }
 
-func NewResourceHandler(svc *service.ResourceService) *ResourceHandler {
-	return &ResourceHandler{svc: svc}
+func NewResourceHandler(svc *service.ResourceService, analytics *service.AnalyticsService) *ResourceHandler {
+	return &ResourceHandler{svc: svc, analytics: analytics}
 }
 
 func (h *ResourceHandler) Upload(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +48,12 @@ func (h *ResourceHandler) Upload(w http.ResponseWriter, r *http.Request) {
 			desc := r.FormValue("description")
 			subject := r.FormValue("subject")
 			resourceType := r.FormValue("type")
-			res, err := h.svc.Upload(r.Context(), ownerID, title, desc, subject, resourceType, f, fh)
+			tags := service.ParseTags(r.MultipartForm.Value["tags"]...)
+			res, err := h.svc.Upload(r.Context(), ownerID, title, desc, subject, resourceType, tags, f, fh)
+			if errors.Is(err, service.ErrUnknownSubject) || errors.Is(err, service.ErrUnknownType) || errors.Is(err, service.ErrInvalidTag) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				fmt.Printf("[Error] Upload failed: %v\n", err) // Add logging
 				http.Error(w, "server error: "+err.Error(), http.StatusInternalServerError) // Return error details for debugging
@@ -75,8 +82,14 @@ func (h *ResourceHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		desc := r.FormValue("description")
 		subject := r.FormValue("subject")
 		resourceType := r.FormValue("type")
+		tags := service.ParseTags(r.MultipartForm.Value["tags"]...)
 
-		res, err := h.svc.Upload(r.Context(), ownerID, title, desc, subject, resourceType, f, fh)
+		res, err := h.svc.Upload(r.Context(), ownerID, title, desc, subject, resourceType, tags, f, fh)
+		if errors.Is(err, service.ErrUnknownSubject) || errors.Is(err, service.ErrUnknownType) || errors.Is(err, service.ErrInvalidTag) {
+			// Every file shares the subject, type and tags, so none would succeed
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err == nil {
 			results = append(results, res)
 		}
@@ -86,12 +99,49 @@ func (h *ResourceHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
+// List returns approved resources only
 func (h *ResourceHandler) List(w http.ResponseWriter, r *http.Request) {
-	search := r.URL.Query().Get("q")
-	// Public list only shows APPROVED resources? Or all for MVP?
-	// Let's show all for now or filter by status if needed.
-	// Requirement: "Search".
-	list, err := h.svc.List(r.Context(), "", search)
+	filter, ok := resourceFilter(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.svc.List(r.Context(), filter)
+	writeResourceList(w, list, err)
+}
+
+// ReviewList returns resources in any status, or in ?status=, whose
+// subject the caller may review
+func (h *ResourceHandler) ReviewList(w http.ResponseWriter, r *http.Request) {
+	filter, ok := resourceFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Status = domain.ResourceStatus(r.URL.Query().Get("status"))
+	list, err := h.svc.ListForReview(r.Context(), GetUserFromContext(r.Context()), filter)
+	writeResourceList(w, list, err)
+}
+
+// resourceFilter reads the search, sort and tag parameters of a listing
+func resourceFilter(w http.ResponseWriter, r *http.Request) (domain.ResourceFilter, bool) {
+	q := r.URL.Query()
+	mode := q.Get("tag_mode")
+	if mode != "" && mode != "any" && mode != "all" {
+		http.Error(w, "tag_mode must be any or all", http.StatusBadRequest)
+		return domain.ResourceFilter{}, false
+	}
+	return domain.ResourceFilter{
+		Search:  q.Get("q"),
+		Sort:    domain.ResourceSort(q.Get("sort")),
+		Tags:    service.ParseTags(q["tags"]...),
+		AllTags: mode == "all",
+	}, true
+}
+
+func writeResourceList(w http.ResponseWriter, list []domain.Resource, err error) {
+	if errors.Is(err, service.ErrInvalidSort) || errors.Is(err, service.ErrInvalidTag) || errors.Is(err, service.ErrInvalidStatus) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -99,6 +149,27 @@ func (h *ResourceHandler) List(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(list)
 }
 
+// Get returns one resource and counts a view. Resources that are not
+// approved are not found, except by their uploader and reviewers.
+func (h *ResourceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	res, err := h.svc.Detail(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	h.analytics.Record(r.Context(), id, domain.EventView, GetUserFromContext(r.Context()))
+	json.NewEncoder(w).Encode(res)
+}
+
 func (h *ResourceHandler) Download(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
@@ -108,7 +179,7 @@ func (h *ResourceHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, reader, err := h.svc.GetFileContent(r.Context(), id)
+	res, reader, err := h.svc.GetFileContent(r.Context(), GetUserFromContext(r.Context()), id)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -118,6 +189,7 @@ func (h *ResourceHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer reader.Close()
+	h.analytics.Record(r.Context(), res.ID, domain.EventDownload, GetUserFromContext(r.Context()))
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", res.OriginalName))
 	w.Header().Set("Content-Type", "application/octet-stream")
@@ -126,35 +198,64 @@ func (h *ResourceHandler) Download(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, reader)
 }
 
-// Admin: Review
-func (h *ResourceHandler) Review(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	id, err := strconv.ParseInt(idStr, 10, 64)
+// Resubmit sends a resource with requested changes back for review.
+// Multipart form with optional title, description, subject, type, tags and
+// file; an empty tags field removes all tags.
+func (h *ResourceHandler) Resubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		http.Error(w, "bad id", http.StatusBadRequest)
 		return
 	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
 
-	var req struct {
-		Status string `json:"status"`
+	edit := service.ResourceEdit{
+		Title:       formValue(r, "title"),
+		Description: formValue(r, "description"),
+		Subject:     formValue(r, "subject"),
+		Type:        formValue(r, "type"),
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
-		return
+	if v, ok := r.MultipartForm.Value["tags"]; ok {
+		edit.Tags = append([]string{}, service.ParseTags(v...)...)
+	}
+	f, fh, err := r.FormFile("file")
+	if err == nil {
+		defer f.Close()
+	} else {
+		f, fh = nil, nil
 	}
 
-	status := domain.ResourceStatus(req.Status)
-	if status != domain.ResourceStatusApproved && status != domain.ResourceStatusRejected {
-		http.Error(w, "invalid status", http.StatusBadRequest)
+	res, err := h.svc.Resubmit(r.Context(), GetUserFromContext(r.Context()), id, edit, f, fh)
+	if err != nil {
+		writeReviewError(w, err)
 		return
 	}
+	json.NewEncoder(w).Encode(res)
+}
 
-	if err := h.svc.Review(r.Context(), id, status); err != nil {
-		http.Error(w, "server error", http.StatusInternalServerError)
-		return
+// formValue returns the multipart form field, or nil when it was not sent
+func formValue(r *http.Request, key string) *string {
+	if v, ok := r.MultipartForm.Value[key]; ok && len(v) > 0 {
+		return &v[0]
+	}
+	return nil
+}
+
+// ResourceSubject resolves the subject of the resource named in the route,
+// so permission checks can be limited to that subject.
+func (h *ResourceHandler) ResourceSubject(r *http.Request) (string, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return "", nil
+	}
+	res, err := h.svc.Get(r.Context(), id)
+	if err != nil || res == nil {
+		return "", err
 	}
-	w.WriteHeader(http.StatusOK)
+	return res.Subject, nil
 }
 
 // Admin: Check Duplicate
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type ReviewHandler struct {
+	svc *service.ReviewService
+}
+
+func NewReviewHandler(svc *service.ReviewService) *ReviewHandler {
+	return &ReviewHandler{svc: svc}
+}
+
+// Review records a reviewer decision. The legacy body {"status": "APPROVED"
+// | "REJECTED", "reason": "..."} is still accepted.
+func (h *ReviewHandler) Review(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Decision   string `json:"decision"`
+		ReasonCode string `json:"reason_code"`
+		Comment    string `json:"comment"`
+		Status     string `json:"status"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Decision == "" {
+		switch domain.ResourceStatus(req.Status) {
+		case domain.ResourceStatusApproved:
+			req.Decision = string(domain.ReviewApprove)
+		case domain.ResourceStatusRejected:
+			req.Decision = string(domain.ReviewReject)
+			if req.ReasonCode == "" {
+				req.ReasonCode = domain.ReasonOther
+			}
+		default:
+			http.Error(w, "invalid decision", http.StatusBadRequest)
+			return
+		}
+		if req.Comment == "" {
+			req.Comment = req.Reason
+		}
+	}
+
+	out, err := h.svc.Review(r.Context(), GetUserFromContext(r.Context()), id, domain.ReviewDecision(req.Decision), req.ReasonCode, req.Comment)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// History lists the reviews of a resource for its uploader or a reviewer
+func (h *ReviewHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	list, err := h.svc.History(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.ResourceReview{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// Policies lists per-subject approval policies and the accepted reason codes
+func (h *ReviewHandler) Policies(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.Policies(r.Context())
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.ReviewPolicy{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"policies":     list,
+		"reason_codes": domain.ReviewReasonCodes,
+	})
+}
+
+func (h *ReviewHandler) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RequiredApprovals int `json:"required_approvals"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	p, err := h.svc.SetPolicy(r.Context(), GetUserFromContext(r.Context()), mux.Vars(r)["subject"], req.RequiredApprovals)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *ReviewHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeletePolicy(r.Context(), GetUserFromContext(r.Context()), mux.Vars(r)["subject"]); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeReviewError maps review workflow errors to HTTP status codes
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrResourceNotFound), errors.Is(err, service.ErrPolicyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrNotResourceOwner), errors.Is(err, service.ErrSelfReview):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrReviewClosed), errors.Is(err, service.ErrAlreadyReviewed), errors.Is(err, service.ErrResubmitNotAllowed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidReview), errors.Is(err, service.ErrInvalidPolicy),
+		errors.Is(err, service.ErrUnknownSubject), errors.Is(err, service.ErrUnknownType), errors.Is(err, service.ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("review request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type RoleHandler struct {
+	authz *service.AuthzService
+}
+
+func NewRoleHandler(authz *service.AuthzService) *RoleHandler {
+	return &RoleHandler{authz: authz}
+}
+
+// Roles lists the assignable roles and the permissions each grants
+func (h *RoleHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(domain.RolePermissions)
+}
+
+func (h *RoleHandler) ListUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.authz.Roles(r.Context(), userID)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.RoleAssignment{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *RoleHandler) AssignUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Role    string `json:"role"`
+		Subject string `json:"subject"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	a, err := h.authz.AssignRole(r.Context(), GetUserFromContext(r.Context()), userID, domain.UserRole(req.Role), req.Subject)
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+func (h *RoleHandler) RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.authz.RevokeRole(r.Context(), GetUserFromContext(r.Context()), userID, domain.UserRole(vars["role"]), r.URL.Query().Get("subject"))
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrRoleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrUnknownSubject):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("role management failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type SMSDeliveryHandler struct {
+	svc *service.SMSDeliveryService
+}
+
+func NewSMSDeliveryHandler(svc *service.SMSDeliveryService) *SMSDeliveryHandler {
+	return &SMSDeliveryHandler{svc: svc}
+}
+
+// List returns SMS send attempts newest first. Query params: phone,
+// provider, status, before_id, limit.
+func (h *SMSDeliveryHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.SMSDeliveryFilter{
+		Phone:    q.Get("phone"),
+		Provider: q.Get("provider"),
+		Status:   q.Get("status"),
+	}
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "bad before_id", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	list, err := h.svc.List(r.Context(), filter)
+	if err != nil {
+		log.Printf("list sms deliveries failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []domain.SMSDelivery{}
+	}
+	resp := map[string]any{"deliveries": list}
+	if len(list) > 0 {
+		// Pass as before_id to fetch the next page
+		resp["next_before_id"] = list[len(list)-1].ID
+	}
+	json.NewEncoder(w).Encode(resp)
+}
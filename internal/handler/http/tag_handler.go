@@ -0,0 +1,113 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type TagHandler struct {
+	svc *service.TagService
+}
+
+func NewTagHandler(svc *service.TagService) *TagHandler {
+	return &TagHandler{svc: svc}
+}
+
+// Autocomplete suggests tags for ?prefix=, most used first
+func (h *TagHandler) Autocomplete(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := h.svc.Autocomplete(r.Context(), r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.Tag{}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// SetResourceTags replaces the tags of a resource with {"tags": [...]}
+func (h *TagHandler) SetResourceTags(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	tags, err := h.svc.SetForResource(r.Context(), GetUserFromContext(r.Context()), id, req.Tags)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"resource_id": id, "tags": tags})
+}
+
+func (h *TagHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	t, err := h.svc.Rename(r.Context(), GetUserFromContext(r.Context()), id, req.Name)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(t)
+}
+
+// Merge takes {"into": "name"} and returns the surviving tag
+func (h *TagHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Into string `json:"into"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	t, err := h.svc.Merge(r.Context(), GetUserFromContext(r.Context()), id, req.Into)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(t)
+}
+
+// writeTagError maps tag errors to HTTP status codes
+func writeTagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTagNotFound), errors.Is(err, service.ErrResourceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrTagExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("tag request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type TaxonomyHandler struct {
+	svc *service.TaxonomyService
+}
+
+func NewTaxonomyHandler(svc *service.TaxonomyService) *TaxonomyHandler {
+	return &TaxonomyHandler{svc: svc}
+}
+
+// Subjects returns the subject tree; ?lang= picks the display names
+func (h *TaxonomyHandler) Subjects(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.svc.SubjectTree(r.Context(), r.URL.Query().Get("lang"))
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tree)
+}
+
+// Types returns the resource types; ?lang= picks the display names
+func (h *TaxonomyHandler) Types(w http.ResponseWriter, r *http.Request) {
+	list, err := h.svc.Types(r.Context(), r.URL.Query().Get("lang"))
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *TaxonomyHandler) CreateSubject(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ParentID *int64             `json:"parent_id"`
+		Kind     domain.SubjectKind `json:"kind"`
+		Slug     string             `json:"slug"`
+		Name     string             `json:"name"`
+		Names    map[string]string  `json:"names"`
+		Aliases  []string           `json:"aliases"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	sub, err := h.svc.CreateSubject(r.Context(), GetUserFromContext(r.Context()), &domain.Subject{
+		ParentID: req.ParentID,
+		Kind:     req.Kind,
+		Slug:     req.Slug,
+		Name:     req.Name,
+		Names:    req.Names,
+		Aliases:  req.Aliases,
+	})
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *TaxonomyHandler) UpdateSubject(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		ParentID *int64              `json:"parent_id"`
+		Kind     *domain.SubjectKind `json:"kind"`
+		Slug     *string             `json:"slug"`
+		Name     *string             `json:"name"`
+		Names    map[string]string   `json:"names"`
+		Aliases  []string            `json:"aliases"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	sub, err := h.svc.UpdateSubject(r.Context(), GetUserFromContext(r.Context()), id, service.SubjectEdit{
+		ParentID: req.ParentID,
+		Kind:     req.Kind,
+		Slug:     req.Slug,
+		Name:     req.Name,
+		Names:    req.Names,
+		Aliases:  req.Aliases,
+	})
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (h *TaxonomyHandler) DeleteSubject(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteSubject(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TaxonomyHandler) CreateType(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Slug    string            `json:"slug"`
+		Name    string            `json:"name"`
+		Names   map[string]string `json:"names"`
+		Aliases []string          `json:"aliases"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	t, err := h.svc.CreateType(r.Context(), GetUserFromContext(r.Context()), &domain.ResourceType{
+		Slug:    req.Slug,
+		Name:    req.Name,
+		Names:   req.Names,
+		Aliases: req.Aliases,
+	})
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *TaxonomyHandler) UpdateType(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Slug    *string           `json:"slug"`
+		Name    *string           `json:"name"`
+		Names   map[string]string `json:"names"`
+		Aliases []string          `json:"aliases"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	t, err := h.svc.UpdateType(r.Context(), GetUserFromContext(r.Context()), id, service.TypeEdit{
+		Slug:    req.Slug,
+		Name:    req.Name,
+		Names:   req.Names,
+		Aliases: req.Aliases,
+	})
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *TaxonomyHandler) DeleteType(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.svc.DeleteType(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Backfill maps existing free-text subjects and types to terms; ?dry_run=1
+// only reports what would change
+func (h *TaxonomyHandler) Backfill(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "1" || r.URL.Query().Get("dry_run") == "true"
+	report, err := h.svc.Backfill(r.Context(), GetUserFromContext(r.Context()), dryRun)
+	if err != nil {
+		writeTaxonomyError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeTaxonomyError maps taxonomy errors to HTTP status codes
+func writeTaxonomyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTaxonomyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTaxonomyConflict), errors.Is(err, service.ErrTaxonomyInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidTaxonomy):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("taxonomy request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/service"
+)
+
+type UserAdminHandler struct {
+	svc *service.UserAdminService
+}
+
+func NewUserAdminHandler(svc *service.UserAdminService) *UserAdminHandler {
+	return &UserAdminHandler{svc: svc}
+}
+
+// List searches users. Query params: q, role, suspended=true, page, page_size
+func (h *UserAdminHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+
+	filter := domain.UserFilter{
+		Query:     q.Get("q"),
+		Role:      domain.UserRole(q.Get("role")),
+		Suspended: q.Get("suspended") == "true",
+		Limit:     pageSize,
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	filter.Offset = (page - 1) * filter.Limit
+
+	list, total, err := h.svc.List(r.Context(), filter)
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	if list == nil {
+		list = []domain.User{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"users": list,
+		"total": total,
+		"page":  page,
+	})
+}
+
+func (h *UserAdminHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	u, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+func (h *UserAdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.svc.SetRole(r.Context(), GetUserFromContext(r.Context()), id, domain.UserRole(req.Role))
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+func (h *UserAdminHandler) Suspend(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Reason string     `json:"reason"`
+		Until  *time.Time `json:"until"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.svc.Suspend(r.Context(), GetUserFromContext(r.Context()), id, req.Reason, req.Until)
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+func (h *UserAdminHandler) Unsuspend(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	u, err := h.svc.Unsuspend(r.Context(), GetUserFromContext(r.Context()), id)
+	if err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(u)
+}
+
+func (h *UserAdminHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	if err := h.svc.ForceLogout(r.Context(), GetUserFromContext(r.Context()), id); err != nil {
+		writeUserAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUserAdminError maps user management errors to HTTP status codes
+func writeUserAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrCannotModifySelf):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrInvalidSuspension):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("user management request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -34,7 +35,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 
 	u, err := h.svc.Signup(r.Context(), req.Name, req.Email, req.Password)
 	if err != nil {
-		if err.Error() == "email already used" {
+		if errors.Is(err, domain.ErrEmailTaken) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -47,19 +48,36 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	var req struct{ Email, Password string }
+	// Either email or phone identifies the account
+	var req struct{ Email, Phone, Password string }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+	identifier := req.Email
+	if identifier == "" {
+		identifier = req.Phone
+	}
+	if identifier == "" || req.Password == "" {
+		http.Error(w, "email or phone and password required", http.StatusBadRequest)
+		return
+	}
 
-	token, err := h.svc.Login(r.Context(), req.Email, req.Password)
+	result, err := h.svc.Login(r.Context(), identifier, req.Password, clientIP(r))
 	if err != nil {
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, service.ErrAccountSuspended) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]any{"token": token})
+	json.NewEncoder(w).Encode(result)
 }
 
 func (h *AuthHandler) SendCode(w http.ResponseWriter, r *http.Request) {
@@ -77,6 +95,10 @@ func (h *AuthHandler) SendCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.svc.SendCode(r.Context(), req.Phone, req.Purpose); err != nil {
+		if errors.Is(err, service.ErrTooManyRequests) {
+			writeTooManyRequests(w, err)
+			return
+		}
 		log.Printf("send code failed: phone=%s purpose=%s err=%v", req.Phone, req.Purpose, err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -102,8 +124,12 @@ func (h *AuthHandler) SignupPhone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.svc.SignupWithPhone(r.Context(), req.Name, req.Phone, req.Code, req.Password)
+	u, err := h.svc.SignupWithPhone(r.Context(), req.Name, req.Phone, req.Code, req.Password, clientIP(r))
 	if err != nil {
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -122,17 +148,286 @@ func (h *AuthHandler) LoginPhone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.svc.LoginWithPhone(r.Context(), req.Phone, req.Code)
+	result, err := h.svc.LoginWithPhone(r.Context(), req.Phone, req.Code, clientIP(r))
 	if err != nil {
+		if errors.Is(err, service.ErrTooManyAttempts) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, service.ErrAccountSuspended) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
+	json.NewEncoder(w).Encode(result)
+}
+
+// LoginTwoFactor exchanges the intermediate token and a TOTP/recovery code for a full token
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TwoFactorToken string `json:"two_factor_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.TwoFactorToken == "" || req.Code == "" {
+		http.Error(w, "two_factor_token and code required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.svc.CompleteTwoFactorLogin(r.Context(), req.TwoFactorToken, req.Code, clientIP(r))
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]any{"token": token})
 }
 
+func (h *AuthHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.svc.EnrollTwoFactor(r.Context(), u)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+func (h *AuthHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.svc.ConfirmTwoFactor(r.Context(), u.ID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.DisableTwoFactor(r.Context(), u.ID, req.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.svc.RegenerateRecoveryCodes(r.Context(), u.ID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
+
+// SendBindPhoneCode sends an SMS code to a phone number the user wants to attach
+func (h *AuthHandler) SendBindPhoneCode(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Phone == "" {
+		http.Error(w, "phone required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.SendPhoneBindCode(r.Context(), u.ID, req.Phone); err != nil {
+		writeAccountLinkError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "code sent"})
+}
+
+// BindPhone attaches or changes the phone number after code verification
+func (h *AuthHandler) BindPhone(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Phone == "" || req.Code == "" {
+		http.Error(w, "phone and code required", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.svc.BindPhone(r.Context(), u.ID, req.Phone, req.Code, clientIP(r))
+	if err != nil {
+		writeAccountLinkError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// SendBindEmailCode emails a code to an address the user wants to attach
+func (h *AuthHandler) SendBindEmailCode(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, "email required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.SendEmailBindCode(r.Context(), u.ID, req.Email); err != nil {
+		writeAccountLinkError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "code sent"})
+}
+
+// BindEmail attaches or changes the email address after code verification
+func (h *AuthHandler) BindEmail(w http.ResponseWriter, r *http.Request) {
+	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" || req.Code == "" {
+		http.Error(w, "email and code required", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.svc.BindEmail(r.Context(), u.ID, req.Email, req.Code, clientIP(r))
+	if err != nil {
+		writeAccountLinkError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// writeAccountLinkError maps phone/email binding errors to HTTP status codes
+func writeAccountLinkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrPhoneTaken), errors.Is(err, domain.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrTooManyAttempts), errors.Is(err, service.ErrTooManyRequests):
+		writeTooManyRequests(w, err)
+	case errors.Is(err, service.ErrInvalidCode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("account link request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
+
+// writeTooManyRequests answers 429, with Retry-After when the rate limiter
+// said how long to wait
+func writeTooManyRequests(w http.ResponseWriter, err error) {
+	var limited *service.RateLimitError
+	if errors.As(err, &limited) && limited.RetryAfter > 0 {
+		w.Header().Set("Retry-After", seconds(limited.RetryAfter))
+	}
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// writeTwoFactorError maps two-factor service errors to HTTP status codes
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTooManyAttempts):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, service.ErrAccountSuspended):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrInvalidTwoFactorCode):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("two-factor request failed: err=%v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
+
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	u := GetUserFromContext(r.Context())
+	if u == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	json.NewEncoder(w).Encode(u)
 }
 
@@ -0,0 +1,122 @@
+// Package cached wraps repositories with read-through caching of hot reads:
+// users and resources by ID, and the unfiltered resource listings. Writes
+// made through the wrappers invalidate what they change once their
+// transaction commits. Entries are loaded from the primary, never from a
+// read replica, and a load that raced an invalidation is not kept.
+//
+// Entries live for the configured TTL at most. Changes made around the
+// wrappers (another process with its own in-memory cache, or SQL run by
+// hand) show up when the entry expires, so instances sharing a database
+// should share a Redis cache or keep the TTL short.
+package cached
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+// store is the cache shared by one wrapper's reads, with the group that
+// keeps concurrent misses from all reaching the database
+type store struct {
+	cache cache.Cache
+	ttl   time.Duration
+	group cache.Group
+}
+
+// readThrough returns the value cached under key, or loads it once for
+// every concurrent caller and caches it. Nil results are not cached, and
+// reads inside a transaction bypass the cache so they neither see stale
+// entries nor cache uncommitted rows.
+//
+// A load may read the row just before a write commits and store it just
+// after the write's invalidation. Every invalidation therefore also moves
+// the key's generation, and a load that sees the generation move while it
+// ran deletes what it stored.
+func readThrough[T any](ctx context.Context, s *store, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	if dbtx.InTx(ctx) {
+		return load(ctx)
+	}
+	data, ok, err := s.cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("cache get failed: key=%s err=%v", key, err)
+	}
+	if ok && gob.NewDecoder(bytes.NewReader(data)).Decode(&v) == nil {
+		return v, nil
+	}
+
+	// Each caller decodes its own copy, so callers never share a value
+	data, err = s.group.Do(key, func() ([]byte, error) {
+		gen := s.generation(ctx, key)
+		v, err := load(dbtx.WithPrimary(ctx))
+		if err != nil || isNil(v) {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		if err := s.cache.Set(ctx, key, buf.Bytes(), s.ttl); err != nil {
+			log.Printf("cache set failed: key=%s err=%v", key, err)
+		} else if s.generation(ctx, key) != gen {
+			if err := s.cache.Delete(ctx, key); err != nil {
+				log.Printf("cache delete failed: keys=[%s] err=%v", key, err)
+			}
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil || data == nil {
+		return v, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// invalidate deletes the keys once the transaction in ctx, if any, commits,
+// after moving their generations
+func (s *store) invalidate(ctx context.Context, keys ...string) {
+	dbtx.AfterCommit(ctx, func() {
+		b := make([]byte, 8)
+		rand.Read(b)
+		gen := []byte(hex.EncodeToString(b))
+		for _, key := range keys {
+			if err := s.cache.Set(ctx, generationKey(key), gen, s.ttl); err != nil {
+				log.Printf("cache set failed: key=%s err=%v", generationKey(key), err)
+			}
+		}
+		if err := s.cache.Delete(ctx, keys...); err != nil {
+			log.Printf("cache delete failed: keys=%v err=%v", keys, err)
+		}
+	})
+}
+
+// generation returns the marker the last invalidation of key left, if any
+func (s *store) generation(ctx context.Context, key string) string {
+	data, _, err := s.cache.Get(ctx, generationKey(key))
+	if err != nil {
+		log.Printf("cache get failed: key=%s err=%v", generationKey(key), err)
+	}
+	return string(data)
+}
+
+func generationKey(key string) string { return "gen:" + key }
+
+func isNil(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package cached
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+// fakeUsers serves GetByID from a map, counting the lookups, and records
+// suspensions. Other methods are not implemented.
+type fakeUsers struct {
+	domain.UserRepository
+	mu      sync.Mutex
+	users   map[int64]domain.User
+	lookups atomic.Int32
+	delay   time.Duration
+	// afterRead runs once the next lookup has read its row
+	afterRead func()
+}
+
+func (f *fakeUsers) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	f.lookups.Add(1)
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	u, ok := f.users[id]
+	after := f.afterRead
+	f.afterRead = nil
+	f.mu.Unlock()
+	if after != nil {
+		after()
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (f *fakeUsers) Suspend(ctx context.Context, id int64, reason string, until *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.users[id]
+	now := time.Now()
+	u.SuspendedAt, u.SuspendReason = &now, reason
+	f.users[id] = u
+	return nil
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{users: map[int64]domain.User{1: {ID: 1, Name: "ada", Password: "hash"}}}
+}
+
+func TestUserGetByIDReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	inner := newFakeUsers()
+	repo := NewUserRepository(inner, cache.NewMemory(10), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		u, err := repo.GetByID(ctx, 1)
+		if err != nil || u == nil || u.Name != "ada" {
+			t.Fatalf("GetByID = %+v, %v", u, err)
+		}
+		if u.Password != "" {
+			t.Fatal("password hash served from the cache")
+		}
+		u.Name = "changed by caller"
+	}
+	if n := inner.lookups.Load(); n != 1 {
+		t.Errorf("%d lookups for repeated reads, want 1", n)
+	}
+
+	// Missing users are not cached
+	for i := 0; i < 2; i++ {
+		if u, err := repo.GetByID(ctx, 2); err != nil || u != nil {
+			t.Fatalf("GetByID(missing) = %+v, %v", u, err)
+		}
+	}
+	if n := inner.lookups.Load(); n != 3 {
+		t.Errorf("lookups = %d after two misses, want 3", n)
+	}
+
+	if err := repo.Suspend(ctx, 1, "spam", nil); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := repo.GetByID(ctx, 1); u == nil || u.SuspendedAt == nil {
+		t.Errorf("GetByID after Suspend = %+v, want the suspension", u)
+	}
+}
+
+func TestUserGetByIDLoadsOnceForConcurrentMisses(t *testing.T) {
+	inner := newFakeUsers()
+	inner.delay = 50 * time.Millisecond
+	repo := NewUserRepository(inner, cache.NewMemory(10), time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if u, err := repo.GetByID(context.Background(), 1); err != nil || u == nil {
+				t.Errorf("GetByID = %+v, %v", u, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := inner.lookups.Load(); n != 1 {
+		t.Errorf("%d lookups for concurrent misses, want 1", n)
+	}
+}
+
+func TestInvalidationWaitsForCommit(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	tx := dbtx.NewManager(db)
+	ctx := context.Background()
+	inner := newFakeUsers()
+	repo := NewUserRepository(inner, cache.NewMemory(10), time.Minute)
+	repo.GetByID(ctx, 1)
+
+	errAbort := errors.New("abort")
+	err = tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Suspend(ctx, 1, "spam", nil); err != nil {
+			return err
+		}
+		// Readers outside the transaction keep the committed copy
+		if u, _ := repo.GetByID(context.Background(), 1); u.SuspendedAt != nil {
+			t.Error("uncommitted suspension visible outside the transaction")
+		}
+		// Reads inside it skip the cache
+		if u, _ := repo.GetByID(ctx, 1); u.SuspendedAt == nil {
+			t.Error("transaction does not see its own write")
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatal(err)
+	}
+	if u, _ := repo.GetByID(ctx, 1); u.SuspendedAt != nil {
+		t.Error("rolled back transaction invalidated the cache")
+	}
+
+	if err := tx.WithinTx(ctx, func(ctx context.Context) error {
+		return repo.Suspend(ctx, 1, "spam", nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := repo.GetByID(ctx, 1); u.SuspendedAt == nil {
+		t.Error("committed suspension not visible")
+	}
+}
+
+func TestLoadRacingInvalidationIsNotKept(t *testing.T) {
+	ctx := context.Background()
+	inner := newFakeUsers()
+	repo := NewUserRepository(inner, cache.NewMemory(10), time.Minute)
+
+	// The suspension commits and invalidates after the lookup read the
+	// row but before it stored it
+	inner.afterRead = func() {
+		if err := repo.Suspend(ctx, 1, "spam", nil); err != nil {
+			t.Error(err)
+		}
+	}
+	if u, _ := repo.GetByID(ctx, 1); u == nil || u.SuspendedAt != nil {
+		t.Fatalf("racing GetByID = %+v, want the row it read", u)
+	}
+	if u, _ := repo.GetByID(ctx, 1); u == nil || u.SuspendedAt == nil {
+		t.Errorf("GetByID after the race = %+v, want the suspension", u)
+	}
+}
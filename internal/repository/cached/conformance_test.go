@@ -0,0 +1,55 @@
+package cached
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/repotest"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+// TestConformance runs the shared repository suite through the caching
+// decorators, which must not change what the repositories return
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "chirp.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := sqlite.NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		c := cache.NewMemory(1000)
+		resources := NewResourceRepository(sqlite.NewResourceRepository(db), c, time.Minute)
+		return repotest.Repos{
+			Users:         NewUserRepository(sqlite.NewUserRepository(db), c, time.Minute),
+			Roles:         sqlite.NewRoleRepository(db),
+			Audit:         sqlite.NewAuditRepository(db),
+			Codes:         sqlite.NewCodeRepository(db),
+			Identities:    sqlite.NewIdentityRepository(db),
+			APITokens:     sqlite.NewAPITokenRepository(db),
+			TwoFactor:     sqlite.NewTwoFactorRepository(db),
+			Resources:     resources,
+			Reviews:       sqlite.NewReviewRepository(db),
+			Reports:       sqlite.NewReportRepository(db),
+			Reactions:     NewReactionRepository(sqlite.NewReactionRepository(db), resources),
+			Comments:      NewCommentRepository(sqlite.NewCommentRepository(db), resources),
+			Collections:   NewCollectionRepository(sqlite.NewCollectionRepository(db), resources),
+			Taxonomy:      NewTaxonomyRepository(sqlite.NewTaxonomyRepository(db), resources),
+			Tags:          sqlite.NewTagRepository(db),
+			Analytics:     NewAnalyticsRepository(sqlite.NewAnalyticsRepository(db), resources),
+			Notifications: sqlite.NewNotificationRepository(db),
+			SMSDeliveries: sqlite.NewSMSDeliveryRepository(db),
+			Tx:            dbtx.NewManager(db),
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package cached
+
+import (
+	"context"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// The wrappers below invalidate cached resources whose counters (likes,
+// ratings, comments, favorites, downloads and views) their writes change.
+
+type reactionRepository struct {
+	domain.ReactionRepository
+	resources *ResourceRepository
+}
+
+func NewReactionRepository(inner domain.ReactionRepository, resources *ResourceRepository) domain.ReactionRepository {
+	return &reactionRepository{ReactionRepository: inner, resources: resources}
+}
+
+func (r *reactionRepository) SetRating(ctx context.Context, resourceID, userID int64, stars int) error {
+	if err := r.ReactionRepository.SetRating(ctx, resourceID, userID, stars); err != nil {
+		return err
+	}
+	r.resources.Invalidate(ctx, resourceID)
+	return nil
+}
+
+func (r *reactionRepository) DeleteRating(ctx context.Context, resourceID, userID int64) (bool, error) {
+	ok, err := r.ReactionRepository.DeleteRating(ctx, resourceID, userID)
+	if err == nil && ok {
+		r.resources.Invalidate(ctx, resourceID)
+	}
+	return ok, err
+}
+
+func (r *reactionRepository) Like(ctx context.Context, resourceID, userID int64) error {
+	if err := r.ReactionRepository.Like(ctx, resourceID, userID); err != nil {
+		return err
+	}
+	r.resources.Invalidate(ctx, resourceID)
+	return nil
+}
+
+func (r *reactionRepository) Unlike(ctx context.Context, resourceID, userID int64) error {
+	if err := r.ReactionRepository.Unlike(ctx, resourceID, userID); err != nil {
+		return err
+	}
+	r.resources.Invalidate(ctx, resourceID)
+	return nil
+}
+
+type commentRepository struct {
+	domain.CommentRepository
+	resources *ResourceRepository
+}
+
+func NewCommentRepository(inner domain.CommentRepository, resources *ResourceRepository) domain.CommentRepository {
+	return &commentRepository{CommentRepository: inner, resources: resources}
+}
+
+func (r *commentRepository) Create(ctx context.Context, c *domain.Comment) error {
+	if err := r.CommentRepository.Create(ctx, c); err != nil {
+		return err
+	}
+	r.resources.Invalidate(ctx, c.ResourceID)
+	return nil
+}
+
+func (r *commentRepository) Delete(ctx context.Context, id int64, deletedBy int64) error {
+	c, err := r.CommentRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.CommentRepository.Delete(ctx, id, deletedBy); err != nil {
+		return err
+	}
+	if c != nil {
+		r.resources.Invalidate(ctx, c.ResourceID)
+	}
+	return nil
+}
+
+type collectionRepository struct {
+	domain.CollectionRepository
+	resources *ResourceRepository
+}
+
+func NewCollectionRepository(inner domain.CollectionRepository, resources *ResourceRepository) domain.CollectionRepository {
+	return &collectionRepository{CollectionRepository: inner, resources: resources}
+}
+
+func (r *collectionRepository) Delete(ctx context.Context, id int64) error {
+	items, err := r.CollectionRepository.Items(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.CollectionRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	ids := make([]int64, len(items))
+	for i, it := range items {
+		ids[i] = it.ResourceID
+	}
+	r.resources.Invalidate(ctx, ids...)
+	return nil
+}
+
+func (r *collectionRepository) AddItem(ctx context.Context, collectionID, resourceID int64) (bool, error) {
+	added, err := r.CollectionRepository.AddItem(ctx, collectionID, resourceID)
+	if err == nil && added {
+		r.resources.Invalidate(ctx, resourceID)
+	}
+	return added, err
+}
+
+func (r *collectionRepository) RemoveItem(ctx context.Context, collectionID, resourceID int64) (bool, error) {
+	removed, err := r.CollectionRepository.RemoveItem(ctx, collectionID, resourceID)
+	if err == nil && removed {
+		r.resources.Invalidate(ctx, resourceID)
+	}
+	return removed, err
+}
+
+type analyticsRepository struct {
+	domain.AnalyticsRepository
+	resources *ResourceRepository
+}
+
+func NewAnalyticsRepository(inner domain.AnalyticsRepository, resources *ResourceRepository) domain.AnalyticsRepository {
+	return &analyticsRepository{AnalyticsRepository: inner, resources: resources}
+}
+
+func (r *analyticsRepository) AddDaily(ctx context.Context, stats []domain.ResourceDailyStat) error {
+	if err := r.AnalyticsRepository.AddDaily(ctx, stats); err != nil {
+		return err
+	}
+	ids := make([]int64, len(stats))
+	for i, s := range stats {
+		ids[i] = s.ResourceID
+	}
+	r.resources.Invalidate(ctx, ids...)
+	return nil
+}
+
+type taxonomyRepository struct {
+	domain.TaxonomyRepository
+	resources *ResourceRepository
+}
+
+// NewTaxonomyRepository drops the cached listings when MapValue backfills
+// taxonomy IDs. The resources it touches are not known, so their own
+// entries expire with the TTL.
+func NewTaxonomyRepository(inner domain.TaxonomyRepository, resources *ResourceRepository) domain.TaxonomyRepository {
+	return &taxonomyRepository{TaxonomyRepository: inner, resources: resources}
+}
+
+func (r *taxonomyRepository) MapValue(ctx context.Context, scope domain.TaxonomyScope, value string, id int64, slug string) (int64, error) {
+	n, err := r.TaxonomyRepository.MapValue(ctx, scope, value, id, slug)
+	if err == nil && n > 0 {
+		r.resources.Invalidate(ctx)
+	}
+	return n, err
+}
@@ -0,0 +1,100 @@
+package cached
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+// listGenKey holds the generation of the cached listings. Listings are
+// cached under the current generation, so starting a new one invalidates
+// all of them at once.
+const listGenKey = "resources:list:gen"
+
+// ResourceRepository caches GetByID and listings without search or tag
+// filters, the first page every visitor sees. Repositories that change
+// resource rows, such as the counters kept by reactions and comments, call
+// Invalidate through their own wrappers.
+type ResourceRepository struct {
+	domain.ResourceRepository
+	store *store
+}
+
+func NewResourceRepository(inner domain.ResourceRepository, c cache.Cache, ttl time.Duration) *ResourceRepository {
+	return &ResourceRepository{ResourceRepository: inner, store: &store{cache: c, ttl: ttl}}
+}
+
+func resourceKey(id int64) string { return "resource:" + strconv.FormatInt(id, 10) }
+
+func (r *ResourceRepository) GetByID(ctx context.Context, id int64) (*domain.Resource, error) {
+	return readThrough(ctx, r.store, resourceKey(id), func(ctx context.Context) (*domain.Resource, error) {
+		return r.ResourceRepository.GetByID(ctx, id)
+	})
+}
+
+func (r *ResourceRepository) List(ctx context.Context, f domain.ResourceFilter) ([]domain.Resource, error) {
+	if f.Search != "" || len(f.Tags) > 0 {
+		return r.ResourceRepository.List(ctx, f)
+	}
+	gen := r.listGen(ctx)
+	key := "resources:list:" + gen + ":" + string(f.Status) + ":" + string(f.Sort)
+	return readThrough(ctx, r.store, key, func(ctx context.Context) ([]domain.Resource, error) {
+		return r.ResourceRepository.List(ctx, f)
+	})
+}
+
+// listGen returns the current listing generation, starting one if the
+// cache has none
+func (r *ResourceRepository) listGen(ctx context.Context) string {
+	if gen, ok, err := r.store.cache.Get(ctx, listGenKey); err == nil && ok {
+		return string(gen)
+	}
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36)
+	r.store.cache.Set(ctx, listGenKey, []byte(gen), r.store.ttl)
+	return gen
+}
+
+func (r *ResourceRepository) Create(ctx context.Context, res *domain.Resource) error {
+	if err := r.ResourceRepository.Create(ctx, res); err != nil {
+		return err
+	}
+	r.Invalidate(ctx)
+	return nil
+}
+
+func (r *ResourceRepository) UpdateStatus(ctx context.Context, id int64, status domain.ResourceStatus) error {
+	if err := r.ResourceRepository.UpdateStatus(ctx, id, status); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+func (r *ResourceRepository) Resubmit(ctx context.Context, res *domain.Resource) error {
+	if err := r.ResourceRepository.Resubmit(ctx, res); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, res.ID)
+	return nil
+}
+
+func (r *ResourceRepository) Reopen(ctx context.Context, id int64) error {
+	if err := r.ResourceRepository.Reopen(ctx, id); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+// Invalidate drops the cached resources and all cached listings once the
+// transaction in ctx, if any, commits
+func (r *ResourceRepository) Invalidate(ctx context.Context, ids ...int64) {
+	keys := []string{listGenKey}
+	for _, id := range ids {
+		keys = append(keys, resourceKey(id))
+	}
+	r.store.invalidate(ctx, keys...)
+}
@@ -0,0 +1,90 @@
+package cached
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+// userRepository caches GetByID, which the auth middleware calls on every
+// authenticated request. The password hash is left out of what it returns,
+// so it is never copied into the cache.
+type userRepository struct {
+	domain.UserRepository
+	store *store
+}
+
+func NewUserRepository(inner domain.UserRepository, c cache.Cache, ttl time.Duration) domain.UserRepository {
+	return &userRepository{UserRepository: inner, store: &store{cache: c, ttl: ttl}}
+}
+
+func userKey(id int64) string { return "user:" + strconv.FormatInt(id, 10) }
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	return readThrough(ctx, r.store, userKey(id), func(ctx context.Context) (*domain.User, error) {
+		u, err := r.UserRepository.GetByID(ctx, id)
+		if u != nil {
+			u.Password = ""
+		}
+		return u, err
+	})
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, u *domain.User) error {
+	if err := r.UserRepository.UpdateProfile(ctx, u); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(u.ID))
+	return nil
+}
+
+func (r *userRepository) UpdateEmail(ctx context.Context, id int64, email string) error {
+	if err := r.UserRepository.UpdateEmail(ctx, id, email); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
+
+func (r *userRepository) UpdatePhoneNumber(ctx context.Context, id int64, phone string) error {
+	if err := r.UserRepository.UpdatePhoneNumber(ctx, id, phone); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id int64, role domain.UserRole) error {
+	if err := r.UserRepository.UpdateRole(ctx, id, role); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
+
+func (r *userRepository) Suspend(ctx context.Context, id int64, reason string, until *time.Time) error {
+	if err := r.UserRepository.Suspend(ctx, id, reason, until); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
+
+func (r *userRepository) Unsuspend(ctx context.Context, id int64) error {
+	if err := r.UserRepository.Unsuspend(ctx, id); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
+
+func (r *userRepository) RevokeTokens(ctx context.Context, id int64) error {
+	if err := r.UserRepository.RevokeTokens(ctx, id); err != nil {
+		return err
+	}
+	r.store.invalidate(ctx, userKey(id))
+	return nil
+}
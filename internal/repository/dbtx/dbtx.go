@@ -0,0 +1,219 @@
+// Package dbtx is how repositories reach their *sql.DB. Repositories built on
+// one pool share a transaction carried in the context, so services can make
+// several repository calls commit or roll back together, and reads may be
+// routed to replicas of the pool.
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+)
+
+type ctxKey struct{}
+
+// primaryKey marks a context whose reads must not go to a replica
+type primaryKey struct{}
+
+// txState is the transaction a context carries and the pool it came from
+type txState struct {
+	db          *sql.DB
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+// InTx reports whether ctx carries a transaction started by WithinTx
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(ctxKey{}).(*txState)
+	return ok
+}
+
+// AfterCommit runs fn once the transaction carried by ctx commits, and not
+// at all if it rolls back. Without a transaction fn runs right away. Caches
+// use it so they are not invalidated before other readers can see the change.
+func AfterCommit(ctx context.Context, fn func()) {
+	if st, ok := ctx.Value(ctxKey{}).(*txState); ok {
+		st.afterCommit = append(st.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// WithPrimary returns a context whose reads through DB.Reader go to the
+// primary even when reads of the pool are routed to replicas. Caches use it
+// so they never keep a lagging replica's copy.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func onPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// DB runs statements in the transaction carried by the context when it was
+// started on the same pool, and directly on the pool otherwise
+type DB struct {
+	db *sql.DB
+}
+
+// Wrap returns db for use by a repository
+func Wrap(db *sql.DB) *DB {
+	return &DB{db: db}
+}
+
+func (d *DB) tx(ctx context.Context) *sql.Tx {
+	if st, ok := ctx.Value(ctxKey{}).(*txState); ok && st.db == d.db {
+		return st.tx
+	}
+	return nil
+}
+
+func (d *DB) replicas() *Replicas {
+	r, _ := routes.Load(d.db)
+	rs, _ := r.(*Replicas)
+	return rs
+}
+
+// wrote notes a successful write for read-your-writes stickiness
+func (d *DB) wrote(ctx context.Context) {
+	if r := d.replicas(); r != nil {
+		r.wrote(ctx)
+	}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (res sql.Result, err error) {
+	if tx := d.tx(ctx); tx != nil {
+		res, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		res, err = d.db.ExecContext(ctx, query, args...)
+	}
+	if err == nil {
+		d.wrote(ctx)
+	}
+	return res, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if tx := d.tx(ctx); tx != nil {
+		return tx.QueryContext(ctx, query, args...)
+	}
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if tx := d.tx(ctx); tx != nil {
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	return d.db.QueryRowContext(ctx, query, args...)
+}
+
+// Reader runs read-only queries
+type Reader interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Reader returns where a read-only query should run: the context's
+// transaction, a replica when reads of the pool are routed (see Route), or
+// the pool itself. Reads that must see the latest data use the DB directly.
+func (d *DB) Reader(ctx context.Context) Reader {
+	if tx := d.tx(ctx); tx != nil {
+		return tx
+	}
+	if r := d.replicas(); r != nil {
+		return r.reader(ctx)
+	}
+	return d.db
+}
+
+// BeginTx starts a transaction, or joins the one carried by ctx. Commit and
+// Rollback of a joined transaction are left to whoever started it.
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if tx := d.tx(ctx); tx != nil {
+		return &Tx{db: d, tx: tx, joined: true}, nil
+	}
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{db: d, tx: tx}, nil
+}
+
+// Tx is a transaction begun by DB.BeginTx
+type Tx struct {
+	db     *DB
+	tx     *sql.Tx
+	joined bool
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	res, err := t.tx.ExecContext(ctx, query, args...)
+	if err == nil {
+		t.db.wrote(ctx)
+	}
+	return res, err
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
+
+func (t *Tx) Commit() error {
+	if t.joined {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	if t.joined {
+		return nil
+	}
+	return t.tx.Rollback()
+}
+
+// Manager implements domain.TxManager for repositories wrapping db
+type Manager struct {
+	db *sql.DB
+}
+
+func NewManager(db *sql.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// WithinTx runs fn in a transaction that commits if fn returns nil and rolls
+// back if it fails or panics. A call made inside fn joins the outer
+// transaction.
+func (m *Manager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if st, ok := ctx.Value(ctxKey{}).(*txState); ok && st.db == m.db {
+		return fn(ctx)
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	st := &txState{db: m.db, tx: tx}
+	if err = fn(context.WithValue(ctx, ctxKey{}, st)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range st.afterCommit {
+		f()
+	}
+	return nil
+}
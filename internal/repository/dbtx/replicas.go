@@ -0,0 +1,177 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// defaultCheckInterval is used when ReplicaOptions leaves CheckInterval unset
+const defaultCheckInterval = 10 * time.Second
+
+// routes maps a primary pool to the replicas its reads are routed to
+var routes sync.Map
+
+// ReplicaOptions tunes read routing
+type ReplicaOptions struct {
+	// Stickiness is how long a user's reads stay on the primary after the
+	// user's own write, so they see it before it reaches the replicas
+	Stickiness time.Duration
+	// CheckInterval is how often replicas are pinged. A replica that fails
+	// gets no reads until it answers again.
+	CheckInterval time.Duration
+}
+
+// Replicas sends reads made through DB.Reader on a primary to its read
+// replicas, round robin among the healthy ones. Reads fall back to the
+// primary inside a transaction, under WithPrimary, during a user's
+// stickiness window and when no replica is healthy.
+type Replicas struct {
+	primary    *sql.DB
+	pools      []*replica
+	next       atomic.Uint64
+	stickiness time.Duration
+
+	mu     sync.Mutex
+	writes map[int64]time.Time // last write per session user
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// Route routes reads of repositories on primary to replicas and starts the
+// health checks. Writes are recognised by ExecContext, so it suits drivers
+// that do not write through queries (MySQL, SQLite).
+func Route(primary *sql.DB, replicas []*sql.DB, opts ReplicaOptions) *Replicas {
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultCheckInterval
+	}
+	r := &Replicas{
+		primary:    primary,
+		stickiness: opts.Stickiness,
+		writes:     make(map[int64]time.Time),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, db := range replicas {
+		r.pools = append(r.pools, &replica{db: db})
+	}
+	r.check(opts.CheckInterval)
+	routes.Store(primary, r)
+	go r.run(opts.CheckInterval)
+	return r
+}
+
+// Close stops routing and the health checks and closes the replica pools
+func (r *Replicas) Close() error {
+	var first error
+	r.closeOnce.Do(func() {
+		routes.CompareAndDelete(r.primary, r)
+		close(r.stop)
+		<-r.done
+		for _, p := range r.pools {
+			if err := p.db.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	})
+	return first
+}
+
+// Healthy returns how many replicas passed the last health check
+func (r *Replicas) Healthy() int {
+	n := 0
+	for _, p := range r.pools {
+		if p.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replicas) run(interval time.Duration) {
+	defer close(r.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+			r.check(interval)
+			r.forget()
+		}
+	}
+}
+
+// check pings every replica, giving each at most one interval to answer
+func (r *Replicas) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, p := range r.pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.healthy.Store(p.db.PingContext(ctx) == nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// forget drops writes older than the stickiness window
+func (r *Replicas) forget() {
+	cutoff := time.Now().Add(-r.stickiness)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for user, at := range r.writes {
+		if at.Before(cutoff) {
+			delete(r.writes, user)
+		}
+	}
+}
+
+func (r *Replicas) wrote(ctx context.Context) {
+	user := domain.SessionFrom(ctx)
+	if user == 0 || r.stickiness <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.writes[user] = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Replicas) sticky(ctx context.Context) bool {
+	user := domain.SessionFrom(ctx)
+	if user == 0 {
+		return false
+	}
+	r.mu.Lock()
+	at, ok := r.writes[user]
+	r.mu.Unlock()
+	return ok && time.Since(at) < r.stickiness
+}
+
+// reader picks the pool for a read outside a transaction
+func (r *Replicas) reader(ctx context.Context) *sql.DB {
+	if len(r.pools) == 0 || onPrimary(ctx) || r.sticky(ctx) {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := range r.pools {
+		if p := r.pools[(start+uint64(i))%uint64(len(r.pools))]; p.healthy.Load() {
+			return p.db
+		}
+	}
+	return r.primary
+}
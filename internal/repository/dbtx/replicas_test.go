@@ -0,0 +1,100 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// openNamed opens a scratch database whose only row names it
+func openNamed(t *testing.T, name string) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE source(name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO source(name) VALUES(?)`, name); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// readFrom names the database a read through d runs on
+func readFrom(t *testing.T, ctx context.Context, d *DB) string {
+	t.Helper()
+	var name string
+	if err := d.Reader(ctx).QueryRowContext(ctx, `SELECT name FROM source`).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReplicaRouting(t *testing.T) {
+	primary, replica := openNamed(t, "primary"), openNamed(t, "replica")
+	d := Wrap(primary)
+	anon := context.Background()
+	if got := readFrom(t, anon, d); got != "primary" {
+		t.Fatalf("read before Route went to %s", got)
+	}
+
+	const stickiness = 200 * time.Millisecond
+	r := Route(primary, []*sql.DB{replica}, ReplicaOptions{Stickiness: stickiness, CheckInterval: 20 * time.Millisecond})
+	t.Cleanup(func() { r.Close() })
+	if r.Healthy() != 1 {
+		t.Fatalf("Healthy = %d, want 1", r.Healthy())
+	}
+
+	writer, other := domain.WithSession(anon, 7), domain.WithSession(anon, 8)
+	if got := readFrom(t, writer, d); got != "replica" {
+		t.Errorf("read went to %s, want replica", got)
+	}
+	if _, err := d.ExecContext(writer, `INSERT INTO source(name) VALUES('written')`); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFrom(t, writer, d); got != "primary" {
+		t.Errorf("read after own write went to %s, want primary", got)
+	}
+	if got := readFrom(t, other, d); got != "replica" {
+		t.Errorf("another user's read went to %s, want replica", got)
+	}
+	if got := readFrom(t, WithPrimary(other), d); got != "primary" {
+		t.Errorf("read under WithPrimary went to %s, want primary", got)
+	}
+	time.Sleep(stickiness)
+	if got := readFrom(t, writer, d); got != "replica" {
+		t.Errorf("read after the stickiness window went to %s, want replica", got)
+	}
+
+	err := NewManager(primary).WithinTx(other, func(ctx context.Context) error {
+		if got := readFrom(t, ctx, d); got != "primary" {
+			t.Errorf("read in a transaction went to %s, want primary", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replica.Close()
+	deadline := time.Now().Add(time.Second)
+	for r.Healthy() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := readFrom(t, anon, d); got != "primary" {
+		t.Errorf("read with the replica down went to %s, want primary", got)
+	}
+
+	r.Close()
+	if got := readFrom(t, anon, d); got != "primary" {
+		t.Errorf("read after Close went to %s, want primary", got)
+	}
+}
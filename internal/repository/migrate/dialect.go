@@ -0,0 +1,139 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	lockName = "chirp_schema_migrations"
+	// lockKey is an arbitrary PostgreSQL advisory lock key; advisory
+	// locks are keyed by number rather than name
+	lockKey     = 4_242_020_041
+	lockTimeout = 30 * time.Second
+	// staleLock is how old a SQLite lock row may get before it is taken to
+	// belong to a crashed run
+	staleLock = 10 * time.Minute
+)
+
+// Dialect holds what differs between databases
+type Dialect interface {
+	// Lock takes the migration lock on conn, waiting up to lockTimeout
+	Lock(ctx context.Context, conn *sql.Conn) error
+	Unlock(ctx context.Context, conn *sql.Conn) error
+	// TransactionalDDL reports whether schema changes can run in a transaction
+	TransactionalDDL() bool
+	// Placeholder returns the n-th (1-based) bind parameter
+	Placeholder(n int) string
+}
+
+var (
+	SQLite   Dialect = sqliteDialect{}
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+)
+
+// sqliteDialect locks with a row in schema_migrations_lock, since SQLite has
+// no named locks. A row left by a crashed run is replaced once stale.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Lock(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+		id INTEGER PRIMARY KEY,
+		locked_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		res, err := conn.ExecContext(ctx, `INSERT OR IGNORE INTO schema_migrations_lock(id, locked_at) VALUES(1, ?)`, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return nil
+		}
+		if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations_lock WHERE id = 1 AND locked_at < ?`, time.Now().UTC().Add(-staleLock)); err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (sqliteDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations_lock WHERE id = 1`)
+	return err
+}
+
+func (sqliteDialect) TransactionalDDL() bool { return true }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+// mysqlDialect uses a named lock, which MySQL releases by itself when the
+// connection holding it drops
+type mysqlDialect struct{}
+
+func (mysqlDialect) Lock(ctx context.Context, conn *sql.Conn) error {
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, int(lockTimeout.Seconds())).Scan(&got); err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return fmt.Errorf("%w (%s)", ErrLocked, lockName)
+	}
+	return nil
+}
+
+func (mysqlDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, lockName)
+	return err
+}
+
+// TransactionalDDL is false: MySQL commits implicitly around DDL statements
+func (mysqlDialect) TransactionalDDL() bool { return false }
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+// postgresDialect uses a session-level advisory lock. pg_advisory_lock has
+// no timeout, so Lock polls pg_try_advisory_lock instead.
+type postgresDialect struct{}
+
+func (postgresDialect) Lock(ctx context.Context, conn *sql.Conn) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		var got bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, int64(lockKey)).Scan(&got); err != nil {
+			return err
+		}
+		if got {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (postgresDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, int64(lockKey))
+	return err
+}
+
+func (postgresDialect) TransactionalDDL() bool { return true }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
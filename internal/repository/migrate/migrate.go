@@ -0,0 +1,388 @@
+// Package migrate applies numbered SQL migrations and records them in the
+// schema_migrations table.
+//
+// Migrations are files named NNNN_name.up.sql and NNNN_name.down.sql. Each
+// applied migration is stored with the SHA-256 checksum of its up file, so a
+// migration edited after it ran is reported instead of silently diverging.
+// Runs hold a database-wide lock, so several instances starting at once
+// apply each migration once.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownVersion   = errors.New("database has a migration this build does not know")
+	ErrIrreversible     = errors.New("migration has no down file")
+	ErrLocked           = errors.New("another migration run holds the lock")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes a migration known to the build, the database, or both
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified is set when the applied checksum differs from the file
+	Modified bool `json:"modified,omitempty"`
+	// Unknown is set for versions recorded in the database but missing here
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrator runs the migrations of one dialect against a database
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+
+	// Legacy, when set, runs under the lock before the first migration is
+	// applied to a database. Drivers use it to bring databases created
+	// before versioned migrations up to the baseline.
+	Legacy func(ctx context.Context, conn *sql.Conn) error
+}
+
+// New reads the migrations in the root of files
+func New(db *sql.DB, dialect Dialect, files fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration file %s: name must look like 0001_name.up.sql", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(files, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+	list := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", mig.Version, mig.Name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return &Migrator{db: db, dialect: dialect, migrations: list}, nil
+}
+
+// Up applies every pending migration in order and returns those applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		if len(applied) == 0 && m.Legacy != nil {
+			if err := m.Legacy(ctx, conn); err != nil {
+				return fmt.Errorf("upgrade legacy schema: %w", err)
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, mig.Up, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// those reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %04d_%s", ErrIrreversible, mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, conn, mig, mig.Down, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every migration of the build and any unknown versions found
+// in the database, by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if rec, ok := applied[mig.Version]; ok {
+			st.AppliedAt = &rec.appliedAt
+			st.Modified = rec.checksum != mig.Checksum
+			delete(applied, mig.Version)
+		}
+		list = append(list, st)
+	}
+	for version, rec := range applied {
+		list = append(list, Status{Version: version, Name: rec.name, AppliedAt: &rec.appliedAt, Unknown: true})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Pending returns the number of migrations not yet applied
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	list, err := m.Status(ctx)
+	n := 0
+	for _, st := range list {
+		if st.AppliedAt == nil {
+			n++
+		}
+	}
+	return n, err
+}
+
+type record struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// locked runs fn on one connection while holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	if err := m.dialect.Lock(ctx, conn); err != nil {
+		return err
+	}
+	defer m.dialect.Unlock(context.Background(), conn)
+	return fn(conn)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]record, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]record{}
+	for rows.Next() {
+		var version int64
+		var rec record
+		if err := rows.Scan(&version, &rec.name, &rec.checksum, &rec.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = rec
+	}
+	return applied, rows.Err()
+}
+
+// verify refuses to run when applied migrations were edited or come from a
+// newer build
+func (m *Migrator) verify(applied map[int64]record) error {
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for version, rec := range applied {
+		mig, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: %04d_%s", ErrUnknownVersion, version, rec.name)
+		}
+		if rec.checksum != mig.Checksum {
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// apply runs one migration script and records (up) or forgets (down) it.
+// Dialects without transactional DDL may leave a failed script half-applied;
+// the error names the statement so it can be repaired by hand.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, script string, up bool) error {
+	type execer interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	}
+	var ex execer = conn
+	var tx *sql.Tx
+	if m.dialect.TransactionalDDL() {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		ex = tx
+	}
+
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	for i, stmt := range splitStatements(script) {
+		if _, err := ex.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %04d_%s %s, statement %d: %w", mig.Version, mig.Name, direction, i+1, err)
+		}
+	}
+	var err error
+	if up {
+		_, err = ex.ExecContext(ctx, `INSERT INTO schema_migrations(version, name, checksum, applied_at) VALUES(`+
+			m.dialect.Placeholder(1)+`, `+m.dialect.Placeholder(2)+`, `+m.dialect.Placeholder(3)+`, `+m.dialect.Placeholder(4)+`)`,
+			mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+	} else {
+		_, err = ex.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = `+m.dialect.Placeholder(1), mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons outside quotes and
+// comments, dropping the comments. Quotes ('', "" and MySQL's backticks)
+// escape themselves by doubling; backslash escapes are not understood.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end - 1 // the newline itself is kept
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += 2 + end + 1
+			cur.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(script); j++ {
+				if script[j] != c {
+					continue
+				}
+				if j+1 < len(script) && script[j+1] == c {
+					j++
+					continue
+				}
+				break
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			cur.WriteString(script[i : j+1])
+			i = j
+		case c == ';':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
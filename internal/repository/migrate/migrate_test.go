@@ -0,0 +1,243 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "chirp.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);\nINSERT INTO notes(body) VALUES('a; b');\n")},
+		"0001_notes.down.sql": {Data: []byte("DROP TABLE notes;\n")},
+		"0002_tags.up.sql":    {Data: []byte("-- tags for notes\nCREATE TABLE tags (name TEXT);\n")},
+		"0002_tags.down.sql":  {Data: []byte("DROP TABLE tags;\n")},
+	}
+}
+
+func newMigrator(t *testing.T, db *sql.DB, files fstest.MapFS) *Migrator {
+	m, err := New(db, SQLite, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m := newMigrator(t, db, testFiles())
+
+	if n, err := m.Pending(ctx); err != nil || n != 2 {
+		t.Fatalf("Pending = %d, %v; want 2", n, err)
+	}
+	done, err := m.Up(ctx)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Up = %v, %v; want 2 applied", done, err)
+	}
+	var body string
+	if err := db.QueryRow(`SELECT body FROM notes`).Scan(&body); err != nil || body != "a; b" {
+		t.Errorf("notes = %q, %v", body, err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("second Up = %v, %v; want nothing to do", done, err)
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil || len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("Down(1) = %v, %v; want 0002 reverted", done, err)
+	}
+	if tableExists(t, db, "tags") || !tableExists(t, db, "notes") {
+		t.Error("Down(1) reverted the wrong migration")
+	}
+	list, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].AppliedAt == nil || list[1].AppliedAt != nil || list[1].Name != "tags" {
+		t.Errorf("Status = %+v", list)
+	}
+
+	if done, err := m.Down(ctx, 5); err != nil || len(done) != 1 || done[0].Version != 1 {
+		t.Errorf("Down(5) = %v, %v; want 0001 reverted", done, err)
+	}
+	if tableExists(t, db, "notes") {
+		t.Error("notes survived Down")
+	}
+}
+
+func TestDownWithoutDownFile(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	files := testFiles()
+	delete(files, "0002_tags.down.sql")
+	m := newMigrator(t, db, files)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Down = %v; want ErrIrreversible", err)
+	}
+}
+
+func TestEditedMigrationRefused(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	if _, err := newMigrator(t, db, testFiles()).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files := testFiles()
+	files["0002_tags.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (name TEXT, color TEXT);\n")}
+	files["0003_more.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE more (id INTEGER);\n")}
+	m := newMigrator(t, db, files)
+	if _, err := m.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Up = %v; want ErrChecksumMismatch", err)
+	}
+	if tableExists(t, db, "more") {
+		t.Error("pending migration applied despite the mismatch")
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Down = %v; want ErrChecksumMismatch", err)
+	}
+	list, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Modified || !list[1].Modified || list[2].AppliedAt != nil {
+		t.Errorf("Status = %+v; want 0002 modified", list)
+	}
+}
+
+func TestUnknownVersionRefused(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	if _, err := newMigrator(t, db, testFiles()).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// an older build that only knows 0001
+	files := testFiles()
+	delete(files, "0002_tags.up.sql")
+	delete(files, "0002_tags.down.sql")
+	m := newMigrator(t, db, files)
+	if _, err := m.Up(ctx); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Up = %v; want ErrUnknownVersion", err)
+	}
+	list, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Unknown || !list[1].Unknown || list[1].Name != "tags" || list[1].AppliedAt == nil {
+		t.Errorf("Status = %+v; want 0002 unknown", list)
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m := newMigrator(t, db, testFiles())
+	if _, err := m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a run holding the lock keeps others waiting
+	if _, err := db.Exec(`CREATE TABLE schema_migrations_lock (id INTEGER PRIMARY KEY, locked_at TIMESTAMP NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations_lock(id, locked_at) VALUES(1, ?)`, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, err := m.Up(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Up while locked = %v; want to wait for the lock", err)
+	}
+	if tableExists(t, db, "notes") {
+		t.Error("migration applied without the lock")
+	}
+
+	// a lock left by a crashed run is taken over once stale
+	if _, err := db.Exec(`UPDATE schema_migrations_lock SET locked_at = ?`, time.Now().UTC().Add(-2*staleLock)); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 2 {
+		t.Fatalf("Up after a stale lock = %v, %v", done, err)
+	}
+	if _, err := m.Down(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent runs apply each migration once
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied int
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := newMigrator(t, db, testFiles()).Up(ctx)
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			applied += len(done)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if applied != 2 {
+		t.Errorf("%d migrations applied by concurrent runs, want 2", applied)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"one per line", "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n", []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"}},
+		{"several on a line", "DROP TABLE a; DROP TABLE b;", []string{"DROP TABLE a", "DROP TABLE b"}},
+		{"no final semicolon", "DROP TABLE a", []string{"DROP TABLE a"}},
+		{"semicolon in a string", "INSERT INTO a VALUES('x;\n', 'it''s; fine');", []string{"INSERT INTO a VALUES('x;\n', 'it''s; fine')"}},
+		{"semicolon in identifiers", "SELECT \"a;b\", `c;d` FROM t;", []string{"SELECT \"a;b\", `c;d` FROM t"}},
+		{"comment lines", "-- setup; not a statement\nDROP TABLE a;\n-- trailing", []string{"DROP TABLE a"}},
+		{"comment after a statement", "DROP TABLE a; -- drop; it\nDROP TABLE b;", []string{"DROP TABLE a", "DROP TABLE b"}},
+		{"block comment", "/* first; */ DROP TABLE a /* ; */;", []string{"DROP TABLE a"}},
+		{"comment marker in a string", "INSERT INTO a VALUES('--;', '/*');", []string{"INSERT INTO a VALUES('--;', '/*')"}},
+		{"empty", "  \n-- nothing\n;\n", nil},
+	}
+	for _, tc := range tests {
+		if got := splitStatements(tc.script); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: splitStatements = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -7,14 +7,15 @@ import (
 	"time"
 
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
 )
 
 type codeRepository struct {
-	db *sql.DB
+	db *dbtx.DB
 }
 
 func NewCodeRepository(db *sql.DB) domain.VerificationCodeRepository {
-	return &codeRepository{db: db}
+	return &codeRepository{db: dbtx.Wrap(db)}
 }
 
 func (r *codeRepository) Save(ctx context.Context, phone, code, purpose string, duration time.Duration) error {
@@ -51,3 +52,12 @@ func (r *codeRepository) Delete(ctx context.Context, phone, purpose string) erro
 	_, err := r.db.ExecContext(ctx, `DELETE FROM verification_codes WHERE phone_number = ? AND purpose = ?`, phone, purpose)
 	return err
 }
+
+func (r *codeRepository) Consume(ctx context.Context, phone, code, purpose string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM verification_codes WHERE phone_number = ? AND purpose = ? AND code = ? AND expires_at > ?`, phone, purpose, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -1,83 +1,159 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/migrate"
 )
 
-func InitDB(dsn string) (*sql.DB, error) {
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Pool sizes a connection pool. Zero fields keep the database/sql defaults.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func (p Pool) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+}
+
+// Open connects to MySQL. The schema is managed by the migrator returned
+// from NewMigrator.
+func Open(dsn string, pool Pool) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
+	pool.apply(db)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
+	return db, nil
+}
 
-	createUsers := `CREATE TABLE IF NOT EXISTS users (
-		id INT PRIMARY KEY AUTO_INCREMENT,
-		name VARCHAR(255),
-		email VARCHAR(255) UNIQUE,
-		password VARCHAR(255),
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		phone_number VARCHAR(50),
-		school VARCHAR(255),
-		student_id VARCHAR(50),
-		birthdate VARCHAR(50),
-		address TEXT,
-		gender VARCHAR(20)
-	);`
-
-	createResources := `CREATE TABLE IF NOT EXISTS resources (
-		id INT PRIMARY KEY AUTO_INCREMENT,
-		owner_id INT,
-		title VARCHAR(255),
-		description TEXT,
-		filename VARCHAR(255),
-		original_name VARCHAR(255),
-		size BIGINT,
-		file_hash VARCHAR(255),
-		status VARCHAR(50) DEFAULT 'PENDING',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		subject VARCHAR(255),
-		type VARCHAR(50),
-		FOREIGN KEY(owner_id) REFERENCES users(id)
-	);`
-
-	createNotifications := `CREATE TABLE IF NOT EXISTS notifications (
-		id INT PRIMARY KEY AUTO_INCREMENT,
-		user_id INT,
-		content TEXT,
-		is_read BOOLEAN DEFAULT FALSE,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
-
-	createCodes := `CREATE TABLE IF NOT EXISTS verification_codes (
-		id INT PRIMARY KEY AUTO_INCREMENT,
-		phone_number VARCHAR(50),
-		code VARCHAR(10),
-		purpose VARCHAR(20),
-		expires_at DATETIME,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		INDEX idx_phone_purpose (phone_number, purpose)
-	);`
+// OpenReplicas opens a pool per read replica. Unlike Open it does not
+// connect: a replica that is down at startup is left to the health checks
+// of dbtx.Route.
+func OpenReplicas(dsns []string, pool Pool) ([]*sql.DB, error) {
+	var dbs []*sql.DB
+	for _, dsn := range dsns {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			for _, d := range dbs {
+				d.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %w", len(dbs)+1, err)
+		}
+		pool.apply(db)
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
 
-	if _, err := db.Exec(createUsers); err != nil {
-		return nil, fmt.Errorf("create users table: %w", err)
+// NewMigrator returns the migrator for the MySQL schema in migrations/
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
 	}
-	if _, err := db.Exec(createResources); err != nil {
-		return nil, fmt.Errorf("create resources table: %w", err)
+	m, err := migrate.New(db, migrate.MySQL, files)
+	if err != nil {
+		return nil, err
+	}
+	m.Legacy = upgradeLegacy
+	return m, nil
+}
+
+// upgradeLegacy applies what the hand-run scripts/migrate_v2..v9 scripts of
+// earlier releases did, skipping columns that are already there, so those
+// databases match the baseline migration
+func upgradeLegacy(ctx context.Context, conn *sql.Conn) error {
+	for _, t := range []struct {
+		table   string
+		columns []struct{ name, definition string }
+	}{
+		{"users", []struct{ name, definition string }{
+			{"role", "VARCHAR(20) NOT NULL DEFAULT 'USER'"},
+			{"suspended_at", "DATETIME NULL"},
+			{"suspended_until", "DATETIME NULL"},
+			{"suspend_reason", "VARCHAR(500)"},
+			{"tokens_revoked_at", "DATETIME NULL"},
+		}},
+		{"resources", []struct{ name, definition string }{
+			{"review_round", "INT NOT NULL DEFAULT 1"},
+			{"rating_sum", "INT NOT NULL DEFAULT 0"},
+			{"rating_count", "INT NOT NULL DEFAULT 0"},
+			{"like_count", "INT NOT NULL DEFAULT 0"},
+			{"comment_count", "INT NOT NULL DEFAULT 0"},
+			{"favorite_count", "INT NOT NULL DEFAULT 0"},
+			{"download_count", "INT NOT NULL DEFAULT 0"},
+			{"view_count", "INT NOT NULL DEFAULT 0"},
+			{"subject_id", "INT NULL"},
+			{"type_id", "INT NULL"},
+		}},
+	} {
+		existing, err := columns(ctx, conn, t.table)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			continue // new database; the baseline creates the table
+		}
+		for _, col := range t.columns {
+			if existing[col.name] {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "ALTER TABLE "+t.table+" ADD COLUMN "+col.name+" "+col.definition); err != nil {
+				return fmt.Errorf("add %s.%s: %w", t.table, col.name, err)
+			}
+		}
 	}
-	if _, err := db.Exec(createNotifications); err != nil {
-		return nil, fmt.Errorf("create notifications table: %w", err)
+	// Verification codes are sent to email addresses as well (v3)
+	existing, err := columns(ctx, conn, "verification_codes")
+	if err != nil {
+		return err
 	}
-	if _, err := db.Exec(createCodes); err != nil {
-		return nil, fmt.Errorf("create verification_codes table: %w", err)
+	if existing["phone_number"] {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE verification_codes MODIFY phone_number VARCHAR(255)`); err != nil {
+			return fmt.Errorf("widen verification_codes.phone_number: %w", err)
+		}
 	}
+	return nil
+}
 
-	return db, nil
+// columns returns the column names of table, or none when it does not exist
+func columns(ctx context.Context, conn *sql.Conn, table string) (map[string]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
 }
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type identityRepository struct {
+	db *dbtx.DB
+}
+
+func NewIdentityRepository(db *sql.DB) domain.UserIdentityRepository {
+	return &identityRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.CreatedAt = time.Now()
+	res, err := r.db.ExecContext(ctx, `INSERT INTO user_identities(user_id,provider,subject,email,created_at) VALUES(?,?,?,?,?)`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	identity.ID = id
+	return nil
+}
+
+func (r *identityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT id,user_id,provider,subject,COALESCE(email,''),created_at FROM user_identities WHERE provider = ? AND subject = ?`, provider, subject)
+	identity := &domain.UserIdentity{}
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *identityRepository) ListByUser(ctx context.Context, userID int64) ([]domain.UserIdentity, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id,user_id,provider,subject,COALESCE(email,''),created_at FROM user_identities WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.UserIdentity
+	for rows.Next() {
+		var identity domain.UserIdentity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, identity)
+	}
+	return list, rows.Err()
+}
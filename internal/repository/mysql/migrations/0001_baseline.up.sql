@@ -0,0 +1,295 @@
+-- Schema as of the introduction of versioned migrations. Tables use IF NOT
+-- EXISTS so databases created by earlier releases are adopted in place.
+
+CREATE TABLE IF NOT EXISTS users (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  name VARCHAR(255),
+  email VARCHAR(255) UNIQUE,
+  password VARCHAR(255),
+  role VARCHAR(20) NOT NULL DEFAULT 'USER',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  phone_number VARCHAR(50),
+  school VARCHAR(255),
+  student_id VARCHAR(50),
+  birthdate VARCHAR(50),
+  address TEXT,
+  gender VARCHAR(20),
+  suspended_at DATETIME NULL,
+  suspended_until DATETIME NULL,
+  suspend_reason VARCHAR(500),
+  tokens_revoked_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS resources (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  owner_id INT,
+  title VARCHAR(255),
+  description TEXT,
+  filename VARCHAR(255),
+  original_name VARCHAR(255),
+  size BIGINT,
+  file_hash VARCHAR(255),
+  status VARCHAR(50) DEFAULT 'PENDING',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  subject VARCHAR(255),
+  type VARCHAR(50),
+  review_round INT NOT NULL DEFAULT 1,
+  rating_sum INT NOT NULL DEFAULT 0,
+  rating_count INT NOT NULL DEFAULT 0,
+  like_count INT NOT NULL DEFAULT 0,
+  comment_count INT NOT NULL DEFAULT 0,
+  favorite_count INT NOT NULL DEFAULT 0,
+  download_count INT NOT NULL DEFAULT 0,
+  view_count INT NOT NULL DEFAULT 0,
+  subject_id INT NULL,
+  type_id INT NULL,
+  FOREIGN KEY(owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT,
+  content TEXT,
+  is_read BOOLEAN DEFAULT FALSE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS verification_codes (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  phone_number VARCHAR(255),
+  code VARCHAR(10),
+  purpose VARCHAR(20),
+  expires_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_phone_purpose (phone_number, purpose)
+);
+
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id INT PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  enabled BOOLEAN DEFAULT FALSE,
+  last_used_step BIGINT DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at DATETIME NULL,
+  INDEX idx_user_hash (user_id, code_hash),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  provider VARCHAR(64) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_provider_subject (provider, subject),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  prefix VARCHAR(32) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  scopes VARCHAR(255) NOT NULL,
+  mfa BOOLEAN DEFAULT FALSE,
+  expires_at DATETIME NULL,
+  last_used_at DATETIME NULL,
+  last_used_ip VARCHAR(64),
+  revoked_at DATETIME NULL,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_user (user_id),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  role VARCHAR(20) NOT NULL,
+  subject VARCHAR(100) NOT NULL DEFAULT '',
+  granted_by INT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_user_role_subject (user_id, role, subject),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  actor_id INT,
+  action VARCHAR(64) NOT NULL,
+  target_type VARCHAR(64) NOT NULL DEFAULT '',
+  target_id VARCHAR(255) NOT NULL DEFAULT '',
+  before_state MEDIUMTEXT,
+  after_state MEDIUMTEXT,
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  request_id VARCHAR(64) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL,
+  prev_hash CHAR(64) NOT NULL,
+  hash CHAR(64) NOT NULL,
+  UNIQUE KEY uniq_prev_hash (prev_hash),
+  KEY idx_audit_actor (actor_id),
+  KEY idx_audit_target (target_type, target_id),
+  KEY idx_audit_created (created_at)
+);
+
+CREATE TABLE IF NOT EXISTS resource_reviews (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  resource_id INT NOT NULL,
+  reviewer_id INT NOT NULL,
+  round INT NOT NULL,
+  decision VARCHAR(20) NOT NULL,
+  reason_code VARCHAR(32) NOT NULL DEFAULT '',
+  comment TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  INDEX idx_resource (resource_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(reviewer_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS review_policies (
+  subject VARCHAR(100) PRIMARY KEY,
+  required_approvals INT NOT NULL,
+  updated_by INT,
+  updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS resource_reports (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  resource_id INT NOT NULL,
+  reporter_id INT NOT NULL,
+  reason VARCHAR(32) NOT NULL,
+  detail TEXT NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'OPEN',
+  created_at DATETIME NOT NULL,
+  resolved_by INT,
+  resolved_at DATETIME NULL,
+  UNIQUE KEY uniq_resource_reporter (resource_id, reporter_id),
+  KEY idx_report_status (status),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(reporter_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_ratings (
+  resource_id INT NOT NULL,
+  user_id INT NOT NULL,
+  stars TINYINT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  PRIMARY KEY(resource_id, user_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_likes (
+  resource_id INT NOT NULL,
+  user_id INT NOT NULL,
+  created_at DATETIME NOT NULL,
+  PRIMARY KEY(resource_id, user_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_comments (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  resource_id INT NOT NULL,
+  user_id INT NOT NULL,
+  parent_id INT,
+  content TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  edited_at DATETIME NULL,
+  deleted_at DATETIME NULL,
+  deleted_by INT,
+  INDEX idx_comment_resource (resource_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id),
+  FOREIGN KEY(parent_id) REFERENCES resource_comments(id)
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  owner_id INT NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL,
+  visibility VARCHAR(20) NOT NULL DEFAULT 'PRIVATE',
+  share_token VARCHAR(64) NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  UNIQUE KEY uniq_share_token (share_token),
+  KEY idx_collection_owner (owner_id),
+  FOREIGN KEY(owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+  collection_id INT NOT NULL,
+  resource_id INT NOT NULL,
+  position INT NOT NULL,
+  added_at DATETIME NOT NULL,
+  PRIMARY KEY(collection_id, resource_id),
+  KEY idx_item_resource (resource_id),
+  FOREIGN KEY(collection_id) REFERENCES collections(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_daily_stats (
+  resource_id INT NOT NULL,
+  day CHAR(10) NOT NULL,
+  downloads INT NOT NULL DEFAULT 0,
+  views INT NOT NULL DEFAULT 0,
+  PRIMARY KEY(resource_id, day),
+  KEY idx_stats_day (day)
+);
+
+CREATE TABLE IF NOT EXISTS subjects (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  parent_id INT NULL,
+  kind VARCHAR(20) NOT NULL,
+  slug VARCHAR(100) NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  names TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  UNIQUE KEY uniq_subject_slug (slug),
+  FOREIGN KEY(parent_id) REFERENCES subjects(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_types (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  slug VARCHAR(100) NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  names TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  UNIQUE KEY uniq_type_slug (slug)
+);
+
+CREATE TABLE IF NOT EXISTS taxonomy_aliases (
+  scope VARCHAR(20) NOT NULL,
+  alias VARCHAR(255) NOT NULL,
+  target_id INT NOT NULL,
+  PRIMARY KEY(scope, alias)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  name VARCHAR(64) NOT NULL,
+  resource_count INT NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  UNIQUE KEY uniq_tag_name (name)
+);
+
+CREATE TABLE IF NOT EXISTS resource_tags (
+  resource_id INT NOT NULL,
+  tag_id INT NOT NULL,
+  PRIMARY KEY(resource_id, tag_id),
+  KEY idx_resource_tags_tag (tag_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(tag_id) REFERENCES tags(id)
+);
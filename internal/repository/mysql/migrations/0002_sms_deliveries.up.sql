@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sms_deliveries (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  phone VARCHAR(32) NOT NULL,
+  purpose VARCHAR(20) NOT NULL DEFAULT '',
+  provider VARCHAR(32) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  message_id VARCHAR(128) NOT NULL DEFAULT '',
+  request_id VARCHAR(128) NOT NULL DEFAULT '',
+  error VARCHAR(1000) NOT NULL DEFAULT '',
+  duration_ms INT NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  KEY idx_sms_deliveries_phone (phone)
+);
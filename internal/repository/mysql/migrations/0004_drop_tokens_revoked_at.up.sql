@@ -0,0 +1,2 @@
+-- Session revocation is tracked by token_version since 0003
+ALTER TABLE users DROP COLUMN tokens_revoked_at;
@@ -4,22 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
 )
 
 type resourceRepository struct {
-	db *sql.DB
+	db *dbtx.DB
 }
 
 func NewResourceRepository(db *sql.DB) domain.ResourceRepository {
-	return &resourceRepository{db: db}
+	return &resourceRepository{db: dbtx.Wrap(db)}
+}
+
+const resourceColumns = `id,owner_id,title,description,filename,original_name,size,file_hash,status,created_at,COALESCE(subject,''),COALESCE(type,''),review_round,rating_sum,rating_count,like_count,comment_count,favorite_count,download_count,view_count,subject_id,type_id`
+
+// resourceSorts maps each sort order to its ORDER BY clause
+var resourceSorts = map[domain.ResourceSort]string{
+	domain.SortNewest:    `created_at DESC, id DESC`,
+	domain.SortRating:    `CASE WHEN rating_count > 0 THEN rating_sum * 1.0 / rating_count ELSE 0 END DESC, rating_count DESC, id DESC`,
+	domain.SortLikes:     `like_count DESC, id DESC`,
+	domain.SortComments:  `comment_count DESC, id DESC`,
+	domain.SortFavorites: `favorite_count DESC, id DESC`,
+	domain.SortDownloads: `download_count DESC, id DESC`,
 }
 
 func (r *resourceRepository) Create(ctx context.Context, res *domain.Resource) error {
-	stmt := `INSERT INTO resources(owner_id,title,description,filename,original_name,size,file_hash,status,created_at,subject,type) VALUES(?,?,?,?,?,?,?,?,?,?,?)`
-	result, err := r.db.ExecContext(ctx, stmt, res.OwnerID, res.Title, res.Description, res.Filename, res.OriginalName, res.Size, res.FileHash, res.Status, time.Now(), res.Subject, res.Type)
+	res.CreatedAt = time.Now()
+	stmt := `INSERT INTO resources(owner_id,title,description,filename,original_name,size,file_hash,status,created_at,subject,type,review_round,subject_id,type_id) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	result, err := r.db.ExecContext(ctx, stmt, res.OwnerID, res.Title, res.Description, res.Filename, res.OriginalName, res.Size, res.FileHash, res.Status, res.CreatedAt, res.Subject, res.Type, res.ReviewRound, res.SubjectID, res.TypeID)
 	if err != nil {
 		return err
 	}
@@ -28,46 +43,59 @@ func (r *resourceRepository) Create(ctx context.Context, res *domain.Resource) e
 	return nil
 }
 
-func (r *resourceRepository) List(ctx context.Context, status domain.ResourceStatus, search string) ([]domain.Resource, error) {
-	query := `SELECT id,owner_id,title,description,filename,original_name,size,file_hash,status,created_at,COALESCE(subject,''),COALESCE(type,'') FROM resources WHERE 1=1`
+func (r *resourceRepository) List(ctx context.Context, f domain.ResourceFilter) ([]domain.Resource, error) {
+	query := `SELECT ` + resourceColumns + ` FROM resources WHERE 1=1`
 	args := []interface{}{}
 
-	if status != "" {
+	if f.Status != "" {
 		query += ` AND status = ?`
-		args = append(args, status)
+		args = append(args, f.Status)
+	}
+	if f.Search != "" {
+		like := "%" + likeEscaper.Replace(f.Search) + "%"
+		query += ` AND (title LIKE ? ESCAPE '!' OR description LIKE ? ESCAPE '!')`
+		args = append(args, like, like)
+	}
+	if len(f.Tags) > 0 {
+		query += ` AND id IN (SELECT rt.resource_id FROM resource_tags rt JOIN tags t ON t.id = rt.tag_id WHERE t.name IN (` + placeholders(len(f.Tags)) + `)`
+		for _, tag := range f.Tags {
+			args = append(args, tag)
+		}
+		if f.AllTags {
+			query += ` GROUP BY rt.resource_id HAVING COUNT(*) = ?`
+			args = append(args, len(f.Tags))
+		}
+		query += `)`
 	}
-	if search != "" {
-		query += ` AND (title LIKE ? OR description LIKE ?)`
-		args = append(args, "%"+search+"%", "%"+search+"%")
+	order, ok := resourceSorts[f.Sort]
+	if !ok {
+		order = resourceSorts[domain.SortNewest]
 	}
-	query += ` ORDER BY created_at DESC`
+	query += ` ORDER BY ` + order
+
+	return r.list(ctx, query, args...)
+}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+func (r *resourceRepository) GetByID(ctx context.Context, id int64) (*domain.Resource, error) {
+	res, err := scanResource(r.db.Reader(ctx).QueryRowContext(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id = ?`, id))
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var list []domain.Resource
-	for rows.Next() {
-		var res domain.Resource
-		if err := rows.Scan(&res.ID, &res.OwnerID, &res.Title, &res.Description, &res.Filename, &res.OriginalName, &res.Size, &res.FileHash, &res.Status, &res.CreatedAt, &res.Subject, &res.Type); err != nil {
-			return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
-		list = append(list, res)
+		return nil, err
 	}
-	return list, nil
+	return res, nil
 }
 
-func (r *resourceRepository) GetByID(ctx context.Context, id int64) (*domain.Resource, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id,owner_id,title,description,filename,original_name,size,file_hash,status,created_at,COALESCE(subject,''),COALESCE(type,'') FROM resources WHERE id = ?`, id)
-	var res domain.Resource
-	if err := row.Scan(&res.ID, &res.OwnerID, &res.Title, &res.Description, &res.Filename, &res.OriginalName, &res.Size, &res.FileHash, &res.Status, &res.CreatedAt, &res.Subject, &res.Type); err != nil {
+func (r *resourceRepository) GetByIDForUpdate(ctx context.Context, id int64) (*domain.Resource, error) {
+	res, err := scanResource(r.db.QueryRowContext(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id = ? FOR UPDATE`, id))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &res, nil
+	return res, nil
 }
 
 func (r *resourceRepository) UpdateStatus(ctx context.Context, id int64, status domain.ResourceStatus) error {
@@ -75,19 +103,70 @@ func (r *resourceRepository) UpdateStatus(ctx context.Context, id int64, status
 	return err
 }
 
+func (r *resourceRepository) Resubmit(ctx context.Context, res *domain.Resource) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET title = ?, description = ?, filename = ?, original_name = ?, size = ?, file_hash = ?, subject = ?, type = ?, subject_id = ?, type_id = ?, status = ?, review_round = ? WHERE id = ?`,
+		res.Title, res.Description, res.Filename, res.OriginalName, res.Size, res.FileHash, res.Subject, res.Type, res.SubjectID, res.TypeID, domain.ResourceStatusPending, res.ReviewRound, res.ID)
+	if err != nil {
+		return err
+	}
+	res.Status = domain.ResourceStatusPending
+	return nil
+}
+
+func (r *resourceRepository) Reopen(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET status = ?, review_round = review_round + 1 WHERE id = ?`, domain.ResourceStatusPending, id)
+	return err
+}
+
 func (r *resourceRepository) GetByHash(ctx context.Context, hash string) ([]domain.Resource, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id,owner_id,title,description,filename,original_name,size,file_hash,status,created_at,COALESCE(subject,''),COALESCE(type,'') FROM resources WHERE file_hash = ?`, hash)
+	return r.list(ctx, `SELECT `+resourceColumns+` FROM resources WHERE file_hash = ?`, hash)
+}
+
+func (r *resourceRepository) ListByIDs(ctx context.Context, ids []int64) ([]domain.Resource, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return r.list(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id IN (?`+strings.Repeat(",?", len(ids)-1)+`)`, args...)
+}
+
+// list runs a read-only query, on a replica when reads are routed
+func (r *resourceRepository) list(ctx context.Context, query string, args ...any) ([]domain.Resource, error) {
+	rows, err := r.db.Reader(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var list []domain.Resource
 	for rows.Next() {
-		var res domain.Resource
-		if err := rows.Scan(&res.ID, &res.OwnerID, &res.Title, &res.Description, &res.Filename, &res.OriginalName, &res.Size, &res.FileHash, &res.Status, &res.CreatedAt, &res.Subject, &res.Type); err != nil {
+		res, err := scanResource(rows)
+		if err != nil {
 			return nil, err
 		}
-		list = append(list, res)
+		list = append(list, *res)
 	}
-	return list, nil
+	return list, rows.Err()
+}
+
+func scanResource(row rowScanner) (*domain.Resource, error) {
+	var res domain.Resource
+	var ratingSum int64
+	var subjectID, typeID sql.NullInt64
+	if err := row.Scan(&res.ID, &res.OwnerID, &res.Title, &res.Description, &res.Filename, &res.OriginalName, &res.Size, &res.FileHash, &res.Status, &res.CreatedAt, &res.Subject, &res.Type, &res.ReviewRound,
+		&ratingSum, &res.RatingCount, &res.LikeCount, &res.CommentCount, &res.FavoriteCount, &res.DownloadCount, &res.ViewCount, &subjectID, &typeID); err != nil {
+		return nil, err
+	}
+	if subjectID.Valid {
+		res.SubjectID = &subjectID.Int64
+	}
+	if typeID.Valid {
+		res.TypeID = &typeID.Int64
+	}
+	if res.RatingCount > 0 {
+		res.RatingAvg = float64(ratingSum) / float64(res.RatingCount)
+	}
+	return &res, nil
 }
@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+// openMigrated opens and migrates an embedded database
+func openMigrated(t *testing.T) *sql.DB {
+	db, err := Open(startEmbedded(t), Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestGetByIDForUpdateReadsPrimary(t *testing.T) {
+	primary, replica := openMigrated(t), openMigrated(t)
+	ctx := domain.WithSession(context.Background(), 7)
+
+	// the replica lags behind: it still has the resource pending
+	for _, db := range []*sql.DB{primary, replica} {
+		res := &domain.Resource{Title: "notes", Status: domain.ResourceStatusPending, ReviewRound: 1}
+		if err := NewResourceRepository(db).Create(context.Background(), res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := primary.Exec(`UPDATE resources SET status = ? WHERE id = 1`, domain.ResourceStatusApproved); err != nil {
+		t.Fatal(err)
+	}
+
+	r := dbtx.Route(primary, []*sql.DB{replica}, dbtx.ReplicaOptions{Stickiness: time.Minute, CheckInterval: time.Minute})
+	t.Cleanup(func() { r.Close() })
+	repo := NewResourceRepository(primary)
+
+	if res, err := repo.GetByID(ctx, 1); err != nil || res == nil || res.Status != domain.ResourceStatusPending {
+		t.Fatalf("GetByID = %+v, %v; want the replica's pending copy", res, err)
+	}
+	if res, err := repo.GetByIDForUpdate(ctx, 1); err != nil || res == nil || res.Status != domain.ResourceStatusApproved {
+		t.Errorf("GetByIDForUpdate = %+v, %v; want the primary's approved row", res, err)
+	}
+}
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type twoFactorRepository struct {
+	db *dbtx.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) domain.TwoFactorRepository {
+	return &twoFactorRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *twoFactorRepository) Get(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT user_id,secret,enabled,last_used_step,created_at FROM two_factor WHERE user_id = ?`, userID)
+	tf := &domain.TwoFactor{}
+	if err := row.Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastUsedStep, &tf.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tf, nil
+}
+
+func (r *twoFactorRepository) Save(ctx context.Context, tf *domain.TwoFactor) error {
+	if tf.CreatedAt.IsZero() {
+		tf.CreatedAt = time.Now()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO two_factor(user_id,secret,enabled,last_used_step,created_at) VALUES(?,?,?,?,?)
+		ON DUPLICATE KEY UPDATE secret=VALUES(secret), enabled=VALUES(enabled), last_used_step=VALUES(last_used_step)`,
+		tf.UserID, tf.Secret, tf.Enabled, tf.LastUsedStep, tf.CreatedAt)
+	return err
+}
+
+func (r *twoFactorRepository) Delete(ctx context.Context, userID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM two_factor WHERE user_id = ?`, userID)
+	return err
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO two_factor_recovery_codes(user_id,code_hash) VALUES(?,?)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE two_factor_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, time.Now(), userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type apiTokenRepository struct {
+	db *dbtx.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) domain.APITokenRepository {
+	return &apiTokenRepository{db: dbtx.Wrap(db)}
+}
+
+const apiTokenColumns = `id,user_id,name,prefix,token_hash,scopes,mfa,expires_at,last_used_at,COALESCE(last_used_ip,''),revoked_at,created_at`
+
+func (r *apiTokenRepository) Create(ctx context.Context, t *domain.APIToken) error {
+	t.CreatedAt = time.Now()
+	return r.db.QueryRowContext(ctx, `INSERT INTO api_tokens(user_id,name,prefix,token_hash,scopes,mfa,expires_at,created_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id`,
+		t.UserID, t.Name, t.Prefix, t.TokenHash, strings.Join(t.Scopes, ","), t.MFA, t.ExpiresAt, t.CreatedAt).Scan(&t.ID)
+}
+
+func (r *apiTokenRepository) GetByHash(ctx context.Context, hash string) (*domain.APIToken, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = $1`, hash)
+	t, err := scanAPIToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *apiTokenRepository) ListByUser(ctx context.Context, userID int64) ([]domain.APIToken, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = $1 ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+func (r *apiTokenRepository) Revoke(ctx context.Context, userID, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *apiTokenRepository) RevokeAll(ctx context.Context, userID int64) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *apiTokenRepository) TouchLastUsed(ctx context.Context, id int64, at time.Time, ip string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`, at, ip, id)
+	return err
+}
+
+func scanAPIToken(row rowScanner) (*domain.APIToken, error) {
+	var (
+		t          domain.APIToken
+		scopes     string
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, &scopes, &t.MFA, &expiresAt, &lastUsedAt, &t.LastUsedIP, &revokedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
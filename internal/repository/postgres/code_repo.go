@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type codeRepository struct {
+	db *dbtx.DB
+}
+
+func NewCodeRepository(db *sql.DB) domain.VerificationCodeRepository {
+	return &codeRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *codeRepository) Save(ctx context.Context, phone, code, purpose string, duration time.Duration) error {
+	// Invalidate previous codes for this phone/purpose
+	_, err := r.db.ExecContext(ctx, `DELETE FROM verification_codes WHERE phone_number = $1 AND purpose = $2`, phone, purpose)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(duration)
+	_, err = r.db.ExecContext(ctx, `INSERT INTO verification_codes (phone_number, code, purpose, expires_at) VALUES ($1, $2, $3, $4)`, phone, code, purpose, expiresAt)
+	return err
+}
+
+func (r *codeRepository) Get(ctx context.Context, phone, purpose string) (string, error) {
+	var code string
+	var expiresAt time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT code, expires_at FROM verification_codes WHERE phone_number = $1 AND purpose = $2 ORDER BY created_at DESC LIMIT 1`, phone, purpose).Scan(&code, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if time.Now().After(expiresAt) {
+		return "", nil // Expired
+	}
+
+	return code, nil
+}
+
+func (r *codeRepository) Delete(ctx context.Context, phone, purpose string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM verification_codes WHERE phone_number = $1 AND purpose = $2`, phone, purpose)
+	return err
+}
+
+func (r *codeRepository) Consume(ctx context.Context, phone, code, purpose string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM verification_codes WHERE phone_number = $1 AND purpose = $2 AND code = $3 AND expires_at > $4`, phone, purpose, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type commentRepository struct {
+	db *dbtx.DB
+}
+
+func NewCommentRepository(db *sql.DB) domain.CommentRepository {
+	return &commentRepository{db: dbtx.Wrap(db)}
+}
+
+const commentColumns = `id,resource_id,user_id,parent_id,content,created_at,edited_at,deleted_at,deleted_by`
+
+func (r *commentRepository) Create(ctx context.Context, c *domain.Comment) error {
+	c.CreatedAt = time.Now()
+	if err := r.db.QueryRowContext(ctx, `INSERT INTO resource_comments(resource_id,user_id,parent_id,content,created_at) VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		c.ResourceID, c.UserID, c.ParentID, c.Content, c.CreatedAt).Scan(&c.ID); err != nil {
+		return err
+	}
+	return r.refreshCount(ctx, c.ResourceID)
+}
+
+func (r *commentRepository) GetByID(ctx context.Context, id int64) (*domain.Comment, error) {
+	c, err := scanComment(r.db.QueryRowContext(ctx, `SELECT `+commentColumns+` FROM resource_comments WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *commentRepository) UpdateContent(ctx context.Context, c *domain.Comment) error {
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, `UPDATE resource_comments SET content = $1, edited_at = $2 WHERE id = $3`, c.Content, now, c.ID); err != nil {
+		return err
+	}
+	c.EditedAt = &now
+	return nil
+}
+
+// Delete clears the content and marks the comment deleted; the row stays so
+// its replies keep their parent
+func (r *commentRepository) Delete(ctx context.Context, id int64, deletedBy int64) error {
+	var resourceID int64
+	if err := r.db.QueryRowContext(ctx, `SELECT resource_id FROM resource_comments WHERE id = $1`, id).Scan(&resourceID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE resource_comments SET content = '', deleted_at = $1, deleted_by = $2 WHERE id = $3 AND deleted_at IS NULL`, time.Now(), deletedBy, id); err != nil {
+		return err
+	}
+	return r.refreshCount(ctx, resourceID)
+}
+
+func (r *commentRepository) ListByResource(ctx context.Context, resourceID int64) ([]domain.Comment, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+commentColumns+` FROM resource_comments WHERE resource_id = $1 ORDER BY id`, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+func (r *commentRepository) refreshCount(ctx context.Context, resourceID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET comment_count = (SELECT COUNT(*) FROM resource_comments WHERE resource_id = $1 AND deleted_at IS NULL) WHERE id = $2`, resourceID, resourceID)
+	return err
+}
+
+func scanComment(row rowScanner) (*domain.Comment, error) {
+	var c domain.Comment
+	var parentID, deletedBy sql.NullInt64
+	var editedAt, deletedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.ResourceID, &c.UserID, &parentID, &c.Content, &c.CreatedAt, &editedAt, &deletedAt, &deletedBy); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		c.ParentID = &parentID.Int64
+	}
+	if editedAt.Valid {
+		c.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
+	}
+	if deletedBy.Valid {
+		c.DeletedBy = &deletedBy.Int64
+	}
+	return &c, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/repotest"
+)
+
+// TestConformance runs the shared repository suite on the server in
+// POSTGRES_TEST_DSN, each test in a fresh schema. The test workflow sets it
+// to a postgres service container.
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db, err := Open(createSchema(t, dsn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return repotest.Repos{
+			Users:         NewUserRepository(db),
+			Roles:         NewRoleRepository(db),
+			Audit:         NewAuditRepository(db),
+			Codes:         NewCodeRepository(db),
+			Identities:    NewIdentityRepository(db),
+			APITokens:     NewAPITokenRepository(db),
+			TwoFactor:     NewTwoFactorRepository(db),
+			Resources:     NewResourceRepository(db),
+			Reviews:       NewReviewRepository(db),
+			Reports:       NewReportRepository(db),
+			Reactions:     NewReactionRepository(db),
+			Comments:      NewCommentRepository(db),
+			Collections:   NewCollectionRepository(db),
+			Taxonomy:      NewTaxonomyRepository(db),
+			Tags:          NewTagRepository(db),
+			Analytics:     NewAnalyticsRepository(db),
+			Notifications: NewNotificationRepository(db),
+			SMSDeliveries: NewSMSDeliveryRepository(db),
+			Tx:            dbtx.NewManager(db),
+		}
+	})
+}
+
+var schemaSeq atomic.Int64
+
+// createSchema creates a scratch schema, dropped when the test ends, and
+// returns dsn with the schema as its search path
+func createSchema(t *testing.T, dsn string) string {
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("chirp_test_%d_%d", time.Now().Unix(), schemaSeq.Add(1))
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + name + " CASCADE") })
+
+	// lib/pq passes unknown settings on as run-time parameters
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", name)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + name
+}
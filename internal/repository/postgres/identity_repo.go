@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type identityRepository struct {
+	db *dbtx.DB
+}
+
+func NewIdentityRepository(db *sql.DB) domain.UserIdentityRepository {
+	return &identityRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	identity.CreatedAt = time.Now()
+	return r.db.QueryRowContext(ctx, `INSERT INTO user_identities(user_id,provider,subject,email,created_at) VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt).Scan(&identity.ID)
+}
+
+func (r *identityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT id,user_id,provider,subject,COALESCE(email,''),created_at FROM user_identities WHERE provider = $1 AND subject = $2`, provider, subject)
+	identity := &domain.UserIdentity{}
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *identityRepository) ListByUser(ctx context.Context, userID int64) ([]domain.UserIdentity, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id,user_id,provider,subject,COALESCE(email,''),created_at FROM user_identities WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.UserIdentity
+	for rows.Next() {
+		var identity domain.UserIdentity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, identity)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS resource_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS taxonomy_aliases;
+DROP TABLE IF EXISTS resource_types;
+DROP TABLE IF EXISTS subjects;
+DROP TABLE IF EXISTS resource_daily_stats;
+DROP TABLE IF EXISTS collection_items;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS resource_comments;
+DROP TABLE IF EXISTS resource_likes;
+DROP TABLE IF EXISTS resource_ratings;
+DROP TABLE IF EXISTS resource_reports;
+DROP TABLE IF EXISTS review_policies;
+DROP TABLE IF EXISTS resource_reviews;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS two_factor;
+DROP TABLE IF EXISTS verification_codes;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS resources;
+DROP TABLE IF EXISTS users;
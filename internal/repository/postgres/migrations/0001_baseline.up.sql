@@ -0,0 +1,289 @@
+-- Initial PostgreSQL schema, equivalent to the MySQL and SQLite baselines.
+-- Times are TIMESTAMPTZ; resources carry a generated tsvector for search.
+
+CREATE TABLE users (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255),
+  email VARCHAR(255) UNIQUE,
+  password VARCHAR(255),
+  role VARCHAR(20) NOT NULL DEFAULT 'USER',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  phone_number VARCHAR(50),
+  school VARCHAR(255),
+  student_id VARCHAR(50),
+  birthdate VARCHAR(50),
+  address TEXT,
+  gender VARCHAR(20),
+  suspended_at TIMESTAMPTZ,
+  suspended_until TIMESTAMPTZ,
+  suspend_reason VARCHAR(500),
+  tokens_revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_users_phone ON users(phone_number);
+
+CREATE TABLE resources (
+  id BIGSERIAL PRIMARY KEY,
+  owner_id BIGINT REFERENCES users(id),
+  title VARCHAR(255),
+  description TEXT,
+  filename VARCHAR(255),
+  original_name VARCHAR(255),
+  size BIGINT,
+  file_hash VARCHAR(255),
+  status VARCHAR(50) NOT NULL DEFAULT 'PENDING',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  subject VARCHAR(255),
+  type VARCHAR(50),
+  review_round INT NOT NULL DEFAULT 1,
+  rating_sum INT NOT NULL DEFAULT 0,
+  rating_count INT NOT NULL DEFAULT 0,
+  like_count INT NOT NULL DEFAULT 0,
+  comment_count INT NOT NULL DEFAULT 0,
+  favorite_count INT NOT NULL DEFAULT 0,
+  download_count INT NOT NULL DEFAULT 0,
+  view_count INT NOT NULL DEFAULT 0,
+  subject_id BIGINT,
+  type_id BIGINT,
+  search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', COALESCE(title, '') || ' ' || COALESCE(description, ''))
+  ) STORED
+);
+
+CREATE INDEX idx_resources_status ON resources(status);
+CREATE INDEX idx_resources_hash ON resources(file_hash);
+CREATE INDEX idx_resources_search ON resources USING GIN(search);
+
+CREATE TABLE notifications (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT REFERENCES users(id),
+  content TEXT,
+  is_read BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_notifications_user ON notifications(user_id);
+
+CREATE TABLE verification_codes (
+  id BIGSERIAL PRIMARY KEY,
+  phone_number VARCHAR(255),
+  code VARCHAR(10),
+  purpose VARCHAR(20),
+  expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_phone_purpose ON verification_codes(phone_number, purpose);
+
+CREATE TABLE two_factor (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id),
+  secret VARCHAR(64) NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE two_factor_recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_user_hash ON two_factor_recovery_codes(user_id, code_hash);
+
+CREATE TABLE user_identities (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  provider VARCHAR(64) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE(provider, subject)
+);
+
+CREATE TABLE api_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  name VARCHAR(100) NOT NULL,
+  prefix VARCHAR(32) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  scopes VARCHAR(255) NOT NULL,
+  mfa BOOLEAN NOT NULL DEFAULT FALSE,
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  last_used_ip VARCHAR(64),
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens(user_id);
+
+CREATE TABLE user_roles (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  role VARCHAR(20) NOT NULL,
+  subject VARCHAR(100) NOT NULL DEFAULT '',
+  granted_by BIGINT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE(user_id, role, subject)
+);
+
+CREATE TABLE audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  actor_id BIGINT,
+  action VARCHAR(64) NOT NULL,
+  target_type VARCHAR(64) NOT NULL DEFAULT '',
+  target_id VARCHAR(255) NOT NULL DEFAULT '',
+  before_state TEXT,
+  after_state TEXT,
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  request_id VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL,
+  prev_hash CHAR(64) NOT NULL UNIQUE,
+  hash CHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_actor ON audit_log(actor_id);
+CREATE INDEX idx_audit_target ON audit_log(target_type, target_id);
+CREATE INDEX idx_audit_created ON audit_log(created_at);
+
+CREATE TABLE resource_reviews (
+  id BIGSERIAL PRIMARY KEY,
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  reviewer_id BIGINT NOT NULL REFERENCES users(id),
+  round INT NOT NULL,
+  decision VARCHAR(20) NOT NULL,
+  reason_code VARCHAR(32) NOT NULL DEFAULT '',
+  comment TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_reviews_resource ON resource_reviews(resource_id);
+
+CREATE TABLE review_policies (
+  subject VARCHAR(100) PRIMARY KEY,
+  required_approvals INT NOT NULL,
+  updated_by BIGINT,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE resource_reports (
+  id BIGSERIAL PRIMARY KEY,
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  reporter_id BIGINT NOT NULL REFERENCES users(id),
+  reason VARCHAR(32) NOT NULL,
+  detail TEXT NOT NULL DEFAULT '',
+  status VARCHAR(20) NOT NULL DEFAULT 'OPEN',
+  created_at TIMESTAMPTZ NOT NULL,
+  resolved_by BIGINT,
+  resolved_at TIMESTAMPTZ,
+  UNIQUE(resource_id, reporter_id)
+);
+
+CREATE INDEX idx_report_status ON resource_reports(status);
+
+CREATE TABLE resource_ratings (
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  stars SMALLINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY(resource_id, user_id)
+);
+
+CREATE TABLE resource_likes (
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  created_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY(resource_id, user_id)
+);
+
+CREATE TABLE resource_comments (
+  id BIGSERIAL PRIMARY KEY,
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  parent_id BIGINT REFERENCES resource_comments(id),
+  content TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  edited_at TIMESTAMPTZ,
+  deleted_at TIMESTAMPTZ,
+  deleted_by BIGINT
+);
+
+CREATE INDEX idx_comments_resource ON resource_comments(resource_id);
+
+CREATE TABLE collections (
+  id BIGSERIAL PRIMARY KEY,
+  owner_id BIGINT NOT NULL REFERENCES users(id),
+  name VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  visibility VARCHAR(20) NOT NULL DEFAULT 'PRIVATE',
+  share_token VARCHAR(64) UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_collection_owner ON collections(owner_id);
+
+CREATE TABLE collection_items (
+  collection_id BIGINT NOT NULL REFERENCES collections(id),
+  resource_id BIGINT NOT NULL,
+  position INT NOT NULL,
+  added_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY(collection_id, resource_id)
+);
+
+CREATE INDEX idx_item_resource ON collection_items(resource_id);
+
+CREATE TABLE resource_daily_stats (
+  resource_id BIGINT NOT NULL,
+  day VARCHAR(10) NOT NULL,
+  downloads INT NOT NULL DEFAULT 0,
+  views INT NOT NULL DEFAULT 0,
+  PRIMARY KEY(resource_id, day)
+);
+
+CREATE INDEX idx_stats_day ON resource_daily_stats(day);
+
+CREATE TABLE subjects (
+  id BIGSERIAL PRIMARY KEY,
+  parent_id BIGINT REFERENCES subjects(id),
+  kind VARCHAR(20) NOT NULL,
+  slug VARCHAR(100) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  names TEXT NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE resource_types (
+  id BIGSERIAL PRIMARY KEY,
+  slug VARCHAR(100) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  names TEXT NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE taxonomy_aliases (
+  scope VARCHAR(20) NOT NULL,
+  alias VARCHAR(255) NOT NULL,
+  target_id BIGINT NOT NULL,
+  PRIMARY KEY(scope, alias)
+);
+
+CREATE TABLE tags (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(64) NOT NULL UNIQUE,
+  resource_count INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE resource_tags (
+  resource_id BIGINT NOT NULL REFERENCES resources(id),
+  tag_id BIGINT NOT NULL REFERENCES tags(id),
+  PRIMARY KEY(resource_id, tag_id)
+);
+
+CREATE INDEX idx_resource_tags_tag ON resource_tags(tag_id);
@@ -0,0 +1,14 @@
+CREATE TABLE sms_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  phone VARCHAR(32) NOT NULL,
+  purpose VARCHAR(20) NOT NULL DEFAULT '',
+  provider VARCHAR(32) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  message_id VARCHAR(128) NOT NULL DEFAULT '',
+  request_id VARCHAR(128) NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_sms_deliveries_phone ON sms_deliveries(phone);
@@ -0,0 +1,3 @@
+-- pg_trgm stays installed; other schemas may use it
+DROP INDEX idx_resources_description_trgm;
+DROP INDEX idx_resources_title_trgm;
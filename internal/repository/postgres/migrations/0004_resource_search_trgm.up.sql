@@ -0,0 +1,7 @@
+-- Trigram indexes serve the ILIKE substring fallback of resource search, so
+-- it no longer scans the table. pg_trgm is a trusted extension (PostgreSQL
+-- 13+); it goes into public so its operator class is found whatever the
+-- connection's search_path.
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA public;
+CREATE INDEX idx_resources_title_trgm ON resources USING GIN (title public.gin_trgm_ops);
+CREATE INDEX idx_resources_description_trgm ON resources USING GIN (description public.gin_trgm_ops);
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type reportRepository struct {
+	db *dbtx.DB
+}
+
+func NewReportRepository(db *sql.DB) domain.ReportRepository {
+	return &reportRepository{db: dbtx.Wrap(db)}
+}
+
+const reportColumns = `id,resource_id,reporter_id,reason,detail,status,created_at,resolved_by,resolved_at`
+
+func (r *reportRepository) Create(ctx context.Context, rp *domain.ResourceReport) error {
+	rp.Status = domain.ReportOpen
+	rp.CreatedAt = time.Now()
+	err := r.db.QueryRowContext(ctx, `INSERT INTO resource_reports(resource_id,reporter_id,reason,detail,status,created_at) VALUES($1,$2,$3,$4,$5,$6)
+		ON CONFLICT (resource_id, reporter_id) DO NOTHING RETURNING id`,
+		rp.ResourceID, rp.ReporterID, rp.Reason, rp.Detail, rp.Status, rp.CreatedAt).Scan(&rp.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrDuplicateReport
+	}
+	return err
+}
+
+func (r *reportRepository) CountOpen(ctx context.Context, resourceID int64) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM resource_reports WHERE resource_id = $1 AND status = $2`, resourceID, domain.ReportOpen).Scan(&n)
+	return n, err
+}
+
+func (r *reportRepository) OpenGroups(ctx context.Context, limit, offset int) ([]domain.ReportGroup, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT rp.resource_id, COALESCE(res.title,''), COALESCE(res.subject,''), res.status, COUNT(*), MAX(rp.created_at)
+		FROM resource_reports rp JOIN resources res ON res.id = rp.resource_id
+		WHERE rp.status = $1
+		GROUP BY rp.resource_id, res.title, res.subject, res.status
+		ORDER BY COUNT(*) DESC, MAX(rp.id) DESC
+		LIMIT $2 OFFSET $3`, domain.ReportOpen, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		list []domain.ReportGroup
+		ids  []int64
+	)
+	for rows.Next() {
+		var g domain.ReportGroup
+		if err := rows.Scan(&g.ResourceID, &g.Title, &g.Subject, &g.Status, &g.OpenReports, &g.LastReportedAt); err != nil {
+			return nil, err
+		}
+		g.Reasons = map[string]int{}
+		list = append(list, g)
+		ids = append(ids, g.ResourceID)
+	}
+	if err := rows.Err(); err != nil || len(list) == 0 {
+		return list, err
+	}
+	return list, r.fillReasons(ctx, list, ids)
+}
+
+// fillReasons counts the open reports per reason for each group
+func (r *reportRepository) fillReasons(ctx context.Context, list []domain.ReportGroup, ids []int64) error {
+	var args params
+	rows, err := r.db.QueryContext(ctx, `SELECT resource_id, reason, COUNT(*) FROM resource_reports
+		WHERE status = `+args.add(domain.ReportOpen)+` AND resource_id IN (`+inList(&args, ids)+`)
+		GROUP BY resource_id, reason`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	byID := make(map[int64]*domain.ReportGroup, len(list))
+	for i := range list {
+		byID[list[i].ResourceID] = &list[i]
+	}
+	for rows.Next() {
+		var id int64
+		var reason string
+		var n int
+		if err := rows.Scan(&id, &reason, &n); err != nil {
+			return err
+		}
+		if g := byID[id]; g != nil {
+			g.Reasons[reason] = n
+		}
+	}
+	return rows.Err()
+}
+
+func (r *reportRepository) ListByResource(ctx context.Context, resourceID int64) ([]domain.ResourceReport, error) {
+	return r.list(ctx, `SELECT `+reportColumns+` FROM resource_reports WHERE resource_id = $1 ORDER BY id`, resourceID)
+}
+
+func (r *reportRepository) Resolve(ctx context.Context, resourceID int64, status domain.ReportStatus, resolvedBy int64) ([]domain.ResourceReport, error) {
+	open, err := r.list(ctx, `SELECT `+reportColumns+` FROM resource_reports WHERE resource_id = $1 AND status = $2 ORDER BY id`, resourceID, domain.ReportOpen)
+	if err != nil || len(open) == 0 {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = r.db.ExecContext(ctx, `UPDATE resource_reports SET status = $1, resolved_by = $2, resolved_at = $3 WHERE resource_id = $4 AND status = $5 AND id <= $6`,
+		status, resolvedBy, now, resourceID, domain.ReportOpen, open[len(open)-1].ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range open {
+		open[i].Status, open[i].ResolvedBy, open[i].ResolvedAt = status, &resolvedBy, &now
+	}
+	return open, nil
+}
+
+func (r *reportRepository) list(ctx context.Context, query string, args ...any) ([]domain.ResourceReport, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ResourceReport
+	for rows.Next() {
+		var rp domain.ResourceReport
+		var resolvedBy sql.NullInt64
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&rp.ID, &rp.ResourceID, &rp.ReporterID, &rp.Reason, &rp.Detail, &rp.Status, &rp.CreatedAt, &resolvedBy, &resolvedAt); err != nil {
+			return nil, err
+		}
+		if resolvedBy.Valid {
+			rp.ResolvedBy = &resolvedBy.Int64
+		}
+		if resolvedAt.Valid {
+			rp.ResolvedAt = &resolvedAt.Time
+		}
+		list = append(list, rp)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type resourceRepository struct {
+	db *dbtx.DB
+}
+
+func NewResourceRepository(db *sql.DB) domain.ResourceRepository {
+	return &resourceRepository{db: dbtx.Wrap(db)}
+}
+
+const resourceColumns = `id,owner_id,title,description,filename,original_name,size,file_hash,status,created_at,COALESCE(subject,''),COALESCE(type,''),review_round,rating_sum,rating_count,like_count,comment_count,favorite_count,download_count,view_count,subject_id,type_id`
+
+// resourceSorts maps each sort order to its ORDER BY clause
+var resourceSorts = map[domain.ResourceSort]string{
+	domain.SortNewest:    `created_at DESC, id DESC`,
+	domain.SortRating:    `CASE WHEN rating_count > 0 THEN rating_sum * 1.0 / rating_count ELSE 0 END DESC, rating_count DESC, id DESC`,
+	domain.SortLikes:     `like_count DESC, id DESC`,
+	domain.SortComments:  `comment_count DESC, id DESC`,
+	domain.SortFavorites: `favorite_count DESC, id DESC`,
+	domain.SortDownloads: `download_count DESC, id DESC`,
+}
+
+func (r *resourceRepository) Create(ctx context.Context, res *domain.Resource) error {
+	res.CreatedAt = time.Now()
+	stmt := `INSERT INTO resources(owner_id,title,description,filename,original_name,size,file_hash,status,created_at,subject,type,review_round,subject_id,type_id) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14) RETURNING id`
+	return r.db.QueryRowContext(ctx, stmt, res.OwnerID, res.Title, res.Description, res.Filename, res.OriginalName, res.Size, res.FileHash, res.Status, res.CreatedAt, res.Subject, res.Type, res.ReviewRound, res.SubjectID, res.TypeID).Scan(&res.ID)
+}
+
+func (r *resourceRepository) List(ctx context.Context, f domain.ResourceFilter) ([]domain.Resource, error) {
+	query := `SELECT ` + resourceColumns + ` FROM resources WHERE TRUE`
+	var args params
+
+	if f.Status != "" {
+		query += ` AND status = ` + args.add(f.Status)
+	}
+	if f.Search != "" {
+		// The simple text search configuration splits on spaces and
+		// punctuation only, so unsegmented CJK text still needs ILIKE. Each
+		// branch has its own GIN index, letting the planner combine them.
+		terms := args.add(f.Search)
+		like := args.add("%" + likeEscaper.Replace(f.Search) + "%")
+		query += ` AND (search @@ plainto_tsquery('simple', ` + terms + `) OR title ILIKE ` + like + ` ESCAPE '!' OR description ILIKE ` + like + ` ESCAPE '!')`
+	}
+	if len(f.Tags) > 0 {
+		query += ` AND id IN (SELECT rt.resource_id FROM resource_tags rt JOIN tags t ON t.id = rt.tag_id WHERE t.name IN (` + inList(&args, f.Tags) + `)`
+		if f.AllTags {
+			query += ` GROUP BY rt.resource_id HAVING COUNT(*) = ` + args.add(len(f.Tags))
+		}
+		query += `)`
+	}
+	order, ok := resourceSorts[f.Sort]
+	if !ok {
+		order = resourceSorts[domain.SortNewest]
+	}
+	query += ` ORDER BY ` + order
+
+	return r.list(ctx, query, args...)
+}
+
+func (r *resourceRepository) GetByID(ctx context.Context, id int64) (*domain.Resource, error) {
+	res, err := scanResource(r.db.QueryRowContext(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *resourceRepository) GetByIDForUpdate(ctx context.Context, id int64) (*domain.Resource, error) {
+	res, err := scanResource(r.db.QueryRowContext(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *resourceRepository) UpdateStatus(ctx context.Context, id int64, status domain.ResourceStatus) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET status = $1 WHERE id = $2`, status, id)
+	return err
+}
+
+func (r *resourceRepository) Resubmit(ctx context.Context, res *domain.Resource) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET title = $1, description = $2, filename = $3, original_name = $4, size = $5, file_hash = $6, subject = $7, type = $8, subject_id = $9, type_id = $10, status = $11, review_round = $12 WHERE id = $13`,
+		res.Title, res.Description, res.Filename, res.OriginalName, res.Size, res.FileHash, res.Subject, res.Type, res.SubjectID, res.TypeID, domain.ResourceStatusPending, res.ReviewRound, res.ID)
+	if err != nil {
+		return err
+	}
+	res.Status = domain.ResourceStatusPending
+	return nil
+}
+
+func (r *resourceRepository) Reopen(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET status = $1, review_round = review_round + 1 WHERE id = $2`, domain.ResourceStatusPending, id)
+	return err
+}
+
+func (r *resourceRepository) GetByHash(ctx context.Context, hash string) ([]domain.Resource, error) {
+	return r.list(ctx, `SELECT `+resourceColumns+` FROM resources WHERE file_hash = $1`, hash)
+}
+
+func (r *resourceRepository) ListByIDs(ctx context.Context, ids []int64) ([]domain.Resource, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var args params
+	return r.list(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id IN (`+inList(&args, ids)+`)`, args...)
+}
+
+func (r *resourceRepository) list(ctx context.Context, query string, args ...any) ([]domain.Resource, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Resource
+	for rows.Next() {
+		res, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *res)
+	}
+	return list, rows.Err()
+}
+
+func scanResource(row rowScanner) (*domain.Resource, error) {
+	var res domain.Resource
+	var ratingSum int64
+	var subjectID, typeID sql.NullInt64
+	if err := row.Scan(&res.ID, &res.OwnerID, &res.Title, &res.Description, &res.Filename, &res.OriginalName, &res.Size, &res.FileHash, &res.Status, &res.CreatedAt, &res.Subject, &res.Type, &res.ReviewRound,
+		&ratingSum, &res.RatingCount, &res.LikeCount, &res.CommentCount, &res.FavoriteCount, &res.DownloadCount, &res.ViewCount, &subjectID, &typeID); err != nil {
+		return nil, err
+	}
+	if subjectID.Valid {
+		res.SubjectID = &subjectID.Int64
+	}
+	if typeID.Valid {
+		res.TypeID = &typeID.Int64
+	}
+	if res.RatingCount > 0 {
+		res.RatingAvg = float64(ratingSum) / float64(res.RatingCount)
+	}
+	return &res, nil
+}
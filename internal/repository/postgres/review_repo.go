@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type reviewRepository struct {
+	db *dbtx.DB
+}
+
+func NewReviewRepository(db *sql.DB) domain.ReviewRepository {
+	return &reviewRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *reviewRepository) Create(ctx context.Context, rv *domain.ResourceReview) error {
+	if rv.CreatedAt.IsZero() {
+		rv.CreatedAt = time.Now()
+	}
+	return r.db.QueryRowContext(ctx, `INSERT INTO resource_reviews(resource_id,reviewer_id,round,decision,reason_code,comment,created_at) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`,
+		rv.ResourceID, rv.ReviewerID, rv.Round, rv.Decision, rv.ReasonCode, rv.Comment, rv.CreatedAt).Scan(&rv.ID)
+}
+
+func (r *reviewRepository) ListByResource(ctx context.Context, resourceID int64) ([]domain.ResourceReview, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id,resource_id,reviewer_id,round,decision,reason_code,comment,created_at FROM resource_reviews WHERE resource_id = $1 ORDER BY id`, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ResourceReview
+	for rows.Next() {
+		var rv domain.ResourceReview
+		if err := rows.Scan(&rv.ID, &rv.ResourceID, &rv.ReviewerID, &rv.Round, &rv.Decision, &rv.ReasonCode, &rv.Comment, &rv.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, rv)
+	}
+	return list, rows.Err()
+}
+
+func (r *reviewRepository) GetPolicy(ctx context.Context, subject string) (*domain.ReviewPolicy, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT subject,required_approvals,updated_by,updated_at FROM review_policies WHERE subject = $1`, subject)
+	p, err := scanReviewPolicy(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (r *reviewRepository) ListPolicies(ctx context.Context) ([]domain.ReviewPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT subject,required_approvals,updated_by,updated_at FROM review_policies ORDER BY subject`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ReviewPolicy
+	for rows.Next() {
+		p, err := scanReviewPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+func (r *reviewRepository) SavePolicy(ctx context.Context, p *domain.ReviewPolicy) error {
+	p.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx, `INSERT INTO review_policies(subject,required_approvals,updated_by,updated_at) VALUES($1,$2,$3,$4)
+		ON CONFLICT (subject) DO UPDATE SET required_approvals=EXCLUDED.required_approvals, updated_by=EXCLUDED.updated_by, updated_at=EXCLUDED.updated_at`,
+		p.Subject, p.RequiredApprovals, p.UpdatedBy, p.UpdatedAt)
+	return err
+}
+
+func (r *reviewRepository) DeletePolicy(ctx context.Context, subject string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM review_policies WHERE subject = $1`, subject)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func scanReviewPolicy(row rowScanner) (*domain.ReviewPolicy, error) {
+	var p domain.ReviewPolicy
+	var updatedBy sql.NullInt64
+	if err := row.Scan(&p.Subject, &p.RequiredApprovals, &updatedBy, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if updatedBy.Valid {
+		p.UpdatedBy = &updatedBy.Int64
+	}
+	return &p, nil
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type smsDeliveryRepository struct {
+	db *dbtx.DB
+}
+
+func NewSMSDeliveryRepository(db *sql.DB) domain.SMSDeliveryRepository {
+	return &smsDeliveryRepository{db: dbtx.Wrap(db)}
+}
+
+const smsDeliveryColumns = `id,phone,purpose,provider,status,message_id,request_id,error,duration_ms,created_at`
+
+func (r *smsDeliveryRepository) Create(ctx context.Context, d *domain.SMSDelivery) error {
+	d.CreatedAt = time.Now()
+	return r.db.QueryRowContext(ctx, `INSERT INTO sms_deliveries(phone,purpose,provider,status,message_id,request_id,error,duration_ms,created_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id`,
+		d.Phone, d.Purpose, d.Provider, d.Status, d.MessageID, d.RequestID, d.Error, d.DurationMS, d.CreatedAt).Scan(&d.ID)
+}
+
+func (r *smsDeliveryRepository) List(ctx context.Context, f domain.SMSDeliveryFilter) ([]domain.SMSDelivery, error) {
+	where := []string{"TRUE"}
+	var args params
+	if f.Phone != "" {
+		where = append(where, "phone = "+args.add(f.Phone))
+	}
+	if f.Provider != "" {
+		where = append(where, "provider = "+args.add(f.Provider))
+	}
+	if f.Status != "" {
+		where = append(where, "status = "+args.add(f.Status))
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < "+args.add(f.BeforeID))
+	}
+
+	query := `SELECT ` + smsDeliveryColumns + ` FROM sms_deliveries WHERE ` + strings.Join(where, " AND ") + ` ORDER BY id DESC LIMIT ` + args.add(f.Limit)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.SMSDelivery
+	for rows.Next() {
+		var d domain.SMSDelivery
+		if err := rows.Scan(&d.ID, &d.Phone, &d.Purpose, &d.Provider, &d.Status, &d.MessageID, &d.RequestID, &d.Error, &d.DurationMS, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
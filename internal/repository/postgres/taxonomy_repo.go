@@ -0,0 +1,373 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type taxonomyRepository struct {
+	db *dbtx.DB
+}
+
+func NewTaxonomyRepository(db *sql.DB) domain.TaxonomyRepository {
+	return &taxonomyRepository{db: dbtx.Wrap(db)}
+}
+
+const (
+	subjectColumns = `id,parent_id,kind,slug,name,names,created_at,updated_at`
+	typeColumns    = `id,slug,name,names,created_at,updated_at`
+)
+
+func (r *taxonomyRepository) ListSubjects(ctx context.Context) ([]domain.Subject, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+subjectColumns+` FROM subjects ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Subject
+	for rows.Next() {
+		s, err := scanSubject(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	aliases, err := r.aliases(ctx, domain.TaxonomySubject)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Aliases = aliases[list[i].ID]
+	}
+	return list, nil
+}
+
+func (r *taxonomyRepository) GetSubject(ctx context.Context, id int64) (*domain.Subject, error) {
+	s, err := scanSubject(r.db.QueryRowContext(ctx, `SELECT `+subjectColumns+` FROM subjects WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if s.Aliases, err = r.targetAliases(ctx, domain.TaxonomySubject, id); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *taxonomyRepository) CreateSubject(ctx context.Context, s *domain.Subject) error {
+	names, err := json.Marshal(s.Names)
+	if err != nil {
+		return err
+	}
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	return r.db.QueryRowContext(ctx, `INSERT INTO subjects(parent_id,kind,slug,name,names,created_at,updated_at) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`,
+		s.ParentID, s.Kind, s.Slug, s.Name, string(names), s.CreatedAt, s.UpdatedAt).Scan(&s.ID)
+}
+
+func (r *taxonomyRepository) UpdateSubject(ctx context.Context, s *domain.Subject) error {
+	names, err := json.Marshal(s.Names)
+	if err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, `UPDATE subjects SET parent_id = $1, kind = $2, slug = $3, name = $4, names = $5, updated_at = $6 WHERE id = $7`,
+		s.ParentID, s.Kind, s.Slug, s.Name, string(names), s.UpdatedAt, s.ID)
+	return err
+}
+
+func (r *taxonomyRepository) DeleteSubject(ctx context.Context, id int64) error {
+	if err := r.SetAliases(ctx, domain.TaxonomySubject, id, nil); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM subjects WHERE id = $1`, id)
+	return err
+}
+
+func (r *taxonomyRepository) SubjectUsage(ctx context.Context, id int64) (int, int, error) {
+	var children, resources int
+	err := r.db.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM subjects WHERE parent_id = $1),
+		(SELECT COUNT(*) FROM resources WHERE subject_id = $2)`, id, id).Scan(&children, &resources)
+	return children, resources, err
+}
+
+func (r *taxonomyRepository) ListTypes(ctx context.Context) ([]domain.ResourceType, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+typeColumns+` FROM resource_types ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ResourceType
+	for rows.Next() {
+		t, err := scanResourceType(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	aliases, err := r.aliases(ctx, domain.TaxonomyType)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Aliases = aliases[list[i].ID]
+	}
+	return list, nil
+}
+
+func (r *taxonomyRepository) GetType(ctx context.Context, id int64) (*domain.ResourceType, error) {
+	t, err := scanResourceType(r.db.QueryRowContext(ctx, `SELECT `+typeColumns+` FROM resource_types WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if t.Aliases, err = r.targetAliases(ctx, domain.TaxonomyType, id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *taxonomyRepository) CreateType(ctx context.Context, t *domain.ResourceType) error {
+	names, err := json.Marshal(t.Names)
+	if err != nil {
+		return err
+	}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	return r.db.QueryRowContext(ctx, `INSERT INTO resource_types(slug,name,names,created_at,updated_at) VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		t.Slug, t.Name, string(names), t.CreatedAt, t.UpdatedAt).Scan(&t.ID)
+}
+
+func (r *taxonomyRepository) UpdateType(ctx context.Context, t *domain.ResourceType) error {
+	names, err := json.Marshal(t.Names)
+	if err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, `UPDATE resource_types SET slug = $1, name = $2, names = $3, updated_at = $4 WHERE id = $5`,
+		t.Slug, t.Name, string(names), t.UpdatedAt, t.ID)
+	return err
+}
+
+func (r *taxonomyRepository) DeleteType(ctx context.Context, id int64) error {
+	if err := r.SetAliases(ctx, domain.TaxonomyType, id, nil); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `DELETE FROM resource_types WHERE id = $1`, id)
+	return err
+}
+
+func (r *taxonomyRepository) TypeUsage(ctx context.Context, id int64) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM resources WHERE type_id = $1`, id).Scan(&n)
+	return n, err
+}
+
+func (r *taxonomyRepository) FindAlias(ctx context.Context, scope domain.TaxonomyScope, alias string) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT target_id FROM taxonomy_aliases WHERE scope = $1 AND alias = $2`, scope, alias).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *taxonomyRepository) SetAliases(ctx context.Context, scope domain.TaxonomyScope, targetID int64, aliases []string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM taxonomy_aliases WHERE scope = $1 AND target_id = $2`, scope, targetID); err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		if _, err := r.db.ExecContext(ctx, `INSERT INTO taxonomy_aliases(scope,alias,target_id) VALUES($1,$2,$3)`, scope, a, targetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *taxonomyRepository) UnmappedValues(ctx context.Context, scope domain.TaxonomyScope) ([]string, error) {
+	col, idCol := taxonomyColumns(scope)
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT `+col+` FROM resources WHERE `+idCol+` IS NULL AND `+col+` IS NOT NULL AND `+col+` <> '' ORDER BY `+col)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+func (r *taxonomyRepository) MapValue(ctx context.Context, scope domain.TaxonomyScope, value string, id int64, slug string) (int64, error) {
+	col, idCol := taxonomyColumns(scope)
+	res, err := r.db.ExecContext(ctx, `UPDATE resources SET `+idCol+` = $1, `+col+` = $2 WHERE `+idCol+` IS NULL AND `+col+` = $3`, id, slug, value)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *taxonomyRepository) SubjectReferences(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT subject FROM user_roles WHERE subject <> '' UNION SELECT subject FROM review_policies ORDER BY subject`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+func (r *taxonomyRepository) MapSubjectReferences(ctx context.Context, value, slug string) (int64, int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// an assignment the user already holds under the slug is dropped
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE id IN (SELECT id FROM (SELECT a.id FROM user_roles a JOIN user_roles b ON b.user_id = a.user_id AND b.role = a.role AND b.subject = $1 AND b.id <> a.id WHERE a.subject = $2) dup)`, slug, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	dropped, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err = tx.ExecContext(ctx, `UPDATE user_roles SET subject = $1 WHERE subject = $2`, slug, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	renamed, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var policies int64
+	var from, to int
+	err = tx.QueryRowContext(ctx, `SELECT required_approvals FROM review_policies WHERE subject = $1`, value).Scan(&from)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return 0, 0, err
+	default:
+		// a policy already set on the slug keeps the stricter requirement
+		err = tx.QueryRowContext(ctx, `SELECT required_approvals FROM review_policies WHERE subject = $1 AND subject <> $2`, slug, value).Scan(&to)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.ExecContext(ctx, `UPDATE review_policies SET subject = $1 WHERE subject = $2`, slug, value)
+		case err != nil:
+		default:
+			if _, err = tx.ExecContext(ctx, `UPDATE review_policies SET required_approvals = $1 WHERE subject = $2`, max(from, to), slug); err == nil {
+				_, err = tx.ExecContext(ctx, `DELETE FROM review_policies WHERE subject = $1`, value)
+			}
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		policies = 1
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return dropped + renamed, policies, nil
+}
+
+// aliases returns all aliases of the scope grouped by target
+func (r *taxonomyRepository) aliases(ctx context.Context, scope domain.TaxonomyScope) (map[int64][]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT target_id, alias FROM taxonomy_aliases WHERE scope = $1 ORDER BY alias`, scope)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byTarget := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var alias string
+		if err := rows.Scan(&id, &alias); err != nil {
+			return nil, err
+		}
+		byTarget[id] = append(byTarget[id], alias)
+	}
+	return byTarget, rows.Err()
+}
+
+func (r *taxonomyRepository) targetAliases(ctx context.Context, scope domain.TaxonomyScope, id int64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT alias FROM taxonomy_aliases WHERE scope = $1 AND target_id = $2 ORDER BY alias`, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		list = append(list, alias)
+	}
+	return list, rows.Err()
+}
+
+// taxonomyColumns names the free-text and ID columns on resources for scope
+func taxonomyColumns(scope domain.TaxonomyScope) (string, string) {
+	if scope == domain.TaxonomyType {
+		return "type", "type_id"
+	}
+	return "subject", "subject_id"
+}
+
+func scanSubject(row rowScanner) (*domain.Subject, error) {
+	var s domain.Subject
+	var parentID sql.NullInt64
+	var names string
+	if err := row.Scan(&s.ID, &parentID, &s.Kind, &s.Slug, &s.Name, &names, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		s.ParentID = &parentID.Int64
+	}
+	if err := json.Unmarshal([]byte(names), &s.Names); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func scanResourceType(row rowScanner) (*domain.ResourceType, error) {
+	var t domain.ResourceType
+	var names string
+	if err := row.Scan(&t.ID, &t.Slug, &t.Name, &names, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(names), &t.Names); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
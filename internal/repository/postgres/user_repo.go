@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type userRepository struct {
+	db *dbtx.DB
+}
+
+func NewUserRepository(db *sql.DB) domain.UserRepository {
+	return &userRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *userRepository) Create(ctx context.Context, u *domain.User) error {
+	if u.Role == "" {
+		u.Role = domain.RoleUser
+	}
+	stmt := `INSERT INTO users(name,email,password,role,created_at,phone_number,school,student_id,birthdate,address,gender) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id`
+	return r.db.QueryRowContext(ctx, stmt, u.Name, u.Email, u.Password, u.Role, time.Now(), u.PhoneNumber, u.School, u.StudentID, u.Birthdate, u.Address, u.Gender).Scan(&u.ID)
+}
+
+const userColumns = `id,name,email,password,role,created_at,COALESCE(phone_number,''),COALESCE(school,''),COALESCE(student_id,''),COALESCE(birthdate,''),COALESCE(address,''),COALESCE(gender,''),suspended_at,suspended_until,COALESCE(suspend_reason,''),token_version`
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
+}
+
+func (r *userRepository) GetByPhoneNumber(ctx context.Context, phone string) (*domain.User, error) {
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE phone_number = $1`, phone)
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
+}
+
+func (r *userRepository) getOne(ctx context.Context, query string, args ...any) (*domain.User, error) {
+	u, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+func (r *userRepository) List(ctx context.Context, f domain.UserFilter) ([]domain.User, int, error) {
+	where := []string{"TRUE"}
+	var args params
+	if q := strings.TrimSpace(f.Query); q != "" {
+		// ILIKE keeps the case-insensitive matching of the other drivers
+		like := args.add("%" + q + "%")
+		where = append(where, "(name ILIKE "+like+" OR email ILIKE "+like+" OR phone_number ILIKE "+like+" OR school ILIKE "+like+")")
+	}
+	if f.Role != "" {
+		where = append(where, "role = "+args.add(f.Role))
+	}
+	if f.Suspended {
+		where = append(where, "suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > "+args.add(time.Now())+")")
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	page := `SELECT ` + userColumns + ` FROM users WHERE ` + cond + ` ORDER BY id DESC LIMIT ` + args.add(f.Limit) + ` OFFSET ` + args.add(f.Offset)
+	rows, err := r.db.QueryContext(ctx, page, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var list []domain.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *u)
+	}
+	return list, total, rows.Err()
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id int64, role domain.UserRole) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET role=$1 WHERE id=$2`, role, id)
+	return err
+}
+
+func (r *userRepository) Suspend(ctx context.Context, id int64, reason string, until *time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET suspended_at=$1, suspended_until=$2, suspend_reason=$3 WHERE id=$4`, time.Now(), until, reason, id)
+	return err
+}
+
+func (r *userRepository) Unsuspend(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET suspended_at=NULL, suspended_until=NULL, suspend_reason=NULL WHERE id=$1`, id)
+	return err
+}
+
+func (r *userRepository) RevokeTokens(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET token_version=token_version+1 WHERE id=$1`, id)
+	return err
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var (
+		u               domain.User
+		suspendedAt     sql.NullTime
+		suspendedUntil  sql.NullTime
+	)
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.CreatedAt, &u.PhoneNumber, &u.School, &u.StudentID, &u.Birthdate, &u.Address, &u.Gender, &suspendedAt, &suspendedUntil, &u.SuspendReason, &u.TokenVersion); err != nil {
+		return nil, err
+	}
+	if suspendedAt.Valid {
+		u.SuspendedAt = &suspendedAt.Time
+	}
+	if suspendedUntil.Valid {
+		u.SuspendedUntil = &suspendedUntil.Time
+	}
+	return &u, nil
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, u *domain.User) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET name=$1, school=$2, student_id=$3, birthdate=$4, address=$5, gender=$6 WHERE id=$7`,
+		u.Name, u.School, u.StudentID, u.Birthdate, u.Address, u.Gender, u.ID)
+	return err
+}
+
+func (r *userRepository) UpdateEmail(ctx context.Context, id int64, email string) error {
+	return r.updateUnique(ctx, id, "email", email, domain.ErrEmailTaken)
+}
+
+func (r *userRepository) UpdatePhoneNumber(ctx context.Context, id int64, phone string) error {
+	return r.updateUnique(ctx, id, "phone_number", phone, domain.ErrPhoneTaken)
+}
+
+// updateUnique sets column only if no other user holds the value
+func (r *userRepository) updateUnique(ctx context.Context, id int64, column, value string, errTaken error) error {
+	stmt := `UPDATE users SET ` + column + ` = $1 WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM users WHERE ` + column + ` = $1 AND id <> $2)`
+	res, err := r.db.ExecContext(ctx, stmt, value, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// Nothing changed: either the user is gone or someone else holds the value
+	var other int64
+	err = r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE `+column+` = $1 AND id <> $2 LIMIT 1`, value, id).Scan(&other)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return errTaken
+}
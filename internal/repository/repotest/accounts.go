@@ -0,0 +1,493 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+func testUsers(t *testing.T, r Repos) {
+	ctx := context.Background()
+
+	if u, err := r.Users.GetByID(ctx, 999); err != nil || u != nil {
+		t.Fatalf("GetByID(missing) = %v, %v; want nil, nil", u, err)
+	}
+	if u, err := r.Users.GetByEmail(ctx, "missing@example.com"); err != nil || u != nil {
+		t.Fatalf("GetByEmail(missing) = %v, %v; want nil, nil", u, err)
+	}
+	if u, err := r.Users.GetByPhoneNumber(ctx, "missing"); err != nil || u != nil {
+		t.Fatalf("GetByPhoneNumber(missing) = %v, %v; want nil, nil", u, err)
+	}
+
+	alice := newUser(t, r, "alice")
+	got, err := r.Users.GetByEmail(ctx, alice.Email)
+	check(t, err)
+	if got == nil || got.ID != alice.ID || got.Name != "alice" || got.Password != "hash" || got.PhoneNumber != alice.PhoneNumber {
+		t.Fatalf("GetByEmail = %+v, want %+v", got, alice)
+	}
+	if got.Role != domain.RoleUser {
+		t.Errorf("default role = %q, want %q", got.Role, domain.RoleUser)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+	if got.SuspendedAt != nil || got.SuspendedUntil != nil || got.TokenVersion != 0 {
+		t.Errorf("new user has suspension or revocation set: %+v", got)
+	}
+	if got, err := r.Users.GetByPhoneNumber(ctx, alice.PhoneNumber); err != nil || got == nil || got.ID != alice.ID {
+		t.Fatalf("GetByPhoneNumber = %v, %v", got, err)
+	}
+
+	alice.School, alice.StudentID, alice.Birthdate, alice.Address, alice.Gender = "Tsinghua", "2031001", "2010-01-02", "Beijing", "F"
+	check(t, r.Users.UpdateProfile(ctx, alice))
+	got, err = r.Users.GetByID(ctx, alice.ID)
+	check(t, err)
+	if got.School != "Tsinghua" || got.StudentID != "2031001" || got.Birthdate != "2010-01-02" || got.Address != "Beijing" || got.Gender != "F" {
+		t.Errorf("after UpdateProfile = %+v", got)
+	}
+
+	bob := newUser(t, r, "bob")
+	if err := r.Users.UpdateEmail(ctx, bob.ID, alice.Email); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Errorf("UpdateEmail(taken) = %v, want ErrEmailTaken", err)
+	}
+	if err := r.Users.UpdatePhoneNumber(ctx, bob.ID, alice.PhoneNumber); !errors.Is(err, domain.ErrPhoneTaken) {
+		t.Errorf("UpdatePhoneNumber(taken) = %v, want ErrPhoneTaken", err)
+	}
+	check(t, r.Users.UpdateEmail(ctx, alice.ID, alice.Email))
+	check(t, r.Users.UpdateEmail(ctx, bob.ID, "robert@example.com"))
+	check(t, r.Users.UpdatePhoneNumber(ctx, bob.ID, "tel-robert"))
+	got, err = r.Users.GetByID(ctx, bob.ID)
+	check(t, err)
+	if got.Email != "robert@example.com" || got.PhoneNumber != "tel-robert" {
+		t.Errorf("after updates email = %q, phone = %q", got.Email, got.PhoneNumber)
+	}
+
+	check(t, r.Users.UpdateRole(ctx, bob.ID, domain.RoleAdmin))
+	list, total, err := r.Users.List(ctx, domain.UserFilter{Role: domain.RoleAdmin, Limit: 10})
+	check(t, err)
+	if total != 1 || len(list) != 1 || list[0].ID != bob.ID || list[0].Role != domain.RoleAdmin {
+		t.Errorf("List(role admin) = %+v, total %d", list, total)
+	}
+	list, total, err = r.Users.List(ctx, domain.UserFilter{Query: "ali", Limit: 10})
+	check(t, err)
+	if total != 1 || len(list) != 1 || list[0].ID != alice.ID {
+		t.Errorf("List(query) = %+v, total %d", list, total)
+	}
+	list, total, err = r.Users.List(ctx, domain.UserFilter{Limit: 1})
+	check(t, err)
+	if total != 2 || len(list) != 1 || list[0].ID != bob.ID {
+		t.Errorf("List(limit 1) = %+v, total %d; want newest user and total 2", list, total)
+	}
+	list, _, err = r.Users.List(ctx, domain.UserFilter{Limit: 1, Offset: 1})
+	check(t, err)
+	if len(list) != 1 || list[0].ID != alice.ID {
+		t.Errorf("List(offset 1) = %+v", list)
+	}
+
+	check(t, r.Users.Suspend(ctx, alice.ID, "spam", &fixedTime))
+	got, err = r.Users.GetByID(ctx, alice.ID)
+	check(t, err)
+	if got.SuspendedAt == nil || got.SuspendReason != "spam" {
+		t.Fatalf("after Suspend = %+v", got)
+	}
+	recent(t, "SuspendedAt", *got.SuspendedAt)
+	samePtrTime(t, "SuspendedUntil", got.SuspendedUntil, &fixedTime)
+	list, total, err = r.Users.List(ctx, domain.UserFilter{Suspended: true, Limit: 10})
+	check(t, err)
+	if total != 1 || len(list) != 1 || list[0].ID != alice.ID {
+		t.Errorf("List(suspended) = %+v, total %d", list, total)
+	}
+	check(t, r.Users.Unsuspend(ctx, alice.ID))
+	got, err = r.Users.GetByID(ctx, alice.ID)
+	check(t, err)
+	if got.SuspendedAt != nil || got.SuspendedUntil != nil || got.SuspendReason != "" {
+		t.Errorf("after Unsuspend = %+v", got)
+	}
+
+	check(t, r.Users.Suspend(ctx, bob.ID, "", nil))
+	got, err = r.Users.GetByID(ctx, bob.ID)
+	check(t, err)
+	if got.SuspendedUntil != nil || !got.Suspended(time.Now().AddDate(10, 0, 0)) {
+		t.Errorf("indefinite suspension = %+v", got)
+	}
+
+	check(t, r.Users.RevokeTokens(ctx, alice.ID))
+	check(t, r.Users.RevokeTokens(ctx, alice.ID))
+	got, err = r.Users.GetByID(ctx, alice.ID)
+	check(t, err)
+	if got.TokenVersion != 2 {
+		t.Errorf("TokenVersion after two revocations = %d, want 2", got.TokenVersion)
+	}
+}
+
+func testRoles(t *testing.T, r Repos) {
+	ctx := context.Background()
+	admin := newUser(t, r, "admin")
+	ta := newUser(t, r, "ta")
+
+	a := &domain.RoleAssignment{UserID: ta.ID, Role: domain.RoleTA, Subject: "math", GrantedBy: &admin.ID}
+	check(t, r.Roles.Assign(ctx, a))
+	if a.ID == 0 {
+		t.Fatal("Assign left ID unset")
+	}
+	recent(t, "CreatedAt", a.CreatedAt)
+	again := &domain.RoleAssignment{UserID: ta.ID, Role: domain.RoleTA, Subject: "math"}
+	check(t, r.Roles.Assign(ctx, again))
+	if again.ID != a.ID || again.GrantedBy == nil || *again.GrantedBy != admin.ID {
+		t.Errorf("repeated Assign = %+v, want the original %+v", again, a)
+	}
+	check(t, r.Roles.Assign(ctx, &domain.RoleAssignment{UserID: ta.ID, Role: domain.RoleModerator}))
+
+	list, err := r.Roles.ListByUser(ctx, ta.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].Role != domain.RoleTA || list[0].Subject != "math" || list[1].Role != domain.RoleModerator {
+		t.Fatalf("ListByUser = %+v", list)
+	}
+	if list[0].GrantedBy == nil || *list[0].GrantedBy != admin.ID || list[1].GrantedBy != nil {
+		t.Errorf("GrantedBy = %v, %v; want %d, nil", list[0].GrantedBy, list[1].GrantedBy, admin.ID)
+	}
+
+	if ok, err := r.Roles.Revoke(ctx, ta.ID, domain.RoleTA, "math"); err != nil || !ok {
+		t.Errorf("Revoke = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.Roles.Revoke(ctx, ta.ID, domain.RoleTA, "math"); err != nil || ok {
+		t.Errorf("second Revoke = %v, %v; want false", ok, err)
+	}
+	if list, err := r.Roles.ListByUser(ctx, admin.ID); err != nil || len(list) != 0 {
+		t.Errorf("ListByUser(no roles) = %+v, %v", list, err)
+	}
+}
+
+func testAudit(t *testing.T, r Repos) {
+	ctx := context.Background()
+	if e, err := r.Audit.Last(ctx); err != nil || e != nil {
+		t.Fatalf("Last(empty) = %v, %v; want nil, nil", e, err)
+	}
+	actor := newUser(t, r, "actor")
+
+	first := &domain.AuditEntry{Action: domain.AuditLoginFailed, IP: "203.0.113.7", RequestID: "req-1", CreatedAt: fixedTime, PrevHash: "", Hash: "h1"}
+	check(t, r.Audit.Append(ctx, first))
+	second := &domain.AuditEntry{
+		ActorID: &actor.ID, Action: domain.AuditProfileUpdate, TargetType: "user", TargetID: "7",
+		Before: []byte(`{"name":"a"}`), After: []byte(`{"name":"b"}`),
+		CreatedAt: fixedTime.Add(time.Hour), PrevHash: "h1", Hash: "h2",
+	}
+	check(t, r.Audit.Append(ctx, second))
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Fatalf("IDs = %d, %d; want increasing", first.ID, second.ID)
+	}
+	if err := r.Audit.Append(ctx, &domain.AuditEntry{Action: domain.AuditLogin, CreatedAt: fixedTime, PrevHash: "h1", Hash: "h3"}); err == nil {
+		t.Error("Append with a used PrevHash succeeded")
+	}
+
+	last, err := r.Audit.Last(ctx)
+	check(t, err)
+	if last == nil || last.ID != second.ID || last.ActorID == nil || *last.ActorID != actor.ID || last.TargetType != "user" || last.TargetID != "7" ||
+		string(last.Before) != `{"name":"a"}` || string(last.After) != `{"name":"b"}` || last.PrevHash != "h1" || last.Hash != "h2" {
+		t.Fatalf("Last = %+v", last)
+	}
+	sameTime(t, "CreatedAt", last.CreatedAt, second.CreatedAt)
+
+	ids := func(f domain.AuditFilter) []int64 {
+		t.Helper()
+		f.Limit = 10
+		list, err := r.Audit.List(ctx, f)
+		check(t, err)
+		var ids []int64
+		for _, e := range list {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	middle := fixedTime.Add(30 * time.Minute)
+	for _, tc := range []struct {
+		name   string
+		filter domain.AuditFilter
+		want   []int64
+	}{
+		{"all", domain.AuditFilter{}, []int64{second.ID, first.ID}},
+		{"ascending", domain.AuditFilter{Ascending: true}, []int64{first.ID, second.ID}},
+		{"actor", domain.AuditFilter{ActorID: &actor.ID}, []int64{second.ID}},
+		{"action", domain.AuditFilter{Action: domain.AuditLoginFailed}, []int64{first.ID}},
+		{"target", domain.AuditFilter{TargetType: "user", TargetID: "7"}, []int64{second.ID}},
+		{"since", domain.AuditFilter{Since: &middle}, []int64{second.ID}},
+		{"until", domain.AuditFilter{Until: &middle}, []int64{first.ID}},
+		{"after", domain.AuditFilter{AfterID: first.ID}, []int64{second.ID}},
+		{"before", domain.AuditFilter{BeforeID: second.ID}, []int64{first.ID}},
+	} {
+		if got := ids(tc.filter); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("List(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	list, err := r.Audit.List(ctx, domain.AuditFilter{Action: domain.AuditLoginFailed, Limit: 1})
+	check(t, err)
+	if len(list) != 1 || list[0].ActorID != nil || list[0].Before != nil || list[0].IP != "203.0.113.7" || list[0].RequestID != "req-1" {
+		t.Errorf("anonymous entry = %+v", list)
+	}
+}
+
+func testCodes(t *testing.T, r Repos) {
+	ctx := context.Background()
+	const phone = "+8613800000000"
+
+	if code, err := r.Codes.Get(ctx, phone, "login"); err != nil || code != "" {
+		t.Fatalf("Get(missing) = %q, %v; want empty", code, err)
+	}
+	check(t, r.Codes.Save(ctx, phone, "123456", "login", time.Minute))
+	if code, err := r.Codes.Get(ctx, phone, "login"); err != nil || code != "123456" {
+		t.Errorf("Get = %q, %v; want 123456", code, err)
+	}
+	if code, err := r.Codes.Get(ctx, phone, "signup"); err != nil || code != "" {
+		t.Errorf("Get(other purpose) = %q, %v; want empty", code, err)
+	}
+	check(t, r.Codes.Save(ctx, phone, "654321", "login", time.Minute))
+	if code, err := r.Codes.Get(ctx, phone, "login"); err != nil || code != "654321" {
+		t.Errorf("Get after resave = %q, %v; want 654321", code, err)
+	}
+	check(t, r.Codes.Delete(ctx, phone, "login"))
+	if code, err := r.Codes.Get(ctx, phone, "login"); err != nil || code != "" {
+		t.Errorf("Get after Delete = %q, %v; want empty", code, err)
+	}
+
+	check(t, r.Codes.Save(ctx, phone, "111111", "signup", -time.Minute))
+	if code, err := r.Codes.Get(ctx, phone, "signup"); err != nil || code != "" {
+		t.Errorf("Get(expired) = %q, %v; want empty", code, err)
+	}
+	if ok, err := r.Codes.Consume(ctx, phone, "111111", "signup"); err != nil || ok {
+		t.Errorf("Consume(expired) = %v, %v; want false", ok, err)
+	}
+
+	check(t, r.Codes.Save(ctx, phone, "222222", "login", time.Minute))
+	if ok, err := r.Codes.Consume(ctx, phone, "333333", "login"); err != nil || ok {
+		t.Errorf("Consume(wrong code) = %v, %v; want false", ok, err)
+	}
+	if ok, err := r.Codes.Consume(ctx, phone, "222222", "login"); err != nil || !ok {
+		t.Errorf("Consume = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.Codes.Consume(ctx, phone, "222222", "login"); err != nil || ok {
+		t.Errorf("second Consume = %v, %v; want false", ok, err)
+	}
+}
+
+func testIdentities(t *testing.T, r Repos) {
+	ctx := context.Background()
+	u := newUser(t, r, "oidc")
+
+	if id, err := r.Identities.GetByProviderSubject(ctx, "github", "42"); err != nil || id != nil {
+		t.Fatalf("GetByProviderSubject(missing) = %v, %v; want nil, nil", id, err)
+	}
+	gh := &domain.UserIdentity{UserID: u.ID, Provider: "github", Subject: "42"}
+	check(t, r.Identities.Create(ctx, gh))
+	if gh.ID == 0 {
+		t.Fatal("Create left ID unset")
+	}
+	got, err := r.Identities.GetByProviderSubject(ctx, "github", "42")
+	check(t, err)
+	if got == nil || got.ID != gh.ID || got.UserID != u.ID || got.Email != "" {
+		t.Fatalf("GetByProviderSubject = %+v", got)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+	if err := r.Identities.Create(ctx, &domain.UserIdentity{UserID: u.ID, Provider: "github", Subject: "42"}); err == nil {
+		t.Error("duplicate provider subject accepted")
+	}
+
+	check(t, r.Identities.Create(ctx, &domain.UserIdentity{UserID: u.ID, Provider: "google", Subject: "abc", Email: "oidc@gmail.com"}))
+	list, err := r.Identities.ListByUser(ctx, u.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].Provider != "github" || list[1].Provider != "google" || list[1].Email != "oidc@gmail.com" {
+		t.Errorf("ListByUser = %+v", list)
+	}
+}
+
+func testAPITokens(t *testing.T, r Repos) {
+	ctx := context.Background()
+	u := newUser(t, r, "dev")
+	other := newUser(t, r, "other")
+
+	if tok, err := r.APITokens.GetByHash(ctx, "missing"); err != nil || tok != nil {
+		t.Fatalf("GetByHash(missing) = %v, %v; want nil, nil", tok, err)
+	}
+	ci := &domain.APIToken{UserID: u.ID, Name: "ci", Prefix: "chp_abcd", TokenHash: "th1",
+		Scopes: []string{domain.ScopeProfileRead, domain.ScopeResourcesRead}, MFA: true, ExpiresAt: &fixedTime}
+	check(t, r.APITokens.Create(ctx, ci))
+	cli := &domain.APIToken{UserID: u.ID, Name: "cli", Prefix: "chp_efgh", TokenHash: "th2", Scopes: []string{domain.ScopeResourcesWrite}}
+	check(t, r.APITokens.Create(ctx, cli))
+
+	got, err := r.APITokens.GetByHash(ctx, "th1")
+	check(t, err)
+	if got == nil || got.ID != ci.ID || got.Name != "ci" || got.Prefix != "chp_abcd" || !got.MFA || !reflect.DeepEqual(got.Scopes, ci.Scopes) {
+		t.Fatalf("GetByHash = %+v", got)
+	}
+	samePtrTime(t, "ExpiresAt", got.ExpiresAt, &fixedTime)
+	samePtrTime(t, "LastUsedAt", got.LastUsedAt, nil)
+	samePtrTime(t, "RevokedAt", got.RevokedAt, nil)
+	recent(t, "CreatedAt", got.CreatedAt)
+
+	list, err := r.APITokens.ListByUser(ctx, u.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].ID != cli.ID || list[1].ID != ci.ID || list[0].MFA || list[0].ExpiresAt != nil {
+		t.Errorf("ListByUser = %+v; want newest first", list)
+	}
+
+	check(t, r.APITokens.TouchLastUsed(ctx, ci.ID, fixedTime, "203.0.113.7"))
+	got, err = r.APITokens.GetByHash(ctx, "th1")
+	check(t, err)
+	samePtrTime(t, "LastUsedAt", got.LastUsedAt, &fixedTime)
+	if got.LastUsedIP != "203.0.113.7" {
+		t.Errorf("LastUsedIP = %q", got.LastUsedIP)
+	}
+
+	if ok, err := r.APITokens.Revoke(ctx, other.ID, ci.ID); err != nil || ok {
+		t.Errorf("Revoke(other user's token) = %v, %v; want false", ok, err)
+	}
+	if ok, err := r.APITokens.Revoke(ctx, u.ID, ci.ID); err != nil || !ok {
+		t.Errorf("Revoke = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.APITokens.Revoke(ctx, u.ID, ci.ID); err != nil || ok {
+		t.Errorf("second Revoke = %v, %v; want false", ok, err)
+	}
+	got, err = r.APITokens.GetByHash(ctx, "th1")
+	check(t, err)
+	if got.RevokedAt == nil {
+		t.Fatal("RevokedAt not set")
+	}
+	recent(t, "RevokedAt", *got.RevokedAt)
+
+	// RevokeAll only touches the user's live tokens
+	check(t, r.APITokens.Create(ctx, &domain.APIToken{UserID: other.ID, Name: "keep", Prefix: "chp_ijkl", TokenHash: "th3"}))
+	if n, err := r.APITokens.RevokeAll(ctx, u.ID); err != nil || n != 1 {
+		t.Errorf("RevokeAll = %d, %v; want 1", n, err)
+	}
+	if got, err := r.APITokens.GetByHash(ctx, "th2"); err != nil || got.RevokedAt == nil {
+		t.Errorf("cli token after RevokeAll = %+v, %v; want revoked", got, err)
+	}
+	if got, err := r.APITokens.GetByHash(ctx, "th3"); err != nil || got.RevokedAt != nil {
+		t.Errorf("other user's token after RevokeAll = %+v, %v; want live", got, err)
+	}
+}
+
+func testTwoFactor(t *testing.T, r Repos) {
+	ctx := context.Background()
+	u := newUser(t, r, "mfa")
+
+	if tf, err := r.TwoFactor.Get(ctx, u.ID); err != nil || tf != nil {
+		t.Fatalf("Get(missing) = %v, %v; want nil, nil", tf, err)
+	}
+	check(t, r.TwoFactor.Save(ctx, &domain.TwoFactor{UserID: u.ID, Secret: "S1"}))
+	got, err := r.TwoFactor.Get(ctx, u.ID)
+	check(t, err)
+	if got == nil || got.Secret != "S1" || got.Enabled {
+		t.Fatalf("Get = %+v", got)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+	check(t, r.TwoFactor.Save(ctx, &domain.TwoFactor{UserID: u.ID, Secret: "S2", Enabled: true, LastUsedStep: 58_000_000}))
+	got, err = r.TwoFactor.Get(ctx, u.ID)
+	check(t, err)
+	if got.Secret != "S2" || !got.Enabled || got.LastUsedStep != 58_000_000 {
+		t.Errorf("Get after second Save = %+v", got)
+	}
+
+	use := func(hash string, want bool) {
+		t.Helper()
+		if ok, err := r.TwoFactor.UseRecoveryCode(ctx, u.ID, hash); err != nil || ok != want {
+			t.Errorf("UseRecoveryCode(%s) = %v, %v; want %v", hash, ok, err, want)
+		}
+	}
+	check(t, r.TwoFactor.ReplaceRecoveryCodes(ctx, u.ID, []string{"c1", "c2"}))
+	use("c1", true)
+	use("c1", false)
+	use("c9", false)
+	check(t, r.TwoFactor.ReplaceRecoveryCodes(ctx, u.ID, []string{"c3"}))
+	use("c2", false)
+	use("c3", true)
+
+	check(t, r.TwoFactor.ReplaceRecoveryCodes(ctx, u.ID, []string{"c4"}))
+	check(t, r.TwoFactor.Delete(ctx, u.ID))
+	if tf, err := r.TwoFactor.Get(ctx, u.ID); err != nil || tf != nil {
+		t.Errorf("Get after Delete = %v, %v; want nil, nil", tf, err)
+	}
+	use("c4", false)
+}
+
+func testNotifications(t *testing.T, r Repos) {
+	ctx := context.Background()
+	u := newUser(t, r, "reader")
+	v := newUser(t, r, "someone")
+
+	system := &domain.Notification{Content: "maintenance tonight"}
+	check(t, r.Notifications.Create(ctx, system))
+	mine := &domain.Notification{UserID: &u.ID, Content: "your upload was approved"}
+	check(t, r.Notifications.Create(ctx, mine))
+	check(t, r.Notifications.Create(ctx, &domain.Notification{UserID: &v.ID, Content: "not for u"}))
+
+	list, err := r.Notifications.List(ctx, &u.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].ID != mine.ID || list[1].ID != system.ID {
+		t.Fatalf("List(user) = %+v; want own and system-wide, newest first", list)
+	}
+	if list[0].UserID == nil || *list[0].UserID != u.ID || list[1].UserID != nil || list[0].IsRead {
+		t.Errorf("List(user) = %+v", list)
+	}
+	recent(t, "CreatedAt", list[0].CreatedAt)
+
+	list, err = r.Notifications.List(ctx, nil)
+	check(t, err)
+	if len(list) != 1 || list[0].ID != system.ID {
+		t.Errorf("List(nil) = %+v; want only system-wide", list)
+	}
+}
+
+func testSMSDeliveries(t *testing.T, r Repos) {
+	ctx := context.Background()
+	failed := &domain.SMSDelivery{Phone: "13900000000", Purpose: "login", Provider: "aliyun", Status: "failed", RequestID: "req-1", Error: "quota exceeded", DurationMS: 120}
+	check(t, r.SMSDeliveries.Create(ctx, failed))
+	sent := &domain.SMSDelivery{Phone: "13900000000", Purpose: "login", Provider: "tencent", Status: "sent", MessageID: "serial-1", DurationMS: 80}
+	check(t, r.SMSDeliveries.Create(ctx, sent))
+	other := &domain.SMSDelivery{Phone: "13800000000", Purpose: "signup", Provider: "tencent", Status: "sent", MessageID: "serial-2"}
+	check(t, r.SMSDeliveries.Create(ctx, other))
+	if failed.ID == 0 || sent.ID <= failed.ID || other.ID <= sent.ID {
+		t.Fatalf("IDs = %d, %d, %d; want increasing", failed.ID, sent.ID, other.ID)
+	}
+
+	list, err := r.SMSDeliveries.List(ctx, domain.SMSDeliveryFilter{Phone: "13900000000", Limit: 10})
+	check(t, err)
+	if len(list) != 2 || list[0].ID != sent.ID || list[1].ID != failed.ID {
+		t.Fatalf("List(phone) = %+v; want the phone's deliveries, newest first", list)
+	}
+	if d := list[1]; d.Purpose != "login" || d.Provider != "aliyun" || d.Status != "failed" || d.RequestID != "req-1" || d.Error != "quota exceeded" || d.DurationMS != 120 || d.MessageID != "" {
+		t.Errorf("failed delivery = %+v", d)
+	}
+	recent(t, "CreatedAt", list[0].CreatedAt)
+
+	ids := func(f domain.SMSDeliveryFilter) []int64 {
+		t.Helper()
+		if f.Limit == 0 {
+			f.Limit = 10
+		}
+		list, err := r.SMSDeliveries.List(ctx, f)
+		check(t, err)
+		var ids []int64
+		for _, d := range list {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		name   string
+		filter domain.SMSDeliveryFilter
+		want   []int64
+	}{
+		{"all", domain.SMSDeliveryFilter{}, []int64{other.ID, sent.ID, failed.ID}},
+		{"provider", domain.SMSDeliveryFilter{Provider: "tencent"}, []int64{other.ID, sent.ID}},
+		{"status", domain.SMSDeliveryFilter{Status: "failed"}, []int64{failed.ID}},
+		{"before", domain.SMSDeliveryFilter{BeforeID: other.ID}, []int64{sent.ID, failed.ID}},
+		{"limit", domain.SMSDeliveryFilter{Limit: 1}, []int64{other.ID}},
+	} {
+		if got := ids(tc.filter); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("List(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+func testTaxonomy(t *testing.T, r Repos) {
+	ctx := context.Background()
+
+	if s, err := r.Taxonomy.GetSubject(ctx, 999); err != nil || s != nil {
+		t.Fatalf("GetSubject(missing) = %v, %v; want nil, nil", s, err)
+	}
+	if rt, err := r.Taxonomy.GetType(ctx, 999); err != nil || rt != nil {
+		t.Fatalf("GetType(missing) = %v, %v; want nil, nil", rt, err)
+	}
+	if id, err := r.Taxonomy.FindAlias(ctx, domain.TaxonomySubject, "missing"); err != nil || id != 0 {
+		t.Fatalf("FindAlias(missing) = %d, %v; want 0", id, err)
+	}
+
+	school := &domain.Subject{Kind: domain.SubjectSchool, Slug: "thu", Name: "Tsinghua", Names: map[string]string{"zh": "清华大学"}}
+	check(t, r.Taxonomy.CreateSubject(ctx, school))
+	course := &domain.Subject{ParentID: &school.ID, Kind: domain.SubjectCourse, Slug: "linear-algebra", Name: "Linear Algebra", Names: map[string]string{}}
+	check(t, r.Taxonomy.CreateSubject(ctx, course))
+	check(t, r.Taxonomy.SetAliases(ctx, domain.TaxonomySubject, course.ID, []string{"xian-dai", "la"}))
+
+	got, err := r.Taxonomy.GetSubject(ctx, course.ID)
+	check(t, err)
+	if got == nil || got.ParentID == nil || *got.ParentID != school.ID || got.Kind != domain.SubjectCourse || got.Slug != "linear-algebra" ||
+		!reflect.DeepEqual(got.Aliases, []string{"la", "xian-dai"}) {
+		t.Fatalf("GetSubject = %+v", got)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+	if id, err := r.Taxonomy.FindAlias(ctx, domain.TaxonomySubject, "la"); err != nil || id != course.ID {
+		t.Errorf("FindAlias = %d, %v; want %d", id, err, course.ID)
+	}
+	if id, err := r.Taxonomy.FindAlias(ctx, domain.TaxonomyType, "la"); err != nil || id != 0 {
+		t.Errorf("FindAlias(other scope) = %d, %v; want 0", id, err)
+	}
+
+	subjects, err := r.Taxonomy.ListSubjects(ctx)
+	check(t, err)
+	if len(subjects) != 2 || subjects[0].ID != school.ID || subjects[0].Names["zh"] != "清华大学" || subjects[0].ParentID != nil ||
+		len(subjects[0].Aliases) != 0 || len(subjects[1].Aliases) != 2 {
+		t.Errorf("ListSubjects = %+v", subjects)
+	}
+
+	course.Name = "Linear Algebra I"
+	course.Names = map[string]string{"zh": "线性代数"}
+	check(t, r.Taxonomy.UpdateSubject(ctx, course))
+	got, err = r.Taxonomy.GetSubject(ctx, course.ID)
+	check(t, err)
+	if got.Name != "Linear Algebra I" || got.Names["zh"] != "线性代数" {
+		t.Errorf("after UpdateSubject = %+v", got)
+	}
+
+	rt := &domain.ResourceType{Slug: "notes", Name: "Notes", Names: map[string]string{"zh": "笔记"}}
+	check(t, r.Taxonomy.CreateType(ctx, rt))
+	check(t, r.Taxonomy.SetAliases(ctx, domain.TaxonomyType, rt.ID, []string{"lecture-notes"}))
+	rt.Name = "Lecture notes"
+	check(t, r.Taxonomy.UpdateType(ctx, rt))
+	gotType, err := r.Taxonomy.GetType(ctx, rt.ID)
+	check(t, err)
+	if gotType == nil || gotType.Name != "Lecture notes" || gotType.Names["zh"] != "笔记" || !reflect.DeepEqual(gotType.Aliases, []string{"lecture-notes"}) {
+		t.Errorf("GetType = %+v", gotType)
+	}
+	if types, err := r.Taxonomy.ListTypes(ctx); err != nil || len(types) != 1 || len(types[0].Aliases) != 1 {
+		t.Errorf("ListTypes = %+v, %v", types, err)
+	}
+
+	res := &domain.Resource{Title: "free text", Status: domain.ResourceStatusApproved, Subject: "Linear Algebra", Type: "Notes", ReviewRound: 1}
+	check(t, r.Resources.Create(ctx, res))
+	if values, err := r.Taxonomy.UnmappedValues(ctx, domain.TaxonomySubject); err != nil || !reflect.DeepEqual(values, []string{"Linear Algebra"}) {
+		t.Errorf("UnmappedValues(subject) = %v, %v", values, err)
+	}
+	if n, err := r.Taxonomy.MapValue(ctx, domain.TaxonomySubject, "Linear Algebra", course.ID, course.Slug); err != nil || n != 1 {
+		t.Errorf("MapValue(subject) = %d, %v; want 1", n, err)
+	}
+	if n, err := r.Taxonomy.MapValue(ctx, domain.TaxonomyType, "Notes", rt.ID, rt.Slug); err != nil || n != 1 {
+		t.Errorf("MapValue(type) = %d, %v; want 1", n, err)
+	}
+	mapped := mustResource(t, r, res.ID)
+	if mapped.SubjectID == nil || *mapped.SubjectID != course.ID || mapped.Subject != "linear-algebra" || mapped.TypeID == nil || *mapped.TypeID != rt.ID || mapped.Type != "notes" {
+		t.Errorf("mapped resource = %+v", mapped)
+	}
+	if values, err := r.Taxonomy.UnmappedValues(ctx, domain.TaxonomySubject); err != nil || len(values) != 0 {
+		t.Errorf("UnmappedValues after MapValue = %v, %v", values, err)
+	}
+
+	if children, resources, err := r.Taxonomy.SubjectUsage(ctx, school.ID); err != nil || children != 1 || resources != 0 {
+		t.Errorf("SubjectUsage(school) = %d, %d, %v; want 1, 0", children, resources, err)
+	}
+	if children, resources, err := r.Taxonomy.SubjectUsage(ctx, course.ID); err != nil || children != 0 || resources != 1 {
+		t.Errorf("SubjectUsage(course) = %d, %d, %v; want 0, 1", children, resources, err)
+	}
+	if n, err := r.Taxonomy.TypeUsage(ctx, rt.ID); err != nil || n != 1 {
+		t.Errorf("TypeUsage = %d, %v; want 1", n, err)
+	}
+
+	ta, other := newUser(t, r, "taxonomy-ta"), newUser(t, r, "taxonomy-other")
+	check(t, r.Roles.Assign(ctx, &domain.RoleAssignment{UserID: ta.ID, Role: domain.RoleTA, Subject: "Linear Algebra"}))
+	check(t, r.Roles.Assign(ctx, &domain.RoleAssignment{UserID: other.ID, Role: domain.RoleTA, Subject: "Linear Algebra"}))
+	check(t, r.Roles.Assign(ctx, &domain.RoleAssignment{UserID: other.ID, Role: domain.RoleTA, Subject: "linear-algebra"}))
+	check(t, r.Roles.Assign(ctx, &domain.RoleAssignment{UserID: other.ID, Role: domain.RoleModerator}))
+	check(t, r.Reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "la", RequiredApprovals: 3}))
+	check(t, r.Reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "linear-algebra", RequiredApprovals: 2}))
+	refs, err := r.Taxonomy.SubjectReferences(ctx)
+	check(t, err)
+	sort.Strings(refs)
+	if !reflect.DeepEqual(refs, []string{"Linear Algebra", "la", "linear-algebra"}) {
+		t.Errorf("SubjectReferences = %v", refs)
+	}
+	if roles, policies, err := r.Taxonomy.MapSubjectReferences(ctx, "Linear Algebra", course.Slug); err != nil || roles != 2 || policies != 0 {
+		t.Errorf("MapSubjectReferences(roles) = %d, %d, %v; want 2, 0", roles, policies, err)
+	}
+	for _, u := range []*domain.User{ta, other} {
+		list, err := r.Roles.ListByUser(ctx, u.ID)
+		check(t, err)
+		var subjects []string
+		for _, a := range list {
+			if a.Role == domain.RoleTA {
+				subjects = append(subjects, a.Subject)
+			}
+		}
+		if !reflect.DeepEqual(subjects, []string{"linear-algebra"}) {
+			t.Errorf("TA subjects of %s after MapSubjectReferences = %v", u.Name, subjects)
+		}
+	}
+	if roles, policies, err := r.Taxonomy.MapSubjectReferences(ctx, "la", course.Slug); err != nil || roles != 0 || policies != 1 {
+		t.Errorf("MapSubjectReferences(policies) = %d, %d, %v; want 0, 1", roles, policies, err)
+	}
+	if p, err := r.Reviews.GetPolicy(ctx, "linear-algebra"); err != nil || p == nil || p.RequiredApprovals != 3 {
+		t.Errorf("merged policy = %+v, %v; want 3 approvals", p, err)
+	}
+	if p, err := r.Reviews.GetPolicy(ctx, "la"); err != nil || p != nil {
+		t.Errorf("GetPolicy(la) after MapSubjectReferences = %+v, %v; want nil", p, err)
+	}
+	if roles, policies, err := r.Taxonomy.MapSubjectReferences(ctx, "missing", course.Slug); err != nil || roles != 0 || policies != 0 {
+		t.Errorf("MapSubjectReferences(missing) = %d, %d, %v; want 0, 0", roles, policies, err)
+	}
+
+	unused := &domain.Subject{Kind: domain.SubjectDepartment, Slug: "unused", Name: "Unused"}
+	check(t, r.Taxonomy.CreateSubject(ctx, unused))
+	check(t, r.Taxonomy.SetAliases(ctx, domain.TaxonomySubject, unused.ID, []string{"old"}))
+	check(t, r.Taxonomy.DeleteSubject(ctx, unused.ID))
+	if s, err := r.Taxonomy.GetSubject(ctx, unused.ID); err != nil || s != nil {
+		t.Errorf("GetSubject after Delete = %v, %v; want nil, nil", s, err)
+	}
+	if id, err := r.Taxonomy.FindAlias(ctx, domain.TaxonomySubject, "old"); err != nil || id != 0 {
+		t.Errorf("alias of deleted subject = %d, %v; want 0", id, err)
+	}
+	oldType := &domain.ResourceType{Slug: "old-type", Name: "Old"}
+	check(t, r.Taxonomy.CreateType(ctx, oldType))
+	check(t, r.Taxonomy.DeleteType(ctx, oldType.ID))
+	if rt, err := r.Taxonomy.GetType(ctx, oldType.ID); err != nil || rt != nil {
+		t.Errorf("GetType after Delete = %v, %v; want nil, nil", rt, err)
+	}
+}
+
+func testTags(t *testing.T, r Repos) {
+	ctx := context.Background()
+	first, second, third := newResource(t, r, nil, "tagged-1"), newResource(t, r, nil, "tagged-2"), newResource(t, r, nil, "tagged-3")
+
+	if tag, err := r.Tags.GetByID(ctx, 999); err != nil || tag != nil {
+		t.Fatalf("GetByID(missing) = %v, %v; want nil, nil", tag, err)
+	}
+	if tag, err := r.Tags.GetByName(ctx, "missing"); err != nil || tag != nil {
+		t.Fatalf("GetByName(missing) = %v, %v; want nil, nil", tag, err)
+	}
+	if m, err := r.Tags.ForResources(ctx, nil); err != nil || m == nil || len(m) != 0 {
+		t.Fatalf("ForResources(nil) = %v, %v; want an empty map", m, err)
+	}
+
+	check(t, r.Tags.SetResourceTags(ctx, first.ID, []string{"exam", "calculus"}))
+	check(t, r.Tags.SetResourceTags(ctx, second.ID, []string{"calculus"}))
+	check(t, r.Tags.SetResourceTags(ctx, third.ID, []string{"c_d"}))
+	byResource, err := r.Tags.ForResources(ctx, []int64{first.ID, second.ID, 999})
+	check(t, err)
+	if want := map[int64][]string{first.ID: {"calculus", "exam"}, second.ID: {"calculus"}}; !reflect.DeepEqual(byResource, want) {
+		t.Errorf("ForResources = %v, want %v", byResource, want)
+	}
+
+	calculus, err := r.Tags.GetByName(ctx, "calculus")
+	check(t, err)
+	if calculus == nil || calculus.ResourceCount != 2 {
+		t.Fatalf("GetByName = %+v; want 2 resources", calculus)
+	}
+	recent(t, "CreatedAt", calculus.CreatedAt)
+
+	names := func(prefix string) []string {
+		t.Helper()
+		tags, err := r.Tags.Search(ctx, prefix, 10)
+		check(t, err)
+		names := []string{}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		return names
+	}
+	if got := names(""); !reflect.DeepEqual(got, []string{"calculus", "c_d", "exam"}) {
+		t.Errorf("Search(\"\") = %v; want most used first, then by name", got)
+	}
+	if got := names("c_"); !reflect.DeepEqual(got, []string{"c_d"}) {
+		t.Errorf("Search(\"c_\") = %v; the underscore must match literally", got)
+	}
+
+	list, err := r.Resources.List(ctx, domain.ResourceFilter{Tags: []string{"calculus", "exam"}})
+	check(t, err)
+	if ids := resourceIDs(list, true); !reflect.DeepEqual(ids, []int64{first.ID, second.ID}) {
+		t.Errorf("List(any tag) = %v", ids)
+	}
+	list, err = r.Resources.List(ctx, domain.ResourceFilter{Tags: []string{"calculus", "exam"}, AllTags: true})
+	check(t, err)
+	if ids := resourceIDs(list, true); !reflect.DeepEqual(ids, []int64{first.ID}) {
+		t.Errorf("List(all tags) = %v", ids)
+	}
+
+	check(t, r.Tags.SetResourceTags(ctx, first.ID, []string{"exam"}))
+	check(t, r.Tags.SetResourceTags(ctx, second.ID, nil))
+	if tag, err := r.Tags.GetByID(ctx, calculus.ID); err != nil || tag == nil || tag.ResourceCount != 0 {
+		t.Errorf("calculus after untagging = %+v, %v; want 0 resources", tag, err)
+	}
+	if got := names("ca"); len(got) != 0 {
+		t.Errorf("Search returned unused tags %v", got)
+	}
+
+	check(t, r.Tags.Rename(ctx, calculus.ID, "calc"))
+	if tag, err := r.Tags.GetByName(ctx, "calc"); err != nil || tag == nil || tag.ID != calculus.ID {
+		t.Errorf("GetByName after Rename = %+v, %v", tag, err)
+	}
+	if err := r.Tags.Rename(ctx, calculus.ID, "exam"); !errors.Is(err, domain.ErrTagNameTaken) {
+		t.Errorf("Rename onto another tag = %v; want ErrTagNameTaken", err)
+	}
+	check(t, r.Tags.Rename(ctx, calculus.ID, "calc"))
+	check(t, r.Tags.SetResourceTags(ctx, second.ID, []string{"calc"}))
+	cd, err := r.Tags.GetByName(ctx, "c_d")
+	check(t, err)
+	check(t, r.Tags.Merge(ctx, cd.ID, calculus.ID))
+	if tag, err := r.Tags.GetByID(ctx, cd.ID); err != nil || tag != nil {
+		t.Errorf("merged tag = %+v, %v; want nil, nil", tag, err)
+	}
+	if tag, err := r.Tags.GetByID(ctx, calculus.ID); err != nil || tag.ResourceCount != 2 {
+		t.Errorf("merge target = %+v, %v; want 2 resources", tag, err)
+	}
+	byResource, err = r.Tags.ForResources(ctx, []int64{third.ID})
+	check(t, err)
+	if want := map[int64][]string{third.ID: {"calc"}}; !reflect.DeepEqual(byResource, want) {
+		t.Errorf("ForResources after Merge = %v, want %v", byResource, want)
+	}
+}
+
+func testAnalytics(t *testing.T, r Repos) {
+	ctx := context.Background()
+	popular, steady := newResource(t, r, nil, "popular"), newResource(t, r, nil, "steady")
+	hidden := newResource(t, r, nil, "hidden")
+	check(t, r.Resources.UpdateStatus(ctx, hidden.ID, domain.ResourceStatusPending))
+
+	check(t, r.Analytics.AddDaily(ctx, []domain.ResourceDailyStat{
+		{ResourceID: steady.ID, Day: "2031-03-13", Downloads: 2, Views: 5},
+		{ResourceID: steady.ID, Day: "2031-03-14", Downloads: 1},
+		{ResourceID: popular.ID, Day: "2031-03-14", Downloads: 5, Views: 1},
+		{ResourceID: hidden.ID, Day: "2031-03-14", Downloads: 9},
+	}))
+	check(t, r.Analytics.AddDaily(ctx, []domain.ResourceDailyStat{{ResourceID: steady.ID, Day: "2031-03-14", Downloads: 3, Views: 2}}))
+
+	daily, err := r.Analytics.Daily(ctx, steady.ID, "2031-03-01")
+	check(t, err)
+	want := []domain.ResourceDailyStat{
+		{ResourceID: steady.ID, Day: "2031-03-13", Downloads: 2, Views: 5},
+		{ResourceID: steady.ID, Day: "2031-03-14", Downloads: 4, Views: 2},
+	}
+	if !reflect.DeepEqual(daily, want) {
+		t.Errorf("Daily = %+v, want %+v", daily, want)
+	}
+	if daily, err := r.Analytics.Daily(ctx, steady.ID, "2031-03-14"); err != nil || len(daily) != 1 {
+		t.Errorf("Daily(from) = %+v, %v", daily, err)
+	}
+	if got := mustResource(t, r, steady.ID); got.DownloadCount != 6 || got.ViewCount != 7 {
+		t.Errorf("totals = %d downloads, %d views; want 6, 7", got.DownloadCount, got.ViewCount)
+	}
+
+	top, err := r.Analytics.TopDownloads(ctx, "2031-03-14", 10)
+	check(t, err)
+	if want := []domain.ResourceCount{{ResourceID: popular.ID, Count: 5}, {ResourceID: steady.ID, Count: 4}}; !reflect.DeepEqual(top, want) {
+		t.Errorf("TopDownloads = %+v, want %+v", top, want)
+	}
+	if top, err := r.Analytics.TopDownloads(ctx, "2031-03-14", 1); err != nil || len(top) != 1 || top[0].ResourceID != popular.ID {
+		t.Errorf("TopDownloads(limit 1) = %+v, %v", top, err)
+	}
+}
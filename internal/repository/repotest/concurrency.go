@@ -0,0 +1,104 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// writers is how many goroutines race in each concurrency test
+const writers = 8
+
+// parallel runs fn once per writer at the same time
+func parallel(fn func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+// testConcurrency checks that counters maintained by the repositories stay
+// exact under concurrent writers and that unique constraints hold
+func testConcurrency(t *testing.T, r Repos) {
+	ctx := context.Background()
+
+	users := make([]*domain.User, writers)
+	parallel(func(i int) {
+		u := &domain.User{Name: fmt.Sprint("racer", i), Email: fmt.Sprintf("racer%d@example.com", i), Password: "hash"}
+		if err := r.Users.Create(ctx, u); err != nil {
+			t.Errorf("Create user %d: %v", i, err)
+		}
+		users[i] = u
+	})
+	if t.Failed() {
+		t.FailNow()
+	}
+	seen := map[int64]bool{}
+	for _, u := range users {
+		if u.ID == 0 || seen[u.ID] {
+			t.Fatalf("concurrent Create gave IDs %v", seen)
+		}
+		seen[u.ID] = true
+	}
+
+	res := newResource(t, r, nil, "contended")
+	parallel(func(i int) {
+		if err := r.Reactions.Like(ctx, res.ID, users[i].ID); err != nil {
+			t.Errorf("Like %d: %v", i, err)
+		}
+		if err := r.Reactions.SetRating(ctx, res.ID, users[i].ID, 1+i%5); err != nil {
+			t.Errorf("SetRating %d: %v", i, err)
+		}
+		if err := r.Analytics.AddDaily(ctx, []domain.ResourceDailyStat{{ResourceID: res.ID, Day: "2031-03-14", Downloads: 1, Views: 2}}); err != nil {
+			t.Errorf("AddDaily %d: %v", i, err)
+		}
+	})
+	got := mustResource(t, r, res.ID)
+	if got.LikeCount != writers || got.RatingCount != writers || got.DownloadCount != writers || got.ViewCount != 2*writers {
+		t.Errorf("counters = %d likes, %d ratings, %d downloads, %d views; want %d, %d, %d, %d",
+			got.LikeCount, got.RatingCount, got.DownloadCount, got.ViewCount, writers, writers, writers, 2*writers)
+	}
+	daily, err := r.Analytics.Daily(ctx, res.ID, "2031-03-14")
+	check(t, err)
+	if len(daily) != 1 || daily[0].Downloads != writers || daily[0].Views != 2*writers {
+		t.Errorf("Daily = %+v; want one row with %d downloads", daily, writers)
+	}
+
+	resources := make([]*domain.Resource, writers)
+	for i := range resources {
+		resources[i] = newResource(t, r, nil, fmt.Sprint("shared-tag-", i))
+	}
+	parallel(func(i int) {
+		if err := r.Tags.SetResourceTags(ctx, resources[i].ID, []string{"shared", fmt.Sprint("own-", i)}); err != nil {
+			t.Errorf("SetResourceTags %d: %v", i, err)
+		}
+	})
+	if tag, err := r.Tags.GetByName(ctx, "shared"); err != nil || tag == nil || tag.ResourceCount != writers {
+		t.Errorf("shared tag = %+v, %v; want %d resources", tag, err, writers)
+	}
+
+	// Appends racing to extend the audit chain from the same entry must
+	// leave exactly one winner
+	var won atomic.Int32
+	parallel(func(i int) {
+		e := &domain.AuditEntry{Action: domain.AuditLogin, CreatedAt: fixedTime, PrevHash: "genesis", Hash: fmt.Sprint("h", i)}
+		if r.Audit.Append(ctx, e) == nil {
+			won.Add(1)
+		}
+	})
+	if n := won.Load(); n != 1 {
+		t.Errorf("%d concurrent appends after the same entry succeeded, want 1", n)
+	}
+}
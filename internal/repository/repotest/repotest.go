@@ -0,0 +1,169 @@
+// Package repotest is a conformance suite for the domain repository
+// interfaces. Every driver runs it against its own database, so the drivers
+// cannot drift apart in not-found semantics, time handling or aggregates.
+//
+// A driver test calls Run with a function that returns repositories on a
+// fresh, migrated and empty database:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repotest.Repos {
+//			db := openTestDB(t)
+//			return repotest.Repos{Users: NewUserRepository(db), ...}
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// Repos holds one driver's repositories, all on the same database
+type Repos struct {
+	Users         domain.UserRepository
+	Roles         domain.RoleRepository
+	Audit         domain.AuditRepository
+	Codes         domain.VerificationCodeRepository
+	Identities    domain.UserIdentityRepository
+	APITokens     domain.APITokenRepository
+	TwoFactor     domain.TwoFactorRepository
+	Resources     domain.ResourceRepository
+	Reviews       domain.ReviewRepository
+	Reports       domain.ReportRepository
+	Reactions     domain.ReactionRepository
+	Comments      domain.CommentRepository
+	Collections   domain.CollectionRepository
+	Taxonomy      domain.TaxonomyRepository
+	Tags          domain.TagRepository
+	Analytics     domain.AnalyticsRepository
+	Notifications domain.NotificationRepository
+	SMSDeliveries domain.SMSDeliveryRepository
+	// Tx runs calls on the repositories above in one transaction
+	Tx domain.TxManager
+}
+
+// Factory returns repositories on a fresh, migrated and empty database. It
+// is called once per subtest and should register cleanup with t.
+type Factory func(t *testing.T) Repos
+
+// Run runs every conformance test as a subtest of t
+func Run(t *testing.T, newRepos Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r Repos)
+	}{
+		{"Users", testUsers},
+		{"Roles", testRoles},
+		{"Audit", testAudit},
+		{"Codes", testCodes},
+		{"Identities", testIdentities},
+		{"APITokens", testAPITokens},
+		{"TwoFactor", testTwoFactor},
+		{"Notifications", testNotifications},
+		{"SMSDeliveries", testSMSDeliveries},
+		{"Resources", testResources},
+		{"Reviews", testReviews},
+		{"Reports", testReports},
+		{"Reactions", testReactions},
+		{"Comments", testComments},
+		{"Collections", testCollections},
+		{"Taxonomy", testTaxonomy},
+		{"Tags", testTags},
+		{"Analytics", testAnalytics},
+		{"Transactions", testTransactions},
+		{"Concurrency", testConcurrency},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepos(t))
+		})
+	}
+}
+
+// fixedTime is a whole second in a non-UTC zone. Drivers must return it as
+// the same instant; MySQL DATETIME columns keep no fractional seconds.
+var fixedTime = time.Date(2031, 3, 14, 15, 9, 26, 0, time.FixedZone("UTC+8", 8*3600))
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sameTime fails unless got is the instant want, whatever its location
+func sameTime(t *testing.T, what string, got, want time.Time) {
+	t.Helper()
+	if !got.Equal(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
+
+// samePtrTime is sameTime for nullable columns; a nil want expects NULL
+func samePtrTime(t *testing.T, what string, got, want *time.Time) {
+	t.Helper()
+	switch {
+	case want == nil && got != nil:
+		t.Errorf("%s = %v, want nil", what, *got)
+	case want != nil && got == nil:
+		t.Errorf("%s = nil, want %v", what, *want)
+	case want != nil:
+		sameTime(t, what, *got, *want)
+	}
+}
+
+// recent fails unless got was stamped by the driver around now. The margin
+// covers second precision and clock skew with a database server.
+func recent(t *testing.T, what string, got time.Time) {
+	t.Helper()
+	if d := time.Since(got); d < -time.Minute || d > time.Minute {
+		t.Errorf("%s = %v, want about now", what, got)
+	}
+}
+
+// newUser creates a user whose unique fields derive from name
+func newUser(t *testing.T, r Repos, name string) *domain.User {
+	t.Helper()
+	u := &domain.User{Name: name, Email: name + "@example.com", Password: "hash", PhoneNumber: "tel-" + name}
+	check(t, r.Users.Create(context.Background(), u))
+	if u.ID == 0 {
+		t.Fatal("Users.Create left ID unset")
+	}
+	return u
+}
+
+// newResource creates an approved resource owned by owner, or anonymous when owner is nil
+func newResource(t *testing.T, r Repos, owner *domain.User, title string) *domain.Resource {
+	t.Helper()
+	res := &domain.Resource{
+		Title:        title,
+		Description:  "about " + title,
+		Filename:     title + ".pdf",
+		OriginalName: title + ".pdf",
+		Size:         1024,
+		FileHash:     "hash-" + title,
+		Status:       domain.ResourceStatusApproved,
+		ReviewRound:  1,
+	}
+	if owner != nil {
+		res.OwnerID = &owner.ID
+	}
+	check(t, r.Resources.Create(context.Background(), res))
+	if res.ID == 0 {
+		t.Fatal("Resources.Create left ID unset")
+	}
+	return res
+}
+
+func mustResource(t *testing.T, r Repos, id int64) *domain.Resource {
+	t.Helper()
+	res, err := r.Resources.GetByID(context.Background(), id)
+	check(t, err)
+	if res == nil {
+		t.Fatalf("resource %d not found", id)
+	}
+	return res
+}
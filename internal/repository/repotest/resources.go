@@ -0,0 +1,442 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// resourceIDs returns the IDs of list, sorted when the order is unspecified
+func resourceIDs(list []domain.Resource, sorted bool) []int64 {
+	ids := []int64{}
+	for _, res := range list {
+		ids = append(ids, res.ID)
+	}
+	if sorted {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return ids
+}
+
+func testResources(t *testing.T, r Repos) {
+	ctx := context.Background()
+	owner := newUser(t, r, "uploader")
+
+	if res, err := r.Resources.GetByID(ctx, 999); err != nil || res != nil {
+		t.Fatalf("GetByID(missing) = %v, %v; want nil, nil", res, err)
+	}
+	if res, err := r.Resources.GetByIDForUpdate(ctx, 999); err != nil || res != nil {
+		t.Fatalf("GetByIDForUpdate(missing) = %v, %v; want nil, nil", res, err)
+	}
+	if list, err := r.Resources.ListByIDs(ctx, nil); err != nil || len(list) != 0 {
+		t.Fatalf("ListByIDs(nil) = %v, %v; want empty", list, err)
+	}
+
+	anon := newResource(t, r, nil, "anonymous")
+	got := mustResource(t, r, anon.ID)
+	if got.OwnerID != nil {
+		t.Errorf("anonymous OwnerID = %d, want nil", *got.OwnerID)
+	}
+
+	notes := &domain.Resource{
+		OwnerID: &owner.ID, Title: "linear algebra notes", Description: "chapter 1-3", Filename: "f1.pdf", OriginalName: "la.pdf",
+		Size: 123456, FileHash: "shared-hash", Status: domain.ResourceStatusApproved, Subject: "math", Type: "notes", ReviewRound: 1,
+	}
+	check(t, r.Resources.Create(ctx, notes))
+	got = mustResource(t, r, notes.ID)
+	if got.OwnerID == nil || *got.OwnerID != owner.ID {
+		t.Errorf("OwnerID = %v, want %d", got.OwnerID, owner.ID)
+	}
+	if got.Title != notes.Title || got.Description != notes.Description || got.Filename != "f1.pdf" || got.OriginalName != "la.pdf" ||
+		got.Size != 123456 || got.FileHash != "shared-hash" || got.Status != domain.ResourceStatusApproved ||
+		got.Subject != "math" || got.Type != "notes" || got.ReviewRound != 1 || got.SubjectID != nil || got.TypeID != nil {
+		t.Errorf("GetByID = %+v, want %+v", got, notes)
+	}
+	if got.RatingAvg != 0 || got.RatingCount != 0 || got.LikeCount != 0 || got.CommentCount != 0 || got.FavoriteCount != 0 || got.DownloadCount != 0 || got.ViewCount != 0 {
+		t.Errorf("new resource has counters set: %+v", got)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+
+	pending := newResource(t, r, owner, "pending")
+	pending.FileHash = "shared-hash"
+	pending.Title = "pending copy"
+	pending.ReviewRound = 2
+	check(t, r.Resources.Resubmit(ctx, pending))
+	if pending.Status != domain.ResourceStatusPending {
+		t.Errorf("Resubmit left Status %q", pending.Status)
+	}
+	got = mustResource(t, r, pending.ID)
+	if got.Status != domain.ResourceStatusPending || got.Title != "pending copy" || got.FileHash != "shared-hash" || got.ReviewRound != 2 {
+		t.Errorf("after Resubmit = %+v", got)
+	}
+	check(t, r.Resources.Reopen(ctx, pending.ID))
+	if got = mustResource(t, r, pending.ID); got.ReviewRound != 3 || got.Status != domain.ResourceStatusPending {
+		t.Errorf("after Reopen round = %d, status = %q", got.ReviewRound, got.Status)
+	}
+	err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		locked, err := r.Resources.GetByIDForUpdate(ctx, pending.ID)
+		if err != nil {
+			return err
+		}
+		if locked == nil || locked.ReviewRound != 3 || locked.Title != "pending copy" {
+			t.Errorf("GetByIDForUpdate = %+v", locked)
+		}
+		return r.Resources.UpdateStatus(ctx, pending.ID, domain.ResourceStatusRejected)
+	})
+	check(t, err)
+	if got = mustResource(t, r, pending.ID); got.Status != domain.ResourceStatusRejected {
+		t.Errorf("after UpdateStatus = %q", got.Status)
+	}
+
+	list, err := r.Resources.List(ctx, domain.ResourceFilter{Status: domain.ResourceStatusApproved})
+	check(t, err)
+	if ids := resourceIDs(list, false); !reflect.DeepEqual(ids, []int64{notes.ID, anon.ID}) {
+		t.Errorf("List(approved) = %v, want newest first", ids)
+	}
+	list, err = r.Resources.List(ctx, domain.ResourceFilter{Search: "algebra"})
+	check(t, err)
+	if ids := resourceIDs(list, false); !reflect.DeepEqual(ids, []int64{notes.ID}) {
+		t.Errorf("List(search) = %v", ids)
+	}
+	for _, q := range []string{"%", "alg_bra", `alg\`} {
+		list, err = r.Resources.List(ctx, domain.ResourceFilter{Search: q})
+		check(t, err)
+		if len(list) != 0 {
+			t.Errorf("List(search %q) = %v; wildcards must match literally", q, resourceIDs(list, false))
+		}
+	}
+	list, err = r.Resources.List(ctx, domain.ResourceFilter{})
+	check(t, err)
+	if len(list) != 3 {
+		t.Errorf("List() returned %d resources, want 3", len(list))
+	}
+
+	list, err = r.Resources.GetByHash(ctx, "shared-hash")
+	check(t, err)
+	if ids := resourceIDs(list, true); !reflect.DeepEqual(ids, []int64{notes.ID, pending.ID}) {
+		t.Errorf("GetByHash = %v", ids)
+	}
+	list, err = r.Resources.ListByIDs(ctx, []int64{anon.ID, notes.ID, 999})
+	check(t, err)
+	if ids := resourceIDs(list, true); !reflect.DeepEqual(ids, []int64{anon.ID, notes.ID}) {
+		t.Errorf("ListByIDs = %v", ids)
+	}
+}
+
+func testReviews(t *testing.T, r Repos) {
+	ctx := context.Background()
+	admin := newUser(t, r, "reviewer")
+	res := newResource(t, r, nil, "reviewed")
+
+	first := &domain.ResourceReview{ResourceID: res.ID, ReviewerID: admin.ID, Round: 1, Decision: domain.ReviewRequestChanges,
+		ReasonCode: domain.ReasonIncomplete, Comment: "add chapter 4", CreatedAt: fixedTime}
+	check(t, r.Reviews.Create(ctx, first))
+	second := &domain.ResourceReview{ResourceID: res.ID, ReviewerID: admin.ID, Round: 2, Decision: domain.ReviewApprove}
+	check(t, r.Reviews.Create(ctx, second))
+	list, err := r.Reviews.ListByResource(ctx, res.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		t.Fatalf("ListByResource = %+v; want oldest first", list)
+	}
+	if list[0].Decision != domain.ReviewRequestChanges || list[0].ReasonCode != domain.ReasonIncomplete || list[0].Comment != "add chapter 4" || list[0].Round != 1 {
+		t.Errorf("first review = %+v", list[0])
+	}
+	sameTime(t, "CreatedAt", list[0].CreatedAt, fixedTime)
+	recent(t, "CreatedAt", list[1].CreatedAt)
+
+	if p, err := r.Reviews.GetPolicy(ctx, "math"); err != nil || p != nil {
+		t.Fatalf("GetPolicy(missing) = %v, %v; want nil, nil", p, err)
+	}
+	check(t, r.Reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "math", RequiredApprovals: 2, UpdatedBy: &admin.ID}))
+	check(t, r.Reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "math", RequiredApprovals: 3}))
+	p, err := r.Reviews.GetPolicy(ctx, "math")
+	check(t, err)
+	if p == nil || p.RequiredApprovals != 3 || p.UpdatedBy != nil {
+		t.Fatalf("GetPolicy after replace = %+v", p)
+	}
+	recent(t, "UpdatedAt", p.UpdatedAt)
+	check(t, r.Reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "art", RequiredApprovals: 1, UpdatedBy: &admin.ID}))
+	policies, err := r.Reviews.ListPolicies(ctx)
+	check(t, err)
+	if len(policies) != 2 || policies[0].Subject != "art" || policies[1].Subject != "math" || policies[0].UpdatedBy == nil {
+		t.Errorf("ListPolicies = %+v; want ordered by subject", policies)
+	}
+	if ok, err := r.Reviews.DeletePolicy(ctx, "math"); err != nil || !ok {
+		t.Errorf("DeletePolicy = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.Reviews.DeletePolicy(ctx, "math"); err != nil || ok {
+		t.Errorf("second DeletePolicy = %v, %v; want false", ok, err)
+	}
+}
+
+func testReports(t *testing.T, r Repos) {
+	ctx := context.Background()
+	a, b, c := newUser(t, r, "ra"), newUser(t, r, "rb"), newUser(t, r, "rc")
+	admin := newUser(t, r, "triage")
+	first, second := newResource(t, r, nil, "reported"), newResource(t, r, nil, "also-reported")
+
+	rp := &domain.ResourceReport{ResourceID: first.ID, ReporterID: a.ID, Reason: domain.ReportCopyright, Detail: "scanned textbook"}
+	check(t, r.Reports.Create(ctx, rp))
+	if rp.ID == 0 || rp.Status != domain.ReportOpen {
+		t.Fatalf("Create = %+v", rp)
+	}
+	if err := r.Reports.Create(ctx, &domain.ResourceReport{ResourceID: first.ID, ReporterID: a.ID, Reason: domain.ReportSpam}); !errors.Is(err, domain.ErrDuplicateReport) {
+		t.Errorf("duplicate Create = %v, want ErrDuplicateReport", err)
+	}
+	check(t, r.Reports.Create(ctx, &domain.ResourceReport{ResourceID: first.ID, ReporterID: b.ID, Reason: domain.ReportSpam}))
+	check(t, r.Reports.Create(ctx, &domain.ResourceReport{ResourceID: second.ID, ReporterID: c.ID, Reason: domain.ReportSpam}))
+
+	if n, err := r.Reports.CountOpen(ctx, first.ID); err != nil || n != 2 {
+		t.Errorf("CountOpen = %d, %v; want 2", n, err)
+	}
+	groups, err := r.Reports.OpenGroups(ctx, 10, 0)
+	check(t, err)
+	if len(groups) != 2 || groups[0].ResourceID != first.ID || groups[0].OpenReports != 2 || groups[1].ResourceID != second.ID {
+		t.Fatalf("OpenGroups = %+v; want most reported first", groups)
+	}
+	if want := map[string]int{domain.ReportCopyright: 1, domain.ReportSpam: 1}; !reflect.DeepEqual(groups[0].Reasons, want) {
+		t.Errorf("Reasons = %v, want %v", groups[0].Reasons, want)
+	}
+	if groups[0].Title != "reported" || groups[0].Status != domain.ResourceStatusApproved {
+		t.Errorf("group = %+v", groups[0])
+	}
+	recent(t, "LastReportedAt", groups[0].LastReportedAt)
+	if groups, err := r.Reports.OpenGroups(ctx, 1, 1); err != nil || len(groups) != 1 || groups[0].ResourceID != second.ID {
+		t.Errorf("OpenGroups(1, 1) = %+v, %v", groups, err)
+	}
+
+	list, err := r.Reports.ListByResource(ctx, first.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].ID != rp.ID || list[0].Detail != "scanned textbook" || list[0].ResolvedAt != nil || list[0].ResolvedBy != nil {
+		t.Fatalf("ListByResource = %+v", list)
+	}
+	recent(t, "CreatedAt", list[0].CreatedAt)
+
+	resolved, err := r.Reports.Resolve(ctx, first.ID, domain.ReportUpheld, admin.ID)
+	check(t, err)
+	if len(resolved) != 2 || resolved[0].Status != domain.ReportUpheld || resolved[0].ResolvedBy == nil || *resolved[0].ResolvedBy != admin.ID {
+		t.Fatalf("Resolve = %+v", resolved)
+	}
+	if n, err := r.Reports.CountOpen(ctx, first.ID); err != nil || n != 0 {
+		t.Errorf("CountOpen after Resolve = %d, %v; want 0", n, err)
+	}
+	list, err = r.Reports.ListByResource(ctx, first.ID)
+	check(t, err)
+	if list[1].Status != domain.ReportUpheld || list[1].ResolvedAt == nil || list[1].ResolvedBy == nil {
+		t.Fatalf("resolved report = %+v", list[1])
+	}
+	recent(t, "ResolvedAt", *list[1].ResolvedAt)
+	if resolved, err := r.Reports.Resolve(ctx, first.ID, domain.ReportDismissed, admin.ID); err != nil || len(resolved) != 0 {
+		t.Errorf("second Resolve = %+v, %v; want none", resolved, err)
+	}
+	if groups, err := r.Reports.OpenGroups(ctx, 10, 0); err != nil || len(groups) != 1 || groups[0].ResourceID != second.ID {
+		t.Errorf("OpenGroups after Resolve = %+v, %v", groups, err)
+	}
+}
+
+func testReactions(t *testing.T, r Repos) {
+	ctx := context.Background()
+	a, b := newUser(t, r, "fan"), newUser(t, r, "critic")
+	liked := newResource(t, r, nil, "liked")
+	plain := newResource(t, r, nil, "plain")
+
+	if stars, err := r.Reactions.GetRating(ctx, liked.ID, a.ID); err != nil || stars != 0 {
+		t.Fatalf("GetRating(missing) = %d, %v; want 0", stars, err)
+	}
+	check(t, r.Reactions.SetRating(ctx, liked.ID, a.ID, 4))
+	check(t, r.Reactions.SetRating(ctx, liked.ID, b.ID, 5))
+	check(t, r.Reactions.SetRating(ctx, liked.ID, a.ID, 2))
+	if stars, err := r.Reactions.GetRating(ctx, liked.ID, a.ID); err != nil || stars != 2 {
+		t.Errorf("GetRating = %d, %v; want 2", stars, err)
+	}
+	if got := mustResource(t, r, liked.ID); got.RatingCount != 2 || got.RatingAvg != 3.5 {
+		t.Errorf("rating count = %d, avg = %v; want 2, 3.5", got.RatingCount, got.RatingAvg)
+	}
+	if ok, err := r.Reactions.DeleteRating(ctx, liked.ID, a.ID); err != nil || !ok {
+		t.Errorf("DeleteRating = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.Reactions.DeleteRating(ctx, liked.ID, a.ID); err != nil || ok {
+		t.Errorf("second DeleteRating = %v, %v; want false", ok, err)
+	}
+	if got := mustResource(t, r, liked.ID); got.RatingCount != 1 || got.RatingAvg != 5 {
+		t.Errorf("after DeleteRating count = %d, avg = %v; want 1, 5", got.RatingCount, got.RatingAvg)
+	}
+
+	check(t, r.Reactions.Like(ctx, liked.ID, a.ID))
+	check(t, r.Reactions.Like(ctx, liked.ID, a.ID))
+	check(t, r.Reactions.Like(ctx, liked.ID, b.ID))
+	if got := mustResource(t, r, liked.ID); got.LikeCount != 2 {
+		t.Errorf("LikeCount = %d, want 2", got.LikeCount)
+	}
+	if ok, err := r.Reactions.HasLiked(ctx, liked.ID, a.ID); err != nil || !ok {
+		t.Errorf("HasLiked = %v, %v; want true", ok, err)
+	}
+	check(t, r.Reactions.Unlike(ctx, liked.ID, a.ID))
+	check(t, r.Reactions.Unlike(ctx, liked.ID, a.ID))
+	if ok, err := r.Reactions.HasLiked(ctx, liked.ID, a.ID); err != nil || ok {
+		t.Errorf("HasLiked after Unlike = %v, %v; want false", ok, err)
+	}
+	if got := mustResource(t, r, liked.ID); got.LikeCount != 1 {
+		t.Errorf("LikeCount after Unlike = %d, want 1", got.LikeCount)
+	}
+
+	for _, s := range []domain.ResourceSort{domain.SortLikes, domain.SortRating} {
+		list, err := r.Resources.List(ctx, domain.ResourceFilter{Sort: s})
+		check(t, err)
+		if ids := resourceIDs(list, false); !reflect.DeepEqual(ids, []int64{liked.ID, plain.ID}) {
+			t.Errorf("List(sort %s) = %v", s, ids)
+		}
+	}
+}
+
+func testComments(t *testing.T, r Repos) {
+	ctx := context.Background()
+	a, mod := newUser(t, r, "commenter"), newUser(t, r, "moderator")
+	res := newResource(t, r, nil, "discussed")
+
+	if c, err := r.Comments.GetByID(ctx, 999); err != nil || c != nil {
+		t.Fatalf("GetByID(missing) = %v, %v; want nil, nil", c, err)
+	}
+	top := &domain.Comment{ResourceID: res.ID, UserID: a.ID, Content: "great notes"}
+	check(t, r.Comments.Create(ctx, top))
+	reply := &domain.Comment{ResourceID: res.ID, UserID: mod.ID, ParentID: &top.ID, Content: "thanks"}
+	check(t, r.Comments.Create(ctx, reply))
+	if got := mustResource(t, r, res.ID); got.CommentCount != 2 {
+		t.Errorf("CommentCount = %d, want 2", got.CommentCount)
+	}
+
+	top.Content = "great notes, edited"
+	check(t, r.Comments.UpdateContent(ctx, top))
+	got, err := r.Comments.GetByID(ctx, top.ID)
+	check(t, err)
+	if got == nil || got.Content != top.Content || got.EditedAt == nil || got.ParentID != nil || got.DeletedAt != nil {
+		t.Fatalf("after UpdateContent = %+v", got)
+	}
+	recent(t, "EditedAt", *got.EditedAt)
+	recent(t, "CreatedAt", got.CreatedAt)
+
+	check(t, r.Comments.Delete(ctx, top.ID, mod.ID))
+	got, err = r.Comments.GetByID(ctx, top.ID)
+	check(t, err)
+	if got.Content != "" || got.DeletedAt == nil || got.DeletedBy == nil || *got.DeletedBy != mod.ID {
+		t.Errorf("after Delete = %+v", got)
+	}
+	if got := mustResource(t, r, res.ID); got.CommentCount != 1 {
+		t.Errorf("CommentCount after Delete = %d, want 1", got.CommentCount)
+	}
+
+	list, err := r.Comments.ListByResource(ctx, res.ID)
+	check(t, err)
+	if len(list) != 2 || list[0].ID != top.ID || list[1].ID != reply.ID || list[1].ParentID == nil || *list[1].ParentID != top.ID {
+		t.Errorf("ListByResource = %+v; want both, oldest first", list)
+	}
+}
+
+func testCollections(t *testing.T, r Repos) {
+	ctx := context.Background()
+	owner, other := newUser(t, r, "collector"), newUser(t, r, "browser")
+	first, second := newResource(t, r, nil, "item-1"), newResource(t, r, nil, "item-2")
+
+	if c, err := r.Collections.GetByID(ctx, 999); err != nil || c != nil {
+		t.Fatalf("GetByID(missing) = %v, %v; want nil, nil", c, err)
+	}
+	if c, err := r.Collections.GetByShareToken(ctx, "missing"); err != nil || c != nil {
+		t.Fatalf("GetByShareToken(missing) = %v, %v; want nil, nil", c, err)
+	}
+
+	exam := &domain.Collection{OwnerID: owner.ID, Name: "exam prep", Visibility: domain.CollectionPrivate}
+	check(t, r.Collections.Create(ctx, exam))
+	shared := &domain.Collection{OwnerID: owner.ID, Name: "shared", Description: "for the class", Visibility: domain.CollectionPublic, ShareToken: "tok123"}
+	check(t, r.Collections.Create(ctx, shared))
+	// a second collection without a token must not collide with the first
+	drafts := &domain.Collection{OwnerID: owner.ID, Name: "drafts", Visibility: domain.CollectionPrivate}
+	check(t, r.Collections.Create(ctx, drafts))
+	elsewhere := &domain.Collection{OwnerID: other.ID, Name: "other", Visibility: domain.CollectionPrivate}
+	check(t, r.Collections.Create(ctx, elsewhere))
+
+	got, err := r.Collections.GetByShareToken(ctx, "tok123")
+	check(t, err)
+	if got == nil || got.ID != shared.ID || got.Description != "for the class" || got.Visibility != domain.CollectionPublic || got.ItemCount != 0 {
+		t.Fatalf("GetByShareToken = %+v", got)
+	}
+	recent(t, "CreatedAt", got.CreatedAt)
+	if got, err := r.Collections.GetByID(ctx, exam.ID); err != nil || got == nil || got.ShareToken != "" {
+		t.Errorf("GetByID = %+v, %v; want empty share token", got, err)
+	}
+
+	list, err := r.Collections.ListByOwner(ctx, owner.ID, false)
+	check(t, err)
+	if len(list) != 3 || list[0].ID != drafts.ID || list[2].ID != exam.ID {
+		t.Errorf("ListByOwner = %+v; want most recently updated first", list)
+	}
+	if list, err := r.Collections.ListByOwner(ctx, owner.ID, true); err != nil || len(list) != 1 || list[0].ID != shared.ID {
+		t.Errorf("ListByOwner(public) = %+v, %v", list, err)
+	}
+
+	add := func(c *domain.Collection, res *domain.Resource, want bool) {
+		t.Helper()
+		if ok, err := r.Collections.AddItem(ctx, c.ID, res.ID); err != nil || ok != want {
+			t.Errorf("AddItem(%s, %s) = %v, %v; want %v", c.Name, res.Title, ok, err, want)
+		}
+	}
+	favorites := func(res *domain.Resource, want int) {
+		t.Helper()
+		if got := mustResource(t, r, res.ID); got.FavoriteCount != want {
+			t.Errorf("%s FavoriteCount = %d, want %d", res.Title, got.FavoriteCount, want)
+		}
+	}
+	add(exam, first, true)
+	add(exam, first, false)
+	add(exam, second, true)
+	add(shared, first, true)
+	favorites(first, 1)
+	add(elsewhere, first, true)
+	favorites(first, 2)
+
+	items, err := r.Collections.Items(ctx, exam.ID)
+	check(t, err)
+	if len(items) != 2 || items[0].ResourceID != first.ID || items[0].Position != 1 || items[1].ResourceID != second.ID || items[1].Position != 2 {
+		t.Fatalf("Items = %+v", items)
+	}
+	recent(t, "AddedAt", items[0].AddedAt)
+	if got, err := r.Collections.GetByID(ctx, exam.ID); err != nil || got.ItemCount != 2 {
+		t.Errorf("ItemCount = %+v, %v; want 2", got, err)
+	}
+
+	check(t, r.Collections.Reorder(ctx, exam.ID, []int64{second.ID, first.ID}))
+	items, err = r.Collections.Items(ctx, exam.ID)
+	check(t, err)
+	if len(items) != 2 || items[0].ResourceID != second.ID || items[1].ResourceID != first.ID {
+		t.Errorf("Items after Reorder = %+v", items)
+	}
+	if ok, err := r.Collections.RemoveItem(ctx, exam.ID, second.ID); err != nil || !ok {
+		t.Errorf("RemoveItem = %v, %v; want true", ok, err)
+	}
+	if ok, err := r.Collections.RemoveItem(ctx, exam.ID, second.ID); err != nil || ok {
+		t.Errorf("second RemoveItem = %v, %v; want false", ok, err)
+	}
+	favorites(second, 0)
+
+	exam.Name, exam.Visibility, exam.ShareToken = "finals", domain.CollectionPublic, "tok456"
+	check(t, r.Collections.Update(ctx, exam))
+	got, err = r.Collections.GetByShareToken(ctx, "tok456")
+	check(t, err)
+	if got == nil || got.ID != exam.ID || got.Name != "finals" || got.Visibility != domain.CollectionPublic {
+		t.Errorf("after Update = %+v", got)
+	}
+
+	check(t, r.Collections.Delete(ctx, exam.ID))
+	if got, err := r.Collections.GetByID(ctx, exam.ID); err != nil || got != nil {
+		t.Errorf("GetByID after Delete = %v, %v; want nil, nil", got, err)
+	}
+	if items, err := r.Collections.Items(ctx, exam.ID); err != nil || len(items) != 0 {
+		t.Errorf("Items after Delete = %+v, %v", items, err)
+	}
+	favorites(first, 2)
+	check(t, r.Collections.Delete(ctx, elsewhere.ID))
+	favorites(first, 1)
+}
@@ -0,0 +1,117 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+var errAbort = errors.New("abort")
+
+// testTransactions checks that calls made through Tx commit and roll back
+// together across repositories, nested calls included
+func testTransactions(t *testing.T, r Repos) {
+	ctx := context.Background()
+
+	check(t, r.Codes.Save(ctx, "tel-kept", "111111", "signup", time.Hour))
+	err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		u := &domain.User{Name: "kept", Email: "kept@example.com", Password: "hash", PhoneNumber: "tel-kept"}
+		if err := r.Users.Create(ctx, u); err != nil {
+			return err
+		}
+		return r.Codes.Delete(ctx, "tel-kept", "signup")
+	})
+	check(t, err)
+	if u, err := r.Users.GetByEmail(ctx, "kept@example.com"); err != nil || u == nil {
+		t.Errorf("committed user = %+v, %v", u, err)
+	}
+	if code, err := r.Codes.Get(ctx, "tel-kept", "signup"); err != nil || code != "" {
+		t.Errorf("committed code delete left %q, %v", code, err)
+	}
+
+	check(t, r.Codes.Save(ctx, "tel-lost", "222222", "signup", time.Hour))
+	err = r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		u := &domain.User{Name: "lost", Email: "lost@example.com", Password: "hash", PhoneNumber: "tel-lost"}
+		if err := r.Users.Create(ctx, u); err != nil {
+			return err
+		}
+		res := &domain.Resource{OwnerID: &u.ID, Title: "lost", Filename: "lost.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1}
+		if err := r.Resources.Create(ctx, res); err != nil {
+			return err
+		}
+		if err := r.Tags.SetResourceTags(ctx, res.ID, []string{"lost-tag"}); err != nil {
+			return err
+		}
+		if err := r.Codes.Delete(ctx, "tel-lost", "signup"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithinTx = %v, want fn's error", err)
+	}
+	if u, err := r.Users.GetByEmail(ctx, "lost@example.com"); err != nil || u != nil {
+		t.Errorf("rolled back user = %+v, %v", u, err)
+	}
+	if tag, err := r.Tags.GetByName(ctx, "lost-tag"); err != nil || tag != nil {
+		t.Errorf("rolled back tag = %+v, %v", tag, err)
+	}
+	if code, err := r.Codes.Get(ctx, "tel-lost", "signup"); err != nil || code != "222222" {
+		t.Errorf("rolled back code delete left %q, %v", code, err)
+	}
+
+	// An inner call joins the outer transaction, so the outer failure
+	// undoes what the inner one committed
+	err = r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			return r.Users.Create(ctx, &domain.User{Name: "inner", Email: "inner@example.com", Password: "hash"})
+		})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("nested WithinTx = %v, want the outer error", err)
+	}
+	if u, err := r.Users.GetByEmail(ctx, "inner@example.com"); err != nil || u != nil {
+		t.Errorf("inner user after outer rollback = %+v, %v", u, err)
+	}
+
+	// Repositories that begin their own transaction join one in progress
+	owner := newUser(t, r, "tfa")
+	check(t, r.TwoFactor.Save(ctx, &domain.TwoFactor{UserID: owner.ID, Secret: "secret", CreatedAt: fixedTime}))
+	check(t, r.TwoFactor.ReplaceRecoveryCodes(ctx, owner.ID, []string{"old"}))
+	err = r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := r.TwoFactor.ReplaceRecoveryCodes(ctx, owner.ID, []string{"new"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithinTx = %v, want fn's error", err)
+	}
+	if ok, err := r.TwoFactor.UseRecoveryCode(ctx, owner.ID, "old"); err != nil || !ok {
+		t.Errorf("UseRecoveryCode(old) after rollback = %v, %v; want true", ok, err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithinTx swallowed a panic")
+			}
+		}()
+		r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := r.Users.Create(ctx, &domain.User{Name: "panic", Email: "panic@example.com", Password: "hash"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if u, err := r.Users.GetByEmail(ctx, "panic@example.com"); err != nil || u != nil {
+		t.Errorf("user after panic = %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type analyticsRepository struct {
+	db *dbtx.DB
+}
+
+func NewAnalyticsRepository(db *sql.DB) domain.AnalyticsRepository {
+	return &analyticsRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *analyticsRepository) AddDaily(ctx context.Context, stats []domain.ResourceDailyStat) error {
+	for _, st := range stats {
+		if _, err := r.db.ExecContext(ctx, `INSERT INTO resource_daily_stats(resource_id,day,downloads,views) VALUES(?,?,?,?)
+			ON CONFLICT(resource_id,day) DO UPDATE SET downloads = downloads + excluded.downloads, views = views + excluded.views`, st.ResourceID, st.Day, st.Downloads, st.Views); err != nil {
+			return err
+		}
+		if _, err := r.db.ExecContext(ctx, `UPDATE resources SET download_count = download_count + ?, view_count = view_count + ? WHERE id = ?`,
+			st.Downloads, st.Views, st.ResourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *analyticsRepository) Daily(ctx context.Context, resourceID int64, fromDay string) ([]domain.ResourceDailyStat, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT resource_id, day, downloads, views FROM resource_daily_stats WHERE resource_id = ? AND day >= ? ORDER BY day`, resourceID, fromDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ResourceDailyStat
+	for rows.Next() {
+		var st domain.ResourceDailyStat
+		if err := rows.Scan(&st.ResourceID, &st.Day, &st.Downloads, &st.Views); err != nil {
+			return nil, err
+		}
+		list = append(list, st)
+	}
+	return list, rows.Err()
+}
+
+func (r *analyticsRepository) TopDownloads(ctx context.Context, fromDay string, limit int) ([]domain.ResourceCount, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT s.resource_id, SUM(s.downloads) FROM resource_daily_stats s
+		JOIN resources res ON res.id = s.resource_id
+		WHERE s.day >= ? AND res.status = ?
+		GROUP BY s.resource_id
+		HAVING SUM(s.downloads) > 0
+		ORDER BY SUM(s.downloads) DESC, s.resource_id DESC
+		LIMIT ?`, fromDay, domain.ResourceStatusApproved, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.ResourceCount
+	for rows.Next() {
+		var c domain.ResourceCount
+		if err := rows.Scan(&c.ResourceID, &c.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
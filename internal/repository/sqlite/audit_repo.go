@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type auditRepository struct {
+	db *dbtx.DB
+}
+
+func NewAuditRepository(db *sql.DB) domain.AuditRepository {
+	return &auditRepository{db: dbtx.Wrap(db)}
+}
+
+const auditColumns = `id,actor_id,action,target_type,target_id,before_state,after_state,ip,request_id,created_at,prev_hash,hash`
+
+func (r *auditRepository) Append(ctx context.Context, e *domain.AuditEntry) error {
+	res, err := r.db.ExecContext(ctx, `INSERT INTO audit_log(actor_id,action,target_type,target_id,before_state,after_state,ip,request_id,created_at,prev_hash,hash) VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
+		e.ActorID, e.Action, e.TargetType, e.TargetID, nullString(e.Before), nullString(e.After), e.IP, e.RequestID, e.CreatedAt, e.PrevHash, e.Hash)
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	e.ID = id
+	return nil
+}
+
+func (r *auditRepository) Last(ctx context.Context) (*domain.AuditEntry, error) {
+	e, err := scanAuditEntry(r.db.QueryRowContext(ctx, `SELECT `+auditColumns+` FROM audit_log ORDER BY id DESC LIMIT 1`))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *auditRepository) List(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEntry, error) {
+	where := []string{"1=1"}
+	var args []any
+	if f.ActorID != nil {
+		where = append(where, "actor_id = ?")
+		args = append(args, *f.ActorID)
+	}
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Since != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, *f.Since)
+	}
+	if f.Until != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, *f.Until)
+	}
+	if f.AfterID > 0 {
+		where = append(where, "id > ?")
+		args = append(args, f.AfterID)
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+	order := "DESC"
+	if f.Ascending {
+		order = "ASC"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE `+strings.Join(where, " AND ")+` ORDER BY id `+order+` LIMIT ?`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+func scanAuditEntry(row rowScanner) (*domain.AuditEntry, error) {
+	var (
+		e       domain.AuditEntry
+		actorID sql.NullInt64
+		before  sql.NullString
+		after   sql.NullString
+	)
+	if err := row.Scan(&e.ID, &actorID, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.IP, &e.RequestID, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+	if actorID.Valid {
+		e.ActorID = &actorID.Int64
+	}
+	if before.Valid {
+		e.Before = []byte(before.String)
+	}
+	if after.Valid {
+		e.After = []byte(after.String)
+	}
+	return &e, nil
+}
+
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: len(b) > 0}
+}
@@ -0,0 +1,187 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type collectionRepository struct {
+	db *dbtx.DB
+}
+
+func NewCollectionRepository(db *sql.DB) domain.CollectionRepository {
+	return &collectionRepository{db: dbtx.Wrap(db)}
+}
+
+const collectionColumns = `id,owner_id,name,description,visibility,share_token,created_at,updated_at,
+	(SELECT COUNT(*) FROM collection_items WHERE collection_id = collections.id)`
+
+func (r *collectionRepository) Create(ctx context.Context, c *domain.Collection) error {
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	res, err := r.db.ExecContext(ctx, `INSERT INTO collections(owner_id,name,description,visibility,share_token,created_at,updated_at) VALUES(?,?,?,?,?,?,?)`,
+		c.OwnerID, c.Name, c.Description, c.Visibility, shareToken(c.ShareToken), c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	c.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *collectionRepository) GetByID(ctx context.Context, id int64) (*domain.Collection, error) {
+	return r.get(ctx, `SELECT `+collectionColumns+` FROM collections WHERE id = ?`, id)
+}
+
+func (r *collectionRepository) GetByShareToken(ctx context.Context, token string) (*domain.Collection, error) {
+	return r.get(ctx, `SELECT `+collectionColumns+` FROM collections WHERE share_token = ?`, token)
+}
+
+func (r *collectionRepository) ListByOwner(ctx context.Context, ownerID int64, publicOnly bool) ([]domain.Collection, error) {
+	query := `SELECT ` + collectionColumns + ` FROM collections WHERE owner_id = ?`
+	args := []any{ownerID}
+	if publicOnly {
+		query += ` AND visibility = ?`
+		args = append(args, domain.CollectionPublic)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY updated_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Collection
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+func (r *collectionRepository) Update(ctx context.Context, c *domain.Collection) error {
+	c.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx, `UPDATE collections SET name = ?, description = ?, visibility = ?, share_token = ?, updated_at = ? WHERE id = ?`,
+		c.Name, c.Description, c.Visibility, shareToken(c.ShareToken), c.UpdatedAt, c.ID)
+	return err
+}
+
+func (r *collectionRepository) Delete(ctx context.Context, id int64) error {
+	items, err := r.Items(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM collection_items WHERE collection_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM collections WHERE id = ?`, id); err != nil {
+		return err
+	}
+	for _, it := range items {
+		if err := r.refreshFavorites(ctx, it.ResourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *collectionRepository) AddItem(ctx context.Context, collectionID, resourceID int64) (bool, error) {
+	var last int
+	if err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(position),0) FROM collection_items WHERE collection_id = ?`, collectionID).Scan(&last); err != nil {
+		return false, err
+	}
+	res, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO collection_items(collection_id,resource_id,position,added_at) VALUES(?,?,?,?)`,
+		collectionID, resourceID, last+1, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, r.itemsChanged(ctx, collectionID, resourceID)
+}
+
+func (r *collectionRepository) RemoveItem(ctx context.Context, collectionID, resourceID int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM collection_items WHERE collection_id = ? AND resource_id = ?`, collectionID, resourceID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, r.itemsChanged(ctx, collectionID, resourceID)
+}
+
+func (r *collectionRepository) Items(ctx context.Context, collectionID int64) ([]domain.CollectionItem, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT resource_id, position, added_at FROM collection_items WHERE collection_id = ? ORDER BY position, added_at`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.CollectionItem
+	for rows.Next() {
+		var it domain.CollectionItem
+		if err := rows.Scan(&it.ResourceID, &it.Position, &it.AddedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, it)
+	}
+	return list, rows.Err()
+}
+
+func (r *collectionRepository) Reorder(ctx context.Context, collectionID int64, resourceIDs []int64) error {
+	for i, id := range resourceIDs {
+		if _, err := r.db.ExecContext(ctx, `UPDATE collection_items SET position = ? WHERE collection_id = ? AND resource_id = ?`, i+1, collectionID, id); err != nil {
+			return err
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE collections SET updated_at = ? WHERE id = ?`, time.Now(), collectionID)
+	return err
+}
+
+func (r *collectionRepository) get(ctx context.Context, query string, args ...any) (*domain.Collection, error) {
+	c, err := scanCollection(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// itemsChanged touches the collection and recounts the resource's favorites
+func (r *collectionRepository) itemsChanged(ctx context.Context, collectionID, resourceID int64) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE collections SET updated_at = ? WHERE id = ?`, time.Now(), collectionID); err != nil {
+		return err
+	}
+	return r.refreshFavorites(ctx, resourceID)
+}
+
+// refreshFavorites counts the distinct users holding the resource in any collection
+func (r *collectionRepository) refreshFavorites(ctx context.Context, resourceID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET favorite_count = (
+		SELECT COUNT(DISTINCT c.owner_id) FROM collection_items i JOIN collections c ON c.id = i.collection_id WHERE i.resource_id = ?
+	) WHERE id = ?`, resourceID, resourceID)
+	return err
+}
+
+func scanCollection(row rowScanner) (*domain.Collection, error) {
+	var c domain.Collection
+	var token sql.NullString
+	if err := row.Scan(&c.ID, &c.OwnerID, &c.Name, &c.Description, &c.Visibility, &token, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount); err != nil {
+		return nil, err
+	}
+	c.ShareToken = token.String
+	return &c, nil
+}
+
+// shareToken stores an empty token as NULL so the unique index allows many
+func shareToken(token string) sql.NullString {
+	return sql.NullString{String: token, Valid: token != ""}
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		db, err := Open(filepath.Join(t.TempDir(), "chirp.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := NewMigrator(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return repotest.Repos{
+			Users:         NewUserRepository(db),
+			Roles:         NewRoleRepository(db),
+			Audit:         NewAuditRepository(db),
+			Codes:         NewCodeRepository(db),
+			Identities:    NewIdentityRepository(db),
+			APITokens:     NewAPITokenRepository(db),
+			TwoFactor:     NewTwoFactorRepository(db),
+			Resources:     NewResourceRepository(db),
+			Reviews:       NewReviewRepository(db),
+			Reports:       NewReportRepository(db),
+			Reactions:     NewReactionRepository(db),
+			Comments:      NewCommentRepository(db),
+			Collections:   NewCollectionRepository(db),
+			Taxonomy:      NewTaxonomyRepository(db),
+			Tags:          NewTagRepository(db),
+			Analytics:     NewAnalyticsRepository(db),
+			Notifications: NewNotificationRepository(db),
+			SMSDeliveries: NewSMSDeliveryRepository(db),
+			Tx:            dbtx.NewManager(db),
+		}
+	})
+}
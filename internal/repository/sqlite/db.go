@@ -1,12 +1,23 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/migrate"
 )
 
-func InitDB(dbPath string) (*sql.DB, error) {
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open connects to the SQLite database at dbPath. The schema is managed by
+// the migrator returned from NewMigrator.
+func Open(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
@@ -15,67 +26,101 @@ func InitDB(dbPath string) (*sql.DB, error) {
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
+	return db, nil
+}
 
-	createUsers := `CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		email TEXT UNIQUE,
-		password TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		phone_number TEXT,
-		school TEXT,
-		student_id TEXT,
-		birthdate TEXT,
-		address TEXT,
-		gender TEXT
-	);`
-
-	createResources := `CREATE TABLE IF NOT EXISTS resources (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		owner_id INTEGER,
-		title TEXT,
-		description TEXT,
-		filename TEXT,
-		original_name TEXT,
-		size INTEGER,
-		file_hash TEXT,
-		status TEXT DEFAULT 'PENDING',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		subject TEXT,
-		type TEXT,
-		FOREIGN KEY(owner_id) REFERENCES users(id)
-	);`
-
-	createCodes := `CREATE TABLE IF NOT EXISTS verification_codes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		phone_number TEXT,
-		code TEXT,
-		purpose TEXT,
-		expires_at DATETIME,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createNotifications := `CREATE TABLE IF NOT EXISTS notifications (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		content TEXT,
-		is_read BOOLEAN DEFAULT FALSE,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
+// parseTime parses a timestamp that the driver returned as text, as it does
+// for aggregates such as MAX(created_at)
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
 
-	if _, err := db.Exec(createUsers); err != nil {
+// NewMigrator returns the migrator for the SQLite schema in migrations/
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
 		return nil, err
 	}
-	if _, err := db.Exec(createResources); err != nil {
+	m, err := migrate.New(db, migrate.SQLite, files)
+	if err != nil {
 		return nil, err
 	}
-	if _, err := db.Exec(createNotifications); err != nil {
-		return nil, err
+	m.Legacy = upgradeLegacy
+	return m, nil
+}
+
+// upgradeLegacy adds the columns that releases before versioned migrations
+// added on startup, so their databases match the baseline migration
+func upgradeLegacy(ctx context.Context, conn *sql.Conn) error {
+	for _, t := range []struct {
+		table   string
+		columns []struct{ name, definition string }
+	}{
+		{"users", []struct{ name, definition string }{
+			{"role", "TEXT DEFAULT 'USER'"},
+			{"suspended_at", "DATETIME"},
+			{"suspended_until", "DATETIME"},
+			{"suspend_reason", "TEXT"},
+			{"tokens_revoked_at", "DATETIME"},
+		}},
+		{"resources", []struct{ name, definition string }{
+			{"review_round", "INTEGER NOT NULL DEFAULT 1"},
+			{"rating_sum", "INTEGER NOT NULL DEFAULT 0"},
+			{"rating_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"like_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"comment_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"favorite_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"download_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"view_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"subject_id", "INTEGER"},
+			{"type_id", "INTEGER"},
+		}},
+	} {
+		existing, err := columns(ctx, conn, t.table)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			continue // new database; the baseline creates the table
+		}
+		for _, col := range t.columns {
+			if existing[col.name] {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "ALTER TABLE "+t.table+" ADD COLUMN "+col.name+" "+col.definition); err != nil {
+				return err
+			}
+		}
 	}
-	if _, err := db.Exec(createCodes); err != nil {
+	return nil
+}
+
+// columns returns the column names of table, or none when it does not exist
+func columns(ctx context.Context, conn *sql.Conn, table string) (map[string]bool, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA table_info("+table+")")
+	if err != nil {
 		return nil, err
 	}
-
-	return db, nil
+	defer rows.Close()
+	names := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
 }
@@ -0,0 +1,281 @@
+-- Schema as of the introduction of versioned migrations. Tables use IF NOT
+-- EXISTS so databases created by earlier releases are adopted in place.
+
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT,
+  email TEXT UNIQUE,
+  password TEXT,
+  role TEXT DEFAULT 'USER',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  phone_number TEXT,
+  school TEXT,
+  student_id TEXT,
+  birthdate TEXT,
+  address TEXT,
+  gender TEXT,
+  suspended_at DATETIME,
+  suspended_until DATETIME,
+  suspend_reason TEXT,
+  tokens_revoked_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS resources (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  owner_id INTEGER,
+  title TEXT,
+  description TEXT,
+  filename TEXT,
+  original_name TEXT,
+  size INTEGER,
+  file_hash TEXT,
+  status TEXT DEFAULT 'PENDING',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  subject TEXT,
+  type TEXT,
+  review_round INTEGER NOT NULL DEFAULT 1,
+  rating_sum INTEGER NOT NULL DEFAULT 0,
+  rating_count INTEGER NOT NULL DEFAULT 0,
+  like_count INTEGER NOT NULL DEFAULT 0,
+  comment_count INTEGER NOT NULL DEFAULT 0,
+  favorite_count INTEGER NOT NULL DEFAULT 0,
+  download_count INTEGER NOT NULL DEFAULT 0,
+  view_count INTEGER NOT NULL DEFAULT 0,
+  subject_id INTEGER,
+  type_id INTEGER,
+  FOREIGN KEY(owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER,
+  content TEXT,
+  is_read BOOLEAN DEFAULT FALSE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS verification_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  phone_number TEXT,
+  code TEXT,
+  purpose TEXT,
+  expires_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS two_factor (
+  user_id INTEGER PRIMARY KEY,
+  secret TEXT NOT NULL,
+  enabled BOOLEAN DEFAULT FALSE,
+  last_used_step INTEGER DEFAULT 0,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at DATETIME,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(provider, subject),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT NOT NULL,
+  mfa BOOLEAN DEFAULT FALSE,
+  expires_at DATETIME,
+  last_used_at DATETIME,
+  last_used_ip TEXT,
+  revoked_at DATETIME,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  role TEXT NOT NULL,
+  subject TEXT NOT NULL DEFAULT '',
+  granted_by INTEGER,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE(user_id, role, subject),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  actor_id INTEGER,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL DEFAULT '',
+  target_id TEXT NOT NULL DEFAULT '',
+  before_state TEXT,
+  after_state TEXT,
+  ip TEXT NOT NULL DEFAULT '',
+  request_id TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL,
+  prev_hash TEXT NOT NULL UNIQUE,
+  hash TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS resource_reviews (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  resource_id INTEGER NOT NULL,
+  reviewer_id INTEGER NOT NULL,
+  round INTEGER NOT NULL,
+  decision TEXT NOT NULL,
+  reason_code TEXT NOT NULL DEFAULT '',
+  comment TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL,
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(reviewer_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS review_policies (
+  subject TEXT PRIMARY KEY,
+  required_approvals INTEGER NOT NULL,
+  updated_by INTEGER,
+  updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS resource_reports (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  resource_id INTEGER NOT NULL,
+  reporter_id INTEGER NOT NULL,
+  reason TEXT NOT NULL,
+  detail TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'OPEN',
+  created_at DATETIME NOT NULL,
+  resolved_by INTEGER,
+  resolved_at DATETIME,
+  UNIQUE(resource_id, reporter_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(reporter_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_ratings (
+  resource_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  stars INTEGER NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  PRIMARY KEY(resource_id, user_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_likes (
+  resource_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  created_at DATETIME NOT NULL,
+  PRIMARY KEY(resource_id, user_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_comments (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  resource_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  parent_id INTEGER,
+  content TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  edited_at DATETIME,
+  deleted_at DATETIME,
+  deleted_by INTEGER,
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(user_id) REFERENCES users(id),
+  FOREIGN KEY(parent_id) REFERENCES resource_comments(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_resource ON resource_comments(resource_id);
+
+CREATE TABLE IF NOT EXISTS collections (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  owner_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  visibility TEXT NOT NULL DEFAULT 'PRIVATE',
+  share_token TEXT UNIQUE,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  FOREIGN KEY(owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS collection_items (
+  collection_id INTEGER NOT NULL,
+  resource_id INTEGER NOT NULL,
+  position INTEGER NOT NULL,
+  added_at DATETIME NOT NULL,
+  PRIMARY KEY(collection_id, resource_id),
+  FOREIGN KEY(collection_id) REFERENCES collections(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_daily_stats (
+  resource_id INTEGER NOT NULL,
+  day TEXT NOT NULL,
+  downloads INTEGER NOT NULL DEFAULT 0,
+  views INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY(resource_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS subjects (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  parent_id INTEGER,
+  kind TEXT NOT NULL,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  names TEXT NOT NULL DEFAULT '{}',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  FOREIGN KEY(parent_id) REFERENCES subjects(id)
+);
+
+CREATE TABLE IF NOT EXISTS resource_types (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  names TEXT NOT NULL DEFAULT '{}',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS taxonomy_aliases (
+  scope TEXT NOT NULL,
+  alias TEXT NOT NULL,
+  target_id INTEGER NOT NULL,
+  PRIMARY KEY(scope, alias)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE,
+  resource_count INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS resource_tags (
+  resource_id INTEGER NOT NULL,
+  tag_id INTEGER NOT NULL,
+  PRIMARY KEY(resource_id, tag_id),
+  FOREIGN KEY(resource_id) REFERENCES resources(id),
+  FOREIGN KEY(tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_resource_tags_tag ON resource_tags(tag_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sms_deliveries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  phone TEXT NOT NULL,
+  purpose TEXT NOT NULL DEFAULT '',
+  provider TEXT NOT NULL,
+  status TEXT NOT NULL,
+  message_id TEXT NOT NULL DEFAULT '',
+  request_id TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sms_deliveries_phone ON sms_deliveries(phone);
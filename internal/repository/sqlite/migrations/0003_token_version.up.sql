@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+-- Sessions revoked by timestamp before versioning stay revoked
+UPDATE users SET token_version = 1 WHERE tokens_revoked_at IS NOT NULL;
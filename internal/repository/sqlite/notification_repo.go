@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+const maxNotifications = 100
+
+type notificationRepository struct {
+	db *dbtx.DB
+}
+
+func NewNotificationRepository(db *sql.DB) domain.NotificationRepository {
+	return &notificationRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *notificationRepository) Create(ctx context.Context, n *domain.Notification) error {
+	n.CreatedAt = time.Now()
+	res, err := r.db.ExecContext(ctx, `INSERT INTO notifications(user_id,content,is_read,created_at) VALUES(?,?,?,?)`, n.UserID, n.Content, n.IsRead, n.CreatedAt)
+	if err != nil {
+		return err
+	}
+	n.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *notificationRepository) List(ctx context.Context, userID *int64) ([]domain.Notification, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id,user_id,content,is_read,created_at FROM notifications WHERE user_id = ? OR user_id IS NULL ORDER BY id DESC LIMIT ?`, userID, maxNotifications)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		var uid sql.NullInt64
+		if err := rows.Scan(&n.ID, &uid, &n.Content, &n.IsRead, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if uid.Valid {
+			n.UserID = &uid.Int64
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
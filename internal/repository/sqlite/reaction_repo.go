@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type reactionRepository struct {
+	db *dbtx.DB
+}
+
+func NewReactionRepository(db *sql.DB) domain.ReactionRepository {
+	return &reactionRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *reactionRepository) SetRating(ctx context.Context, resourceID, userID int64, stars int) error {
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO resource_ratings(resource_id,user_id,stars,created_at,updated_at) VALUES(?,?,?,?,?)
+		ON CONFLICT(resource_id,user_id) DO UPDATE SET stars = excluded.stars, updated_at = excluded.updated_at`, resourceID, userID, stars, now, now); err != nil {
+		return err
+	}
+	return r.refreshRatings(ctx, resourceID)
+}
+
+func (r *reactionRepository) DeleteRating(ctx context.Context, resourceID, userID int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM resource_ratings WHERE resource_id = ? AND user_id = ?`, resourceID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, r.refreshRatings(ctx, resourceID)
+}
+
+func (r *reactionRepository) GetRating(ctx context.Context, resourceID, userID int64) (int, error) {
+	var stars int
+	err := r.db.QueryRowContext(ctx, `SELECT stars FROM resource_ratings WHERE resource_id = ? AND user_id = ?`, resourceID, userID).Scan(&stars)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return stars, err
+}
+
+func (r *reactionRepository) Like(ctx context.Context, resourceID, userID int64) error {
+	if _, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO resource_likes(resource_id,user_id,created_at) VALUES(?,?,?)`, resourceID, userID, time.Now()); err != nil {
+		return err
+	}
+	return r.refreshLikes(ctx, resourceID)
+}
+
+func (r *reactionRepository) Unlike(ctx context.Context, resourceID, userID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM resource_likes WHERE resource_id = ? AND user_id = ?`, resourceID, userID); err != nil {
+		return err
+	}
+	return r.refreshLikes(ctx, resourceID)
+}
+
+func (r *reactionRepository) HasLiked(ctx context.Context, resourceID, userID int64) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM resource_likes WHERE resource_id = ? AND user_id = ?`, resourceID, userID).Scan(&n)
+	return n > 0, err
+}
+
+// refreshRatings recomputes the rating aggregates from the ratings table, so
+// concurrent writers cannot drift the stored sum and count
+func (r *reactionRepository) refreshRatings(ctx context.Context, resourceID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET
+		rating_sum = (SELECT COALESCE(SUM(stars),0) FROM resource_ratings WHERE resource_id = ?),
+		rating_count = (SELECT COUNT(*) FROM resource_ratings WHERE resource_id = ?)
+		WHERE id = ?`, resourceID, resourceID, resourceID)
+	return err
+}
+
+func (r *reactionRepository) refreshLikes(ctx context.Context, resourceID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE resources SET like_count = (SELECT COUNT(*) FROM resource_likes WHERE resource_id = ?) WHERE id = ?`, resourceID, resourceID)
+	return err
+}
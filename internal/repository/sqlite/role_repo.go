@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type roleRepository struct {
+	db *dbtx.DB
+}
+
+func NewRoleRepository(db *sql.DB) domain.RoleRepository {
+	return &roleRepository{db: dbtx.Wrap(db)}
+}
+
+func (r *roleRepository) Assign(ctx context.Context, a *domain.RoleAssignment) error {
+	_, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO user_roles(user_id,role,subject,granted_by,created_at) VALUES(?,?,?,?,?)`,
+		a.UserID, a.Role, a.Subject, a.GrantedBy, time.Now())
+	if err != nil {
+		return err
+	}
+	// Read back so an already existing assignment reports its original row
+	row := r.db.QueryRowContext(ctx, `SELECT id,granted_by,created_at FROM user_roles WHERE user_id = ? AND role = ? AND subject = ?`, a.UserID, a.Role, a.Subject)
+	var grantedBy sql.NullInt64
+	if err := row.Scan(&a.ID, &grantedBy, &a.CreatedAt); err != nil {
+		return err
+	}
+	a.GrantedBy = nil
+	if grantedBy.Valid {
+		a.GrantedBy = &grantedBy.Int64
+	}
+	return nil
+}
+
+func (r *roleRepository) Revoke(ctx context.Context, userID int64, role domain.UserRole, subject string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ? AND role = ? AND subject = ?`, userID, role, subject)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *roleRepository) ListByUser(ctx context.Context, userID int64) ([]domain.RoleAssignment, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id,user_id,role,subject,granted_by,created_at FROM user_roles WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.RoleAssignment
+	for rows.Next() {
+		var a domain.RoleAssignment
+		var grantedBy sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Role, &a.Subject, &grantedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if grantedBy.Valid {
+			a.GrantedBy = &grantedBy.Int64
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
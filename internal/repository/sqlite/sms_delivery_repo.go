@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type smsDeliveryRepository struct {
+	db *dbtx.DB
+}
+
+func NewSMSDeliveryRepository(db *sql.DB) domain.SMSDeliveryRepository {
+	return &smsDeliveryRepository{db: dbtx.Wrap(db)}
+}
+
+const smsDeliveryColumns = `id,phone,purpose,provider,status,message_id,request_id,error,duration_ms,created_at`
+
+func (r *smsDeliveryRepository) Create(ctx context.Context, d *domain.SMSDelivery) error {
+	d.CreatedAt = time.Now()
+	res, err := r.db.ExecContext(ctx, `INSERT INTO sms_deliveries(phone,purpose,provider,status,message_id,request_id,error,duration_ms,created_at) VALUES(?,?,?,?,?,?,?,?,?)`,
+		d.Phone, d.Purpose, d.Provider, d.Status, d.MessageID, d.RequestID, d.Error, d.DurationMS, d.CreatedAt)
+	if err != nil {
+		return err
+	}
+	d.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *smsDeliveryRepository) List(ctx context.Context, f domain.SMSDeliveryFilter) ([]domain.SMSDelivery, error) {
+	where := []string{"1=1"}
+	var args []any
+	if f.Phone != "" {
+		where = append(where, "phone = ?")
+		args = append(args, f.Phone)
+	}
+	if f.Provider != "" {
+		where = append(where, "provider = ?")
+		args = append(args, f.Provider)
+	}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+smsDeliveryColumns+` FROM sms_deliveries WHERE `+strings.Join(where, " AND ")+` ORDER BY id DESC LIMIT ?`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.SMSDelivery
+	for rows.Next() {
+		var d domain.SMSDelivery
+		if err := rows.Scan(&d.ID, &d.Phone, &d.Purpose, &d.Provider, &d.Status, &d.MessageID, &d.RequestID, &d.Error, &d.DurationMS, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,201 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+)
+
+type tagRepository struct {
+	db *dbtx.DB
+}
+
+func NewTagRepository(db *sql.DB) domain.TagRepository {
+	return &tagRepository{db: dbtx.Wrap(db)}
+}
+
+const tagColumns = `id,name,resource_count,created_at`
+
+func (r *tagRepository) SetResourceTags(ctx context.Context, resourceID int64, names []string) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT tag_id FROM resource_tags WHERE resource_id = ?`, resourceID)
+	if err != nil {
+		return err
+	}
+	var affected []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		affected = append(affected, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		if _, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO tags(name,resource_count,created_at) VALUES(?,0,?)`, name, now); err != nil {
+			return err
+		}
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM resource_tags WHERE resource_id = ?`, resourceID); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		args := []any{resourceID}
+		for _, name := range names {
+			args = append(args, name)
+		}
+		if _, err := r.db.ExecContext(ctx, `INSERT INTO resource_tags(resource_id,tag_id) SELECT ?, id FROM tags WHERE name IN (`+placeholders(len(names))+`)`, args...); err != nil {
+			return err
+		}
+		rows, err := r.db.QueryContext(ctx, `SELECT tag_id FROM resource_tags WHERE resource_id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			affected = append(affected, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return r.refreshCounts(ctx, affected...)
+}
+
+func (r *tagRepository) ForResources(ctx context.Context, resourceIDs []int64) (map[int64][]string, error) {
+	byResource := make(map[int64][]string)
+	if len(resourceIDs) == 0 {
+		return byResource, nil
+	}
+	args := make([]any, len(resourceIDs))
+	for i, id := range resourceIDs {
+		args[i] = id
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT rt.resource_id, t.name FROM resource_tags rt JOIN tags t ON t.id = rt.tag_id
+		WHERE rt.resource_id IN (`+placeholders(len(resourceIDs))+`) ORDER BY t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		byResource[id] = append(byResource[id], name)
+	}
+	return byResource, rows.Err()
+}
+
+// likeEscaper makes user input match literally in LIKE patterns that
+// declare ESCAPE '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (r *tagRepository) Search(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	escaped := likeEscaper.Replace(prefix)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+tagColumns+` FROM tags WHERE resource_count > 0 AND name LIKE ? ESCAPE '!'
+		ORDER BY resource_count DESC, name LIMIT ?`, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []domain.Tag
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+func (r *tagRepository) GetByID(ctx context.Context, id int64) (*domain.Tag, error) {
+	return r.get(ctx, `SELECT `+tagColumns+` FROM tags WHERE id = ?`, id)
+}
+
+func (r *tagRepository) GetByName(ctx context.Context, name string) (*domain.Tag, error) {
+	return r.get(ctx, `SELECT `+tagColumns+` FROM tags WHERE name = ?`, name)
+}
+
+func (r *tagRepository) Rename(ctx context.Context, id int64, name string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE tags SET name = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM tags WHERE name = ? AND id <> ?)`, name, id, name, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// Nothing changed: either the tag is gone or another tag has the name
+	var other int64
+	err = r.db.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = ? AND id <> ? LIMIT 1`, name, id).Scan(&other)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return domain.ErrTagNameTaken
+}
+
+func (r *tagRepository) Merge(ctx context.Context, fromID, intoID int64) error {
+	if _, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO resource_tags(resource_id,tag_id) SELECT resource_id, ? FROM resource_tags WHERE tag_id = ?`, intoID, fromID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM resource_tags WHERE tag_id = ?`, fromID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, fromID); err != nil {
+		return err
+	}
+	return r.refreshCounts(ctx, intoID)
+}
+
+func (r *tagRepository) get(ctx context.Context, query string, args ...any) (*domain.Tag, error) {
+	t, err := scanTag(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// refreshCounts recomputes resource_count of the given tags
+func (r *tagRepository) refreshCounts(ctx context.Context, ids ...any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE tags SET resource_count = (SELECT COUNT(*) FROM resource_tags WHERE tag_id = tags.id)
+		WHERE id IN (`+placeholders(len(ids))+`)`, ids...)
+	return err
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(",?", n-1)
+}
+
+func scanTag(row rowScanner) (*domain.Tag, error) {
+	var t domain.Tag
+	if err := row.Scan(&t.ID, &t.Name, &t.ResourceCount, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
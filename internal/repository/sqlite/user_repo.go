@@ -4,22 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
 )
 
 type userRepository struct {
-	db *sql.DB
+	db *dbtx.DB
 }
 
 func NewUserRepository(db *sql.DB) domain.UserRepository {
-	return &userRepository{db: db}
+	return &userRepository{db: dbtx.Wrap(db)}
 }
 
 func (r *userRepository) Create(ctx context.Context, u *domain.User) error {
-	stmt := `INSERT INTO users(name,email,password,created_at,phone_number,school,student_id,birthdate,address,gender) VALUES(?,?,?,?,?,?,?,?,?,?)`
-	res, err := r.db.ExecContext(ctx, stmt, u.Name, u.Email, u.Password, time.Now(), u.PhoneNumber, u.School, u.StudentID, u.Birthdate, u.Address, u.Gender)
+	if u.Role == "" {
+		u.Role = domain.RoleUser
+	}
+	stmt := `INSERT INTO users(name,email,password,role,created_at,phone_number,school,student_id,birthdate,address,gender) VALUES(?,?,?,?,?,?,?,?,?,?,?)`
+	res, err := r.db.ExecContext(ctx, stmt, u.Name, u.Email, u.Password, u.Role, time.Now(), u.PhoneNumber, u.School, u.StudentID, u.Birthdate, u.Address, u.Gender)
 	if err != nil {
 		return err
 	}
@@ -28,46 +33,106 @@ func (r *userRepository) Create(ctx context.Context, u *domain.User) error {
 	return nil
 }
 
+const userColumns = `id,name,email,password,COALESCE(role,'USER'),created_at,COALESCE(phone_number,''),COALESCE(school,''),COALESCE(student_id,''),COALESCE(birthdate,''),COALESCE(address,''),COALESCE(gender,''),suspended_at,suspended_until,COALESCE(suspend_reason,''),token_version`
+
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id,name,email,password,created_at,COALESCE(phone_number,''),COALESCE(school,''),COALESCE(student_id,''),COALESCE(birthdate,''),COALESCE(address,''),COALESCE(gender,'') FROM users WHERE email = ?`, email)
-	u := &domain.User{}
-	var created string
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &created, &u.PhoneNumber, &u.School, &u.StudentID, &u.Birthdate, &u.Address, &u.Gender); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	u.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
-	return u, nil
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, email)
 }
 
 func (r *userRepository) GetByPhoneNumber(ctx context.Context, phone string) (*domain.User, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id,name,email,password,created_at,COALESCE(phone_number,''),COALESCE(school,''),COALESCE(student_id,''),COALESCE(birthdate,''),COALESCE(address,''),COALESCE(gender,'') FROM users WHERE phone_number = ?`, phone)
-	u := &domain.User{}
-	var created string
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &created, &u.PhoneNumber, &u.School, &u.StudentID, &u.Birthdate, &u.Address, &u.Gender); err != nil {
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE phone_number = ?`, phone)
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	return r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (r *userRepository) getOne(ctx context.Context, query string, args ...any) (*domain.User, error) {
+	u, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	u.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
 	return u, nil
 }
 
-func (r *userRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id,name,email,password,created_at,COALESCE(phone_number,''),COALESCE(school,''),COALESCE(student_id,''),COALESCE(birthdate,''),COALESCE(address,''),COALESCE(gender,'') FROM users WHERE id = ?`, id)
-	u := &domain.User{}
-	var created string
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &created, &u.PhoneNumber, &u.School, &u.StudentID, &u.Birthdate, &u.Address, &u.Gender); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+func (r *userRepository) List(ctx context.Context, f domain.UserFilter) ([]domain.User, int, error) {
+	where := []string{"1=1"}
+	var args []any
+	if q := strings.TrimSpace(f.Query); q != "" {
+		like := "%" + q + "%"
+		where = append(where, "(name LIKE ? OR email LIKE ? OR phone_number LIKE ? OR school LIKE ?)")
+		args = append(args, like, like, like, like)
+	}
+	if f.Role != "" {
+		where = append(where, "role = ?")
+		args = append(args, f.Role)
+	}
+	if f.Suspended {
+		where = append(where, "suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > ?)")
+		args = append(args, time.Now())
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE `+cond+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var list []domain.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
 		}
+		list = append(list, *u)
+	}
+	return list, total, rows.Err()
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id int64, role domain.UserRole) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET role=? WHERE id=?`, role, id)
+	return err
+}
+
+func (r *userRepository) Suspend(ctx context.Context, id int64, reason string, until *time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET suspended_at=?, suspended_until=?, suspend_reason=? WHERE id=?`, time.Now(), until, reason, id)
+	return err
+}
+
+func (r *userRepository) Unsuspend(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET suspended_at=NULL, suspended_until=NULL, suspend_reason=NULL WHERE id=?`, id)
+	return err
+}
+
+func (r *userRepository) RevokeTokens(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET token_version=token_version+1 WHERE id=?`, id)
+	return err
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var (
+		u               domain.User
+		suspendedAt     sql.NullTime
+		suspendedUntil  sql.NullTime
+	)
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.CreatedAt, &u.PhoneNumber, &u.School, &u.StudentID, &u.Birthdate, &u.Address, &u.Gender, &suspendedAt, &suspendedUntil, &u.SuspendReason, &u.TokenVersion); err != nil {
 		return nil, err
 	}
-	u.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", created)
-	return u, nil
+	if suspendedAt.Valid {
+		u.SuspendedAt = &suspendedAt.Time
+	}
+	if suspendedUntil.Valid {
+		u.SuspendedUntil = &suspendedUntil.Time
+	}
+	return &u, nil
 }
 
 func (r *userRepository) UpdateProfile(ctx context.Context, u *domain.User) error {
@@ -75,3 +140,33 @@ func (r *userRepository) UpdateProfile(ctx context.Context, u *domain.User) erro
 		u.Name, u.School, u.StudentID, u.Birthdate, u.Address, u.Gender, u.ID)
 	return err
 }
+
+func (r *userRepository) UpdateEmail(ctx context.Context, id int64, email string) error {
+	return r.updateUnique(ctx, id, "email", email, domain.ErrEmailTaken)
+}
+
+func (r *userRepository) UpdatePhoneNumber(ctx context.Context, id int64, phone string) error {
+	return r.updateUnique(ctx, id, "phone_number", phone, domain.ErrPhoneTaken)
+}
+
+// updateUnique sets column only if no other user holds the value
+func (r *userRepository) updateUnique(ctx context.Context, id int64, column, value string, errTaken error) error {
+	stmt := `UPDATE users SET ` + column + ` = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM users WHERE ` + column + ` = ? AND id <> ?)`
+	res, err := r.db.ExecContext(ctx, stmt, value, id, value, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// Nothing changed: either the value was already set or someone else holds it
+	var other int64
+	err = r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE `+column+` = ? AND id <> ? LIMIT 1`, value, id).Scan(&other)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return errTaken
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	purposeBindPhone = "bind_phone"
+	purposeBindEmail = "bind_email"
+)
+
+var ErrTooManyRequests = errors.New("too many requests, please try again later")
+
+// RateLimitError is ErrTooManyRequests with the time until the next
+// request is allowed
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string        { return ErrTooManyRequests.Error() }
+func (e *RateLimitError) Is(target error) bool { return target == ErrTooManyRequests }
+
+// allowSend applies the code sending rate limit to a phone number or
+// email address
+func (s *AuthService) allowSend(ctx context.Context, target string) error {
+	if s.rateLimiter == nil {
+		return nil
+	}
+	res, err := s.rateLimiter.Allow(ctx, target)
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	if !res.Allowed {
+		return &RateLimitError{RetryAfter: res.RetryAfter}
+	}
+	return nil
+}
+
+// SendPhoneBindCode sends an SMS code for attaching phone to the user's account
+func (s *AuthService) SendPhoneBindCode(ctx context.Context, userID int64, phone string) error {
+	if err := s.checkPhoneAvailable(ctx, userID, phone); err != nil {
+		return err
+	}
+	if err := s.allowSend(ctx, phone); err != nil {
+		return err
+	}
+
+	code, err := s.issueCode(ctx, bindCodeTarget(userID, phone), purposeBindPhone)
+	if err != nil {
+		return err
+	}
+	return s.smsSender.Send(ctx, phone, code, purposeBindPhone)
+}
+
+// BindPhone attaches or changes the user's phone number after verifying the SMS code
+func (s *AuthService) BindPhone(ctx context.Context, userID int64, phone, code, clientIP string) (*domain.User, error) {
+	target := bindCodeTarget(userID, phone)
+	if err := s.verifyCode(ctx, target, purposeBindPhone, code, clientIP); err != nil {
+		return nil, err
+	}
+	before, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrUserNotFound
+	}
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdatePhoneNumber(ctx, userID, phone); err != nil {
+			return err
+		}
+		return s.codeRepo.Delete(ctx, target, purposeBindPhone)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, domain.AuditPhoneBind, "user", strconv.FormatInt(userID, 10),
+		map[string]string{"phone_number": before.PhoneNumber}, map[string]string{"phone_number": phone})
+
+	return s.userRepo.GetByID(ctx, userID)
+}
+
+// SendEmailBindCode emails a code for attaching address to the user's account
+func (s *AuthService) SendEmailBindCode(ctx context.Context, userID int64, address string) error {
+	address = normalizeEmail(address)
+	if err := s.checkEmailAvailable(ctx, userID, address); err != nil {
+		return err
+	}
+	if err := s.allowSend(ctx, address); err != nil {
+		return err
+	}
+
+	code, err := s.issueCode(ctx, bindCodeTarget(userID, address), purposeBindEmail)
+	if err != nil {
+		return err
+	}
+	return s.emailSender.Send(ctx, address, code, purposeBindEmail)
+}
+
+// BindEmail replaces the user's email (e.g. the synthetic @phone.chirp
+// address of phone sign-ups) after verifying the emailed code
+func (s *AuthService) BindEmail(ctx context.Context, userID int64, address, code, clientIP string) (*domain.User, error) {
+	address = normalizeEmail(address)
+	target := bindCodeTarget(userID, address)
+	if err := s.verifyCode(ctx, target, purposeBindEmail, code, clientIP); err != nil {
+		return nil, err
+	}
+	before, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, ErrUserNotFound
+	}
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdateEmail(ctx, userID, address); err != nil {
+			return err
+		}
+		return s.codeRepo.Delete(ctx, target, purposeBindEmail)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, domain.AuditEmailBind, "user", strconv.FormatInt(userID, 10),
+		map[string]string{"email": before.Email}, map[string]string{"email": address})
+
+	return s.userRepo.GetByID(ctx, userID)
+}
+
+func (s *AuthService) checkPhoneAvailable(ctx context.Context, userID int64, phone string) error {
+	existing, err := s.userRepo.GetByPhoneNumber(ctx, phone)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != userID {
+		return domain.ErrPhoneTaken
+	}
+	return nil
+}
+
+func (s *AuthService) checkEmailAvailable(ctx context.Context, userID int64, address string) error {
+	existing, err := s.userRepo.GetByEmail(ctx, address)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != userID {
+		return domain.ErrEmailTaken
+	}
+	return nil
+}
+
+// bindCodeTarget keys a binding code by the requesting user as well as the
+// phone number or address, so a second user asking to bind the same target
+// does not replace the first user's pending code
+func bindCodeTarget(userID int64, target string) string {
+	return strconv.FormatInt(userID, 10) + ":" + target
+}
+
+func normalizeEmail(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
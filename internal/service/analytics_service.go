@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	statsDayLayout     = "2006-01-02"
+	defaultStatsDays   = 30
+	maxStatsDays       = 365
+	defaultTopLimit    = 10
+	maxTopLimit        = 50
+	topDownloadsPeriod = 7 // days counted by "most downloaded this week"
+)
+
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+// TopResource is a resource with its downloads in the ranking period
+type TopResource struct {
+	Resource  domain.Resource `json:"resource"`
+	Downloads int             `json:"downloads"`
+}
+
+type statKey struct {
+	resourceID int64
+	day        string
+}
+
+// AnalyticsService counts resource downloads and views. A user (or, for
+// anonymous requests, an IP) counts once per resource and event kind within
+// the dedup window. Counts are buffered in memory and written every flush
+// interval, so the database sees one write per resource and day instead of
+// one per request. Dedup state is per process.
+type AnalyticsService struct {
+	repo         domain.AnalyticsRepository
+	resourceRepo domain.ResourceRepository
+	authz        *AuthzService
+	window       time.Duration
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	pending map[statKey]*domain.ResourceDailyStat
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAnalyticsService starts the background flusher; call Close to stop it
+// and write what is still buffered.
+func NewAnalyticsService(repo domain.AnalyticsRepository, resourceRepo domain.ResourceRepository, authz *AuthzService, window, flushInterval time.Duration) *AnalyticsService {
+	s := &AnalyticsService{
+		repo:         repo,
+		resourceRepo: resourceRepo,
+		authz:        authz,
+		window:       window,
+		seen:         make(map[string]time.Time),
+		pending:      make(map[statKey]*domain.ResourceDailyStat),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go s.run(flushInterval)
+	return s
+}
+
+// Record counts an event unless the same viewer triggered it within the
+// window. u may be nil; the client IP from the request info is used then.
+// Without either the event is counted as is, rather than lumping every
+// unknown viewer together.
+func (s *AnalyticsService) Record(ctx context.Context, resourceID int64, kind domain.ResourceEvent, u *domain.User) {
+	var viewer string
+	if u != nil {
+		viewer = "u:" + strconv.FormatInt(u.ID, 10)
+	} else if ip := RequestInfoFrom(ctx).IP; ip != "" {
+		viewer = "ip:" + ip
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if viewer != "" {
+		key := string(kind) + ":" + strconv.FormatInt(resourceID, 10) + ":" + viewer
+		if last, ok := s.seen[key]; ok && now.Sub(last) < s.window {
+			return
+		}
+		s.seen[key] = now
+	}
+
+	k := statKey{resourceID: resourceID, day: now.UTC().Format(statsDayLayout)}
+	st := s.pending[k]
+	if st == nil {
+		st = &domain.ResourceDailyStat{ResourceID: resourceID, Day: k.day}
+		s.pending[k] = st
+	}
+	switch kind {
+	case domain.EventDownload:
+		st.Downloads++
+	case domain.EventView:
+		st.Views++
+	}
+}
+
+// Daily returns per-day counts for the last days days, including days
+// without events. Only the uploader and users with analytics.read may see it.
+func (s *AnalyticsService) Daily(ctx context.Context, viewer *domain.User, id int64, days int) ([]domain.ResourceDailyStat, error) {
+	if days == 0 {
+		days = defaultStatsDays
+	}
+	if days < 1 || days > maxStatsDays {
+		return nil, ErrInvalidStatsRange
+	}
+	res, err := s.resourceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.OwnerID == nil || *res.OwnerID != viewer.ID {
+		ok, err := s.authz.Can(ctx, viewer, domain.PermAnalyticsRead, res.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrForbidden
+		}
+	}
+
+	start := time.Now().UTC().AddDate(0, 0, 1-days)
+	rows, err := s.repo.Daily(ctx, id, start.Format(statsDayLayout))
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]domain.ResourceDailyStat, len(rows))
+	for _, st := range rows {
+		byDay[st.Day] = st
+	}
+	series := make([]domain.ResourceDailyStat, days)
+	for i := range series {
+		day := start.AddDate(0, 0, i).Format(statsDayLayout)
+		series[i] = byDay[day]
+		series[i].ResourceID, series[i].Day = id, day
+	}
+	return series, nil
+}
+
+// TopDownloads ranks approved resources by downloads over the last seven days
+func (s *AnalyticsService) TopDownloads(ctx context.Context, limit int) ([]TopResource, error) {
+	if limit <= 0 {
+		limit = defaultTopLimit
+	}
+	if limit > maxTopLimit {
+		limit = maxTopLimit
+	}
+	from := time.Now().UTC().AddDate(0, 0, 1-topDownloadsPeriod).Format(statsDayLayout)
+	counts, err := s.repo.TopDownloads(ctx, from, limit)
+	if err != nil || len(counts) == 0 {
+		return nil, err
+	}
+	ids := make([]int64, len(counts))
+	for i, c := range counts {
+		ids[i] = c.ResourceID
+	}
+	resources, err := s.resourceRepo.ListByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]domain.Resource, len(resources))
+	for _, res := range resources {
+		byID[res.ID] = res
+	}
+	list := make([]TopResource, 0, len(counts))
+	for _, c := range counts {
+		if res, ok := byID[c.ResourceID]; ok {
+			list = append(list, TopResource{Resource: res, Downloads: c.Count})
+		}
+	}
+	return list, nil
+}
+
+// Close stops the flusher and writes the remaining counts
+func (s *AnalyticsService) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *AnalyticsService) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush writes the buffered counts. On failure they are merged back and
+// retried on the next tick.
+func (s *AnalyticsService) flush() {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = make(map[statKey]*domain.ResourceDailyStat)
+	now := time.Now()
+	for key, at := range s.seen {
+		if now.Sub(at) >= s.window {
+			delete(s.seen, key)
+		}
+	}
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	stats := make([]domain.ResourceDailyStat, 0, len(batch))
+	for _, st := range batch {
+		stats = append(stats, *st)
+	}
+	if err := s.repo.AddDaily(context.Background(), stats); err != nil {
+		log.Printf("analytics flush failed: stats=%d err=%v", len(stats), err)
+		s.mu.Lock()
+		for k, st := range batch {
+			if cur := s.pending[k]; cur != nil {
+				cur.Downloads += st.Downloads
+				cur.Views += st.Views
+			} else {
+				s.pending[k] = st
+			}
+		}
+		s.mu.Unlock()
+	}
+}
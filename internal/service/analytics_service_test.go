@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+// fakeAnalytics keeps the daily rows in memory and fails AddDaily while
+// fail is set
+type fakeAnalytics struct {
+	mu     sync.Mutex
+	fail   bool
+	writes int
+	daily  map[statKey]domain.ResourceDailyStat
+}
+
+func newFakeAnalytics() *fakeAnalytics {
+	return &fakeAnalytics{daily: make(map[statKey]domain.ResourceDailyStat)}
+}
+
+func (f *fakeAnalytics) AddDaily(ctx context.Context, stats []domain.ResourceDailyStat) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("database is down")
+	}
+	f.writes++
+	for _, st := range stats {
+		k := statKey{resourceID: st.ResourceID, day: st.Day}
+		cur := f.daily[k]
+		cur.ResourceID, cur.Day = st.ResourceID, st.Day
+		cur.Downloads += st.Downloads
+		cur.Views += st.Views
+		f.daily[k] = cur
+	}
+	return nil
+}
+
+func (f *fakeAnalytics) Daily(ctx context.Context, resourceID int64, fromDay string) ([]domain.ResourceDailyStat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rows []domain.ResourceDailyStat
+	for k, st := range f.daily {
+		if k.resourceID == resourceID && k.day >= fromDay {
+			rows = append(rows, st)
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeAnalytics) TopDownloads(ctx context.Context, fromDay string, limit int) ([]domain.ResourceCount, error) {
+	return nil, nil
+}
+
+func (f *fakeAnalytics) counts(resourceID int64, day string) domain.ResourceDailyStat {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.daily[statKey{resourceID: resourceID, day: day}]
+}
+
+func TestAnalyticsRecordAndFlush(t *testing.T) {
+	repo := newFakeAnalytics()
+	// flushed by hand; the ticker never fires during the test
+	s := NewAnalyticsService(repo, nil, nil, time.Hour, time.Hour)
+	today := time.Now().UTC().Format(statsDayLayout)
+	alice := &domain.User{ID: 1}
+	fromIP := func(ip string) context.Context {
+		return WithRequestInfo(context.Background(), RequestInfo{IP: ip})
+	}
+
+	// one count per viewer, resource and kind within the window
+	for i := 0; i < 3; i++ {
+		s.Record(fromIP("203.0.113.7"), 10, domain.EventDownload, alice)
+		s.Record(fromIP("203.0.113.7"), 10, domain.EventDownload, nil)
+	}
+	s.Record(fromIP("203.0.113.8"), 10, domain.EventDownload, nil)
+	s.Record(fromIP("203.0.113.7"), 10, domain.EventView, alice)
+	s.Record(fromIP("203.0.113.7"), 11, domain.EventDownload, alice)
+	// without a user or an IP there is nothing to dedup on
+	for i := 0; i < 2; i++ {
+		s.Record(context.Background(), 10, domain.EventView, nil)
+	}
+	s.flush()
+	if got := repo.counts(10, today); got.Downloads != 3 || got.Views != 3 {
+		t.Errorf("resource 10 = %+v; want 3 downloads and 3 views", got)
+	}
+	if got := repo.counts(11, today); got.Downloads != 1 || got.Views != 0 {
+		t.Errorf("resource 11 = %+v; want 1 download", got)
+	}
+
+	// a failed flush keeps its counts for the next one
+	repo.fail = true
+	s.Record(fromIP("203.0.113.9"), 10, domain.EventDownload, nil)
+	s.flush()
+	s.Record(fromIP("203.0.113.10"), 10, domain.EventDownload, nil)
+	s.flush()
+	repo.fail = false
+	writes := repo.writes
+	s.flush()
+	if got := repo.counts(10, today); got.Downloads != 5 || repo.writes != writes+1 {
+		t.Errorf("after a failed flush: resource 10 = %+v in %d writes; want 5 downloads in one write", got, repo.writes-writes)
+	}
+	s.flush()
+	if repo.writes != writes+1 {
+		t.Error("an empty buffer was written")
+	}
+
+	// the window ends and flush forgets the viewer
+	s.mu.Lock()
+	for key := range s.seen {
+		s.seen[key] = time.Now().Add(-time.Hour)
+	}
+	s.mu.Unlock()
+	s.flush()
+	if n := len(s.seen); n != 0 {
+		t.Errorf("%d viewers kept past the window", n)
+	}
+	s.Record(fromIP("203.0.113.7"), 10, domain.EventDownload, alice)
+	s.Close()
+	if got := repo.counts(10, today); got.Downloads != 6 {
+		t.Errorf("resource 10 = %+v; want the download after the window written on Close", got)
+	}
+}
+
+func TestAnalyticsDaily(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit)
+	repo := newFakeAnalytics()
+	s := NewAnalyticsService(repo, resources, authz, time.Hour, time.Hour)
+	t.Cleanup(s.Close)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	admin := &domain.User{Name: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}
+	for _, u := range []*domain.User{owner, other, admin} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := &domain.Resource{Title: "notes", Filename: "notes.pdf", Subject: "math", OwnerID: &owner.ID, Status: domain.ResourceStatusApproved, ReviewRound: 1}
+	if err := resources.Create(ctx, res); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	day := func(ago int) string { return now.AddDate(0, 0, -ago).Format(statsDayLayout) }
+	if err := repo.AddDaily(ctx, []domain.ResourceDailyStat{
+		{ResourceID: res.ID, Day: day(0), Downloads: 2, Views: 5},
+		{ResourceID: res.ID, Day: day(2), Views: 1},
+		{ResourceID: res.ID, Day: day(3), Downloads: 9}, // outside a 3-day range
+		{ResourceID: res.ID + 1, Day: day(1), Downloads: 4},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := s.Daily(ctx, owner, res.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.ResourceDailyStat{
+		{ResourceID: res.ID, Day: day(2), Views: 1},
+		{ResourceID: res.ID, Day: day(1)},
+		{ResourceID: res.ID, Day: day(0), Downloads: 2, Views: 5},
+	}
+	if len(series) != len(want) {
+		t.Fatalf("Daily = %+v; want %d days", series, len(want))
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Errorf("day %d = %+v, want %+v", i, series[i], want[i])
+		}
+	}
+	if series, err := s.Daily(ctx, owner, res.ID, 0); err != nil || len(series) != defaultStatsDays || series[defaultStatsDays-1] != want[2] {
+		t.Errorf("Daily(default) = %d days, %v; want %d ending today", len(series), err, defaultStatsDays)
+	}
+	for _, days := range []int{-1, maxStatsDays + 1} {
+		if _, err := s.Daily(ctx, owner, res.ID, days); !errors.Is(err, ErrInvalidStatsRange) {
+			t.Errorf("Daily(%d days) = %v; want ErrInvalidStatsRange", days, err)
+		}
+	}
+
+	// besides the uploader only analytics.read may look
+	if _, err := s.Daily(ctx, other, res.ID, 3); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Daily(other user) = %v; want ErrForbidden", err)
+	}
+	if series, err := s.Daily(ctx, admin, res.ID, 3); err != nil || len(series) != 3 {
+		t.Errorf("Daily(analytics.read) = %+v, %v", series, err)
+	}
+	if _, err := s.Daily(ctx, owner, 999, 3); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("Daily(missing) = %v; want ErrResourceNotFound", err)
+	}
+}
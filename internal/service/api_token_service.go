@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	// APITokenPrefix distinguishes personal API tokens from JWTs
+	APITokenPrefix = "chirp_pat_"
+	maxAPITokens   = 20
+	// lastUsedResolution limits how often usage is written back per token
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrTooManyAPITokens = errors.New("too many API tokens")
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+// APITokenService manages personal access tokens
+type APITokenService struct {
+	repo     domain.APITokenRepository
+	userRepo domain.UserRepository
+	authz    *AuthzService
+	audit    *AuditService
+}
+
+// scopePermissions lists scopes that may only be requested by holders of a permission
+var scopePermissions = map[string]domain.Permission{
+	domain.ScopeAdminReview: domain.PermResourceReview,
+}
+
+func NewAPITokenService(repo domain.APITokenRepository, userRepo domain.UserRepository, authz *AuthzService, audit *AuditService) *APITokenService {
+	return &APITokenService{
+		repo:     repo,
+		userRepo: userRepo,
+		authz:    authz,
+		audit:    audit,
+	}
+}
+
+// Create issues a new token for u and returns it together with the
+// plaintext secret, which is never retrievable again. mfa records whether
+// the creating session passed two-factor authentication.
+func (s *APITokenService) Create(ctx context.Context, u *domain.User, name string, scopes []string, expiresAt *time.Time, mfa bool) (*domain.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, "", errors.New("name required (max 100 characters)")
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, sc := range scopes {
+		if !validScope(sc) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, sc)
+		}
+		if perm, ok := scopePermissions[sc]; ok {
+			allowed, err := s.authz.CanAny(ctx, u, perm)
+			if err != nil {
+				return nil, "", err
+			}
+			if !allowed {
+				return nil, "", fmt.Errorf("%w: %s requires %s permission", ErrInvalidScope, sc, perm)
+			}
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+
+	existing, err := s.repo.ListByUser(ctx, u.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	active := 0
+	for _, t := range existing {
+		if t.RevokedAt == nil {
+			active++
+		}
+	}
+	if active >= maxAPITokens {
+		return nil, "", ErrTooManyAPITokens
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t := &domain.APIToken{
+		UserID:    u.ID,
+		Name:      name,
+		Prefix:    secret[:len(APITokenPrefix)+6],
+		TokenHash: hashAPIToken(secret),
+		Scopes:    scopes,
+		MFA:       mfa,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, t); err != nil {
+		return nil, "", err
+	}
+	s.audit.Record(ctx, u.ID, domain.AuditAPITokenCreate, "api_token", strconv.FormatInt(t.ID, 10), nil, t)
+	return t, secret, nil
+}
+
+func (s *APITokenService) List(ctx context.Context, userID int64) ([]domain.APIToken, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *APITokenService) Revoke(ctx context.Context, userID, id int64) error {
+	ok, err := s.repo.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPITokenNotFound
+	}
+	s.audit.Record(ctx, userID, domain.AuditAPITokenRevoke, "api_token", strconv.FormatInt(id, 10), nil, nil)
+	return nil
+}
+
+// Authenticate resolves a presented token to its user. Revoked and expired
+// tokens are rejected; last-used time and IP are recorded.
+func (s *APITokenService) Authenticate(ctx context.Context, secret, clientIP string) (*domain.User, *domain.APIToken, error) {
+	t, err := s.repo.GetByHash(ctx, hashAPIToken(secret))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if t == nil || t.RevokedAt != nil || (t.ExpiresAt != nil && now.After(*t.ExpiresAt)) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	u, err := s.userRepo.GetByID(ctx, t.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= lastUsedResolution || t.LastUsedIP != clientIP {
+		if err := s.repo.TouchLastUsed(ctx, t.ID, now, clientIP); err != nil {
+			log.Printf("api token touch failed: id=%d err=%v", t.ID, err)
+		}
+	}
+	return u, t, nil
+}
+
+// IsAPIToken reports whether a bearer credential looks like a personal API token
+func IsAPIToken(credential string) bool {
+	return strings.HasPrefix(credential, APITokenPrefix)
+}
+
+func validScope(scope string) bool {
+	for _, sc := range domain.APITokenScopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	repo := sqlite.NewAPITokenRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit)
+	s := NewAPITokenService(repo, users, authz, audit)
+
+	dev := &domain.User{Name: "dev", Email: "dev@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	for _, u := range []*domain.User{dev, other} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := s.Create(ctx, dev, "ci", nil, nil, false); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Create(no scopes) = %v; want ErrInvalidScope", err)
+	}
+	if _, _, err := s.Create(ctx, dev, "ci", []string{"resources:delete"}, nil, false); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Create(unknown scope) = %v; want ErrInvalidScope", err)
+	}
+	if _, _, err := s.Create(ctx, dev, "ci", []string{domain.ScopeAdminReview}, nil, false); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Create(admin scope without permission) = %v; want ErrInvalidScope", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := s.Create(ctx, dev, "ci", []string{domain.ScopeResourcesRead}, &past, false); err == nil {
+		t.Error("Create(expired) succeeded")
+	}
+
+	// only the hash of the secret is stored, and it finds the token again
+	tok, secret, err := s.Create(ctx, dev, "ci", []string{domain.ScopeResourcesRead}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIToken(secret) || !strings.HasPrefix(secret, tok.Prefix) || tok.TokenHash != hashAPIToken(secret) || strings.Contains(tok.TokenHash, secret) {
+		t.Errorf("token %+v does not match secret %q", tok, secret)
+	}
+	u, got, err := s.Authenticate(ctx, secret, "203.0.113.7")
+	if err != nil || u.ID != dev.ID || got.ID != tok.ID || !got.MFA {
+		t.Fatalf("Authenticate = %+v, %+v, %v", u, got, err)
+	}
+	if got, err := repo.GetByHash(ctx, tok.TokenHash); err != nil || got.LastUsedAt == nil || got.LastUsedIP != "203.0.113.7" {
+		t.Errorf("usage not recorded: %+v, %v", got, err)
+	}
+	if _, _, err := s.Authenticate(ctx, secret+"x", ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate(wrong secret) = %v; want ErrInvalidToken", err)
+	}
+
+	// expiry
+	soon := time.Now().Add(time.Hour)
+	expiring, expiringSecret, err := s.Create(ctx, dev, "short", []string{domain.ScopeResourcesRead}, &soon, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Authenticate(ctx, expiringSecret, ""); err != nil {
+		t.Errorf("Authenticate before expiry = %v", err)
+	}
+	if _, err := db.Exec(`UPDATE api_tokens SET expires_at = ? WHERE id = ?`, past, expiring.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Authenticate(ctx, expiringSecret, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after expiry = %v; want ErrInvalidToken", err)
+	}
+
+	// revocation is limited to the owner
+	if err := s.Revoke(ctx, other.ID, tok.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("Revoke(other user) = %v; want ErrAPITokenNotFound", err)
+	}
+	if err := s.Revoke(ctx, dev.ID, tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, dev.ID, tok.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("second Revoke = %v; want ErrAPITokenNotFound", err)
+	}
+	if _, _, err := s.Authenticate(ctx, secret, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after Revoke = %v; want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+	auditAppendRetries   = 3
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo carries per-request metadata recorded in the audit log
+type RequestInfo struct {
+	IP        string
+	RequestID string
+}
+
+// WithRequestInfo attaches request metadata for the audit log to ctx
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the metadata set by WithRequestInfo, if any
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// AuditVerification is the result of walking the hash chain
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Checked  int    `json:"checked"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // ID of the first entry that does not verify
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditService appends to and reads the hash-chained audit log
+type AuditService struct {
+	repo domain.AuditRepository
+	// mu serializes appends within this process; the unique prev_hash
+	// column catches writers in other processes.
+	mu sync.Mutex
+}
+
+func NewAuditService(repo domain.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends an entry. actorID 0 records an anonymous actor; before and
+// after are stored as JSON snapshots. Failures are logged rather than
+// returned so an audit outage does not undo the action being audited.
+func (s *AuditService) Record(ctx context.Context, actorID int64, action, targetType, targetID string, before, after any) {
+	info := RequestInfoFrom(ctx)
+	e := &domain.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         info.IP,
+		RequestID:  info.RequestID,
+	}
+	if actorID != 0 {
+		e.ActorID = &actorID
+	}
+	var err error
+	if e.Before, err = marshalState(before); err == nil {
+		e.After, err = marshalState(after)
+	}
+	if err == nil {
+		// The entry must be written even if the client has gone away
+		err = s.append(context.WithoutCancel(ctx), e)
+	}
+	if err != nil {
+		log.Printf("audit record failed: action=%s target=%s/%s err=%v", action, targetType, targetID, err)
+	}
+}
+
+func (s *AuditService) append(ctx context.Context, e *domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for i := 0; i < auditAppendRetries; i++ {
+		var last *domain.AuditEntry
+		if last, err = s.repo.Last(ctx); err != nil {
+			return err
+		}
+		e.PrevHash = ""
+		if last != nil {
+			e.PrevHash = last.Hash
+		}
+		// Stored timestamps have second precision in MySQL; hash what is stored
+		e.CreatedAt = time.Now().Truncate(time.Second)
+		e.Hash = HashAuditEntry(e)
+		if err = s.repo.Append(ctx, e); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *AuditService) List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// Export writes all matching entries, oldest first, as JSON lines
+func (s *AuditService) Export(ctx context.Context, filter domain.AuditFilter, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	filter.Ascending = true
+	filter.Limit = maxAuditPageSize
+	for {
+		page, err := s.repo.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			if err := enc.Encode(&page[i]); err != nil {
+				return err
+			}
+		}
+		if len(page) < filter.Limit {
+			return nil
+		}
+		filter.AfterID = page[len(page)-1].ID
+	}
+}
+
+// Verify walks the whole chain and reports the first entry whose hash or
+// link to its predecessor does not match.
+func (s *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	res := &AuditVerification{OK: true}
+	filter := domain.AuditFilter{Ascending: true, Limit: maxAuditPageSize}
+	prev := ""
+	for {
+		page, err := s.repo.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page {
+			e := &page[i]
+			switch {
+			case e.PrevHash != prev:
+				res.OK, res.BrokenAt, res.Reason = false, e.ID, "prev_hash does not match preceding entry"
+			case HashAuditEntry(e) != e.Hash:
+				res.OK, res.BrokenAt, res.Reason = false, e.ID, "hash does not match entry contents"
+			}
+			if !res.OK {
+				return res, nil
+			}
+			prev = e.Hash
+			res.Checked++
+		}
+		if len(page) < filter.Limit {
+			return res, nil
+		}
+		filter.AfterID = page[len(page)-1].ID
+	}
+}
+
+// HashAuditEntry computes the chained hash of e over PrevHash and every
+// recorded field except ID and Hash.
+func HashAuditEntry(e *domain.AuditEntry) string {
+	var actor int64
+	if e.ActorID != nil {
+		actor = *e.ActorID
+	}
+	b, _ := json.Marshal([]any{
+		e.PrevHash,
+		actor,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		string(e.Before),
+		string(e.After),
+		e.IP,
+		e.RequestID,
+		e.CreatedAt.Unix(),
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func marshalState(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
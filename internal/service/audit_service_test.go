@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+// racingAudit lets another writer extend the chain right after the next
+// Last, so the entry read is stale by the time it is appended to
+type racingAudit struct {
+	domain.AuditRepository
+	other *AuditService
+	raced int
+}
+
+func (r *racingAudit) Last(ctx context.Context) (*domain.AuditEntry, error) {
+	last, err := r.AuditRepository.Last(ctx)
+	if err == nil && r.other != nil {
+		other := r.other
+		r.other = nil
+		other.Record(ctx, 2, "racer.append", "", "", nil, nil)
+		r.raced++
+	}
+	return last, err
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IP: "203.0.113.7", RequestID: "req-1"})
+	db := openTestDB(t)
+	s := NewAuditService(sqlite.NewAuditRepository(db))
+
+	if res, err := s.Verify(ctx); err != nil || !res.OK || res.Checked != 0 {
+		t.Fatalf("Verify(empty) = %+v, %v", res, err)
+	}
+	for i := 1; i <= 3; i++ {
+		s.Record(ctx, 1, "resource.approve", "resource", strconv.Itoa(i), map[string]string{"status": "pending"}, map[string]string{"status": "approved"})
+	}
+	s.Record(ctx, 0, domain.AuditLoginFailed, "login", "a@example.com", nil, nil)
+
+	res, err := s.Verify(ctx)
+	if err != nil || !res.OK || res.Checked != 4 {
+		t.Fatalf("Verify = %+v, %v; want 4 entries checked", res, err)
+	}
+	entries, err := s.List(ctx, domain.AuditFilter{Ascending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].PrevHash != "" || entries[1].PrevHash != entries[0].Hash || entries[3].ActorID != nil {
+		t.Errorf("chain = %+v", entries)
+	}
+	if entries[0].IP != "203.0.113.7" || entries[0].RequestID != "req-1" {
+		t.Errorf("request info not recorded: %+v", entries[0])
+	}
+
+	// editing a recorded state is caught at that entry
+	if _, err := db.Exec(`UPDATE audit_log SET after_state = ? WHERE id = ?`, `{"status":"rejected"}`, entries[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	res, err = s.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK || res.BrokenAt != entries[2].ID || res.Checked != 2 {
+		t.Errorf("Verify after edit = %+v; want broken at %d", res, entries[2].ID)
+	}
+}
+
+func TestAuditAppendRetriesStaleLast(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	other := NewAuditService(sqlite.NewAuditRepository(db))
+	other.Record(ctx, 2, "racer.append", "", "", nil, nil)
+
+	repo := &racingAudit{AuditRepository: sqlite.NewAuditRepository(db), other: other}
+	s := NewAuditService(repo)
+	s.Record(ctx, 1, "user.force_logout", "user", "3", nil, nil)
+	if repo.raced != 1 {
+		t.Fatal("the other writer did not run")
+	}
+
+	entries, err := s.List(ctx, domain.AuditFilter{Ascending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Action != "user.force_logout" || entries[2].PrevHash != entries[1].Hash {
+		t.Errorf("entries = %+v; want the retried entry linked after the racer's", entries)
+	}
+	if res, err := s.Verify(ctx); err != nil || !res.OK || res.Checked != 3 {
+		t.Errorf("Verify = %+v, %v", res, err)
+	}
+}
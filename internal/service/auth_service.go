@@ -3,51 +3,79 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/email"
 	"github.com/zuquanzhi/Chirp/backend/pkg/limiter"
 	"github.com/zuquanzhi/Chirp/backend/pkg/sms"
 	"github.com/zuquanzhi/Chirp/backend/pkg/util"
 )
 
+// maxCodeAttempts is the number of wrong guesses after which a
+// verification code is invalidated and a new one must be requested.
+const maxCodeAttempts = 5
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidCode        = errors.New("invalid or expired verification code")
+	ErrTooManyAttempts    = errors.New("too many failed attempts, please try again later")
+)
+
+const accessTokenTTL = 24 * time.Hour
+
 type AuthService struct {
 	userRepo    domain.UserRepository
 	codeRepo    domain.VerificationCodeRepository
+	tfRepo      domain.TwoFactorRepository
 	smsSender   sms.Sender
+	emailSender email.Sender
 	rateLimiter limiter.RateLimiter
+	attempts    limiter.AttemptTracker
+	audit       *AuditService
+	tx          domain.TxManager
 	jwtSecret   string
 }
 
-func NewAuthService(userRepo domain.UserRepository, codeRepo domain.VerificationCodeRepository, smsSender sms.Sender, rateLimiter limiter.RateLimiter, jwtSecret string) *AuthService {
+func NewAuthService(userRepo domain.UserRepository, codeRepo domain.VerificationCodeRepository, tfRepo domain.TwoFactorRepository, smsSender sms.Sender, emailSender email.Sender, rateLimiter limiter.RateLimiter, attempts limiter.AttemptTracker, audit *AuditService, tx domain.TxManager, jwtSecret string) *AuthService {
 	return &AuthService{
 		userRepo:    userRepo,
 		codeRepo:    codeRepo,
+		tfRepo:      tfRepo,
 		smsSender:   smsSender,
+		emailSender: emailSender,
 		rateLimiter: rateLimiter,
+		attempts:    attempts,
+		audit:       audit,
+		tx:          tx,
 		jwtSecret:   jwtSecret,
 	}
 }
 
+// LoginResult is returned by the password/SMS login step. When the account
+// has two-factor authentication enabled, only TwoFactorToken is set and it
+// must be exchanged for a full token via CompleteTwoFactorLogin.
+type LoginResult struct {
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	TwoFactorToken    string `json:"two_factor_token,omitempty"`
+}
+
 func (s *AuthService) SendCode(ctx context.Context, phone, purpose string) error {
 	// Rate Limit Check
-	if s.rateLimiter != nil && !s.rateLimiter.Allow(phone) {
-		return errors.New("too many requests, please try again later")
-	}
-
-	// Generate 6 digit secure random code
-	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
-	if err != nil {
+	if err := s.allowSend(ctx, phone); err != nil {
 		return err
 	}
-	code := fmt.Sprintf("%06d", n.Int64())
 
-	// Save to DB
-	if err := s.codeRepo.Save(ctx, phone, code, purpose, 5*time.Minute); err != nil {
+	code, err := s.issueCode(ctx, phone, purpose)
+	if err != nil {
 		return err
 	}
 
@@ -59,24 +87,11 @@ func (s *AuthService) SendCode(ctx context.Context, phone, purpose string) error
 	return nil
 }
 
-func (s *AuthService) SignupWithPhone(ctx context.Context, name, phone, code, password string) (*domain.User, error) {
+func (s *AuthService) SignupWithPhone(ctx context.Context, name, phone, code, password, clientIP string) (*domain.User, error) {
 	// Verify Code
-	storedCode, err := s.codeRepo.Get(ctx, phone, "signup")
-	if err != nil {
+	if err := s.verifyCode(ctx, phone, "signup", code, clientIP); err != nil {
 		return nil, err
 	}
-	if storedCode == "" || storedCode != code {
-		return nil, errors.New("invalid or expired verification code")
-	}
-
-	// Check existing
-	existing, err := s.userRepo.GetByPhoneNumber(ctx, phone)
-	if err != nil {
-		return nil, err
-	}
-	if existing != nil {
-		return nil, errors.New("phone number already used")
-	}
 
 	hash, err := util.HashPassword(password)
 	if err != nil {
@@ -91,46 +106,50 @@ func (s *AuthService) SignupWithPhone(ctx context.Context, name, phone, code, pa
 		Email: phone + "@phone.chirp",
 	}
 
-	if err := s.userRepo.Create(ctx, u); err != nil {
+	// The account only exists once the code is used up, and the code stays
+	// valid if the account cannot be created
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.userRepo.GetByPhoneNumber(ctx, phone)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return domain.ErrPhoneTaken
+		}
+		if err := s.userRepo.Create(ctx, u); err != nil {
+			return err
+		}
+		return s.codeRepo.Delete(ctx, phone, "signup")
+	})
+	if err != nil {
 		return nil, err
 	}
-
-	// Cleanup code
-	s.codeRepo.Delete(ctx, phone, "signup")
-
 	return u, nil
 }
 
-func (s *AuthService) LoginWithPhone(ctx context.Context, phone, code string) (string, error) {
+func (s *AuthService) LoginWithPhone(ctx context.Context, phone, code, clientIP string) (*LoginResult, error) {
 	// Verify Code
-	storedCode, err := s.codeRepo.Get(ctx, phone, "login")
-	if err != nil {
-		return "", err
-	}
-	if storedCode == "" || storedCode != code {
-		return "", errors.New("invalid or expired verification code")
+	if err := s.verifyCode(ctx, phone, "login", code, clientIP); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			s.audit.Record(ctx, 0, domain.AuditLoginFailed, "login", phone, nil, map[string]string{"method": "sms", "reason": "invalid code"})
+		}
+		return nil, err
 	}
 
 	u, err := s.userRepo.GetByPhoneNumber(ctx, phone)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if u == nil {
-		return "", errors.New("user not found")
+		return nil, errors.New("user not found")
 	}
 
-	// Generate Token
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   u.ID,
-		"email": u.Email,
-		"phone": u.PhoneNumber,
-		"exp":   time.Now().Add(24 * time.Hour).Unix(),
-	})
-
 	// Cleanup code
-	s.codeRepo.Delete(ctx, phone, "login")
+	if err := s.codeRepo.Delete(ctx, phone, "login"); err != nil {
+		return nil, err
+	}
 
-	return t.SignedString([]byte(s.jwtSecret))
+	return s.finishLogin(ctx, u, "sms")
 }
 
 func (s *AuthService) Signup(ctx context.Context, name, email, password string) (*domain.User, error) {
@@ -139,7 +158,7 @@ func (s *AuthService) Signup(ctx context.Context, name, email, password string)
 		return nil, err
 	}
 	if existing != nil {
-		return nil, errors.New("email already used")
+		return nil, domain.ErrEmailTaken
 	}
 
 	hash, err := util.HashPassword(password)
@@ -160,26 +179,97 @@ func (s *AuthService) Signup(ctx context.Context, name, email, password string)
 	return u, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
-	u, err := s.userRepo.GetByEmail(ctx, email)
+// Login checks a password. The identifier is an email address, or a phone
+// number for accounts that have one attached.
+func (s *AuthService) Login(ctx context.Context, identifier, password, clientIP string) (*LoginResult, error) {
+	acctKey := "login:" + strings.ToLower(identifier)
+	ipKey := ipAttemptKey(clientIP)
+	// The attempt is counted before the password is checked, so concurrent
+	// guesses cannot all pass while the first bcrypt comparison runs
+	if _, ok := s.reserve(acctKey, ipKey); !ok {
+		return nil, ErrTooManyAttempts
+	}
+
+	var (
+		u   *domain.User
+		err error
+	)
+	if strings.Contains(identifier, "@") {
+		u, err = s.userRepo.GetByEmail(ctx, identifier)
+	} else {
+		u, err = s.userRepo.GetByPhoneNumber(ctx, identifier)
+	}
 	if err != nil {
-		return "", err
+		s.release(acctKey, ipKey)
+		return nil, err
 	}
 	if u == nil {
-		return "", errors.New("invalid credentials")
+		s.audit.Record(ctx, 0, domain.AuditLoginFailed, "login", identifier, nil, map[string]string{"method": "password", "reason": "unknown account"})
+		return nil, ErrInvalidCredentials
 	}
 
 	if err := util.CheckPassword(u.Password, password); err != nil {
-		return "", errors.New("invalid credentials")
+		s.audit.Record(ctx, 0, domain.AuditLoginFailed, "login", identifier, nil, map[string]string{"method": "password", "reason": "wrong password"})
+		return nil, ErrInvalidCredentials
+	}
+	s.reset(acctKey)
+	s.release(ipKey)
+
+	return s.finishLogin(ctx, u, "password")
+}
+
+// finishLogin issues a full access token, or an intermediate two-factor
+// token when the user has TOTP enabled. method names the first factor for
+// the audit log.
+func (s *AuthService) finishLogin(ctx context.Context, u *domain.User, method string) (*LoginResult, error) {
+	if u.Suspended(time.Now()) {
+		return nil, ErrAccountSuspended
+	}
+	tf, err := s.tfRepo.Get(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tf != nil && tf.Enabled {
+		token, err := s.signTwoFactorToken(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{TwoFactorRequired: true, TwoFactorToken: token}, nil
 	}
 
-	// Generate Token
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	token, err := s.signToken(u, "", accessTokenTTL, false, "")
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, u.ID, domain.AuditLogin, "user", strconv.FormatInt(u.ID, 10), nil, map[string]string{"method": method})
+	return &LoginResult{Token: token}, nil
+}
+
+// signToken generates a JWT for u. Access tokens have an empty typ; mfa marks
+// tokens obtained with a second factor, and jti, when set, identifies a
+// single-use token.
+func (s *AuthService) signToken(u *domain.User, typ string, ttl time.Duration, mfa bool, jti string) (string, error) {
+	claims := jwt.MapClaims{
 		"sub":   u.ID,
 		"email": u.Email,
-		"exp":   time.Now().Add(24 * time.Hour).Unix(),
-	})
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(ttl).Unix(),
+		"sv":    u.TokenVersion,
+	}
+	if u.PhoneNumber != "" {
+		claims["phone"] = u.PhoneNumber
+	}
+	if typ != "" {
+		claims["typ"] = typ
+	}
+	if mfa {
+		claims["mfa"] = true
+	}
+	if jti != "" {
+		claims["jti"] = jti
+	}
 
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return t.SignedString([]byte(s.jwtSecret))
 }
 
@@ -197,6 +287,8 @@ func (s *AuthService) UpdateProfile(ctx context.Context, u *domain.User) (*domai
 		return nil, errors.New("user not found")
 	}
 
+	before := *existing
+
 	// Apply updates (allow empty string to clear)
 	existing.Name = u.Name
 	existing.School = u.School
@@ -208,6 +300,145 @@ func (s *AuthService) UpdateProfile(ctx context.Context, u *domain.User) (*domai
 	if err := s.userRepo.UpdateProfile(ctx, existing); err != nil {
 		return nil, err
 	}
+	s.audit.Record(ctx, existing.ID, domain.AuditProfileUpdate, "user", strconv.FormatInt(existing.ID, 10), before, existing)
 
 	return existing, nil
 }
+
+// issueCode generates a 6 digit secure random code and stores it for target
+func (s *AuthService) issueCode(ctx context.Context, target, purpose string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	// Save to DB
+	if err := s.codeRepo.Save(ctx, target, code, purpose, 5*time.Minute); err != nil {
+		return "", err
+	}
+	// A fresh code gets a fresh attempt budget
+	if s.attempts != nil {
+		s.attempts.Reset(codeAttemptKey(target, purpose))
+	}
+	return code, nil
+}
+
+// verifyCode checks a submitted verification code in constant time. Every
+// guess counts against both the phone/purpose and the client IP before it
+// is compared, so parallel requests cannot all guess before the first
+// failure is recorded; the stored code is invalidated after
+// maxCodeAttempts guesses.
+func (s *AuthService) verifyCode(ctx context.Context, phone, purpose, code, clientIP string) error {
+	codeKey := codeAttemptKey(phone, purpose)
+	ipKey := ipAttemptKey(clientIP)
+	n, ok := s.reserve(codeKey, ipKey)
+	if !ok {
+		return ErrTooManyAttempts
+	}
+	if n > maxCodeAttempts {
+		// The code has had all its guesses; issueCode resets the count
+		if err := s.codeRepo.Delete(ctx, phone, purpose); err != nil {
+			return err
+		}
+		return ErrTooManyAttempts
+	}
+
+	storedCode, err := s.codeRepo.Get(ctx, phone, purpose)
+	if err != nil {
+		return err
+	}
+	if storedCode == "" {
+		return ErrInvalidCode
+	}
+	if subtle.ConstantTimeCompare([]byte(storedCode), []byte(code)) != 1 {
+		if n == maxCodeAttempts {
+			if err := s.codeRepo.Delete(ctx, phone, purpose); err != nil {
+				return err
+			}
+		}
+		return ErrInvalidCode
+	}
+
+	s.reset(codeKey)
+	s.release(ipKey)
+	return nil
+}
+
+// reserve counts an attempt against every key before it is checked and
+// returns the count for the first key. Nothing is counted when any key is
+// blocked.
+func (s *AuthService) reserve(keys ...string) (int, bool) {
+	if s.attempts == nil {
+		return 0, true
+	}
+	first := 0
+	var reserved []string
+	for i, k := range keys {
+		if k == "" {
+			continue
+		}
+		n, ok := s.attempts.Reserve(k)
+		if !ok {
+			s.release(reserved...)
+			return n, false
+		}
+		if i == 0 {
+			first = n
+		}
+		reserved = append(reserved, k)
+	}
+	return first, true
+}
+
+func (s *AuthService) release(keys ...string) {
+	if s.attempts == nil {
+		return
+	}
+	for _, k := range keys {
+		if k != "" {
+			s.attempts.Release(k)
+		}
+	}
+}
+
+func (s *AuthService) blocked(keys ...string) bool {
+	if s.attempts == nil {
+		return false
+	}
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if blocked, _ := s.attempts.Blocked(k); blocked {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AuthService) reset(keys ...string) {
+	if s.attempts == nil {
+		return
+	}
+	for _, k := range keys {
+		if k != "" {
+			s.attempts.Reset(k)
+		}
+	}
+}
+
+func codeAttemptKey(phone, purpose string) string {
+	return "code:" + purpose + ":" + phone
+}
+
+func twoFactorAttemptKey(userID int64) string {
+	return "2fa:" + strconv.FormatInt(userID, 10)
+}
+
+func ipAttemptKey(clientIP string) string {
+	if clientIP == "" {
+		return ""
+	}
+	return "ip:" + clientIP
+}
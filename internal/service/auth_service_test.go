@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/pkg/limiter"
+	"github.com/zuquanzhi/Chirp/backend/pkg/util"
+)
+
+// openTestDB returns a migrated, empty SQLite database
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "chirp.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := sqlite.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// lastCode is an SMS and email sender that keeps the last code per target
+type lastCode struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func (l *lastCode) Send(ctx context.Context, target, code, purpose string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.codes[target] = code
+	return nil
+}
+
+// memCodes is a VerificationCodeRepository whose Get is slow enough for
+// parallel requests to overlap
+type memCodes struct {
+	mu    sync.Mutex
+	codes map[string]string
+	gets  atomic.Int32
+}
+
+func (m *memCodes) Save(ctx context.Context, phone, code, purpose string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[purpose+":"+phone] = code
+	return nil
+}
+
+func (m *memCodes) Get(ctx context.Context, phone, purpose string) (string, error) {
+	m.gets.Add(1)
+	time.Sleep(5 * time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.codes[purpose+":"+phone], nil
+}
+
+func (m *memCodes) Delete(ctx context.Context, phone, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.codes, purpose+":"+phone)
+	return nil
+}
+
+func (m *memCodes) Consume(ctx context.Context, phone, code, purpose string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.codes[purpose+":"+phone] != code {
+		return false, nil
+	}
+	delete(m.codes, purpose+":"+phone)
+	return true, nil
+}
+
+func TestVerifyCodeLimitsGuesses(t *testing.T) {
+	ctx := context.Background()
+	codes := &memCodes{codes: map[string]string{}}
+	// No delays, so only the per-code limit applies
+	s := &AuthService{codeRepo: codes, attempts: limiter.NewInMemoryAttemptTracker(limiter.AttemptPolicy{Window: time.Hour})}
+
+	codes.Save(ctx, "13900000000", "123456", "login", time.Minute)
+	for i := 0; i < maxCodeAttempts-1; i++ {
+		if err := s.verifyCode(ctx, "13900000000", "login", "000000", "203.0.113.1"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("wrong guess %d = %v; want ErrInvalidCode", i+1, err)
+		}
+	}
+	if err := s.verifyCode(ctx, "13900000000", "login", "123456", "203.0.113.1"); err != nil {
+		t.Fatalf("right code on the last guess = %v", err)
+	}
+
+	// A fresh code gets a fresh budget, and the last wrong guess uses it up
+	code, err := s.issueCode(ctx, "13900000000", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxCodeAttempts; i++ {
+		s.verifyCode(ctx, "13900000000", "login", "wrong", "203.0.113.1")
+	}
+	if err := s.verifyCode(ctx, "13900000000", "login", code, "203.0.113.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("right code after %d wrong guesses = %v; want ErrTooManyAttempts", maxCodeAttempts, err)
+	}
+	if stored, _ := codes.Get(ctx, "13900000000", "login"); stored != "" {
+		t.Error("code still stored after running out of guesses")
+	}
+}
+
+func TestVerifyCodeConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	codes := &memCodes{codes: map[string]string{}}
+	s := &AuthService{codeRepo: codes, attempts: limiter.NewInMemoryAttemptTracker(limiter.AttemptPolicy{Window: time.Hour})}
+	codes.Save(ctx, "13900000000", "123456", "login", time.Minute)
+
+	// Every request starts before any has been compared; only
+	// maxCodeAttempts of them may reach the stored code
+	var (
+		wg      sync.WaitGroup
+		correct atomic.Int32
+	)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			guess := fmt.Sprintf("%06d", i)
+			if i == 150 {
+				guess = "123456"
+			}
+			if s.verifyCode(ctx, "13900000000", "login", guess, fmt.Sprintf("203.0.113.%d", i%250)) == nil {
+				correct.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := codes.gets.Load(); n > maxCodeAttempts {
+		t.Errorf("%d guesses compared against the code; want at most %d", n, maxCodeAttempts)
+	}
+	if correct.Load() > 1 {
+		t.Errorf("%d requests verified", correct.Load())
+	}
+}
+
+func TestLoginConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	hash, err := util.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(ctx, &domain.User{Name: "alice", Email: "alice@example.com", Password: hash}); err != nil {
+		t.Fatal(err)
+	}
+	const threshold = 5
+	s := &AuthService{
+		userRepo: users,
+		audit:    NewAuditService(sqlite.NewAuditRepository(db)),
+		attempts: limiter.NewInMemoryAttemptTracker(limiter.AttemptPolicy{LockoutThreshold: threshold, LockoutDuration: time.Hour, Window: time.Hour}),
+	}
+
+	// Every guess starts before any password has been compared; only
+	// threshold of them may reach bcrypt
+	var (
+		wg       sync.WaitGroup
+		compared atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Login(ctx, "alice@example.com", fmt.Sprintf("guess %d", i), fmt.Sprintf("203.0.113.%d", i))
+			if errors.Is(err, ErrInvalidCredentials) {
+				compared.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := compared.Load(); n > threshold {
+		t.Errorf("%d guesses compared against the password; want at most %d", n, threshold)
+	}
+	if _, err := s.Login(ctx, "alice@example.com", "correct horse", "198.51.100.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Login after lockout = %v; want ErrTooManyAttempts", err)
+	}
+}
+
+func TestBindCodesPerUser(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	sent := &lastCode{codes: map[string]string{}}
+	s := &AuthService{
+		userRepo:  users,
+		codeRepo:  sqlite.NewCodeRepository(db),
+		smsSender: sent,
+		audit:     NewAuditService(sqlite.NewAuditRepository(db)),
+		tx:        dbtx.NewManager(db),
+	}
+	alice := &domain.User{Name: "alice", Email: "alice@example.com"}
+	bob := &domain.User{Name: "bob", Email: "bob@example.com"}
+	for _, u := range []*domain.User{alice, bob} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.SendPhoneBindCode(ctx, alice.ID, "13900000000"); err != nil {
+		t.Fatal(err)
+	}
+	aliceCode := sent.codes["13900000000"]
+	// Bob asking for the same number must not replace Alice's code
+	if err := s.SendPhoneBindCode(ctx, bob.ID, "13900000000"); err != nil {
+		t.Fatal(err)
+	}
+	bobCode := sent.codes["13900000000"]
+
+	if aliceCode != bobCode {
+		if _, err := s.BindPhone(ctx, bob.ID, "13900000000", aliceCode, ""); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("bob binding with alice's code = %v; want ErrInvalidCode", err)
+		}
+	}
+	u, err := s.BindPhone(ctx, alice.ID, "13900000000", aliceCode, "")
+	if err != nil {
+		t.Fatalf("alice binding after bob's request = %v", err)
+	}
+	if u.PhoneNumber != "13900000000" {
+		t.Errorf("phone = %q", u.PhoneNumber)
+	}
+	if _, err := s.BindPhone(ctx, bob.ID, "13900000000", bobCode, ""); !errors.Is(err, domain.ErrPhoneTaken) {
+		t.Errorf("bob binding a taken number = %v; want ErrPhoneTaken", err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrRoleNotFound = errors.New("role assignment not found")
+	ErrUserNotFound = errors.New("user not found")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// AuthzService answers permission checks. A user's permissions come from
+// the role column on users (always global) plus role assignments, which
+// may be limited to a subject.
+type AuthzService struct {
+	roleRepo domain.RoleRepository
+	userRepo domain.UserRepository
+	taxonomy *TaxonomyService
+	audit    *AuditService
+}
+
+func NewAuthzService(roleRepo domain.RoleRepository, userRepo domain.UserRepository, taxonomy *TaxonomyService, audit *AuditService) *AuthzService {
+	return &AuthzService{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+		taxonomy: taxonomy,
+		audit:    audit,
+	}
+}
+
+// Can reports whether u holds perm globally or for the given subject.
+func (s *AuthzService) Can(ctx context.Context, u *domain.User, perm domain.Permission, subject string) (bool, error) {
+	return s.check(ctx, u, perm, func(a domain.RoleAssignment) bool {
+		return a.Subject == "" || (subject != "" && strings.EqualFold(a.Subject, strings.TrimSpace(subject)))
+	})
+}
+
+// CanAny reports whether u holds perm for at least one subject. Used where
+// the subject is not known up front, e.g. listing a review queue.
+func (s *AuthzService) CanAny(ctx context.Context, u *domain.User, perm domain.Permission) (bool, error) {
+	return s.check(ctx, u, perm, func(domain.RoleAssignment) bool { return true })
+}
+
+func (s *AuthzService) check(ctx context.Context, u *domain.User, perm domain.Permission, match func(domain.RoleAssignment) bool) (bool, error) {
+	if u == nil {
+		return false, nil
+	}
+	if u.Role.Grants(perm) {
+		return true, nil
+	}
+	list, err := s.roleRepo.ListByUser(ctx, u.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range list {
+		if a.Role.Grants(perm) && match(a) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Roles lists the assignments held by a user
+func (s *AuthzService) Roles(ctx context.Context, userID int64) ([]domain.RoleAssignment, error) {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return s.roleRepo.ListByUser(ctx, userID)
+}
+
+// AssignRole grants role to the user. ADMIN can only be granted globally.
+func (s *AuthzService) AssignRole(ctx context.Context, actor *domain.User, userID int64, role domain.UserRole, subject string) (*domain.RoleAssignment, error) {
+	subject = strings.TrimSpace(subject)
+	if _, ok := domain.RolePermissions[role]; !ok {
+		return nil, ErrInvalidRole
+	}
+	if role == domain.RoleAdmin && subject != "" {
+		return nil, fmt.Errorf("%w: ADMIN cannot be limited to a subject", ErrInvalidRole)
+	}
+	if len(subject) > 100 {
+		return nil, fmt.Errorf("%w: subject too long (max 100 characters)", ErrInvalidRole)
+	}
+	// scoped roles match resources by the subject slug they are stored under
+	subject, err := s.taxonomy.SubjectSlug(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+
+	a := &domain.RoleAssignment{
+		UserID:  userID,
+		Role:    role,
+		Subject: subject,
+	}
+	a.GrantedBy = &actor.ID
+	if err := s.roleRepo.Assign(ctx, a); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditRoleAssign, "user", strconv.FormatInt(userID, 10), nil, a)
+	return a, nil
+}
+
+func (s *AuthzService) RevokeRole(ctx context.Context, actor *domain.User, userID int64, role domain.UserRole, subject string) error {
+	subject = strings.TrimSpace(subject)
+	ok, err := s.roleRepo.Revoke(ctx, userID, role, subject)
+	if err != nil {
+		return err
+	}
+	if !ok && subject != "" {
+		// the assignment may have been stored under the subject's slug
+		slug, err := s.taxonomy.SubjectSlug(ctx, subject)
+		if err != nil && !errors.Is(err, ErrUnknownSubject) {
+			return err
+		}
+		if err == nil && slug != subject {
+			if ok, err = s.roleRepo.Revoke(ctx, userID, role, slug); err != nil {
+				return err
+			}
+			subject = slug
+		}
+	}
+	if !ok {
+		return ErrRoleNotFound
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditRoleRevoke, "user", strconv.FormatInt(userID, 10),
+		domain.RoleAssignment{UserID: userID, Role: role, Subject: subject}, nil)
+	return nil
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	maxCollections           = 100
+	maxCollectionItems       = 500
+	maxCollectionName        = 100
+	maxCollectionDescription = 1000
+)
+
+var (
+	ErrInvalidCollection    = errors.New("invalid collection")
+	ErrCollectionNotFound   = errors.New("collection not found")
+	ErrTooManyCollections   = errors.New("collection limit reached")
+	ErrCollectionFull       = errors.New("collection is full")
+	ErrNotCollectable       = errors.New("only published resources can be collected")
+	ErrCollectionItemAbsent = errors.New("resource is not in the collection")
+)
+
+// CollectionView is a collection with its items. Hidden items are shown to
+// the owner only.
+type CollectionView struct {
+	domain.Collection
+	Items []domain.CollectionItem `json:"items"`
+}
+
+// CollectionEdit holds the collection fields to change; nil leaves a field as is
+type CollectionEdit struct {
+	Name        *string
+	Description *string
+	Visibility  *domain.CollectionVisibility
+}
+
+// CollectionService manages users' collections of resources. Public
+// collections are readable by anyone; private ones by their owner and by
+// holders of the share link.
+type CollectionService struct {
+	repo         domain.CollectionRepository
+	resourceRepo domain.ResourceRepository
+}
+
+func NewCollectionService(repo domain.CollectionRepository, resourceRepo domain.ResourceRepository) *CollectionService {
+	return &CollectionService{
+		repo:         repo,
+		resourceRepo: resourceRepo,
+	}
+}
+
+func (s *CollectionService) Create(ctx context.Context, owner *domain.User, name, description string, visibility domain.CollectionVisibility) (*domain.Collection, error) {
+	c := &domain.Collection{OwnerID: owner.ID, Name: name, Description: description, Visibility: visibility}
+	if c.Visibility == "" {
+		c.Visibility = domain.CollectionPrivate
+	}
+	if err := validCollection(c); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListByOwner(ctx, owner.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxCollections {
+		return nil, ErrTooManyCollections
+	}
+	if err := s.repo.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Mine lists the user's own collections
+func (s *CollectionService) Mine(ctx context.Context, owner *domain.User) ([]domain.Collection, error) {
+	return s.repo.ListByOwner(ctx, owner.ID, false)
+}
+
+// PublicByUser lists a user's public collections without share tokens
+func (s *CollectionService) PublicByUser(ctx context.Context, userID int64) ([]domain.Collection, error) {
+	list, err := s.repo.ListByOwner(ctx, userID, true)
+	for i := range list {
+		list[i].ShareToken = ""
+	}
+	return list, err
+}
+
+// Get returns a collection with its items when the viewer may see it. viewer
+// may be nil.
+func (s *CollectionService) Get(ctx context.Context, viewer *domain.User, id int64) (*CollectionView, error) {
+	c, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	owner := c != nil && viewer != nil && c.OwnerID == viewer.ID
+	if c == nil || (!owner && c.Visibility != domain.CollectionPublic) {
+		return nil, ErrCollectionNotFound
+	}
+	return s.view(ctx, c, owner)
+}
+
+// Shared returns the collection behind a share link
+func (s *CollectionService) Shared(ctx context.Context, viewer *domain.User, token string) (*CollectionView, error) {
+	if token == "" {
+		return nil, ErrCollectionNotFound
+	}
+	c, err := s.repo.GetByShareToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCollectionNotFound
+	}
+	return s.view(ctx, c, viewer != nil && c.OwnerID == viewer.ID)
+}
+
+func (s *CollectionService) Update(ctx context.Context, owner *domain.User, id int64, edit CollectionEdit) (*domain.Collection, error) {
+	c, err := s.owned(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if edit.Name != nil {
+		c.Name = *edit.Name
+	}
+	if edit.Description != nil {
+		c.Description = *edit.Description
+	}
+	if edit.Visibility != nil {
+		c.Visibility = *edit.Visibility
+	}
+	if err := validCollection(c); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *CollectionService) Delete(ctx context.Context, owner *domain.User, id int64) error {
+	if _, err := s.owned(ctx, owner, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// AddItem appends a published resource; adding it twice is not an error
+func (s *CollectionService) AddItem(ctx context.Context, owner *domain.User, id, resourceID int64) (*domain.Collection, error) {
+	c, err := s.owned(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.resourceRepo.GetByIDForUpdate(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.Status != domain.ResourceStatusApproved {
+		return nil, ErrNotCollectable
+	}
+	if c.ItemCount >= maxCollectionItems {
+		return nil, ErrCollectionFull
+	}
+	added, err := s.repo.AddItem(ctx, id, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		c.ItemCount++
+	}
+	return c, nil
+}
+
+func (s *CollectionService) RemoveItem(ctx context.Context, owner *domain.User, id, resourceID int64) error {
+	if _, err := s.owned(ctx, owner, id); err != nil {
+		return err
+	}
+	removed, err := s.repo.RemoveItem(ctx, id, resourceID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrCollectionItemAbsent
+	}
+	return nil
+}
+
+// Reorder sets the item order; resourceIDs must list every item once
+func (s *CollectionService) Reorder(ctx context.Context, owner *domain.User, id int64, resourceIDs []int64) error {
+	if _, err := s.owned(ctx, owner, id); err != nil {
+		return err
+	}
+	items, err := s.repo.Items(ctx, id)
+	if err != nil {
+		return err
+	}
+	present := make(map[int64]bool, len(items))
+	for _, it := range items {
+		present[it.ResourceID] = true
+	}
+	if len(resourceIDs) != len(items) {
+		return fmt.Errorf("%w: resource_ids must list all %d items", ErrInvalidCollection, len(items))
+	}
+	for _, rid := range resourceIDs {
+		if !present[rid] {
+			return fmt.Errorf("%w: resource %d listed twice or not in the collection", ErrInvalidCollection, rid)
+		}
+		delete(present, rid)
+	}
+	return s.repo.Reorder(ctx, id, resourceIDs)
+}
+
+// Share creates or rotates the share link token
+func (s *CollectionService) Share(ctx context.Context, owner *domain.User, id int64) (*domain.Collection, error) {
+	c, err := s.owned(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	c.ShareToken = base64.RawURLEncoding.EncodeToString(b)
+	if err := s.repo.Update(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Unshare revokes the share link
+func (s *CollectionService) Unshare(ctx context.Context, owner *domain.User, id int64) error {
+	c, err := s.owned(ctx, owner, id)
+	if err != nil {
+		return err
+	}
+	if c.ShareToken == "" {
+		return nil
+	}
+	c.ShareToken = ""
+	return s.repo.Update(ctx, c)
+}
+
+// owned returns the collection when it belongs to the user. Other users'
+// collections read as not found so their existence is not revealed.
+func (s *CollectionService) owned(ctx context.Context, owner *domain.User, id int64) (*domain.Collection, error) {
+	c, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || c.OwnerID != owner.ID {
+		return nil, ErrCollectionNotFound
+	}
+	return c, nil
+}
+
+// view loads the items. Resources that are gone or not approved become
+// hidden placeholders for the owner and are left out for everyone else.
+func (s *CollectionService) view(ctx context.Context, c *domain.Collection, owner bool) (*CollectionView, error) {
+	items, err := s.repo.Items(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(items))
+	for i, it := range items {
+		ids[i] = it.ResourceID
+	}
+	resources, err := s.resourceRepo.ListByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*domain.Resource, len(resources))
+	for i := range resources {
+		resources[i].URL = downloadURL(resources[i].ID)
+		byID[resources[i].ID] = &resources[i]
+	}
+
+	v := &CollectionView{Collection: *c, Items: []domain.CollectionItem{}}
+	if !owner {
+		v.ShareToken = ""
+	}
+	for _, it := range items {
+		res := byID[it.ResourceID]
+		if res == nil || res.Status != domain.ResourceStatusApproved {
+			if !owner {
+				continue
+			}
+			it.Hidden = true
+		} else {
+			it.Resource = res
+		}
+		v.Items = append(v.Items, it)
+	}
+	v.ItemCount = len(v.Items)
+	return v, nil
+}
+
+func validCollection(c *domain.Collection) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" || len(c.Name) > maxCollectionName {
+		return fmt.Errorf("%w: name required (max %d characters)", ErrInvalidCollection, maxCollectionName)
+	}
+	if len(c.Description) > maxCollectionDescription {
+		return fmt.Errorf("%w: description too long (max %d characters)", ErrInvalidCollection, maxCollectionDescription)
+	}
+	switch c.Visibility {
+	case domain.CollectionPrivate, domain.CollectionPublic:
+	default:
+		return fmt.Errorf("%w: visibility must be PRIVATE or PUBLIC", ErrInvalidCollection)
+	}
+	return nil
+}
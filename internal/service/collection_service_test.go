@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+func TestCollectionViews(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	s := NewCollectionService(sqlite.NewCollectionRepository(db), resources)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	for _, u := range []*domain.User{owner, other} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var res []*domain.Resource
+	for _, title := range []string{"a", "b", "c"} {
+		r := &domain.Resource{Title: title, Filename: title + ".pdf", Status: domain.ResourceStatusApproved, ReviewRound: 1}
+		if err := resources.Create(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, r)
+	}
+	draft := &domain.Resource{Title: "draft", Filename: "draft.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1}
+	if err := resources.Create(ctx, draft); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.Create(ctx, owner, "exam prep", "", "")
+	if err != nil || c.Visibility != domain.CollectionPrivate {
+		t.Fatalf("Create = %+v, %v; want a private collection", c, err)
+	}
+	for _, r := range res {
+		if _, err := s.AddItem(ctx, owner, c.ID, r.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddItem(ctx, owner, c.ID, draft.ID); !errors.Is(err, ErrNotCollectable) {
+		t.Errorf("AddItem(pending) = %v; want ErrNotCollectable", err)
+	}
+	if _, err := s.AddItem(ctx, other, c.ID, res[0].ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("AddItem(not owner) = %v; want ErrCollectionNotFound", err)
+	}
+
+	// private collections are the owner's alone until shared
+	if _, err := s.Get(ctx, other, c.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Get(private, other) = %v; want ErrCollectionNotFound", err)
+	}
+	if _, err := s.Get(ctx, nil, c.ID); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Get(private, anonymous) = %v; want ErrCollectionNotFound", err)
+	}
+	shared, err := s.Share(ctx, owner, c.ID)
+	if err != nil || shared.ShareToken == "" {
+		t.Fatalf("Share = %+v, %v", shared, err)
+	}
+	token := shared.ShareToken
+
+	// a resource taken down stays in the collection as a placeholder
+	if _, err := db.Exec(`UPDATE resources SET status = ? WHERE id = ?`, domain.ResourceStatusRejected, res[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Get(ctx, owner, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ShareToken != token || v.ItemCount != 3 || len(v.Items) != 3 || !v.Items[1].Hidden || v.Items[1].Resource != nil || v.Items[0].Resource == nil {
+		t.Errorf("owner's view = %+v; want 3 items with the second hidden", v)
+	}
+	if v.Items[0].Resource != nil && v.Items[0].Resource.URL != downloadURL(res[0].ID) {
+		t.Errorf("item URL = %q", v.Items[0].Resource.URL)
+	}
+	v, err = s.Shared(ctx, other, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ShareToken != "" || v.ItemCount != 2 || len(v.Items) != 2 || v.Items[0].ResourceID != res[0].ID || v.Items[1].ResourceID != res[2].ID {
+		t.Errorf("shared view = %+v; want 2 visible items and no token", v)
+	}
+	if v, err := s.Shared(ctx, owner, token); err != nil || v.ShareToken != token || len(v.Items) != 3 {
+		t.Errorf("Shared(owner) = %+v, %v; want the owner's view", v, err)
+	}
+
+	// public collections are listed without their share links
+	public := domain.CollectionPublic
+	if _, err := s.Update(ctx, owner, c.ID, CollectionEdit{Visibility: &public}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(ctx, nil, c.ID); err != nil || v.ShareToken != "" || len(v.Items) != 2 {
+		t.Errorf("Get(public, anonymous) = %+v, %v", v, err)
+	}
+	list, err := s.PublicByUser(ctx, owner.ID)
+	if err != nil || len(list) != 1 || list[0].ShareToken != "" {
+		t.Errorf("PublicByUser = %+v, %v; want one collection without its token", list, err)
+	}
+	if mine, err := s.Mine(ctx, owner); err != nil || len(mine) != 1 || mine[0].ShareToken != token {
+		t.Errorf("Mine = %+v, %v; want the token kept for the owner", mine, err)
+	}
+
+	// unsharing revokes the link
+	if err := s.Unshare(ctx, owner, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Shared(ctx, other, token); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Shared after Unshare = %v; want ErrCollectionNotFound", err)
+	}
+	if _, err := s.Shared(ctx, other, ""); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Shared(empty token) = %v; want ErrCollectionNotFound", err)
+	}
+}
+
+func TestCollectionReorder(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	s := NewCollectionService(sqlite.NewCollectionRepository(db), resources)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	for _, u := range []*domain.User{owner, other} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := s.Create(ctx, owner, "reading list", "", domain.CollectionPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, title := range []string{"a", "b", "c"} {
+		r := &domain.Resource{Title: title, Filename: title + ".pdf", Status: domain.ResourceStatusApproved, ReviewRound: 1}
+		if err := resources.Create(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AddItem(ctx, owner, c.ID, r.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, r.ID)
+	}
+
+	for name, order := range map[string][]int64{
+		"missing an item": {ids[2], ids[0]},
+		"listed twice":    {ids[2], ids[2], ids[0]},
+		"not an item":     {ids[2], ids[1], 999},
+		"extra item":      {ids[2], ids[1], ids[0], 999},
+	} {
+		if err := s.Reorder(ctx, owner, c.ID, order); !errors.Is(err, ErrInvalidCollection) {
+			t.Errorf("Reorder(%s) = %v; want ErrInvalidCollection", name, err)
+		}
+	}
+	if err := s.Reorder(ctx, other, c.ID, []int64{ids[2], ids[1], ids[0]}); !errors.Is(err, ErrCollectionNotFound) {
+		t.Errorf("Reorder(not owner) = %v; want ErrCollectionNotFound", err)
+	}
+
+	if err := s.Reorder(ctx, owner, c.ID, []int64{ids[2], ids[0], ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Get(ctx, owner, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, it := range v.Items {
+		got = append(got, it.ResourceID)
+	}
+	if len(got) != 3 || got[0] != ids[2] || got[1] != ids[0] || got[2] != ids[1] {
+		t.Errorf("order after Reorder = %v", got)
+	}
+
+	if err := s.RemoveItem(ctx, owner, c.ID, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveItem(ctx, owner, c.ID, ids[0]); !errors.Is(err, ErrCollectionItemAbsent) {
+		t.Errorf("second RemoveItem = %v; want ErrCollectionItemAbsent", err)
+	}
+	if err := s.Reorder(ctx, owner, c.ID, []int64{ids[1], ids[2]}); err != nil {
+		t.Errorf("Reorder after RemoveItem = %v", err)
+	}
+}
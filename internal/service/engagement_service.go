@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const maxCommentLength = 2000
+
+var (
+	ErrNotEngageable   = errors.New("only published resources accept ratings, likes and comments")
+	ErrInvalidRating   = errors.New("rating must be between 1 and 5 stars")
+	ErrSelfRating      = errors.New("cannot rate your own resource")
+	ErrInvalidComment  = errors.New("invalid comment")
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrCommentDeleted  = errors.New("comment was deleted")
+)
+
+// Engagement is the rating, like and comment summary of a resource. MyRating
+// and Liked describe the viewer and are zero for anonymous viewers.
+type Engagement struct {
+	ResourceID    int64   `json:"resource_id"`
+	RatingAvg     float64 `json:"rating_avg"`
+	RatingCount   int     `json:"rating_count"`
+	LikeCount     int     `json:"like_count"`
+	CommentCount  int     `json:"comment_count"`
+	FavoriteCount int     `json:"favorite_count"`
+	MyRating      int     `json:"my_rating,omitempty"`
+	Liked         bool    `json:"liked"`
+}
+
+// EngagementService handles ratings, likes and threaded comments on published
+// resources. Aggregates are stored on the resource row by the repositories so
+// listings can sort by them.
+type EngagementService struct {
+	reactions    domain.ReactionRepository
+	comments     domain.CommentRepository
+	resourceRepo domain.ResourceRepository
+	authz        *AuthzService
+	audit        *AuditService
+}
+
+func NewEngagementService(reactions domain.ReactionRepository, comments domain.CommentRepository, resourceRepo domain.ResourceRepository, authz *AuthzService, audit *AuditService) *EngagementService {
+	return &EngagementService{
+		reactions:    reactions,
+		comments:     comments,
+		resourceRepo: resourceRepo,
+		authz:        authz,
+		audit:        audit,
+	}
+}
+
+// Summary returns the engagement of a published resource; viewer may be nil
+func (s *EngagementService) Summary(ctx context.Context, viewer *domain.User, id int64) (*Engagement, error) {
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.summary(ctx, viewer, id)
+}
+
+// Rate sets the user's 1-5 star rating, replacing an earlier one
+func (s *EngagementService) Rate(ctx context.Context, u *domain.User, id int64, stars int) (*Engagement, error) {
+	if stars < 1 || stars > 5 {
+		return nil, ErrInvalidRating
+	}
+	res, err := s.published(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res.OwnerID != nil && *res.OwnerID == u.ID {
+		return nil, ErrSelfRating
+	}
+	if err := s.reactions.SetRating(ctx, id, u.ID, stars); err != nil {
+		return nil, err
+	}
+	return s.summary(ctx, u, id)
+}
+
+// Unrate removes the user's rating; removing a missing rating is not an error
+func (s *EngagementService) Unrate(ctx context.Context, u *domain.User, id int64) (*Engagement, error) {
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	if _, err := s.reactions.DeleteRating(ctx, id, u.ID); err != nil {
+		return nil, err
+	}
+	return s.summary(ctx, u, id)
+}
+
+// Like is idempotent, as is Unlike
+func (s *EngagementService) Like(ctx context.Context, u *domain.User, id int64) (*Engagement, error) {
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.reactions.Like(ctx, id, u.ID); err != nil {
+		return nil, err
+	}
+	return s.summary(ctx, u, id)
+}
+
+func (s *EngagementService) Unlike(ctx context.Context, u *domain.User, id int64) (*Engagement, error) {
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.reactions.Unlike(ctx, id, u.ID); err != nil {
+		return nil, err
+	}
+	return s.summary(ctx, u, id)
+}
+
+// Comments returns the comment threads of a published resource, oldest first.
+// Deleted comments stay in place with empty content when they have replies.
+func (s *EngagementService) Comments(ctx context.Context, id int64) ([]*domain.Comment, error) {
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	list, err := s.comments.ListByResource(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return threadComments(list), nil
+}
+
+// Comment adds a comment, or a reply when parentID is set
+func (s *EngagementService) Comment(ctx context.Context, u *domain.User, id int64, parentID *int64, content string) (*domain.Comment, error) {
+	content, err := validComment(content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.published(ctx, id); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		parent, err := s.comments.GetByID(ctx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.ResourceID != id {
+			return nil, fmt.Errorf("%w: parent comment not found on this resource", ErrInvalidComment)
+		}
+		if parent.DeletedAt != nil {
+			return nil, ErrCommentDeleted
+		}
+	}
+	c := &domain.Comment{ResourceID: id, UserID: u.ID, ParentID: parentID, Content: content}
+	if err := s.comments.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// EditComment changes the content of the author's own comment
+func (s *EngagementService) EditComment(ctx context.Context, u *domain.User, commentID int64, content string) (*domain.Comment, error) {
+	content, err := validComment(content)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.comments.GetByID(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCommentNotFound
+	}
+	if c.UserID != u.ID {
+		return nil, ErrForbidden
+	}
+	if c.DeletedAt != nil {
+		return nil, ErrCommentDeleted
+	}
+	c.Content = content
+	if err := s.comments.UpdateContent(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DeleteComment removes a comment. Authors may delete their own comments;
+// moderators of the resource's subject may delete any, which is audited.
+func (s *EngagementService) DeleteComment(ctx context.Context, u *domain.User, commentID int64) error {
+	c, err := s.comments.GetByID(ctx, commentID)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return ErrCommentNotFound
+	}
+	if c.DeletedAt != nil {
+		return nil
+	}
+	moderated := c.UserID != u.ID
+	if moderated {
+		res, err := s.resourceRepo.GetByID(ctx, c.ResourceID)
+		if err != nil {
+			return err
+		}
+		subject := ""
+		if res != nil {
+			subject = res.Subject
+		}
+		ok, err := s.authz.Can(ctx, u, domain.PermCommentModerate, subject)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrForbidden
+		}
+	}
+	if err := s.comments.Delete(ctx, commentID, u.ID); err != nil {
+		return err
+	}
+	if moderated {
+		s.audit.Record(ctx, u.ID, domain.AuditCommentDelete, "comment", strconv.FormatInt(commentID, 10),
+			map[string]any{"resource_id": c.ResourceID, "user_id": c.UserID, "content": c.Content}, nil)
+	}
+	return nil
+}
+
+// published returns the resource when it is approved
+func (s *EngagementService) published(ctx context.Context, id int64) (*domain.Resource, error) {
+	res, err := s.resourceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.Status != domain.ResourceStatusApproved {
+		return nil, ErrNotEngageable
+	}
+	return res, nil
+}
+
+func (s *EngagementService) summary(ctx context.Context, viewer *domain.User, id int64) (*Engagement, error) {
+	res, err := s.resourceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	e := &Engagement{
+		ResourceID:    id,
+		RatingAvg:     res.RatingAvg,
+		RatingCount:   res.RatingCount,
+		LikeCount:     res.LikeCount,
+		CommentCount:  res.CommentCount,
+		FavoriteCount: res.FavoriteCount,
+	}
+	if viewer != nil {
+		if e.MyRating, err = s.reactions.GetRating(ctx, id, viewer.ID); err != nil {
+			return nil, err
+		}
+		if e.Liked, err = s.reactions.HasLiked(ctx, id, viewer.ID); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func validComment(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", fmt.Errorf("%w: content required", ErrInvalidComment)
+	}
+	if len(content) > maxCommentLength {
+		return "", fmt.Errorf("%w: content too long (max %d characters)", ErrInvalidComment, maxCommentLength)
+	}
+	return content, nil
+}
+
+// threadComments nests replies under their parents. Deleted comments without
+// live replies are dropped.
+func threadComments(list []domain.Comment) []*domain.Comment {
+	byID := make(map[int64]*domain.Comment, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	var roots []*domain.Comment
+	for i := range list {
+		c := &list[i]
+		if c.ParentID != nil {
+			if parent := byID[*c.ParentID]; parent != nil {
+				parent.Replies = append(parent.Replies, c)
+				continue
+			}
+		}
+		roots = append(roots, c)
+	}
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(list []*domain.Comment) []*domain.Comment {
+	kept := list[:0]
+	for _, c := range list {
+		c.Replies = pruneDeleted(c.Replies)
+		if c.DeletedAt != nil && len(c.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
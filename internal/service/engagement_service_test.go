@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/cached"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/pkg/cache"
+)
+
+func TestEngagement(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	// Summaries read the cached resource, so every write must invalidate it
+	resources := cached.NewResourceRepository(sqlite.NewResourceRepository(db), cache.NewMemory(100), time.Minute)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit)
+	s := NewEngagementService(
+		cached.NewReactionRepository(sqlite.NewReactionRepository(db), resources),
+		cached.NewCommentRepository(sqlite.NewCommentRepository(db), resources),
+		resources, authz, audit)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	alice := &domain.User{Name: "alice", Email: "alice@example.com"}
+	bob := &domain.User{Name: "bob", Email: "bob@example.com"}
+	mod := &domain.User{Name: "mod", Email: "mod@example.com", Role: domain.RoleModerator}
+	for _, u := range []*domain.User{owner, alice, bob, mod} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := &domain.Resource{Title: "notes", Filename: "notes.pdf", Subject: "math", OwnerID: &owner.ID, Status: domain.ResourceStatusApproved, ReviewRound: 1}
+	pending := &domain.Resource{Title: "draft", Filename: "draft.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1}
+	for _, r := range []*domain.Resource{res, pending} {
+		if err := resources.Create(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary := func(viewer *domain.User) *Engagement {
+		t.Helper()
+		e, err := s.Summary(ctx, viewer, res.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	if e := summary(nil); e.RatingCount != 0 || e.LikeCount != 0 || e.CommentCount != 0 {
+		t.Fatalf("fresh Summary = %+v", e)
+	}
+
+	// ratings
+	if _, err := s.Rate(ctx, owner, res.ID, 5); !errors.Is(err, ErrSelfRating) {
+		t.Errorf("Rate(own resource) = %v; want ErrSelfRating", err)
+	}
+	if _, err := s.Rate(ctx, alice, res.ID, 6); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("Rate(6) = %v; want ErrInvalidRating", err)
+	}
+	if _, err := s.Rate(ctx, alice, pending.ID, 4); !errors.Is(err, ErrNotEngageable) {
+		t.Errorf("Rate(pending) = %v; want ErrNotEngageable", err)
+	}
+	if e, err := s.Rate(ctx, alice, res.ID, 4); err != nil || e.RatingAvg != 4 || e.RatingCount != 1 || e.MyRating != 4 {
+		t.Errorf("Rate = %+v, %v; want avg 4 of 1", e, err)
+	}
+	if e, err := s.Rate(ctx, bob, res.ID, 2); err != nil || e.RatingAvg != 3 || e.RatingCount != 2 {
+		t.Errorf("second Rate = %+v, %v; want avg 3 of 2", e, err)
+	}
+	if e, err := s.Rate(ctx, alice, res.ID, 5); err != nil || e.RatingAvg != 3.5 || e.RatingCount != 2 || e.MyRating != 5 {
+		t.Errorf("re-Rate = %+v, %v; want avg 3.5 of 2", e, err)
+	}
+	if e, err := s.Unrate(ctx, bob, res.ID); err != nil || e.RatingAvg != 5 || e.RatingCount != 1 || e.MyRating != 0 {
+		t.Errorf("Unrate = %+v, %v; want avg 5 of 1", e, err)
+	}
+	if e, err := s.Unrate(ctx, bob, res.ID); err != nil || e.RatingCount != 1 {
+		t.Errorf("second Unrate = %+v, %v", e, err)
+	}
+
+	// likes
+	for i := 0; i < 2; i++ {
+		if e, err := s.Like(ctx, alice, res.ID); err != nil || e.LikeCount != 1 || !e.Liked {
+			t.Errorf("Like #%d = %+v, %v; want 1 like", i+1, e, err)
+		}
+	}
+	if e, err := s.Like(ctx, bob, res.ID); err != nil || e.LikeCount != 2 {
+		t.Errorf("second user's Like = %+v, %v; want 2 likes", e, err)
+	}
+	if e, err := s.Unlike(ctx, alice, res.ID); err != nil || e.LikeCount != 1 || e.Liked {
+		t.Errorf("Unlike = %+v, %v; want 1 like", e, err)
+	}
+	if e := summary(bob); e.LikeCount != 1 || !e.Liked || e.RatingAvg != 5 {
+		t.Errorf("Summary(bob) = %+v", e)
+	}
+
+	// comment threads
+	root, err := s.Comment(ctx, alice, res.ID, nil, "  great notes  ")
+	if err != nil || root.Content != "great notes" {
+		t.Fatalf("Comment = %+v, %v", root, err)
+	}
+	reply, err := s.Comment(ctx, bob, res.ID, &root.ID, "agreed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Comment(ctx, bob, pending.ID, &root.ID, "elsewhere"); !errors.Is(err, ErrNotEngageable) {
+		t.Errorf("Comment(pending) = %v; want ErrNotEngageable", err)
+	}
+	if _, err := s.Comment(ctx, bob, res.ID, nil, "   "); !errors.Is(err, ErrInvalidComment) {
+		t.Errorf("Comment(blank) = %v; want ErrInvalidComment", err)
+	}
+	if e := summary(nil); e.CommentCount != 2 {
+		t.Errorf("CommentCount = %d after two comments, want 2", e.CommentCount)
+	}
+	threads, err := s.Comments(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 1 || threads[0].ID != root.ID || len(threads[0].Replies) != 1 || threads[0].Replies[0].ID != reply.ID {
+		t.Fatalf("Comments = %+v; want the reply under its parent", threads)
+	}
+
+	// moderation
+	if err := s.DeleteComment(ctx, bob, root.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("DeleteComment(someone else's) = %v; want ErrForbidden", err)
+	}
+	if err := s.DeleteComment(ctx, mod, root.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e := summary(nil); e.CommentCount != 1 {
+		t.Errorf("CommentCount = %d after a delete, want 1", e.CommentCount)
+	}
+	if _, err := s.Comment(ctx, bob, res.ID, &root.ID, "too late"); !errors.Is(err, ErrCommentDeleted) {
+		t.Errorf("reply to a deleted comment = %v; want ErrCommentDeleted", err)
+	}
+	threads, err = s.Comments(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 1 || threads[0].DeletedAt == nil || threads[0].Content != "" || len(threads[0].Replies) != 1 {
+		t.Errorf("Comments after delete = %+v; want the emptied parent kept for its reply", threads)
+	}
+	entries, err := audit.List(ctx, domain.AuditFilter{Action: domain.AuditCommentDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || *entries[0].ActorID != mod.ID || entries[0].TargetID != strconv.FormatInt(root.ID, 10) || string(entries[0].Before) == "" {
+		t.Errorf("audit entries = %+v; want the moderator's delete", entries)
+	}
+
+	// authors delete their own comments without an audit entry
+	if err := s.DeleteComment(ctx, bob, reply.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e := summary(nil); e.CommentCount != 0 {
+		t.Errorf("CommentCount = %d after deleting both, want 0", e.CommentCount)
+	}
+	if threads, err := s.Comments(ctx, res.ID); err != nil || len(threads) != 0 {
+		t.Errorf("Comments = %+v, %v; want the deleted thread dropped", threads, err)
+	}
+	if entries, _ := audit.List(ctx, domain.AuditFilter{Action: domain.AuditCommentDelete}); len(entries) != 1 {
+		t.Errorf("%d delete entries; want only the moderator's", len(entries))
+	}
+}
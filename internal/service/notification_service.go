@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+// NotificationService delivers in-app notifications to users
+type NotificationService struct {
+	repo domain.NotificationRepository
+}
+
+func NewNotificationService(repo domain.NotificationRepository) *NotificationService {
+	return &NotificationService{repo: repo}
+}
+
+// Notify stores a notification for the user. Failures are logged so that
+// a notification outage does not fail the action that triggered it.
+func (s *NotificationService) Notify(ctx context.Context, userID int64, content string) {
+	n := &domain.Notification{UserID: &userID, Content: content}
+	if err := s.repo.Create(context.WithoutCancel(ctx), n); err != nil {
+		log.Printf("notify failed: user=%d err=%v", userID, err)
+	}
+}
+
+// List returns the user's notifications and system-wide ones, newest first
+func (s *NotificationService) List(ctx context.Context, userID int64) ([]domain.Notification, error) {
+	return s.repo.List(ctx, &userID)
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/oidc"
+)
+
+const (
+	tokenTypeOIDCFlow = "oidc_flow"
+	oidcFlowTTL       = 10 * time.Minute
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCFlow = errors.New("invalid or expired sign-on request")
+)
+
+// OIDCProvider is a configured identity provider plus its claim mapping
+type OIDCProvider struct {
+	Name           string
+	Client         *oidc.Provider
+	StudentIDClaim string
+	SchoolClaim    string
+	School         string // fallback when the school claim is absent
+}
+
+// OIDCService implements single sign-on via the OIDC authorization-code
+// flow with PKCE. Successful logins end in the normal Chirp JWT.
+type OIDCService struct {
+	auth         *AuthService
+	userRepo     domain.UserRepository
+	identityRepo domain.UserIdentityRepository
+	providers    map[string]*OIDCProvider
+	jwtSecret    string
+}
+
+func NewOIDCService(auth *AuthService, userRepo domain.UserRepository, identityRepo domain.UserIdentityRepository, providers []*OIDCProvider, jwtSecret string) *OIDCService {
+	m := make(map[string]*OIDCProvider, len(providers))
+	for _, p := range providers {
+		if p.StudentIDClaim == "" {
+			p.StudentIDClaim = "student_id"
+		}
+		if p.SchoolClaim == "" {
+			p.SchoolClaim = "school"
+		}
+		m[p.Name] = p
+	}
+	return &OIDCService{
+		auth:         auth,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		providers:    m,
+		jwtSecret:    jwtSecret,
+	}
+}
+
+// Providers returns the configured provider names
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin starts a login with the given provider. It returns the URL to
+// redirect to and a signed flow token holding state, nonce and the PKCE
+// verifier, which the caller keeps (e.g. in an HttpOnly cookie) until the
+// callback.
+func (s *OIDCService) Begin(ctx context.Context, provider string) (authURL, flowToken string, err error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = p.Client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":      tokenTypeOIDCFlow,
+		"provider": provider,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcFlowTTL).Unix(),
+	})
+	flowToken, err = t.SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, flowToken, nil
+}
+
+// Complete handles the provider callback: it checks state against the flow
+// token, exchanges the code, verifies the ID token, resolves or creates the
+// local user and issues a Chirp token.
+func (s *OIDCService) Complete(ctx context.Context, provider, state, code, flowToken string) (*LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	flow, err := s.parseFlow(flowToken)
+	if err != nil {
+		return nil, err
+	}
+	if flow["provider"] != provider || state == "" || flow["state"] != state {
+		return nil, ErrInvalidOIDCFlow
+	}
+
+	tokens, err := p.Client.Exchange(ctx, code, flow["verifier"])
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.Client.VerifyIDToken(ctx, tokens.IDToken, flow["nonce"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Userinfo may carry claims the ID token omits; the ID token wins on conflicts
+	merged := map[string]any{}
+	if tokens.AccessToken != "" {
+		if info, err := p.Client.UserInfo(ctx, tokens.AccessToken); err == nil {
+			if info["sub"] == nil || info["sub"] == claims["sub"] {
+				for k, v := range info {
+					merged[k] = v
+				}
+			}
+		}
+	}
+	for k, v := range claims {
+		merged[k] = v
+	}
+
+	u, err := s.resolveUser(ctx, p, merged)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.finishLogin(ctx, u, "oidc:"+provider)
+}
+
+// resolveUser finds the local account for the external identity: an
+// existing link, then a verified email, then a verified phone number.
+// Otherwise a new account is created from the claims.
+func (s *OIDCService) resolveUser(ctx context.Context, p *OIDCProvider, claims map[string]any) (*domain.User, error) {
+	subject := claimString(claims, "sub")
+	if subject == "" {
+		return nil, errors.New("id_token without subject")
+	}
+
+	identity, err := s.identityRepo.GetByProviderSubject(ctx, p.Name, subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		u, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil {
+			return nil, fmt.Errorf("identity %d points to missing user %d", identity.ID, identity.UserID)
+		}
+		return u, nil
+	}
+
+	email := strings.ToLower(claimString(claims, "email"))
+	phone := claimString(claims, "phone_number")
+	profile := domain.User{
+		Name:      claimString(claims, "name"),
+		StudentID: claimString(claims, p.StudentIDClaim),
+		School:    claimString(claims, p.SchoolClaim),
+	}
+	if profile.School == "" {
+		profile.School = p.School
+	}
+
+	var u *domain.User
+	if email != "" && claimBool(claims, "email_verified") {
+		if u, err = s.userRepo.GetByEmail(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	if u == nil && phone != "" && claimBool(claims, "phone_number_verified") {
+		if u, err = s.userRepo.GetByPhoneNumber(ctx, phone); err != nil {
+			return nil, err
+		}
+	}
+
+	if u != nil {
+		// Fill in blanks only; never overwrite what the user set themselves
+		changed := false
+		for _, f := range []struct {
+			dst *string
+			src string
+		}{
+			{&u.Name, profile.Name},
+			{&u.StudentID, profile.StudentID},
+			{&u.School, profile.School},
+		} {
+			if *f.dst == "" && f.src != "" {
+				*f.dst = f.src
+				changed = true
+			}
+		}
+		if changed {
+			if err := s.userRepo.UpdateProfile(ctx, u); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		u = &profile
+		u.Email = email
+		if email == "" || !claimBool(claims, "email_verified") {
+			// Unverified addresses must not claim the unique email slot
+			u.Email = p.Name + "-" + subject + "@sso.chirp"
+		}
+		if claimBool(claims, "phone_number_verified") {
+			u.PhoneNumber = phone
+		}
+		// No local password: the account can only sign in through SSO until one is set
+		if err := s.userRepo.Create(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   u.ID,
+		Provider: p.Name,
+		Subject:  subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *OIDCService) parseFlow(flowToken string) (map[string]string, error) {
+	tok, err := jwt.Parse(flowToken, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !tok.Valid {
+		return nil, ErrInvalidOIDCFlow
+	}
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != tokenTypeOIDCFlow {
+		return nil, ErrInvalidOIDCFlow
+	}
+
+	flow := make(map[string]string, 4)
+	for _, k := range []string{"provider", "state", "nonce", "verifier"} {
+		v, _ := claims[k].(string)
+		if v == "" {
+			return nil, ErrInvalidOIDCFlow
+		}
+		flow[k] = v
+	}
+	return flow, nil
+}
+
+func claimString(claims map[string]any, key string) string {
+	switch v := claims[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// claimBool accepts both JSON booleans and the "true" strings some IdPs send
+func claimBool(claims map[string]any, key string) bool {
+	switch v := claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
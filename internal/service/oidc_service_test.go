@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/pkg/oidc"
+	"github.com/zuquanzhi/Chirp/backend/pkg/oidc/oidctest"
+)
+
+type oidcFixture struct {
+	svc        *OIDCService
+	idp        *oidctest.IdP
+	users      domain.UserRepository
+	identities domain.UserIdentityRepository
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	db := openTestDB(t)
+	idp := oidctest.New(t, "chirp")
+	users := sqlite.NewUserRepository(db)
+	identities := sqlite.NewIdentityRepository(db)
+	auth := &AuthService{
+		userRepo:  users,
+		tfRepo:    sqlite.NewTwoFactorRepository(db),
+		audit:     NewAuditService(sqlite.NewAuditRepository(db)),
+		jwtSecret: "test-secret",
+	}
+	provider := &OIDCProvider{
+		Name:   "campus",
+		Client: oidc.NewProvider(oidc.Config{Issuer: idp.URL, ClientID: "chirp", RedirectURL: "https://chirp.example.com/cb"}),
+		School: "Example University",
+	}
+	return &oidcFixture{
+		svc:        NewOIDCService(auth, users, identities, []*OIDCProvider{provider}, "test-secret"),
+		idp:        idp,
+		users:      users,
+		identities: identities,
+	}
+}
+
+// login runs Begin, signs in at the IdP with claims and returns the
+// callback's state and code with the flow token
+func (f *oidcFixture) login(t *testing.T, claims jwt.MapClaims) (state, code, flow string) {
+	authURL, flow, err := f.svc.Begin(context.Background(), "campus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err = f.idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state, code, flow
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+	existing := &domain.User{Name: "Alice", Email: "alice@example.edu"}
+	if err := f.users.Create(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	state, code, flow := f.login(t, jwt.MapClaims{"sub": "s-alice", "email": "Alice@Example.edu", "email_verified": true, "student_id": "2024001"})
+	res, err := f.svc.Complete(ctx, "campus", state, code, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Token == "" {
+		t.Fatal("no token issued")
+	}
+	ids, err := f.identities.ListByUser(ctx, existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0].Subject != "s-alice" {
+		t.Fatalf("identities of the existing user = %+v; want the campus subject linked", ids)
+	}
+	u, _ := f.users.GetByID(ctx, existing.ID)
+	if u.Name != "Alice" || u.StudentID != "2024001" || u.School != "Example University" {
+		t.Errorf("profile = %q %q %q; want blanks filled, name kept", u.Name, u.StudentID, u.School)
+	}
+
+	// The next login finds the link, even without an email claim
+	state, code, flow = f.login(t, jwt.MapClaims{"sub": "s-alice"})
+	if _, err := f.svc.Complete(ctx, "campus", state, code, flow); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := f.identities.ListByUser(ctx, existing.ID); len(ids) != 1 {
+		t.Errorf("%d identities after second login; want 1", len(ids))
+	}
+}
+
+func TestOIDCIgnoresUnverifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+	victim := &domain.User{Name: "Bob", Email: "bob@example.edu"}
+	if err := f.users.Create(ctx, victim); err != nil {
+		t.Fatal(err)
+	}
+
+	state, code, flow := f.login(t, jwt.MapClaims{"sub": "s-mallory", "email": "bob@example.edu", "email_verified": false})
+	if _, err := f.svc.Complete(ctx, "campus", state, code, flow); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := f.identities.ListByUser(ctx, victim.ID); len(ids) != 0 {
+		t.Fatalf("unverified email linked to the existing account: %+v", ids)
+	}
+	identity, err := f.identities.GetByProviderSubject(ctx, "campus", "s-mallory")
+	if err != nil || identity == nil {
+		t.Fatalf("identity = %v, %v; want a new account", identity, err)
+	}
+	u, _ := f.users.GetByID(ctx, identity.UserID)
+	if u.Email == "bob@example.edu" || !strings.HasSuffix(u.Email, "@sso.chirp") {
+		t.Errorf("new account email = %q; want a placeholder", u.Email)
+	}
+}
+
+func TestOIDCRejectsMismatchedFlow(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+
+	state, code, flow := f.login(t, jwt.MapClaims{"sub": "s-alice"})
+	if _, err := f.svc.Complete(ctx, "campus", state+"x", code, flow); !errors.Is(err, ErrInvalidOIDCFlow) {
+		t.Errorf("state mismatch = %v; want ErrInvalidOIDCFlow", err)
+	}
+	_, _, otherFlow := f.login(t, jwt.MapClaims{"sub": "s-alice"})
+	if _, err := f.svc.Complete(ctx, "campus", state, code, otherFlow); !errors.Is(err, ErrInvalidOIDCFlow) {
+		t.Errorf("another login's flow token = %v; want ErrInvalidOIDCFlow", err)
+	}
+	if _, err := f.svc.Complete(ctx, "campus", state, code, flow+"x"); !errors.Is(err, ErrInvalidOIDCFlow) {
+		t.Errorf("tampered flow token = %v; want ErrInvalidOIDCFlow", err)
+	}
+
+	// The IdP answers with an ID token for someone else's nonce
+	state, code, flow = f.login(t, jwt.MapClaims{"sub": "s-alice", "nonce": "replayed"})
+	if _, err := f.svc.Complete(ctx, "campus", state, code, flow); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("nonce mismatch = %v; want rejected", err)
+	}
+	if identity, _ := f.identities.GetByProviderSubject(ctx, "campus", "s-alice"); identity != nil {
+		t.Error("identity created by a rejected login")
+	}
+}
@@ -4,14 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strings"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 )
 
 type AliyunOSSStorage struct {
 	bucket *oss.Bucket
-	domain string
 }
 
 func NewAliyunOSSStorage(endpoint, accessKeyID, accessKeySecret, bucketName string) (*AliyunOSSStorage, error) {
@@ -24,18 +22,7 @@ func NewAliyunOSSStorage(endpoint, accessKeyID, accessKeySecret, bucketName stri
 		return nil, err
 	}
 
-	// Construct domain
-	// Remove protocol from endpoint to ensure correct domain construction
-	cleanEndpoint := strings.TrimPrefix(endpoint, "http://")
-	cleanEndpoint = strings.TrimPrefix(cleanEndpoint, "https://")
-	
-	// Public URL: https://bucket-name.oss-cn-hangzhou.aliyuncs.com
-	domain := fmt.Sprintf("https://%s.%s", bucketName, cleanEndpoint)
-
-	return &AliyunOSSStorage{
-		bucket: bucket,
-		domain: domain,
-	}, nil
+	return &AliyunOSSStorage{bucket: bucket}, nil
 }
 
 func (s *AliyunOSSStorage) Save(ctx context.Context, file io.Reader, filename string) (string, int64, error) {
@@ -61,6 +48,6 @@ func (s *AliyunOSSStorage) Get(ctx context.Context, path string) (io.ReadCloser,
 	return s.bucket.GetObject(path)
 }
 
-func (s *AliyunOSSStorage) GetPublicURL(path string) string {
-	return fmt.Sprintf("%s/%s", s.domain, path)
+func (s *AliyunOSSStorage) Delete(ctx context.Context, path string) error {
+	return s.bucket.DeleteObject(path)
 }
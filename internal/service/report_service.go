@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	maxReportDetail       = 1000
+	defaultReportPageSize = 20
+	maxReportPageSize     = 100
+)
+
+var (
+	ErrInvalidReport     = errors.New("invalid report")
+	ErrNotReportable     = errors.New("only published resources can be reported")
+	ErrNoOpenReports     = errors.New("resource has no open reports")
+	ErrInvalidResolution = errors.New("invalid resolution")
+)
+
+// ReportService handles user reports on published resources. Once the
+// number of open reports on a resource reaches the hide threshold it goes
+// back to the review queue; triage closes all open reports on a resource at
+// once and tells each reporter the outcome.
+type ReportService struct {
+	repo          domain.ReportRepository
+	resourceRepo  domain.ResourceRepository
+	notifications *NotificationService
+	audit         *AuditService
+	tx            domain.TxManager
+	hideThreshold int // 0 disables automatic hiding
+}
+
+func NewReportService(repo domain.ReportRepository, resourceRepo domain.ResourceRepository, notifications *NotificationService, audit *AuditService, tx domain.TxManager, hideThreshold int) *ReportService {
+	return &ReportService{
+		repo:          repo,
+		resourceRepo:  resourceRepo,
+		notifications: notifications,
+		audit:         audit,
+		tx:            tx,
+		hideThreshold: hideThreshold,
+	}
+}
+
+// Report flags an approved resource. Each user may report a resource once.
+func (s *ReportService) Report(ctx context.Context, reporter *domain.User, resourceID int64, reason, detail string) (*domain.ResourceReport, error) {
+	reason = strings.TrimSpace(reason)
+	detail = strings.TrimSpace(detail)
+	if !validReportReason(reason) {
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidReport, reason)
+	}
+	if len(detail) > maxReportDetail {
+		return nil, fmt.Errorf("%w: detail too long (max %d characters)", ErrInvalidReport, maxReportDetail)
+	}
+
+	res, err := s.resourceRepo.GetByIDForUpdate(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.Status != domain.ResourceStatusApproved {
+		return nil, ErrNotReportable
+	}
+
+	rp := &domain.ResourceReport{
+		ResourceID: resourceID,
+		ReporterID: reporter.ID,
+		Reason:     reason,
+		Detail:     detail,
+	}
+	if err := s.repo.Create(ctx, rp); err != nil {
+		return nil, err
+	}
+
+	if s.hideThreshold > 0 {
+		n, err := s.repo.CountOpen(ctx, resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if n >= s.hideThreshold {
+			if err := s.resourceRepo.Reopen(ctx, resourceID); err != nil {
+				return nil, err
+			}
+			s.audit.Record(ctx, 0, domain.AuditResourceAutoHide, "resource", strconv.FormatInt(resourceID, 10),
+				map[string]any{"status": res.Status},
+				map[string]any{"status": domain.ResourceStatusPending, "open_reports": n, "threshold": s.hideThreshold})
+		}
+	}
+	return rp, nil
+}
+
+// Queue lists resources with open reports, most reported first
+func (s *ReportService) Queue(ctx context.Context, limit, offset int) ([]domain.ReportGroup, error) {
+	if limit <= 0 {
+		limit = defaultReportPageSize
+	}
+	if limit > maxReportPageSize {
+		limit = maxReportPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.OpenGroups(ctx, limit, offset)
+}
+
+func (s *ReportService) ListByResource(ctx context.Context, resourceID int64) ([]domain.ResourceReport, error) {
+	return s.repo.ListByResource(ctx, resourceID)
+}
+
+// Resolve closes the open reports on a resource. Upholding them takes the
+// resource down (REJECTED); dismissing leaves its status as is, so a
+// resource hidden by reports returns through normal review. Closing the
+// reports and taking the resource down commit together; reporters are
+// notified afterwards.
+func (s *ReportService) Resolve(ctx context.Context, actor *domain.User, resourceID int64, outcome domain.ReportStatus) ([]domain.ResourceReport, error) {
+	if outcome != domain.ReportUpheld && outcome != domain.ReportDismissed {
+		return nil, fmt.Errorf("%w: outcome must be UPHELD or DISMISSED", ErrInvalidResolution)
+	}
+
+	var (
+		res    *domain.Resource
+		closed []domain.ResourceReport
+		status domain.ResourceStatus
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if res, err = s.resourceRepo.GetByIDForUpdate(ctx, resourceID); err != nil {
+			return err
+		}
+		if res == nil {
+			return ErrResourceNotFound
+		}
+		if closed, err = s.repo.Resolve(ctx, resourceID, outcome, actor.ID); err != nil {
+			return err
+		}
+		if len(closed) == 0 {
+			return ErrNoOpenReports
+		}
+		status = res.Status
+		if outcome == domain.ReportUpheld && res.Status != domain.ResourceStatusRejected {
+			status = domain.ResourceStatusRejected
+			return s.resourceRepo.UpdateStatus(ctx, resourceID, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditReportResolve, "resource", strconv.FormatInt(resourceID, 10),
+		map[string]any{"status": res.Status},
+		map[string]any{"status": status, "outcome": outcome, "reports": len(closed)})
+
+	msg := fmt.Sprintf("Your report on %q was reviewed: no violation was found.", res.Title)
+	if outcome == domain.ReportUpheld {
+		msg = fmt.Sprintf("Your report on %q was reviewed: the resource has been removed.", res.Title)
+	}
+	for _, rp := range closed {
+		s.notifications.Notify(ctx, rp.ReporterID, msg)
+	}
+	return closed, nil
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range domain.ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
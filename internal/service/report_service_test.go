@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+// failingStatus is a ResourceRepository whose status updates fail
+type failingStatus struct {
+	domain.ResourceRepository
+}
+
+func (failingStatus) UpdateStatus(ctx context.Context, id int64, status domain.ResourceStatus) error {
+	return errors.New("database went away")
+}
+
+func TestResolveIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	reports := sqlite.NewReportRepository(db)
+	notifications := sqlite.NewNotificationRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+
+	admin := &domain.User{Name: "admin", Email: "admin@example.com"}
+	reporter := &domain.User{Name: "reporter", Email: "reporter@example.com"}
+	for _, u := range []*domain.User{admin, reporter} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := &domain.Resource{Title: "notes", Filename: "notes.pdf", Status: domain.ResourceStatusApproved, ReviewRound: 1}
+	if err := resources.Create(ctx, res); err != nil {
+		t.Fatal(err)
+	}
+	if err := reports.Create(ctx, &domain.ResourceReport{ResourceID: res.ID, ReporterID: reporter.ID, Reason: domain.ReportReasons[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := NewReportService(reports, failingStatus{resources}, NewNotificationService(notifications), audit, dbtx.NewManager(db), 0)
+	if _, err := broken.Resolve(ctx, admin, res.ID, domain.ReportUpheld); err == nil {
+		t.Fatal("Resolve succeeded although the resource could not be taken down")
+	}
+	if n, err := reports.CountOpen(ctx, res.ID); err != nil || n != 1 {
+		t.Fatalf("open reports after failed Resolve = %d, %v; want 1", n, err)
+	}
+	if list, _ := notifications.List(ctx, &reporter.ID); len(list) != 0 {
+		t.Errorf("reporter notified of a failed resolution: %+v", list)
+	}
+
+	s := NewReportService(reports, resources, NewNotificationService(notifications), audit, dbtx.NewManager(db), 0)
+	closed, err := s.Resolve(ctx, admin, res.ID, domain.ReportUpheld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 1 {
+		t.Errorf("closed %d reports; want 1", len(closed))
+	}
+	if got, _ := resources.GetByID(ctx, res.ID); got.Status != domain.ResourceStatusRejected {
+		t.Errorf("status = %s; want REJECTED", got.Status)
+	}
+	if _, err := s.Resolve(ctx, admin, res.ID, domain.ReportDismissed); !errors.Is(err, ErrNoOpenReports) {
+		t.Errorf("second Resolve = %v; want ErrNoOpenReports", err)
+	}
+}
+
+func TestHiddenResourceLeavesPublicList(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	taxonomy := NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit)
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, taxonomy, audit)
+	catalog := NewResourceService(resources, storage, audit, taxonomy, sqlite.NewTagRepository(db), dbtx.NewManager(db), authz)
+	reports := NewReportService(sqlite.NewReportRepository(db), resources, NewNotificationService(sqlite.NewNotificationRepository(db)), audit, dbtx.NewManager(db), 2)
+
+	admin := &domain.User{Name: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}
+	first := &domain.User{Name: "first", Email: "first@example.com"}
+	second := &domain.User{Name: "second", Email: "second@example.com"}
+	for _, u := range []*domain.User{admin, first, second} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := &domain.Resource{Title: "notes", Filename: "notes.pdf", Status: domain.ResourceStatusApproved, ReviewRound: 1}
+	pending := &domain.Resource{Title: "draft", Filename: "draft.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1}
+	for _, r := range []*domain.Resource{res, pending} {
+		if err := resources.Create(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed := func() []int64 {
+		list, err := catalog.List(ctx, domain.ResourceFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, r := range list {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	if ids := listed(); len(ids) != 1 || ids[0] != res.ID {
+		t.Fatalf("public list = %v; want only the approved resource %d", ids, res.ID)
+	}
+
+	for _, u := range []*domain.User{first, second} {
+		if _, err := reports.Report(ctx, u, res.ID, domain.ReportReasons[0], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ids := listed(); len(ids) != 0 {
+		t.Errorf("public list after the hide threshold = %v; want empty", ids)
+	}
+	if list, err := catalog.ListForReview(ctx, admin, domain.ResourceFilter{Status: domain.ResourceStatusPending}); err != nil || len(list) != 2 {
+		t.Errorf("ListForReview(PENDING) = %d resources, %v; want 2", len(list), err)
+	}
+	if list, err := catalog.ListForReview(ctx, first, domain.ResourceFilter{}); err != nil || len(list) != 0 {
+		t.Errorf("ListForReview by a non-reviewer = %d resources, %v; want none", len(list), err)
+	}
+}
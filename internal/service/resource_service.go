@@ -4,101 +4,279 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/zuquanzhi/Chirp/backend/internal/domain"
 )
 
+var (
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrInvalidSort      = errors.New("invalid sort")
+	ErrInvalidStatus    = errors.New("invalid status")
+)
+
 type ResourceService struct {
-	repo    domain.ResourceRepository
-	storage FileStorage
+	repo     domain.ResourceRepository
+	storage  FileStorage
+	audit    *AuditService
+	taxonomy *TaxonomyService
+	tags     domain.TagRepository
+	tx       domain.TxManager
+	authz    *AuthzService
 }
 
-func NewResourceService(repo domain.ResourceRepository, storage FileStorage) *ResourceService {
+func NewResourceService(repo domain.ResourceRepository, storage FileStorage, audit *AuditService, taxonomy *TaxonomyService, tags domain.TagRepository, tx domain.TxManager, authz *AuthzService) *ResourceService {
 	return &ResourceService{
-		repo:    repo,
-		storage: storage,
+		repo:     repo,
+		storage:  storage,
+		authz:    authz,
+		audit:    audit,
+		taxonomy: taxonomy,
+		tags:     tags,
+		tx:       tx,
+	}
+}
+
+func (s *ResourceService) Upload(ctx context.Context, ownerID *int64, title, desc, subject, resourceType string, tags []string, file multipart.File, header *multipart.FileHeader) (*domain.Resource, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	res := &domain.Resource{
+		OwnerID:     ownerID,
+		Title:       title,
+		Description: desc,
+		Status:      domain.ResourceStatusPending,
+		ReviewRound: 1,
+	}
+	if err := s.classify(ctx, res, &subject, &resourceType); err != nil {
+		return nil, err
+	}
+
+	savedName, size, fileHash, err := s.store(ctx, file, header)
+	if err != nil {
+		return nil, err
+	}
+	res.Filename = savedName // Store the key/path returned by storage
+	res.OriginalName = header.Filename
+	res.Size = size
+	res.FileHash = fileHash
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, res); err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			return s.tags.SetResourceTags(ctx, res.ID, tags)
+		}
+		return nil
+	})
+	if err != nil {
+		s.discard(ctx, savedName)
+		return nil, err
+	}
+	res.Tags = tags
+
+	res.URL = downloadURL(res.ID)
+
+	return res, nil
+}
+
+// classify sets the resource's subject and type from the given values,
+// resolving them against the taxonomy. Nil values are left unchanged.
+func (s *ResourceService) classify(ctx context.Context, res *domain.Resource, subject, resourceType *string) error {
+	if subject != nil {
+		res.Subject, res.SubjectID = *subject, nil
+		sub, err := s.taxonomy.ResolveSubject(ctx, *subject)
+		if err != nil {
+			return err
+		}
+		if sub != nil {
+			res.Subject, res.SubjectID = sub.Slug, &sub.ID
+		}
 	}
+	if resourceType != nil {
+		res.Type, res.TypeID = *resourceType, nil
+		t, err := s.taxonomy.ResolveType(ctx, *resourceType)
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			res.Type, res.TypeID = t.Slug, &t.ID
+		}
+	}
+	return nil
 }
 
-func (s *ResourceService) Upload(ctx context.Context, ownerID *int64, title, desc, subject, resourceType string, file multipart.File, header *multipart.FileHeader) (*domain.Resource, error) {
+// store hashes the upload and saves it under a fresh name, returning the
+// storage key, size and SHA-256 hash
+func (s *ResourceService) store(ctx context.Context, file multipart.File, header *multipart.FileHeader) (string, int64, string, error) {
 	// Calculate Hash
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
-		return nil, err
+		return "", 0, "", err
 	}
 	fileHash := hex.EncodeToString(hash.Sum(nil))
 
 	// Reset file pointer
 	file.Seek(0, 0)
 
-	id := uuid.New().String()
-	ext := filepath.Ext(header.Filename)
-	storedName := id + ext
-	
-	// Use Storage Interface
+	storedName := uuid.New().String() + filepath.Ext(header.Filename)
 	savedName, size, err := s.storage.Save(ctx, file, storedName)
 	if err != nil {
-		return nil, err
+		return "", 0, "", err
 	}
+	return savedName, size, fileHash, nil
+}
 
-	res := &domain.Resource{
-		OwnerID:      ownerID,
-		Title:        title,
-		Description:  desc,
-		Filename:     savedName, // Store the key/path returned by storage
-		OriginalName: header.Filename,
-		Size:         size,
-		FileHash:     fileHash,
-		Status:       domain.ResourceStatusPending,
-		Subject:      subject,
-		Type:         resourceType,
+// discard removes a stored file no row refers to any more: an upload whose
+// row was rolled back, or a file replaced on resubmission. Failures are
+// logged; they leave an orphan in storage but do not fail the request.
+func (s *ResourceService) discard(ctx context.Context, savedName string) {
+	if err := s.storage.Delete(ctx, savedName); err != nil {
+		log.Printf("discard file failed: file=%s err=%v", savedName, err)
 	}
+}
 
-	if err := s.repo.Create(ctx, res); err != nil {
+// List returns published resources; filter.Status is ignored
+func (s *ResourceService) List(ctx context.Context, filter domain.ResourceFilter) ([]domain.Resource, error) {
+	filter.Status = domain.ResourceStatusApproved
+	return s.list(ctx, filter)
+}
+
+// ListForReview returns resources in any status, or in filter.Status when
+// set, limited to the subjects reviewer may review
+func (s *ResourceService) ListForReview(ctx context.Context, reviewer *domain.User, filter domain.ResourceFilter) ([]domain.Resource, error) {
+	switch filter.Status {
+	case "", domain.ResourceStatusPending, domain.ResourceStatusApproved, domain.ResourceStatusRejected, domain.ResourceStatusChangesRequested:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, filter.Status)
+	}
+	list, err := s.list(ctx, filter)
+	if err != nil {
 		return nil, err
 	}
-
-	// Populate URL
-	res.URL = s.storage.GetPublicURL(savedName)
-
-	return res, nil
+	visible := list[:0]
+	for _, res := range list {
+		ok, err := s.authz.Can(ctx, reviewer, domain.PermResourceReview, res.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, res)
+		}
+	}
+	return visible, nil
 }
 
-func (s *ResourceService) List(ctx context.Context, status domain.ResourceStatus, search string) ([]domain.Resource, error) {
-	list, err := s.repo.List(ctx, status, search)
+func (s *ResourceService) list(ctx context.Context, filter domain.ResourceFilter) ([]domain.Resource, error) {
+	switch filter.Sort {
+	case "", domain.SortNewest, domain.SortRating, domain.SortLikes, domain.SortComments, domain.SortFavorites, domain.SortDownloads:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSort, filter.Sort)
+	}
+	tags, err := NormalizeTags(filter.Tags)
+	if err != nil {
+		return nil, err
+	}
+	filter.Tags = tags
+	list, err := s.repo.List(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 	// Populate URLs
 	for i := range list {
-		list[i].URL = s.storage.GetPublicURL(list[i].Filename)
+		list[i].URL = downloadURL(list[i].ID)
+	}
+	if err := s.loadTags(ctx, list); err != nil {
+		return nil, err
 	}
 	return list, nil
 }
 
-func (s *ResourceService) GetDownloadPath(ctx context.Context, id int64) (*domain.Resource, string, error) {
-	res, err := s.repo.GetByID(ctx, id)
+// loadTags sets the Tags of each resource
+func (s *ResourceService) loadTags(ctx context.Context, list []domain.Resource) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	byResource, err := s.tags.ForResources(ctx, ids)
 	if err != nil {
-		return nil, "", err
+		return err
 	}
-	if res == nil {
-		return nil, "", nil
+	for i := range list {
+		list[i].Tags = byResource[list[i].ID]
 	}
-	// Note: This method signature implies returning a local path, which might not work for OSS.
-	// Ideally, we should return a ReadCloser or a URL.
-	// For now, let's keep it compatible with LocalStorage logic in Handler, 
-	// but in a real OSS scenario, the Handler should use s.storage.Get() or s.storage.GetPublicURL().
-	// We will refactor the Handler to use the Service's GetContent method instead.
-	return res, res.Filename, nil
+	return nil
+}
+
+// Get returns the resource metadata, or nil when it does not exist
+func (s *ResourceService) Get(ctx context.Context, id int64) (*domain.Resource, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-// New method to get file content
-func (s *ResourceService) GetFileContent(ctx context.Context, id int64) (*domain.Resource, io.ReadCloser, error) {
+// Detail returns the resource with its download URL, or nil when it does not
+// exist or viewer may not see it (see visible). viewer may be nil.
+func (s *ResourceService) Detail(ctx context.Context, viewer *domain.User, id int64) (*domain.Resource, error) {
+	res, err := s.visibleByID(ctx, viewer, id)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	res.URL = downloadURL(res.ID)
+	byResource, err := s.tags.ForResources(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	res.Tags = byResource[id]
+	return res, nil
+}
+
+// visibleByID loads the resource, returning nil when it does not exist or
+// viewer may not see it. Approved resources are public; others, such as
+// pending or rejected uploads, are only shown to their uploader and to
+// users who may review their subject.
+func (s *ResourceService) visibleByID(ctx context.Context, viewer *domain.User, id int64) (*domain.Resource, error) {
 	res, err := s.repo.GetByID(ctx, id)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	if res.Status == domain.ResourceStatusApproved {
+		return res, nil
+	}
+	if viewer == nil {
+		return nil, nil
+	}
+	if res.OwnerID != nil && *res.OwnerID == viewer.ID {
+		return res, nil
+	}
+	ok, err := s.authz.Can(ctx, viewer, domain.PermResourceReview, res.Subject)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+// downloadURL is where clients fetch a resource's file. Files are only
+// served through the download endpoint, which applies the same visibility
+// rules as Detail and counts the download.
+func downloadURL(id int64) string {
+	return "/api/public/resources/" + strconv.FormatInt(id, 10) + "/download"
+}
+
+// GetFileContent opens the resource's file, or returns nil when the resource
+// does not exist or viewer may not see it. viewer may be nil.
+func (s *ResourceService) GetFileContent(ctx context.Context, viewer *domain.User, id int64) (*domain.Resource, io.ReadCloser, error) {
+	res, err := s.visibleByID(ctx, viewer, id)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,8 +292,102 @@ func (s *ResourceService) GetFileContent(ctx context.Context, id int64) (*domain
 }
 
 
-func (s *ResourceService) Review(ctx context.Context, id int64, status domain.ResourceStatus) error {
-	return s.repo.UpdateStatus(ctx, id, status)
+// ResourceEdit holds the metadata an uploader may change on resubmission.
+// Nil fields keep their current value.
+type ResourceEdit struct {
+	Title       *string
+	Description *string
+	Subject     *string
+	Type        *string
+	Tags        []string // nil keeps the tags; empty removes them
+}
+
+// Resubmit applies the uploader's edits, optionally replaces the file, and
+// sends a resource with requested changes back for review in a new round.
+func (s *ResourceService) Resubmit(ctx context.Context, owner *domain.User, id int64, edit ResourceEdit, file multipart.File, header *multipart.FileHeader) (*domain.Resource, error) {
+	res, err := s.repo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.OwnerID == nil || *res.OwnerID != owner.ID {
+		return nil, ErrNotResourceOwner
+	}
+	if res.Status != domain.ResourceStatusChangesRequested {
+		return nil, ErrResubmitNotAllowed
+	}
+
+	before := map[string]any{"status": res.Status, "round": res.ReviewRound, "title": res.Title, "subject": res.Subject, "file_hash": res.FileHash}
+	if edit.Title != nil {
+		res.Title = *edit.Title
+	}
+	if edit.Description != nil {
+		res.Description = *edit.Description
+	}
+	if err := s.classify(ctx, res, edit.Subject, edit.Type); err != nil {
+		return nil, err
+	}
+	var tags []string
+	if edit.Tags != nil {
+		if tags, err = NormalizeTags(edit.Tags); err != nil {
+			return nil, err
+		}
+	}
+	var stored string
+	replaced := res.Filename
+	if file != nil {
+		savedName, size, fileHash, err := s.store(ctx, file, header)
+		if err != nil {
+			return nil, err
+		}
+		stored = savedName
+		res.Filename, res.OriginalName, res.Size, res.FileHash = savedName, header.Filename, size, fileHash
+	}
+	res.ReviewRound++
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// the file is stored outside the transaction, so check again that
+		// no concurrent review or resubmission moved the resource on
+		current, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return ErrResourceNotFound
+		}
+		if current.Status != domain.ResourceStatusChangesRequested || current.ReviewRound != res.ReviewRound-1 {
+			return ErrResubmitNotAllowed
+		}
+		if err := s.repo.Resubmit(ctx, res); err != nil {
+			return err
+		}
+		if tags != nil {
+			return s.tags.SetResourceTags(ctx, id, tags)
+		}
+		return nil
+	})
+	if err != nil {
+		if stored != "" {
+			s.discard(ctx, stored)
+		}
+		return nil, err
+	}
+	// Each upload is stored under a fresh name, so no other row refers to
+	// the replaced file
+	if stored != "" && replaced != "" && replaced != stored {
+		s.discard(ctx, replaced)
+	}
+	byResource, err := s.tags.ForResources(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	res.Tags = byResource[id]
+
+	s.audit.Record(ctx, owner.ID, domain.AuditResourceResubmit, "resource", strconv.FormatInt(id, 10), before,
+		map[string]any{"status": res.Status, "round": res.ReviewRound, "title": res.Title, "subject": res.Subject, "file_hash": res.FileHash})
+	res.URL = downloadURL(res.ID)
+	return res, nil
 }
 
 func (s *ResourceService) CheckDuplicate(ctx context.Context, hash string) ([]domain.Resource, error) {
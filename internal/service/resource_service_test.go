@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+// memFile is an in-memory multipart.File
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+func TestResubmitReplacesFile(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+	storage, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	resources := sqlite.NewResourceRepository(db)
+	s := NewResourceService(resources, storage, audit, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), sqlite.NewTagRepository(db), dbtx.NewManager(db), nil)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	if err := sqlite.NewUserRepository(db).Create(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "v1.pdf"), []byte("first draft"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res := &domain.Resource{Title: "notes", Filename: "v1.pdf", OriginalName: "notes.pdf", Status: domain.ResourceStatusChangesRequested, ReviewRound: 1, OwnerID: &owner.ID}
+	if err := resources.Create(ctx, res); err != nil {
+		t.Fatal(err)
+	}
+
+	file := memFile{bytes.NewReader([]byte("second draft"))}
+	updated, err := s.Resubmit(ctx, owner, res.ID, ResourceEdit{}, file, &multipart.FileHeader{Filename: "notes-v2.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Filename == "v1.pdf" || updated.Status != domain.ResourceStatusPending {
+		t.Fatalf("resubmitted = %+v", updated)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "v1.pdf")); !os.IsNotExist(err) {
+		t.Errorf("replaced file still stored: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, updated.Filename)); err != nil || string(data) != "second draft" {
+		t.Errorf("new file = %q, %v", data, err)
+	}
+}
+
+func TestDetailHidesUnapproved(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := sqlite.NewUserRepository(db)
+	roles := sqlite.NewRoleRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	resources := sqlite.NewResourceRepository(db)
+	taxonomy := NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit)
+	authz := NewAuthzService(roles, users, taxonomy, audit)
+	s := NewResourceService(resources, storage, audit, taxonomy, sqlite.NewTagRepository(db), dbtx.NewManager(db), authz)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	ta := &domain.User{Name: "ta", Email: "ta@example.com"}
+	otherTA := &domain.User{Name: "other-ta", Email: "other-ta@example.com"}
+	for _, u := range []*domain.User{owner, other, ta, otherTA} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, a := range []domain.RoleAssignment{{UserID: ta.ID, Role: domain.RoleTA, Subject: "math"}, {UserID: otherTA.ID, Role: domain.RoleTA, Subject: "physics"}} {
+		if err := roles.Assign(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := &domain.Resource{Title: "notes", Subject: "math", Filename: "notes.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1, OwnerID: &owner.ID}
+	if err := resources.Create(ctx, res); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		viewer  *domain.User
+		visible bool
+	}{
+		{"anonymous", nil, false},
+		{"another user", other, false},
+		{"TA of another subject", otherTA, false},
+		{"uploader", owner, true},
+		{"TA of the subject", ta, true},
+	} {
+		got, err := s.Detail(ctx, tc.viewer, res.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got != nil) != tc.visible {
+			t.Errorf("%s: Detail of a pending resource = %v; want visible=%v", tc.name, got, tc.visible)
+		}
+	}
+
+	if err := resources.UpdateStatus(ctx, res.ID, domain.ResourceStatusApproved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Detail(ctx, nil, res.ID)
+	if err != nil || got == nil {
+		t.Fatalf("anonymous Detail of an approved resource = %v, %v", got, err)
+	}
+	// files are only reachable through the visibility-checked endpoint
+	if want := fmt.Sprintf("/api/public/resources/%d/download", res.ID); got.URL != want {
+		t.Errorf("URL = %q; want %q", got.URL, want)
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	maxReviewComment      = 2000
+	maxRequiredApprovals  = 10
+	defaultRequiredReview = 1
+)
+
+var (
+	ErrInvalidReview      = errors.New("invalid review")
+	ErrReviewClosed       = errors.New("resource is not awaiting review")
+	ErrAlreadyReviewed    = errors.New("already approved this submission")
+	ErrSelfReview         = errors.New("cannot review your own upload")
+	ErrInvalidPolicy      = errors.New("invalid review policy")
+	ErrPolicyNotFound     = errors.New("review policy not found")
+	ErrNotResourceOwner   = errors.New("only the uploader can do this")
+	ErrResubmitNotAllowed = errors.New("resource has no pending change request")
+)
+
+// ReviewOutcome reports a recorded review and where the resource stands
+type ReviewOutcome struct {
+	Review            *domain.ResourceReview `json:"review"`
+	Status            domain.ResourceStatus  `json:"status"`
+	Approvals         int                    `json:"approvals"`
+	RequiredApprovals int                    `json:"required_approvals"`
+}
+
+// ReviewService records reviewer decisions on resources. A rejection or
+// change request takes effect immediately; approvals accumulate until the
+// subject's policy is met. Each resubmission starts a new round.
+type ReviewService struct {
+	repo         domain.ReviewRepository
+	resourceRepo domain.ResourceRepository
+	authz        *AuthzService
+	taxonomy     *TaxonomyService
+	audit        *AuditService
+	tx           domain.TxManager
+}
+
+func NewReviewService(repo domain.ReviewRepository, resourceRepo domain.ResourceRepository, authz *AuthzService, taxonomy *TaxonomyService, audit *AuditService, tx domain.TxManager) *ReviewService {
+	return &ReviewService{
+		repo:         repo,
+		resourceRepo: resourceRepo,
+		authz:        authz,
+		taxonomy:     taxonomy,
+		audit:        audit,
+		tx:           tx,
+	}
+}
+
+// Review records the reviewer's decision on the current round of the resource.
+// A reason code is required unless approving.
+func (s *ReviewService) Review(ctx context.Context, reviewer *domain.User, id int64, decision domain.ReviewDecision, reasonCode, comment string) (*ReviewOutcome, error) {
+	reasonCode = strings.TrimSpace(reasonCode)
+	comment = strings.TrimSpace(comment)
+	switch decision {
+	case domain.ReviewApprove:
+	case domain.ReviewReject, domain.ReviewRequestChanges:
+		if reasonCode == "" {
+			return nil, fmt.Errorf("%w: reason_code required", ErrInvalidReview)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown decision %q", ErrInvalidReview, decision)
+	}
+	if reasonCode != "" && !validReasonCode(reasonCode) {
+		return nil, fmt.Errorf("%w: unknown reason_code %q", ErrInvalidReview, reasonCode)
+	}
+	if len(comment) > maxReviewComment {
+		return nil, fmt.Errorf("%w: comment too long (max %d characters)", ErrInvalidReview, maxReviewComment)
+	}
+
+	// The status check, the approval count and the status change happen in
+	// one transaction, so concurrent reviews cannot both act on a stale round
+	var (
+		res       *domain.Resource
+		review    *domain.ResourceReview
+		status    domain.ResourceStatus
+		approvals int
+		required  int
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if res, err = s.resourceRepo.GetByIDForUpdate(ctx, id); err != nil {
+			return err
+		}
+		if res == nil {
+			return ErrResourceNotFound
+		}
+		if res.OwnerID != nil && *res.OwnerID == reviewer.ID {
+			return ErrSelfReview
+		}
+		if res.Status != domain.ResourceStatusPending {
+			return ErrReviewClosed
+		}
+
+		history, err := s.repo.ListByResource(ctx, id)
+		if err != nil {
+			return err
+		}
+		if decision == domain.ReviewApprove && roundApprovers(history, res.ReviewRound)[reviewer.ID] {
+			return ErrAlreadyReviewed
+		}
+		if required, err = s.requiredApprovals(ctx, res.Subject); err != nil {
+			return err
+		}
+
+		review = &domain.ResourceReview{
+			ResourceID: id,
+			ReviewerID: reviewer.ID,
+			Round:      res.ReviewRound,
+			Decision:   decision,
+			ReasonCode: reasonCode,
+			Comment:    comment,
+		}
+		if err := s.repo.Create(ctx, review); err != nil {
+			return err
+		}
+
+		// Count again with this review included, rather than adding one to
+		// the earlier count
+		if history, err = s.repo.ListByResource(ctx, id); err != nil {
+			return err
+		}
+		approvals = len(roundApprovers(history, res.ReviewRound))
+
+		status = res.Status
+		switch decision {
+		case domain.ReviewApprove:
+			if approvals >= required {
+				status = domain.ResourceStatusApproved
+			}
+		case domain.ReviewReject:
+			status = domain.ResourceStatusRejected
+		case domain.ReviewRequestChanges:
+			status = domain.ResourceStatusChangesRequested
+		}
+		if status != res.Status {
+			return s.resourceRepo.UpdateStatus(ctx, id, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, reviewer.ID, domain.AuditResourceReview, "resource", strconv.FormatInt(id, 10),
+		map[string]any{"status": res.Status},
+		map[string]any{"status": status, "decision": decision, "reason_code": reasonCode, "comment": comment, "round": res.ReviewRound})
+	return &ReviewOutcome{
+		Review:            review,
+		Status:            status,
+		Approvals:         approvals,
+		RequiredApprovals: required,
+	}, nil
+}
+
+// History returns every review of the resource. It is visible to the
+// uploader and to users who may review the resource's subject.
+func (s *ReviewService) History(ctx context.Context, viewer *domain.User, id int64) ([]domain.ResourceReview, error) {
+	res, err := s.resourceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.OwnerID == nil || *res.OwnerID != viewer.ID {
+		ok, err := s.authz.Can(ctx, viewer, domain.PermResourceReview, res.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrForbidden
+		}
+	}
+	return s.repo.ListByResource(ctx, id)
+}
+
+func (s *ReviewService) Policies(ctx context.Context) ([]domain.ReviewPolicy, error) {
+	return s.repo.ListPolicies(ctx)
+}
+
+// SetPolicy requires the given number of distinct approvals for the subject.
+// It applies to approvals recorded from now on.
+func (s *ReviewService) SetPolicy(ctx context.Context, actor *domain.User, subject string, required int) (*domain.ReviewPolicy, error) {
+	subject = normalizeSubject(subject)
+	if subject == "" || len(subject) > 100 {
+		return nil, fmt.Errorf("%w: subject required (max 100 characters)", ErrInvalidPolicy)
+	}
+	if required < 1 || required > maxRequiredApprovals {
+		return nil, fmt.Errorf("%w: required_approvals must be between 1 and %d", ErrInvalidPolicy, maxRequiredApprovals)
+	}
+	// policies are looked up by the subject slug stored on resources
+	subject, err := s.taxonomy.SubjectSlug(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	subject = normalizeSubject(subject)
+	before, err := s.repo.GetPolicy(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	p := &domain.ReviewPolicy{
+		Subject:           subject,
+		RequiredApprovals: required,
+		UpdatedBy:         &actor.ID,
+	}
+	if err := s.repo.SavePolicy(ctx, p); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditReviewPolicySet, "review_policy", subject, policyState(before), policyState(p))
+	return p, nil
+}
+
+// DeletePolicy returns the subject to the default of one approval
+func (s *ReviewService) DeletePolicy(ctx context.Context, actor *domain.User, subject string) error {
+	subject = normalizeSubject(subject)
+	before, err := s.repo.GetPolicy(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if before == nil && subject != "" {
+		// the policy may have been stored under the subject's slug
+		slug, err := s.taxonomy.SubjectSlug(ctx, subject)
+		if err != nil && !errors.Is(err, ErrUnknownSubject) {
+			return err
+		}
+		if err == nil && slug != subject {
+			if before, err = s.repo.GetPolicy(ctx, slug); err != nil {
+				return err
+			}
+			subject = slug
+		}
+	}
+	ok, err := s.repo.DeletePolicy(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPolicyNotFound
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditReviewPolicyDelete, "review_policy", subject, policyState(before), nil)
+	return nil
+}
+
+func (s *ReviewService) requiredApprovals(ctx context.Context, subject string) (int, error) {
+	subject = normalizeSubject(subject)
+	if subject == "" {
+		return defaultRequiredReview, nil
+	}
+	p, err := s.repo.GetPolicy(ctx, subject)
+	if err != nil || p == nil {
+		return defaultRequiredReview, err
+	}
+	return p.RequiredApprovals, nil
+}
+
+// roundApprovers returns the reviewers who approved the given round
+func roundApprovers(history []domain.ResourceReview, round int) map[int64]bool {
+	approvers := make(map[int64]bool)
+	for _, rv := range history {
+		if rv.Round == round && rv.Decision == domain.ReviewApprove {
+			approvers[rv.ReviewerID] = true
+		}
+	}
+	return approvers
+}
+
+func validReasonCode(code string) bool {
+	for _, c := range domain.ReviewReasonCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSubject matches subjects case-insensitively, like role assignments
+func normalizeSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(subject))
+}
+
+// policyState is the audit snapshot of a review policy
+func policyState(p *domain.ReviewPolicy) any {
+	if p == nil {
+		return nil
+	}
+	return map[string]any{"required_approvals": p.RequiredApprovals}
+}
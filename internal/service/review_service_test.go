@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+func TestReviewApprovals(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	reviews := sqlite.NewReviewRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	s := NewReviewService(reviews, resources, nil, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit, dbtx.NewManager(db))
+
+	owner := domain.User{Name: "owner", Email: "owner@example.com"}
+	first := domain.User{Name: "first", Email: "first@example.com"}
+	second := domain.User{Name: "second", Email: "second@example.com"}
+	for _, u := range []*domain.User{&owner, &first, &second} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reviews.SavePolicy(ctx, &domain.ReviewPolicy{Subject: "math", RequiredApprovals: 2}); err != nil {
+		t.Fatal(err)
+	}
+	res := &domain.Resource{Title: "notes", Subject: "math", Filename: "notes.pdf", Status: domain.ResourceStatusPending, ReviewRound: 1, OwnerID: &owner.ID}
+	if err := resources.Create(ctx, res); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Review(ctx, &owner, res.ID, domain.ReviewApprove, "", ""); !errors.Is(err, ErrSelfReview) {
+		t.Fatalf("uploader approving = %v; want ErrSelfReview", err)
+	}
+	out, err := s.Review(ctx, &first, res.ID, domain.ReviewApprove, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Status != domain.ResourceStatusPending || out.Approvals != 1 || out.RequiredApprovals != 2 {
+		t.Errorf("first approval = %+v", out)
+	}
+	if _, err := s.Review(ctx, &first, res.ID, domain.ReviewApprove, "", ""); !errors.Is(err, ErrAlreadyReviewed) {
+		t.Errorf("approving twice = %v; want ErrAlreadyReviewed", err)
+	}
+	out, err = s.Review(ctx, &second, res.ID, domain.ReviewApprove, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Status != domain.ResourceStatusApproved || out.Approvals != 2 {
+		t.Errorf("second approval = %+v", out)
+	}
+	if got, _ := resources.GetByID(ctx, res.ID); got.Status != domain.ResourceStatusApproved {
+		t.Errorf("stored status = %s", got.Status)
+	}
+	if _, err := s.Review(ctx, &second, res.ID, domain.ReviewReject, domain.ReasonOther, ""); !errors.Is(err, ErrReviewClosed) {
+		t.Errorf("review after approval = %v; want ErrReviewClosed", err)
+	}
+	if list, _ := reviews.ListByResource(ctx, res.ID); len(list) != 2 {
+		t.Errorf("%d reviews stored; want 2", len(list))
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/sms"
+)
+
+const (
+	defaultSMSDeliveryPageSize = 50
+	maxSMSDeliveryPageSize     = 500
+	maxSMSDeliveryErrorLen     = 1000
+)
+
+// SMSDeliveryService keeps a record of every SMS send attempt, so support
+// can tell which provider handled a code that never arrived and look it up
+// in that provider's console
+type SMSDeliveryService struct {
+	repo domain.SMSDeliveryRepository
+}
+
+func NewSMSDeliveryService(repo domain.SMSDeliveryRepository) *SMSDeliveryService {
+	return &SMSDeliveryService{repo: repo}
+}
+
+// RecordDelivery implements sms.Recorder. Failures are logged rather than
+// returned so a database outage does not stop codes from being sent.
+func (s *SMSDeliveryService) RecordDelivery(ctx context.Context, d sms.Delivery) {
+	errMsg := d.Error
+	if len(errMsg) > maxSMSDeliveryErrorLen {
+		errMsg = errMsg[:maxSMSDeliveryErrorLen]
+	}
+	err := s.repo.Create(ctx, &domain.SMSDelivery{
+		Phone:      d.Phone,
+		Purpose:    d.Purpose,
+		Provider:   d.Provider,
+		Status:     d.Status,
+		MessageID:  d.MessageID,
+		RequestID:  d.RequestID,
+		Error:      errMsg,
+		DurationMS: d.Duration.Milliseconds(),
+	})
+	if err != nil {
+		log.Printf("record sms delivery failed: provider=%s status=%s err=%v", d.Provider, d.Status, err)
+	}
+}
+
+func (s *SMSDeliveryService) List(ctx context.Context, filter domain.SMSDeliveryFilter) ([]domain.SMSDelivery, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultSMSDeliveryPageSize
+	}
+	if filter.Limit > maxSMSDeliveryPageSize {
+		filter.Limit = maxSMSDeliveryPageSize
+	}
+	return s.repo.List(ctx, filter)
+}
@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -13,9 +15,8 @@ type FileStorage interface {
 	Save(ctx context.Context, file io.Reader, filename string) (string, int64, error)
 	// Get for retrieving a file as a ReadCloser
 	Get(ctx context.Context, path string) (io.ReadCloser, error)
-	// GetPublicURL for getting a public URL to access the file
-	// For local storage, it may return a relative path
-	GetPublicURL(path string) string
+	// Delete removes a stored file; deleting a missing file is not an error
+	Delete(ctx context.Context, path string) error
 }
 
 // LocalStorage local filesystem implementation
@@ -55,7 +56,10 @@ func (s *LocalStorage) Get(ctx context.Context, path string) (io.ReadCloser, err
 	return os.Open(fpath)
 }
 
-func (s *LocalStorage) GetPublicURL(path string) string {
-	// For local storage, return relative path
-	return "/uploads/" + path
+func (s *LocalStorage) Delete(ctx context.Context, path string) error {
+	err := os.Remove(filepath.Join(s.baseDir, filepath.Base(path)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	maxTagLength       = 32
+	maxResourceTags    = 10
+	defaultTagSuggests = 10
+	maxTagSuggests     = 50
+)
+
+var (
+	ErrInvalidTag  = errors.New("invalid tag")
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("tag already exists")
+)
+
+// TagService suggests tags, edits the tags of a resource and lets admins
+// clean up the tag vocabulary
+type TagService struct {
+	repo         domain.TagRepository
+	resourceRepo domain.ResourceRepository
+	authz        *AuthzService
+	audit        *AuditService
+}
+
+func NewTagService(repo domain.TagRepository, resourceRepo domain.ResourceRepository, authz *AuthzService, audit *AuditService) *TagService {
+	return &TagService{
+		repo:         repo,
+		resourceRepo: resourceRepo,
+		authz:        authz,
+		audit:        audit,
+	}
+}
+
+// Autocomplete returns tags in use that start with prefix, most used first.
+// An empty prefix returns the most used tags.
+func (s *TagService) Autocomplete(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	if limit <= 0 {
+		limit = defaultTagSuggests
+	}
+	if limit > maxTagSuggests {
+		limit = maxTagSuggests
+	}
+	return s.repo.Search(ctx, tagKey(prefix), limit)
+}
+
+// SetForResource replaces the tags of a resource. The uploader and reviewers
+// of the resource's subject may retag it without a new review round.
+func (s *TagService) SetForResource(ctx context.Context, u *domain.User, id int64, raw []string) ([]string, error) {
+	tags, err := NormalizeTags(raw)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.resourceRepo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, ErrResourceNotFound
+	}
+	if res.OwnerID == nil || *res.OwnerID != u.ID {
+		ok, err := s.authz.Can(ctx, u, domain.PermResourceReview, res.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrForbidden
+		}
+	}
+	if err := s.repo.SetResourceTags(ctx, id, tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Rename changes a tag's name on every resource. Renaming onto an existing
+// tag is refused; merge the tags instead.
+func (s *TagService) Rename(ctx context.Context, actor *domain.User, id int64, name string) (*domain.Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrTagNotFound
+	}
+	if t.Name == name {
+		return t, nil
+	}
+	other, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if other != nil {
+		return nil, fmt.Errorf("%w: %q, merge into it instead", ErrTagExists, name)
+	}
+	// another admin may have created the name since the check above
+	if err := s.repo.Rename(ctx, id, name); errors.Is(err, domain.ErrTagNameTaken) {
+		return nil, fmt.Errorf("%w: %q, merge into it instead", ErrTagExists, name)
+	} else if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTagRename, "tag", strconv.FormatInt(id, 10),
+		map[string]any{"name": t.Name}, map[string]any{"name": name})
+	t.Name = name
+	return t, nil
+}
+
+// Merge moves the resources of tag id onto the tag named into and deletes
+// tag id. It returns the surviving tag.
+func (s *TagService) Merge(ctx context.Context, actor *domain.User, id int64, into string) (*domain.Tag, error) {
+	into, err := normalizeTag(into)
+	if err != nil {
+		return nil, err
+	}
+	from, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if from == nil {
+		return nil, ErrTagNotFound
+	}
+	target, err := s.repo.GetByName(ctx, into)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: %q", ErrTagNotFound, into)
+	}
+	if target.ID == from.ID {
+		return nil, fmt.Errorf("%w: cannot merge a tag into itself", ErrInvalidTag)
+	}
+	if err := s.repo.Merge(ctx, from.ID, target.ID); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTagMerge, "tag", strconv.FormatInt(id, 10),
+		map[string]any{"name": from.Name, "resource_count": from.ResourceCount},
+		map[string]any{"into_id": target.ID, "into": target.Name})
+	return s.repo.GetByID(ctx, target.ID)
+}
+
+// ParseTags splits comma-separated tag lists, as sent in forms and query
+// strings, into their parts
+func ParseTags(values ...string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, t := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '，' }) {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// NormalizeTags normalizes each tag and drops duplicates, keeping the
+// first-seen order
+func NormalizeTags(raw []string) ([]string, error) {
+	tags := []string{}
+	seen := make(map[string]bool, len(raw))
+	for _, r := range raw {
+		t, err := normalizeTag(r)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > maxResourceTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrInvalidTag, maxResourceTags)
+	}
+	return tags, nil
+}
+
+// normalizeTag lower-cases the tag, drops a leading '#' and joins words with
+// dashes. Letters, digits, '-', '_' and '.' are allowed.
+func normalizeTag(raw string) (string, error) {
+	t := tagKey(raw)
+	if t == "" || utf8.RuneCountInString(t) > maxTagLength {
+		return "", fmt.Errorf("%w: %q must be 1-%d characters", ErrInvalidTag, raw, maxTagLength)
+	}
+	for _, r := range t {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return "", fmt.Errorf("%w: %q may only contain letters, digits, '-', '_' and '.'", ErrInvalidTag, raw)
+		}
+	}
+	return t, nil
+}
+
+// tagKey applies the case and spacing rules without validating
+func tagKey(raw string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "#"))), "-")
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+// racingTags gives the next renamed-to name to another resource right
+// after Rename checks that it is free
+type racingTags struct {
+	domain.TagRepository
+	resourceID int64
+	raced      int
+}
+
+func (r *racingTags) GetByName(ctx context.Context, name string) (*domain.Tag, error) {
+	t, err := r.TagRepository.GetByName(ctx, name)
+	if err == nil && r.resourceID != 0 {
+		id := r.resourceID
+		r.resourceID = 0
+		if err := r.TagRepository.SetResourceTags(ctx, id, []string{name}); err != nil {
+			return nil, err
+		}
+		r.raced++
+	}
+	return t, err
+}
+
+func TestNormalizeTags(t *testing.T) {
+	if got := ParseTags("exam, calculus", "notes，2024 ", " , "); !reflect.DeepEqual(got, []string{"exam", "calculus", "notes", "2024"}) {
+		t.Errorf("ParseTags = %q", got)
+	}
+
+	tests := []struct {
+		raw  []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{"#Linear  Algebra", "linear-algebra", "LINEAR ALGEBRA"}, []string{"linear-algebra"}},
+		{[]string{"v1.2_draft", "数学", "Exam"}, []string{"v1.2_draft", "数学", "exam"}},
+	}
+	for _, tc := range tests {
+		if got, err := NormalizeTags(tc.raw); err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("NormalizeTags(%q) = %q, %v; want %q", tc.raw, got, err, tc.want)
+		}
+	}
+
+	many := make([]string, maxResourceTags+1)
+	for i := range many {
+		many[i] = "t" + strconv.Itoa(i)
+	}
+	for name, raw := range map[string][]string{
+		"empty":         {"exam", "  "},
+		"only a hash":   {"#"},
+		"too long":      {strings.Repeat("a", maxTagLength+1)},
+		"punctuation":   {"c++"},
+		"wildcard":      {"50%"},
+		"too many tags": many,
+	} {
+		if _, err := NormalizeTags(raw); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("NormalizeTags(%s) = %v; want ErrInvalidTag", name, err)
+		}
+	}
+	// the same tag written differently counts once towards the limit
+	if tags, err := NormalizeTags(append(many[:maxResourceTags], "#T0")); err != nil || len(tags) != maxResourceTags {
+		t.Errorf("NormalizeTags(duplicate at the limit) = %q, %v", tags, err)
+	}
+}
+
+func TestTagService(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	resources := sqlite.NewResourceRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit)
+	repo := &racingTags{TagRepository: sqlite.NewTagRepository(db)}
+	s := NewTagService(repo, resources, authz, audit)
+
+	owner := &domain.User{Name: "owner", Email: "owner@example.com"}
+	other := &domain.User{Name: "other", Email: "other@example.com"}
+	admin := &domain.User{Name: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}
+	for _, u := range []*domain.User{owner, other, admin} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var res []*domain.Resource
+	for _, title := range []string{"a", "b", "c"} {
+		r := &domain.Resource{Title: title, Filename: title + ".pdf", Subject: "math", OwnerID: &owner.ID, Status: domain.ResourceStatusApproved, ReviewRound: 1}
+		if err := resources.Create(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, r)
+	}
+
+	// tagging is limited to the uploader and the subject's reviewers
+	if tags, err := s.SetForResource(ctx, owner, res[0].ID, []string{"#Exam", "calc_1", "exam"}); err != nil || !reflect.DeepEqual(tags, []string{"exam", "calc_1"}) {
+		t.Fatalf("SetForResource = %q, %v", tags, err)
+	}
+	if _, err := s.SetForResource(ctx, other, res[0].ID, []string{"spam"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("SetForResource(not owner) = %v; want ErrForbidden", err)
+	}
+	if _, err := s.SetForResource(ctx, admin, res[1].ID, []string{"calc1", "exam"}); err != nil {
+		t.Errorf("SetForResource(reviewer) = %v", err)
+	}
+	if _, err := s.SetForResource(ctx, owner, 999, []string{"exam"}); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("SetForResource(missing) = %v; want ErrResourceNotFound", err)
+	}
+	if _, err := s.SetForResource(ctx, owner, res[2].ID, []string{"50%"}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("SetForResource(invalid) = %v; want ErrInvalidTag", err)
+	}
+
+	// LIKE wildcards in the prefix match literally
+	suggest := func(prefix string) []string {
+		t.Helper()
+		tags, err := s.Autocomplete(ctx, prefix, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		return names
+	}
+	for prefix, want := range map[string][]string{
+		"":       {"exam", "calc1", "calc_1"},
+		"#CALC":  {"calc1", "calc_1"},
+		"calc_":  {"calc_1"},
+		"%":      {},
+		"c%1":    {},
+		"!":      {},
+		"exam!%": {},
+	} {
+		if got := suggest(prefix); !reflect.DeepEqual(got, want) {
+			t.Errorf("Autocomplete(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+
+	exam, _ := repo.GetByName(ctx, "exam")
+	calc, _ := repo.GetByName(ctx, "calc_1")
+	calc1, _ := repo.GetByName(ctx, "calc1")
+
+	// renames keep the tag and are audited; names held by another tag are refused
+	renamed, err := s.Rename(ctx, admin, calc.ID, "Calculus")
+	if err != nil || renamed.ID != calc.ID || renamed.Name != "calculus" {
+		t.Fatalf("Rename = %+v, %v", renamed, err)
+	}
+	if _, err := s.Rename(ctx, admin, calc.ID, "#EXAM"); !errors.Is(err, ErrTagExists) {
+		t.Errorf("Rename(onto exam) = %v; want ErrTagExists", err)
+	}
+	if _, err := s.Rename(ctx, admin, 999, "anything"); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("Rename(missing) = %v; want ErrTagNotFound", err)
+	}
+	if tag, err := s.Rename(ctx, admin, calc.ID, "calculus"); err != nil || tag.Name != "calculus" {
+		t.Errorf("Rename(same name) = %+v, %v", tag, err)
+	}
+	entries, err := audit.List(ctx, domain.AuditFilter{Action: domain.AuditTagRename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].TargetID != strconv.FormatInt(calc.ID, 10) || string(entries[0].After) != `{"name":"calculus"}` {
+		t.Errorf("rename entries = %+v; want one for calc_1", entries)
+	}
+
+	// a name taken between the check and the update is refused the same way
+	repo.resourceID = res[2].ID
+	if _, err := s.Rename(ctx, admin, calc1.ID, "algebra"); !errors.Is(err, ErrTagExists) {
+		t.Errorf("Rename(racing a new tag) = %v; want ErrTagExists", err)
+	}
+	if repo.raced != 1 {
+		t.Fatal("the racing tag was not created")
+	}
+	if tag, _ := repo.GetByID(ctx, calc1.ID); tag == nil || tag.Name != "calc1" {
+		t.Errorf("tag after a refused rename = %+v", tag)
+	}
+
+	// merging moves the resources once and drops the merged tag
+	if _, err := s.Merge(ctx, admin, calc1.ID, "calc1"); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Merge(into itself) = %v; want ErrInvalidTag", err)
+	}
+	if _, err := s.Merge(ctx, admin, calc1.ID, "missing"); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("Merge(into missing) = %v; want ErrTagNotFound", err)
+	}
+	merged, err := s.Merge(ctx, admin, exam.ID, "calculus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.ID != calc.ID || merged.ResourceCount != 2 {
+		t.Errorf("Merge = %+v; want calculus on both tagged resources", merged)
+	}
+	if tag, err := repo.GetByID(ctx, exam.ID); err != nil || tag != nil {
+		t.Errorf("merged tag = %+v, %v; want it deleted", tag, err)
+	}
+	byResource, err := repo.ForResources(ctx, []int64{res[0].ID, res[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int64][]string{res[0].ID: {"calculus"}, res[1].ID: {"calc1", "calculus"}}; !reflect.DeepEqual(byResource, want) {
+		t.Errorf("tags after Merge = %v, want %v", byResource, want)
+	}
+	if entries, _ := audit.List(ctx, domain.AuditFilter{Action: domain.AuditTagMerge}); len(entries) != 1 {
+		t.Errorf("%d merge entries, want 1", len(entries))
+	}
+}
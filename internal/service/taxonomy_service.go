@@ -0,0 +1,626 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	maxTaxonomyName    = 100
+	maxTaxonomyAliases = 20
+)
+
+var (
+	ErrInvalidTaxonomy  = errors.New("invalid taxonomy term")
+	ErrTaxonomyNotFound = errors.New("taxonomy term not found")
+	ErrTaxonomyConflict = errors.New("slug or alias already in use")
+	ErrTaxonomyInUse    = errors.New("taxonomy term is in use")
+	ErrUnknownSubject   = errors.New("unknown subject")
+	ErrUnknownType      = errors.New("unknown resource type")
+
+	slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// parentKind is the kind a subject's parent must have; schools have none
+var parentKind = map[domain.SubjectKind]domain.SubjectKind{
+	domain.SubjectSchool:     "",
+	domain.SubjectDepartment: domain.SubjectSchool,
+	domain.SubjectCourse:     domain.SubjectDepartment,
+}
+
+// SubjectEdit holds the subject fields to change; nil leaves a field as is
+type SubjectEdit struct {
+	ParentID *int64
+	Kind     *domain.SubjectKind
+	Slug     *string
+	Name     *string
+	Names    map[string]string
+	Aliases  []string
+}
+
+// TypeEdit holds the resource type fields to change; nil leaves a field as is
+type TypeEdit struct {
+	Slug    *string
+	Name    *string
+	Names   map[string]string
+	Aliases []string
+}
+
+// BackfillReport describes how free-text values were mapped to terms
+type BackfillReport struct {
+	DryRun   bool                `json:"dry_run"`
+	Subjects BackfillScopeReport `json:"subjects"`
+	Types    BackfillScopeReport `json:"types"`
+	// References covers the subjects named by role assignments and review
+	// policies, which must match the slugs stored on resources
+	References BackfillReferenceReport `json:"subject_references"`
+}
+
+// BackfillScopeReport lists the value -> slug mappings of one scope, the
+// resources updated (zero on dry runs) and the values nothing matched
+type BackfillScopeReport struct {
+	Mapped    map[string]string `json:"mapped"`
+	Resources int64             `json:"resources_updated"`
+	Unmatched []string          `json:"unmatched"`
+}
+
+// BackfillReferenceReport lists the value -> slug mappings of subjects named
+// by role assignments and review policies, the rows changed (zero on dry
+// runs) and the values nothing matched
+type BackfillReferenceReport struct {
+	Mapped    map[string]string `json:"mapped"`
+	Roles     int64             `json:"roles_updated"`
+	Policies  int64             `json:"policies_updated"`
+	Unmatched []string          `json:"unmatched"`
+}
+
+// taxonomyTerm is the part of a subject or type used for resolution
+type taxonomyTerm struct {
+	id      int64
+	slug    string
+	name    string
+	names   map[string]string
+	aliases []string
+}
+
+// TaxonomyService manages subjects and resource types and resolves the
+// values users type in. While a scope has no terms yet, values in that scope
+// are accepted as free text so existing deployments keep working.
+type TaxonomyService struct {
+	repo  domain.TaxonomyRepository
+	audit *AuditService
+}
+
+func NewTaxonomyService(repo domain.TaxonomyRepository, audit *AuditService) *TaxonomyService {
+	return &TaxonomyService{repo: repo, audit: audit}
+}
+
+// SubjectTree returns the subjects nested school -> department -> course,
+// with DisplayName set for lang (falling back to Name)
+func (s *TaxonomyService) SubjectTree(ctx context.Context, lang string) ([]*domain.Subject, error) {
+	list, err := s.repo.ListSubjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*domain.Subject, len(list))
+	for i := range list {
+		list[i].DisplayName = displayName(list[i].Name, list[i].Names, lang)
+		byID[list[i].ID] = &list[i]
+	}
+	roots := []*domain.Subject{}
+	for i := range list {
+		sub := &list[i]
+		if sub.ParentID != nil {
+			if parent := byID[*sub.ParentID]; parent != nil {
+				parent.Children = append(parent.Children, sub)
+				continue
+			}
+		}
+		roots = append(roots, sub)
+	}
+	return roots, nil
+}
+
+// Types returns the resource types with DisplayName set for lang
+func (s *TaxonomyService) Types(ctx context.Context, lang string) ([]domain.ResourceType, error) {
+	list, err := s.repo.ListTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].DisplayName = displayName(list[i].Name, list[i].Names, lang)
+	}
+	if list == nil {
+		list = []domain.ResourceType{}
+	}
+	return list, nil
+}
+
+func (s *TaxonomyService) CreateSubject(ctx context.Context, actor *domain.User, sub *domain.Subject) (*domain.Subject, error) {
+	if err := s.validSubject(ctx, sub); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(ctx, domain.TaxonomySubject, 0, sub.Slug, sub.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSubject(ctx, sub); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetAliases(ctx, domain.TaxonomySubject, sub.ID, sub.Aliases); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyCreate, "subject", strconv.FormatInt(sub.ID, 10), nil, sub)
+	return sub, nil
+}
+
+// UpdateSubject edits a subject. The slug of a subject that resources use is
+// fixed, as are the kinds of subjects that have children.
+func (s *TaxonomyService) UpdateSubject(ctx context.Context, actor *domain.User, id int64, edit SubjectEdit) (*domain.Subject, error) {
+	sub, err := s.repo.GetSubject(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrTaxonomyNotFound
+	}
+	before := *sub
+	children, resources, err := s.repo.SubjectUsage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if edit.Kind != nil && *edit.Kind != sub.Kind {
+		if children > 0 {
+			return nil, fmt.Errorf("%w: cannot change the kind of a subject with children", ErrTaxonomyInUse)
+		}
+		sub.Kind = *edit.Kind
+		sub.ParentID = nil
+	}
+	if edit.ParentID != nil {
+		sub.ParentID = edit.ParentID
+	}
+	if edit.Slug != nil && normalizeTerm(*edit.Slug) != sub.Slug {
+		if resources > 0 {
+			return nil, fmt.Errorf("%w: slug is used by %d resources", ErrTaxonomyInUse, resources)
+		}
+		sub.Slug = *edit.Slug
+	}
+	if edit.Name != nil {
+		sub.Name = *edit.Name
+	}
+	if edit.Names != nil {
+		sub.Names = edit.Names
+	}
+	if edit.Aliases != nil {
+		sub.Aliases = edit.Aliases
+	}
+	if sub.ParentID != nil && *sub.ParentID == sub.ID {
+		return nil, fmt.Errorf("%w: subject cannot be its own parent", ErrInvalidTaxonomy)
+	}
+	if err := s.validSubject(ctx, sub); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(ctx, domain.TaxonomySubject, id, sub.Slug, sub.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSubject(ctx, sub); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetAliases(ctx, domain.TaxonomySubject, id, sub.Aliases); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyUpdate, "subject", strconv.FormatInt(id, 10), before, sub)
+	return sub, nil
+}
+
+// DeleteSubject removes a subject without children or resources
+func (s *TaxonomyService) DeleteSubject(ctx context.Context, actor *domain.User, id int64) error {
+	sub, err := s.repo.GetSubject(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return ErrTaxonomyNotFound
+	}
+	children, resources, err := s.repo.SubjectUsage(ctx, id)
+	if err != nil {
+		return err
+	}
+	if children > 0 || resources > 0 {
+		return fmt.Errorf("%w: %d child subjects, %d resources", ErrTaxonomyInUse, children, resources)
+	}
+	if err := s.repo.DeleteSubject(ctx, id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyDelete, "subject", strconv.FormatInt(id, 10), sub, nil)
+	return nil
+}
+
+func (s *TaxonomyService) CreateType(ctx context.Context, actor *domain.User, t *domain.ResourceType) (*domain.ResourceType, error) {
+	if err := validTerm(&t.Slug, &t.Name, t.Names, &t.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(ctx, domain.TaxonomyType, 0, t.Slug, t.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateType(ctx, t); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetAliases(ctx, domain.TaxonomyType, t.ID, t.Aliases); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyCreate, "resource_type", strconv.FormatInt(t.ID, 10), nil, t)
+	return t, nil
+}
+
+// UpdateType edits a resource type; the slug is fixed once resources use it
+func (s *TaxonomyService) UpdateType(ctx context.Context, actor *domain.User, id int64, edit TypeEdit) (*domain.ResourceType, error) {
+	t, err := s.repo.GetType(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrTaxonomyNotFound
+	}
+	before := *t
+	if edit.Slug != nil && normalizeTerm(*edit.Slug) != t.Slug {
+		resources, err := s.repo.TypeUsage(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if resources > 0 {
+			return nil, fmt.Errorf("%w: slug is used by %d resources", ErrTaxonomyInUse, resources)
+		}
+		t.Slug = *edit.Slug
+	}
+	if edit.Name != nil {
+		t.Name = *edit.Name
+	}
+	if edit.Names != nil {
+		t.Names = edit.Names
+	}
+	if edit.Aliases != nil {
+		t.Aliases = edit.Aliases
+	}
+	if err := validTerm(&t.Slug, &t.Name, t.Names, &t.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(ctx, domain.TaxonomyType, id, t.Slug, t.Aliases); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateType(ctx, t); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetAliases(ctx, domain.TaxonomyType, id, t.Aliases); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyUpdate, "resource_type", strconv.FormatInt(id, 10), before, t)
+	return t, nil
+}
+
+// DeleteType removes a resource type that no resource uses
+func (s *TaxonomyService) DeleteType(ctx context.Context, actor *domain.User, id int64) error {
+	t, err := s.repo.GetType(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return ErrTaxonomyNotFound
+	}
+	resources, err := s.repo.TypeUsage(ctx, id)
+	if err != nil {
+		return err
+	}
+	if resources > 0 {
+		return fmt.Errorf("%w: %d resources", ErrTaxonomyInUse, resources)
+	}
+	if err := s.repo.DeleteType(ctx, id); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyDelete, "resource_type", strconv.FormatInt(id, 10), t, nil)
+	return nil
+}
+
+// ResolveSubject maps a user-supplied value to a subject by ID, slug, alias
+// or display name. It returns nil for an empty value, and for any value
+// while no subjects are defined.
+func (s *TaxonomyService) ResolveSubject(ctx context.Context, value string) (*domain.Subject, error) {
+	list, err := s.repo.ListSubjects(ctx)
+	if err != nil || len(list) == 0 || strings.TrimSpace(value) == "" {
+		return nil, err
+	}
+	terms := make([]taxonomyTerm, len(list))
+	for i, sub := range list {
+		terms[i] = taxonomyTerm{id: sub.ID, slug: sub.Slug, name: sub.Name, names: sub.Names, aliases: sub.Aliases}
+	}
+	i, ok := resolveTerm(terms, value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSubject, value)
+	}
+	return &list[i], nil
+}
+
+// ResolveType is ResolveSubject for resource types
+func (s *TaxonomyService) ResolveType(ctx context.Context, value string) (*domain.ResourceType, error) {
+	list, err := s.repo.ListTypes(ctx)
+	if err != nil || len(list) == 0 || strings.TrimSpace(value) == "" {
+		return nil, err
+	}
+	terms := make([]taxonomyTerm, len(list))
+	for i, t := range list {
+		terms[i] = taxonomyTerm{id: t.ID, slug: t.Slug, name: t.Name, names: t.Names, aliases: t.Aliases}
+	}
+	i, ok := resolveTerm(terms, value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, value)
+	}
+	return &list[i], nil
+}
+
+// Backfill maps the free-text subject and type of resources that have no
+// term yet, using the same rules as uploads. A dry run only reports.
+func (s *TaxonomyService) Backfill(ctx context.Context, actor *domain.User, dryRun bool) (*BackfillReport, error) {
+	report := &BackfillReport{DryRun: dryRun}
+	var err error
+	report.Subjects, err = s.backfill(ctx, domain.TaxonomySubject, dryRun, func(v string) (int64, string, error) {
+		sub, err := s.ResolveSubject(ctx, v)
+		if err != nil || sub == nil {
+			return 0, "", err
+		}
+		return sub.ID, sub.Slug, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Types, err = s.backfill(ctx, domain.TaxonomyType, dryRun, func(v string) (int64, string, error) {
+		t, err := s.ResolveType(ctx, v)
+		if err != nil || t == nil {
+			return 0, "", err
+		}
+		return t.ID, t.Slug, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.References, err = s.backfillReferences(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		s.audit.Record(ctx, actor.ID, domain.AuditTaxonomyBackfill, "taxonomy", "", nil, report)
+	}
+	return report, nil
+}
+
+func (s *TaxonomyService) backfill(ctx context.Context, scope domain.TaxonomyScope, dryRun bool, resolve func(string) (int64, string, error)) (BackfillScopeReport, error) {
+	r := BackfillScopeReport{Mapped: map[string]string{}, Unmatched: []string{}}
+	values, err := s.repo.UnmappedValues(ctx, scope)
+	if err != nil {
+		return r, err
+	}
+	for _, v := range values {
+		id, slug, err := resolve(v)
+		if errors.Is(err, ErrUnknownSubject) || errors.Is(err, ErrUnknownType) || (err == nil && id == 0) {
+			r.Unmatched = append(r.Unmatched, v)
+			continue
+		}
+		if err != nil {
+			return r, err
+		}
+		r.Mapped[v] = slug
+		if dryRun {
+			continue
+		}
+		n, err := s.repo.MapValue(ctx, scope, v, id, slug)
+		if err != nil {
+			return r, err
+		}
+		r.Resources += n
+	}
+	return r, nil
+}
+
+// backfillReferences points role assignments and review policies at the
+// slug their subject resolves to, so they keep matching the resources
+func (s *TaxonomyService) backfillReferences(ctx context.Context, dryRun bool) (BackfillReferenceReport, error) {
+	r := BackfillReferenceReport{Mapped: map[string]string{}, Unmatched: []string{}}
+	values, err := s.repo.SubjectReferences(ctx)
+	if err != nil {
+		return r, err
+	}
+	for _, v := range values {
+		sub, err := s.ResolveSubject(ctx, v)
+		if errors.Is(err, ErrUnknownSubject) || (err == nil && sub == nil) {
+			r.Unmatched = append(r.Unmatched, v)
+			continue
+		}
+		if err != nil {
+			return r, err
+		}
+		if sub.Slug == v {
+			continue
+		}
+		r.Mapped[v] = sub.Slug
+		if dryRun {
+			continue
+		}
+		roles, policies, err := s.repo.MapSubjectReferences(ctx, v, sub.Slug)
+		if err != nil {
+			return r, err
+		}
+		r.Roles += roles
+		r.Policies += policies
+	}
+	return r, nil
+}
+
+// SubjectSlug returns the slug a subject named by a role assignment or review
+// policy is stored under. Values pass through trimmed while no subjects are
+// defined; otherwise they must resolve to a subject.
+func (s *TaxonomyService) SubjectSlug(ctx context.Context, value string) (string, error) {
+	sub, err := s.ResolveSubject(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	if sub == nil {
+		return strings.TrimSpace(value), nil
+	}
+	return sub.Slug, nil
+}
+
+// validSubject normalizes the subject and checks its place in the hierarchy
+func (s *TaxonomyService) validSubject(ctx context.Context, sub *domain.Subject) error {
+	if err := validTerm(&sub.Slug, &sub.Name, sub.Names, &sub.Aliases); err != nil {
+		return err
+	}
+	want, ok := parentKind[sub.Kind]
+	if !ok {
+		return fmt.Errorf("%w: kind must be school, department or course", ErrInvalidTaxonomy)
+	}
+	if want == "" {
+		if sub.ParentID != nil {
+			return fmt.Errorf("%w: a school has no parent", ErrInvalidTaxonomy)
+		}
+		return nil
+	}
+	if sub.ParentID == nil {
+		return fmt.Errorf("%w: a %s needs a %s as parent", ErrInvalidTaxonomy, sub.Kind, want)
+	}
+	parent, err := s.repo.GetSubject(ctx, *sub.ParentID)
+	if err != nil {
+		return err
+	}
+	if parent == nil || parent.Kind != want {
+		return fmt.Errorf("%w: a %s needs a %s as parent", ErrInvalidTaxonomy, sub.Kind, want)
+	}
+	return nil
+}
+
+// checkUnique makes sure the slug and aliases do not collide with another
+// term's slug or aliases in the same scope
+func (s *TaxonomyService) checkUnique(ctx context.Context, scope domain.TaxonomyScope, selfID int64, slug string, aliases []string) error {
+	var slugs map[string]int64
+	if scope == domain.TaxonomySubject {
+		list, err := s.repo.ListSubjects(ctx)
+		if err != nil {
+			return err
+		}
+		slugs = make(map[string]int64, len(list))
+		for _, sub := range list {
+			slugs[sub.Slug] = sub.ID
+		}
+	} else {
+		list, err := s.repo.ListTypes(ctx)
+		if err != nil {
+			return err
+		}
+		slugs = make(map[string]int64, len(list))
+		for _, t := range list {
+			slugs[t.Slug] = t.ID
+		}
+	}
+	for _, key := range append([]string{slug}, aliases...) {
+		if id, ok := slugs[key]; ok && id != selfID {
+			return fmt.Errorf("%w: %q", ErrTaxonomyConflict, key)
+		}
+		id, err := s.repo.FindAlias(ctx, scope, key)
+		if err != nil {
+			return err
+		}
+		if id != 0 && id != selfID {
+			return fmt.Errorf("%w: %q", ErrTaxonomyConflict, key)
+		}
+	}
+	return nil
+}
+
+// validTerm normalizes slug and aliases to lower case and checks the fields
+// shared by subjects and types
+func validTerm(slug, name *string, names map[string]string, aliases *[]string) error {
+	*slug = normalizeTerm(*slug)
+	*name = strings.TrimSpace(*name)
+	if !slugPattern.MatchString(*slug) {
+		return fmt.Errorf("%w: slug must be 1-64 lower-case letters, digits, '-' or '_'", ErrInvalidTaxonomy)
+	}
+	if *name == "" || len(*name) > maxTaxonomyName {
+		return fmt.Errorf("%w: name required (max %d characters)", ErrInvalidTaxonomy, maxTaxonomyName)
+	}
+	for lang, n := range names {
+		if lang == "" || strings.TrimSpace(n) == "" || len(n) > maxTaxonomyName {
+			return fmt.Errorf("%w: names must map a language to a name (max %d characters)", ErrInvalidTaxonomy, maxTaxonomyName)
+		}
+	}
+	if len(*aliases) > maxTaxonomyAliases {
+		return fmt.Errorf("%w: at most %d aliases", ErrInvalidTaxonomy, maxTaxonomyAliases)
+	}
+	seen := map[string]bool{*slug: true}
+	kept := []string{}
+	for _, a := range *aliases {
+		a = normalizeTerm(a)
+		if a == "" || len(a) > maxTaxonomyName {
+			return fmt.Errorf("%w: aliases must be non-empty (max %d characters)", ErrInvalidTaxonomy, maxTaxonomyName)
+		}
+		if !seen[a] {
+			seen[a] = true
+			kept = append(kept, a)
+		}
+	}
+	*aliases = kept
+	return nil
+}
+
+// resolveTerm finds the term value refers to: by ID, slug, alias, or a
+// unique case-insensitive match on a display name
+func resolveTerm(terms []taxonomyTerm, value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	key := normalizeTerm(value)
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		for i, t := range terms {
+			if t.id == id {
+				return i, true
+			}
+		}
+	}
+	for i, t := range terms {
+		if t.slug == key {
+			return i, true
+		}
+	}
+	for i, t := range terms {
+		for _, a := range t.aliases {
+			if a == key {
+				return i, true
+			}
+		}
+	}
+	found := -1
+	for i, t := range terms {
+		match := strings.EqualFold(t.name, value)
+		for _, n := range t.names {
+			match = match || strings.EqualFold(n, value)
+		}
+		if match {
+			if found >= 0 {
+				return 0, false // ambiguous
+			}
+			found = i
+		}
+	}
+	return found, found >= 0
+}
+
+func normalizeTerm(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+func displayName(name string, names map[string]string, lang string) string {
+	if n, ok := names[lang]; ok && n != "" {
+		return n
+	}
+	return name
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+func TestBackfillSubjectReferences(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	taxonomyRepo := sqlite.NewTaxonomyRepository(db)
+	reviews := sqlite.NewReviewRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	taxonomy := NewTaxonomyService(taxonomyRepo, audit)
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, taxonomy, audit)
+	review := NewReviewService(reviews, sqlite.NewResourceRepository(db), authz, taxonomy, audit, dbtx.NewManager(db))
+
+	admin := &domain.User{Name: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}
+	ta := &domain.User{Name: "ta", Email: "ta@example.com"}
+	for _, u := range []*domain.User{admin, ta} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// free-text subjects are kept as typed while there is no taxonomy
+	if _, err := authz.AssignRole(ctx, admin, ta.ID, domain.RoleTA, "Math"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := review.SetPolicy(ctx, admin, "math", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	math := &domain.Subject{Kind: domain.SubjectSchool, Slug: "mathematics", Name: "Mathematics"}
+	if err := taxonomyRepo.CreateSubject(ctx, math); err != nil {
+		t.Fatal(err)
+	}
+	if err := taxonomyRepo.SetAliases(ctx, domain.TaxonomySubject, math.ID, []string{"math"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := authz.Can(ctx, ta, domain.PermResourceReview, "mathematics"); err != nil || ok {
+		t.Fatalf("Can before backfill = %v, %v; want false", ok, err)
+	}
+
+	report, err := taxonomy.Backfill(ctx, admin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := report.References
+	if !reflect.DeepEqual(refs.Mapped, map[string]string{"Math": "mathematics", "math": "mathematics"}) || refs.Roles != 1 || refs.Policies != 1 {
+		t.Errorf("References = %+v", refs)
+	}
+	if ok, err := authz.Can(ctx, ta, domain.PermResourceReview, "mathematics"); err != nil || !ok {
+		t.Errorf("Can after backfill = %v, %v; want true", ok, err)
+	}
+	if n, err := review.requiredApprovals(ctx, "mathematics"); err != nil || n != 2 {
+		t.Errorf("requiredApprovals after backfill = %d, %v; want 2", n, err)
+	}
+
+	// once subjects are defined, new references are stored by slug
+	if _, err := authz.AssignRole(ctx, admin, ta.ID, domain.RoleTA, "Physics"); !errors.Is(err, ErrUnknownSubject) {
+		t.Errorf("AssignRole(unknown subject) = %v; want ErrUnknownSubject", err)
+	}
+	if p, err := review.SetPolicy(ctx, admin, "Mathematics", 3); err != nil || p.Subject != "mathematics" {
+		t.Errorf("SetPolicy = %+v, %v; want subject mathematics", p, err)
+	}
+	if _, err := review.SetPolicy(ctx, admin, "Physics", 3); !errors.Is(err, ErrUnknownSubject) {
+		t.Errorf("SetPolicy(unknown subject) = %v; want ErrUnknownSubject", err)
+	}
+	if err := authz.RevokeRole(ctx, admin, ta.ID, domain.RoleTA, "Math"); err != nil {
+		t.Errorf("RevokeRole by alias = %v", err)
+	}
+}
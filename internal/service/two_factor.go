@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/pkg/totp"
+)
+
+const (
+	tokenTypeTwoFactor = "2fa"
+	twoFactorTokenTTL  = 5 * time.Minute
+	// purposeTwoFactorLogin stores the challenge of each outstanding
+	// intermediate token, so the token is accepted once
+	purposeTwoFactorLogin = "2fa_login"
+	totpIssuer            = "Chirp"
+	recoveryCodeCount     = 10
+	recoveryCodeChars     = 10 // base32 characters, 50 bits
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidToken         = errors.New("invalid or expired token")
+)
+
+// TwoFactorEnrollment is returned when a user starts TOTP enrollment
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// EnrollTwoFactor generates a new TOTP secret for u. The enrollment stays
+// disabled until ConfirmTwoFactor is called with a valid code.
+func (s *AuthService) EnrollTwoFactor(ctx context.Context, u *domain.User) (*TwoFactorEnrollment, error) {
+	existing, err := s.tfRepo.Get(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tfRepo.Save(ctx, &domain.TwoFactor{UserID: u.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	account := u.Email
+	if account == "" {
+		account = u.PhoneNumber
+	}
+	return &TwoFactorEnrollment{Secret: secret, URI: totp.URI(totpIssuer, account, secret)}, nil
+}
+
+// ConfirmTwoFactor enables a pending enrollment and returns freshly generated
+// recovery codes. The plaintext codes are only available in this response.
+func (s *AuthService) ConfirmTwoFactor(ctx context.Context, userID int64, code string) ([]string, error) {
+	tf, err := s.tfRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	err = s.limitSecondFactor(userID, "", func() error {
+		step, ok := totp.Validate(tf.Secret, code, time.Now(), tf.LastUsedStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		tf.LastUsedStep = step
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tf.Enabled = true
+	if err := s.tfRepo.Save(ctx, tf); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, domain.AuditTwoFactorEnable, "user", strconv.FormatInt(userID, 10), nil, nil)
+
+	return s.newRecoveryCodes(ctx, userID)
+}
+
+// DisableTwoFactor removes the enrollment after checking a TOTP or recovery code.
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID int64, code string) error {
+	tf, err := s.enabledTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifySecondFactor(ctx, tf, code, ""); err != nil {
+		return err
+	}
+	if err := s.tfRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, userID, domain.AuditTwoFactorDisable, "user", strconv.FormatInt(userID, 10), nil, nil)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a TOTP code.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	tf, err := s.enabledTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifySecondFactor(ctx, tf, code, ""); err != nil {
+		return nil, err
+	}
+	codes, err := s.newRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, userID, domain.AuditRecoveryCodesRenew, "user", strconv.FormatInt(userID, 10), nil, nil)
+	return codes, nil
+}
+
+// CompleteTwoFactorLogin exchanges the intermediate token from Login plus a
+// TOTP or recovery code for a full access token.
+func (s *AuthService) CompleteTwoFactorLogin(ctx context.Context, twoFactorToken, code, clientIP string) (string, error) {
+	claims, err := s.parseTwoFactorToken(twoFactorToken)
+	if err != nil {
+		return "", err
+	}
+	userID := claims.userID
+
+	ipKey := ipAttemptKey(clientIP)
+	if s.blocked(twoFactorAttemptKey(userID), ipKey) {
+		return "", ErrTooManyAttempts
+	}
+
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	// A logout everywhere since the first factor voids the token
+	if u == nil || claims.version != u.TokenVersion {
+		return "", ErrInvalidToken
+	}
+	tf, err := s.enabledTwoFactor(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.verifySecondFactor(ctx, tf, code, ipKey); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.audit.Record(ctx, 0, domain.AuditLoginFailed, "user", strconv.FormatInt(userID, 10), nil, map[string]string{"method": "2fa", "reason": "invalid code"})
+		}
+		return "", err
+	}
+
+	if u.Suspended(time.Now()) {
+		return "", ErrAccountSuspended
+	}
+	ok, err := s.codeRepo.Consume(ctx, twoFactorChallengeTarget(userID), claims.challenge, purposeTwoFactorLogin)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	token, err := s.signToken(u, "", accessTokenTTL, true, "")
+	if err != nil {
+		return "", err
+	}
+	s.audit.Record(ctx, u.ID, domain.AuditLogin, "user", strconv.FormatInt(u.ID, 10), nil, map[string]string{"method": "2fa"})
+	return token, nil
+}
+
+func (s *AuthService) enabledTwoFactor(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	tf, err := s.tfRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || !tf.Enabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	return tf, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code. Each try counts against the user's attempt budget, and against ipKey
+// when set.
+func (s *AuthService) verifySecondFactor(ctx context.Context, tf *domain.TwoFactor, code, ipKey string) error {
+	code = strings.TrimSpace(code)
+	return s.limitSecondFactor(tf.UserID, ipKey, func() error {
+		if len(code) == totp.Digits {
+			step, ok := totp.Validate(tf.Secret, code, time.Now(), tf.LastUsedStep)
+			if !ok {
+				return ErrInvalidTwoFactorCode
+			}
+			tf.LastUsedStep = step
+			return s.tfRepo.Save(ctx, tf)
+		}
+
+		used, err := s.tfRepo.UseRecoveryCode(ctx, tf.UserID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	})
+}
+
+// limitSecondFactor runs check as one guess at userID's second factor. The
+// guess is counted before check runs, so parallel requests cannot exceed the
+// budget; it is given back if check fails for a reason other than a wrong
+// code, and a right code clears the user's failures.
+func (s *AuthService) limitSecondFactor(userID int64, ipKey string, check func() error) error {
+	acctKey := twoFactorAttemptKey(userID)
+	if _, ok := s.reserve(acctKey, ipKey); !ok {
+		return ErrTooManyAttempts
+	}
+	err := check()
+	switch {
+	case err == nil:
+		s.reset(acctKey)
+		s.release(ipKey)
+	case !errors.Is(err, ErrInvalidTwoFactorCode):
+		s.release(acctKey, ipKey)
+	}
+	return err
+}
+
+func (s *AuthService) newRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, (recoveryCodeChars*5+7)/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:recoveryCodeChars]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	if err := s.tfRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// twoFactorClaims is what an intermediate two-factor token carries
+type twoFactorClaims struct {
+	userID    int64
+	version   int64 // the user's TokenVersion at the first factor
+	challenge string
+}
+
+// signTwoFactorToken issues the intermediate token for u and stores its
+// challenge, replacing that of any earlier token
+func (s *AuthService) signTwoFactorToken(ctx context.Context, u *domain.User) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := hex.EncodeToString(b)
+	if err := s.codeRepo.Save(ctx, twoFactorChallengeTarget(u.ID), challenge, purposeTwoFactorLogin, twoFactorTokenTTL); err != nil {
+		return "", err
+	}
+	return s.signToken(u, tokenTypeTwoFactor, twoFactorTokenTTL, false, challenge)
+}
+
+func (s *AuthService) parseTwoFactorToken(tokenStr string) (*twoFactorClaims, error) {
+	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !tok.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if typ, _ := claims["typ"].(string); typ != tokenTypeTwoFactor {
+		return nil, ErrInvalidToken
+	}
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sv, _ := claims["sv"].(float64)
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, ErrInvalidToken
+	}
+	return &twoFactorClaims{userID: int64(sub), version: int64(sv), challenge: jti}, nil
+}
+
+// twoFactorChallengeTarget keys the stored challenge of a user's
+// intermediate token
+func twoFactorChallengeTarget(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// hashRecoveryCode normalizes user input (case, dashes, spaces) before hashing.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
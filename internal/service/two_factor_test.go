@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+	"github.com/zuquanzhi/Chirp/backend/pkg/limiter"
+	"github.com/zuquanzhi/Chirp/backend/pkg/totp"
+	"github.com/zuquanzhi/Chirp/backend/pkg/util"
+)
+
+// memTwoFactor is a TwoFactorRepository holding one user's enrollment
+type memTwoFactor struct {
+	mu       sync.Mutex
+	tf       *domain.TwoFactor
+	recovery map[string]bool
+}
+
+func (m *memTwoFactor) Get(ctx context.Context, userID int64) (*domain.TwoFactor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tf == nil || m.tf.UserID != userID {
+		return nil, nil
+	}
+	tf := *m.tf
+	return &tf, nil
+}
+
+func (m *memTwoFactor) Save(ctx context.Context, tf *domain.TwoFactor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *tf
+	m.tf = &saved
+	return nil
+}
+
+func (m *memTwoFactor) Delete(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tf, m.recovery = nil, nil
+	return nil
+}
+
+func (m *memTwoFactor) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recovery = map[string]bool{}
+	for _, h := range hashes {
+		m.recovery[h] = true
+	}
+	return nil
+}
+
+func (m *memTwoFactor) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.recovery[hash] {
+		return false, nil
+	}
+	delete(m.recovery, hash)
+	return true, nil
+}
+
+func TestSecondFactorLimitsGuesses(t *testing.T) {
+	ctx := context.Background()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memTwoFactor{tf: &domain.TwoFactor{UserID: 7, Secret: secret, Enabled: true}}
+	repo.ReplaceRecoveryCodes(ctx, 7, []string{hashRecoveryCode("AAAAA-BBBBB")})
+	policy := limiter.AttemptPolicy{LockoutThreshold: 5, LockoutDuration: time.Hour, Window: time.Hour}
+	s := &AuthService{tfRepo: repo, attempts: limiter.NewInMemoryAttemptTracker(policy)}
+
+	// Disabling and regenerating share the user's budget
+	for i := 0; i < 4; i++ {
+		if err := s.DisableTwoFactor(ctx, 7, "CCCCC-DDDDD"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("wrong code %d = %v; want ErrInvalidTwoFactorCode", i+1, err)
+		}
+	}
+	if _, err := s.RegenerateRecoveryCodes(ctx, 7, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("fifth wrong code = %v; want ErrInvalidTwoFactorCode", err)
+	}
+	if err := s.DisableTwoFactor(ctx, 7, "AAAAA-BBBBB"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("right code after lockout = %v; want ErrTooManyAttempts", err)
+	}
+	if !repo.recovery[hashRecoveryCode("AAAAA-BBBBB")] {
+		t.Error("recovery code used up while locked out")
+	}
+}
+
+func TestSecondFactorConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memTwoFactor{tf: &domain.TwoFactor{UserID: 7, Secret: secret}}
+	policy := limiter.AttemptPolicy{LockoutThreshold: 5, LockoutDuration: time.Hour, Window: time.Hour}
+	s := &AuthService{tfRepo: repo, attempts: limiter.NewInMemoryAttemptTracker(policy)}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		compared int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ConfirmTwoFactor(ctx, 7, "abcdef")
+			if errors.Is(err, ErrInvalidTwoFactorCode) {
+				mu.Lock()
+				compared++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if compared > policy.LockoutThreshold {
+		t.Errorf("%d codes compared; want at most %d", compared, policy.LockoutThreshold)
+	}
+}
+
+func TestTwoFactorTokenSingleUse(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	tfRepo := sqlite.NewTwoFactorRepository(db)
+	s := &AuthService{
+		userRepo:  users,
+		codeRepo:  sqlite.NewCodeRepository(db),
+		tfRepo:    tfRepo,
+		audit:     NewAuditService(sqlite.NewAuditRepository(db)),
+		jwtSecret: "secret",
+	}
+	hash, err := util.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &domain.User{Name: "mfa", Email: "mfa@example.com", Password: hash}
+	if err := users.Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tfRepo.Save(ctx, &domain.TwoFactor{UserID: u.ID, Secret: secret, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.newRecoveryCodes(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes[0]) != recoveryCodeChars+1 || codes[0][5] != '-' {
+		t.Errorf("recovery code %q; want %d characters and a dash", codes[0], recoveryCodeChars)
+	}
+	login := func() string {
+		t.Helper()
+		res, err := s.Login(ctx, "mfa@example.com", "correct horse", "")
+		if err != nil || !res.TwoFactorRequired {
+			t.Fatalf("Login = %+v, %v; want a two-factor token", res, err)
+		}
+		return res.TwoFactorToken
+	}
+
+	token := login()
+	if _, err := s.CompleteTwoFactorLogin(ctx, token, "WRONG-CODE0", ""); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("wrong code = %v; want ErrInvalidTwoFactorCode", err)
+	}
+	if _, err := s.CompleteTwoFactorLogin(ctx, token, codes[0], ""); err != nil {
+		t.Fatalf("CompleteTwoFactorLogin after a typo = %v", err)
+	}
+	if _, err := s.CompleteTwoFactorLogin(ctx, token, codes[1], ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("replayed token = %v; want ErrInvalidToken", err)
+	}
+
+	// a newer login supersedes the earlier token
+	older, newer := login(), login()
+	if _, err := s.CompleteTwoFactorLogin(ctx, older, codes[2], ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("superseded token = %v; want ErrInvalidToken", err)
+	}
+	if _, err := s.CompleteTwoFactorLogin(ctx, newer, codes[3], ""); err != nil {
+		t.Errorf("latest token = %v", err)
+	}
+
+	// a logout everywhere between the factors voids the token
+	token = login()
+	if err := users.RevokeTokens(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CompleteTwoFactorLogin(ctx, token, codes[4], ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token from before the logout = %v; want ErrInvalidToken", err)
+	}
+}
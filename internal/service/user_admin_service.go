@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+var (
+	ErrAccountSuspended  = errors.New("account suspended")
+	ErrCannotModifySelf  = errors.New("cannot perform this action on your own account")
+	ErrInvalidSuspension = errors.New("invalid suspension")
+)
+
+// UserAdminService backs the admin user management endpoints
+type UserAdminService struct {
+	userRepo  domain.UserRepository
+	tokenRepo domain.APITokenRepository
+	authz     *AuthzService
+	audit     *AuditService
+	tx        domain.TxManager
+}
+
+func NewUserAdminService(userRepo domain.UserRepository, tokenRepo domain.APITokenRepository, authz *AuthzService, audit *AuditService, tx domain.TxManager) *UserAdminService {
+	return &UserAdminService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		authz:     authz,
+		audit:     audit,
+		tx:        tx,
+	}
+}
+
+// List returns one page of users and the total number of matches
+func (s *UserAdminService) List(ctx context.Context, filter domain.UserFilter) ([]domain.User, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.userRepo.List(ctx, filter)
+}
+
+func (s *UserAdminService) Get(ctx context.Context, id int64) (*domain.User, error) {
+	u, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// SetRole changes the user's global role. Admins cannot change their own
+// role, so the last admin cannot lock everyone out by accident.
+func (s *UserAdminService) SetRole(ctx context.Context, actor *domain.User, id int64, role domain.UserRole) (*domain.User, error) {
+	if _, ok := domain.RolePermissions[role]; !ok && role != domain.RoleUser {
+		return nil, ErrInvalidRole
+	}
+	if actor.ID == id {
+		return nil, ErrCannotModifySelf
+	}
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditUserRoleChange, "user", strconv.FormatInt(id, 10),
+		map[string]domain.UserRole{"role": u.Role}, map[string]domain.UserRole{"role": role})
+	u.Role = role
+	return u, nil
+}
+
+// Suspend blocks the user from signing in and from using existing tokens.
+// Users who can manage roles may only be suspended by others who can.
+func (s *UserAdminService) Suspend(ctx context.Context, actor *domain.User, id int64, reason string, until *time.Time) (*domain.User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 500 {
+		return nil, fmt.Errorf("%w: reason required (max 500 characters)", ErrInvalidSuspension)
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidSuspension)
+	}
+	if actor.ID == id {
+		return nil, ErrCannotModifySelf
+	}
+
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOutrank(ctx, actor, u); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.Suspend(ctx, id, reason, until); err != nil {
+		return nil, err
+	}
+	after, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditUserSuspend, "user", strconv.FormatInt(id, 10), suspension(u), suspension(after))
+	return after, nil
+}
+
+// Unsuspend lifts a suspension. As with Suspend, only users who can manage
+// roles may unsuspend others who can.
+func (s *UserAdminService) Unsuspend(ctx context.Context, actor *domain.User, id int64) (*domain.User, error) {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOutrank(ctx, actor, u); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Unsuspend(ctx, id); err != nil {
+		return nil, err
+	}
+	after, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditUserUnsuspend, "user", strconv.FormatInt(id, 10), suspension(u), suspension(after))
+	return after, nil
+}
+
+// ForceLogout invalidates every session token issued to the user so far
+// and revokes all of their personal API tokens.
+func (s *UserAdminService) ForceLogout(ctx context.Context, actor *domain.User, id int64) error {
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if actor.ID != id {
+		if err := s.requireOutrank(ctx, actor, u); err != nil {
+			return err
+		}
+	}
+	var revoked int64
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.RevokeTokens(ctx, id); err != nil {
+			return err
+		}
+		revoked, err = s.tokenRepo.RevokeAll(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, actor.ID, domain.AuditUserForceLogout, "user", strconv.FormatInt(id, 10), nil, map[string]any{"api_tokens_revoked": revoked})
+	return nil
+}
+
+// suspension is the audit snapshot of a user's suspension state
+func suspension(u *domain.User) map[string]any {
+	return map[string]any{
+		"suspended_at":    u.SuspendedAt,
+		"suspended_until": u.SuspendedUntil,
+		"suspend_reason":  u.SuspendReason,
+	}
+}
+
+func (s *UserAdminService) requireOutrank(ctx context.Context, actor, target *domain.User) error {
+	targetIsManager, err := s.authz.Can(ctx, target, domain.PermRoleManage, "")
+	if err != nil || !targetIsManager {
+		return err
+	}
+	actorIsManager, err := s.authz.Can(ctx, actor, domain.PermRoleManage, "")
+	if err != nil {
+		return err
+	}
+	if !actorIsManager {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zuquanzhi/Chirp/backend/internal/domain"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/dbtx"
+	"github.com/zuquanzhi/Chirp/backend/internal/repository/sqlite"
+)
+
+func TestForceLogoutRevokesAPITokens(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := sqlite.NewUserRepository(db)
+	tokenRepo := sqlite.NewAPITokenRepository(db)
+	audit := NewAuditService(sqlite.NewAuditRepository(db))
+	authz := NewAuthzService(sqlite.NewRoleRepository(db), users, NewTaxonomyService(sqlite.NewTaxonomyRepository(db), audit), audit)
+	tokens := NewAPITokenService(tokenRepo, users, authz, audit)
+	admin := NewUserAdminService(users, tokenRepo, authz, audit, dbtx.NewManager(db))
+
+	root := &domain.User{Name: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}
+	dev := &domain.User{Name: "dev", Email: "dev@example.com"}
+	for _, u := range []*domain.User{root, dev} {
+		if err := users.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var secrets []string
+	for _, name := range []string{"ci", "cli"} {
+		_, secret, err := tokens.Create(ctx, dev, name, []string{domain.ScopeResourcesRead}, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, secret)
+	}
+	_, kept, err := tokens.Create(ctx, root, "ops", []string{domain.ScopeResourcesRead}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := admin.ForceLogout(ctx, root, dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := users.GetByID(ctx, dev.ID); err != nil || u.TokenVersion != 1 {
+		t.Errorf("TokenVersion = %+v, %v; want 1", u, err)
+	}
+	for _, secret := range secrets {
+		if _, _, err := tokens.Authenticate(ctx, secret, "203.0.113.7"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate after ForceLogout = %v; want ErrInvalidToken", err)
+		}
+	}
+	if _, _, err := tokens.Authenticate(ctx, kept, "203.0.113.7"); err != nil {
+		t.Errorf("Authenticate(admin's token) = %v", err)
+	}
+
+	entries, err := audit.List(ctx, domain.AuditFilter{Action: domain.AuditUserForceLogout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0].After) != `{"api_tokens_revoked":2}` {
+		t.Errorf("audit entries = %+v; want one recording 2 revoked tokens", entries)
+	}
+}
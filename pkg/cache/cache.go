@@ -0,0 +1,60 @@
+// Package cache stores short-lived copies of hot data. Values are opaque
+// bytes; callers encode them and decide what to cache and for how long.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores values under string keys until their time to live runs out.
+// Implementations may drop entries early, so a miss only means "load it".
+type Cache interface {
+	// Get returns the value stored under key and whether there was one
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys; missing keys are ignored
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Group runs one load per key at a time: callers asking for a key while it
+// is being loaded wait for that load and share its result, so an expired
+// hot key reaches the database once rather than once per request.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// Do runs fn for key unless a call for key is in flight, in which case it
+// waits for that call and returns its result
+func (g *Group) Do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis/redistest"
+)
+
+// testCache checks the behaviour every backend shares; advance moves the
+// backend's clock
+func testCache(t *testing.T, c Cache, advance func(time.Duration)) {
+	ctx := context.Background()
+	if _, ok, err := c.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("Get on empty cache = %v, %v", ok, err)
+	}
+	if err := c.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "b", []byte("2"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := c.Get(ctx, "a"); err != nil || !ok || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v, %v", v, ok, err)
+	}
+	if err := c.Set(ctx, "a", []byte("one"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := c.Get(ctx, "a"); string(v) != "one" {
+		t.Errorf("Get(a) after overwrite = %q", v)
+	}
+
+	advance(2 * time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("entry served after its TTL")
+	}
+	if _, ok, _ := c.Get(ctx, "b"); !ok {
+		t.Error("entry dropped before its TTL")
+	}
+
+	if err := c.Delete(ctx, "b", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("entry served after Delete")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(100)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	testCache(t, m, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2)
+	m.Set(ctx, "a", []byte("1"), time.Minute)
+	m.Set(ctx, "b", []byte("2"), time.Minute)
+	m.Get(ctx, "a")
+	m.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := m.Get(ctx, "b"); ok {
+		t.Error("least recently used entry survived")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok, _ := m.Get(ctx, k); !ok {
+			t.Errorf("%s evicted", k)
+		}
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len = %d, want 2", m.Len())
+	}
+}
+
+func TestRedis(t *testing.T) {
+	srv := redistest.NewServer(t)
+	testCache(t, NewRedis(srv.Client(t), "test:"), srv.FastForward)
+}
+
+func TestGroupSharesConcurrentLoads(t *testing.T) {
+	var g Group
+	var loads atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("k", func() ([]byte, error) {
+				loads.Add(1)
+				<-release
+				return []byte("v"), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = string(v)
+		}()
+	}
+	// Let every caller reach Do before the load finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("%d loads for concurrent callers, want 1", n)
+	}
+	for i, v := range results {
+		if v != "v" {
+			t.Errorf("caller %d got %q", i, v)
+		}
+	}
+
+	// Once the load is done the next call loads again
+	g.Do("k", func() ([]byte, error) { loads.Add(1); return nil, nil })
+	if n := loads.Load(); n != 2 {
+		t.Errorf("loads = %d after a later call, want 2", n)
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis"
+)
+
+// Redis is a Cache on a Redis-protocol server, shared by every instance
+// using the same server and prefix
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis stores entries under prefix+key
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.client.Do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	return value, ok, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	// PX needs at least a millisecond
+	ttl = max(ttl, time.Millisecond)
+	_, err := r.client.Do(ctx, "SET", r.prefix+key, value, "PX", ttl)
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, r.prefix+k)
+	}
+	_, err := r.client.Do(ctx, args...)
+	return err
+}
@@ -0,0 +1,76 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Sender defines the interface for sending verification emails
+type Sender interface {
+	Send(ctx context.Context, to, code, purpose string) error
+}
+
+// ConsoleSender is a mock sender that logs to console (for dev/test). It
+// logs codes only with EchoCodes set, which must stay off in production.
+type ConsoleSender struct {
+	EchoCodes bool
+}
+
+func (s *ConsoleSender) Send(ctx context.Context, to, code, purpose string) error {
+	if s.EchoCodes {
+		// Not a key=value field, so the log redaction leaves the code alone
+		log.Printf("[Email] to=%s purpose=%s dev echo: %s", to, purpose, code)
+		return nil
+	}
+	log.Printf("[Email] to=%s purpose=%s (code not sent; set DEV_ECHO_CODES=true to log it)", to, purpose)
+	return nil
+}
+
+// SMTPSender delivers verification codes through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPSender(host, port, username, password, from string) *SMTPSender {
+	return &SMTPSender{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, to, code, purpose string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient")
+	}
+
+	subject := "Chirp verification code"
+	body := fmt.Sprintf("Your Chirp verification code is %s. It expires in 5 minutes.\r\nIf you did not request it (%s), please ignore this email.", code, purpose)
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+
+	log.Printf("[Email] SMTP sent to=%s purpose=%s", to, purpose)
+	return nil
+}
@@ -0,0 +1,176 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// AttemptTracker records failed attempts per key (account, IP, phone...)
+// and decides when further attempts must be delayed or locked out.
+type AttemptTracker interface {
+	// Blocked reports whether key is currently blocked and how long is left.
+	Blocked(key string) (bool, time.Duration)
+	// Fail records a failed attempt for key and returns the number of
+	// consecutive failures recorded so far.
+	Fail(key string) int
+	// Reserve counts an attempt for key before it is checked, as Fail
+	// does, unless key is blocked. It returns the number of attempts
+	// counted so far and whether this one may go ahead. Concurrent attempts
+	// each get their own count, so they cannot all get in before the first
+	// failure is recorded. Reset or Release the key when the attempt turns
+	// out to be legitimate.
+	Reserve(key string) (int, bool)
+	// Release takes back one attempt counted by Reserve. Delays already
+	// imposed stay in place.
+	Release(key string)
+	// Reset clears the failure history for key, e.g. after a successful login.
+	Reset(key string)
+}
+
+// AttemptPolicy configures progressive delays and lockouts.
+type AttemptPolicy struct {
+	// FreeAttempts is the number of failures allowed before delays kick in.
+	FreeAttempts int
+	// BaseDelay is the delay after the first non-free failure; it doubles
+	// with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold is the number of failures that triggers a lockout.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long a failure is remembered after the last one.
+	Window time.Duration
+}
+
+// DefaultAttemptPolicy is suitable for password and OTP checks.
+var DefaultAttemptPolicy = AttemptPolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	Window:           15 * time.Minute,
+}
+
+// InMemoryAttemptTracker implements AttemptTracker in process memory
+type InMemoryAttemptTracker struct {
+	mu      sync.Mutex
+	entries map[string]*attempts
+	policy  AttemptPolicy
+}
+
+type attempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+func NewInMemoryAttemptTracker(policy AttemptPolicy) *InMemoryAttemptTracker {
+	t := &InMemoryAttemptTracker{
+		entries: make(map[string]*attempts),
+		policy:  policy,
+	}
+	// Start cleanup routine
+	go t.cleanup()
+	return t
+}
+
+func (t *InMemoryAttemptTracker) Blocked(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, exists := t.entries[key]
+	if !exists {
+		return false, 0
+	}
+	remaining := time.Until(a.blockedUntil)
+	if remaining <= 0 {
+		return false, 0
+	}
+	return true, remaining
+}
+
+func (t *InMemoryAttemptTracker) Fail(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count(key, time.Now())
+}
+
+func (t *InMemoryAttemptTracker) Reserve(key string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if a, exists := t.entries[key]; exists && now.Before(a.blockedUntil) {
+		return a.failures, false
+	}
+	return t.count(key, now), true
+}
+
+func (t *InMemoryAttemptTracker) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if a, exists := t.entries[key]; exists && a.failures > 0 {
+		a.failures--
+	}
+}
+
+// count records an attempt for key and applies the policy's delays. The
+// caller holds t.mu.
+func (t *InMemoryAttemptTracker) count(key string, now time.Time) int {
+	a, exists := t.entries[key]
+	if !exists || now.Sub(a.lastFailure) > t.policy.Window {
+		a = &attempts{}
+		t.entries[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+
+	if t.policy.LockoutThreshold > 0 && a.failures >= t.policy.LockoutThreshold {
+		a.blockedUntil = now.Add(t.policy.LockoutDuration)
+		return a.failures
+	}
+	if a.failures > t.policy.FreeAttempts && t.policy.BaseDelay > 0 {
+		a.blockedUntil = now.Add(t.delay(a.failures - t.policy.FreeAttempts))
+	}
+	return a.failures
+}
+
+func (t *InMemoryAttemptTracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// delay returns BaseDelay doubled for every step beyond the first, capped at MaxDelay.
+func (t *InMemoryAttemptTracker) delay(step int) time.Duration {
+	d := t.policy.BaseDelay
+	for i := 1; i < step; i++ {
+		d *= 2
+		if t.policy.MaxDelay > 0 && d >= t.policy.MaxDelay {
+			return t.policy.MaxDelay
+		}
+	}
+	if t.policy.MaxDelay > 0 && d > t.policy.MaxDelay {
+		return t.policy.MaxDelay
+	}
+	return d
+}
+
+func (t *InMemoryAttemptTracker) cleanup() {
+	interval := t.policy.Window
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		t.mu.Lock()
+		now := time.Now()
+		for k, a := range t.entries {
+			if now.Sub(a.lastFailure) > t.policy.Window && now.After(a.blockedUntil) {
+				delete(t.entries, k)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
@@ -0,0 +1,94 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAttemptTracker(t *testing.T) {
+	tr := NewInMemoryAttemptTracker(AttemptPolicy{
+		FreeAttempts:     2,
+		BaseDelay:        time.Minute,
+		MaxDelay:         time.Hour,
+		LockoutThreshold: 5,
+		LockoutDuration:  24 * time.Hour,
+		Window:           time.Hour,
+	})
+
+	for i := 1; i <= 2; i++ {
+		if n := tr.Fail("k"); n != i {
+			t.Fatalf("Fail = %d; want %d", n, i)
+		}
+		if blocked, _ := tr.Blocked("k"); blocked {
+			t.Fatalf("blocked after %d free failures", i)
+		}
+	}
+	tr.Fail("k")
+	if blocked, left := tr.Blocked("k"); !blocked || left > time.Minute || left < 59*time.Second {
+		t.Fatalf("Blocked after 3 failures = %v, %v; want the base delay", blocked, left)
+	}
+	tr.Fail("k")
+	if _, left := tr.Blocked("k"); left < 119*time.Second || left > 2*time.Minute {
+		t.Errorf("delay after 4 failures = %v; want doubled", left)
+	}
+	tr.Fail("k")
+	if _, left := tr.Blocked("k"); left < 23*time.Hour {
+		t.Errorf("delay after 5 failures = %v; want the lockout", left)
+	}
+	if blocked, _ := tr.Blocked("other"); blocked {
+		t.Error("unrelated key blocked")
+	}
+
+	tr.Reset("k")
+	if blocked, _ := tr.Blocked("k"); blocked {
+		t.Error("blocked after Reset")
+	}
+	if n := tr.Fail("k"); n != 1 {
+		t.Errorf("Fail after Reset = %d; want 1", n)
+	}
+}
+
+func TestAttemptTrackerReserve(t *testing.T) {
+	tr := NewInMemoryAttemptTracker(AttemptPolicy{FreeAttempts: 3, BaseDelay: time.Minute, Window: time.Hour})
+
+	// Parallel attempts each count before any is checked, so only the free
+	// ones and the one that triggers the delay get through
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed []int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, ok := tr.Reserve("k"); ok {
+				mu.Lock()
+				allowed = append(allowed, n)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(allowed) != 4 {
+		t.Fatalf("%d reservations allowed (%v); want 4", len(allowed), allowed)
+	}
+	seen := map[int]bool{}
+	for _, n := range allowed {
+		seen[n] = true
+	}
+	for n := 1; n <= 4; n++ {
+		if !seen[n] {
+			t.Errorf("counts %v; want each of 1-4 once", allowed)
+		}
+	}
+
+	tr2 := NewInMemoryAttemptTracker(AttemptPolicy{FreeAttempts: 3, BaseDelay: time.Minute, Window: time.Hour})
+	tr2.Reserve("k")
+	tr2.Reserve("k")
+	tr2.Release("k")
+	if n, ok := tr2.Reserve("k"); !ok || n != 2 {
+		t.Errorf("Reserve after Release = %d, %v; want 2, true", n, ok)
+	}
+}
@@ -1,75 +1,172 @@
 package limiter
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
 // RateLimiter defines interface for rate limiting
 type RateLimiter interface {
-	// Allow checks if the action is allowed for the key.
-	// Returns true if allowed, false otherwise.
-	Allow(key string) bool
+	// Allow counts an action for key and reports whether it may proceed,
+	// with the remaining allowance and when to retry if it may not. An
+	// error means the limiter could not decide, e.g. its store is down.
+	Allow(ctx context.Context, key string) (Result, error)
+	// Stop releases the limiter's background work
+	Stop()
 }
 
-// InMemoryLimiter implements a simple window-based rate limiter
+// Result is the outcome of Allow
+type Result struct {
+	Allowed bool
+	// Limit is the number of actions the policy allows per window
+	Limit int
+	// Remaining is how many more actions are allowed right now
+	Remaining int
+	// RetryAfter is how long to wait before the next action is allowed;
+	// zero when this one was
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full limit is available again
+	ResetAfter time.Duration
+}
+
+// InMemoryLimiter implements RateLimiter in process memory. Instances
+// behind a load balancer each keep their own counts; use RedisLimiter to
+// share them.
 type InMemoryLimiter struct {
-	mu       sync.Mutex
-	counters map[string]*window
-	limit    int
-	window   time.Duration
+	mu      sync.Mutex
+	entries map[string]*memEntry
+	policy  Policy
+	now     func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-type window struct {
-	count     int
-	startTime time.Time
+// memEntry is the state of one key; the policy's algorithm uses one of
+// the fields
+type memEntry struct {
+	count   int         // fixed window: actions in the window
+	end     time.Time   // fixed window: when the window ends
+	tat     time.Time   // token bucket: theoretical arrival time
+	log     []time.Time // sliding log: allowed actions in the window
+	expires time.Time   // when the entry no longer limits anything
 }
 
-func NewInMemoryLimiter(limit int, windowDuration time.Duration) *InMemoryLimiter {
+func NewInMemoryLimiter(policy Policy) *InMemoryLimiter {
 	l := &InMemoryLimiter{
-		counters: make(map[string]*window),
-		limit:    limit,
-		window:   windowDuration,
+		entries: make(map[string]*memEntry),
+		policy:  policy,
+		now:     time.Now,
+		stop:    make(chan struct{}),
 	}
 	// Start cleanup routine
 	go l.cleanup()
 	return l
 }
 
-func (l *InMemoryLimiter) Allow(key string) bool {
+func (l *InMemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	now := time.Now()
-	w, exists := l.counters[key]
+	now := l.now()
+	e, exists := l.entries[key]
+	if !exists || !now.Before(e.expires) {
+		e = &memEntry{}
+		l.entries[key] = e
+	}
 
-	if !exists || now.Sub(w.startTime) > l.window {
-		// New window or expired window
-		l.counters[key] = &window{
-			count:     1,
-			startTime: now,
+	var res Result
+	switch l.policy.Algorithm {
+	case TokenBucket:
+		var tat time.Time
+		tat, res = l.policy.tokenBucket(e.tat, now)
+		e.tat = tat
+	case SlidingLog:
+		e.log = trimLog(e.log, now.Add(-l.policy.Window))
+		res = l.policy.slidingLog(e.log, now)
+		if res.Allowed {
+			e.log = append(e.log, now)
+		}
+	default:
+		if !now.Before(e.end) {
+			e.count, e.end = 0, now.Add(l.policy.Window)
 		}
-		return true
+		e.count++
+		res = l.policy.fixedWindow(e.count, e.end.Sub(now))
 	}
+	e.expires = now.Add(res.ResetAfter)
+	return res, nil
+}
 
-	if w.count >= l.limit {
-		return false
+// trimLog drops the times at or before cutoff from the sorted log
+func trimLog(log []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(log) && !log[i].After(cutoff) {
+		i++
 	}
+	return log[i:]
+}
 
-	w.count++
-	return true
+// Stop ends the cleanup routine. The limiter keeps working, but no longer
+// forgets idle keys.
+func (l *InMemoryLimiter) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
 }
 
 func (l *InMemoryLimiter) cleanup() {
-	ticker := time.NewTicker(l.window * 2)
-	for range ticker.C {
+	ticker := time.NewTicker(l.policy.Window * 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
 		l.mu.Lock()
-		now := time.Now()
-		for k, w := range l.counters {
-			if now.Sub(w.startTime) > l.window {
-				delete(l.counters, k)
+		now := l.now()
+		for k, e := range l.entries {
+			if !now.Before(e.expires) {
+				delete(l.entries, k)
 			}
 		}
 		l.mu.Unlock()
 	}
 }
+
+// MultiLimiter applies several limiters to each key, e.g. one per minute
+// and ten per day. They are asked in order and the first denial stops the
+// rest from counting the action, so list the shortest windows first:
+// retrying too early then does not use up the longer allowances.
+type MultiLimiter struct {
+	limiters []RateLimiter
+}
+
+func NewMultiLimiter(limiters ...RateLimiter) *MultiLimiter {
+	return &MultiLimiter{limiters: limiters}
+}
+
+// Allow returns the first denial, or the allowed result with the least
+// remaining
+func (m *MultiLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	out := Result{Allowed: true}
+	for i, l := range m.limiters {
+		res, err := l.Allow(ctx, key)
+		if err != nil {
+			return Result{}, err
+		}
+		if !res.Allowed {
+			return res, nil
+		}
+		if i == 0 || res.Remaining < out.Remaining {
+			out = res
+		}
+	}
+	return out, nil
+}
+
+func (m *MultiLimiter) Stop() {
+	for _, l := range m.limiters {
+		l.Stop()
+	}
+}
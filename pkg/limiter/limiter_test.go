@@ -0,0 +1,183 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis/redistest"
+)
+
+// backend creates a limiter for a policy and a way to move its clock
+type backend func(t *testing.T, p Policy) (RateLimiter, func(time.Duration))
+
+func memoryBackend(t *testing.T, p Policy) (RateLimiter, func(time.Duration)) {
+	l := NewInMemoryLimiter(p)
+	t.Cleanup(l.Stop)
+	now := time.Now()
+	var mu sync.Mutex
+	l.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return l, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func redisBackend(t *testing.T, p Policy) (RateLimiter, func(time.Duration)) {
+	srv := redistest.NewServer(t)
+	return NewRedisLimiter(srv.Client(t), "rl:", p), srv.FastForward
+}
+
+func TestLimiters(t *testing.T) {
+	backends := map[string]backend{"Memory": memoryBackend, "Redis": redisBackend}
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("FixedWindow", func(t *testing.T) { testFixedWindow(t, b) })
+			t.Run("TokenBucket", func(t *testing.T) { testTokenBucket(t, b) })
+			t.Run("SlidingLog", func(t *testing.T) { testSlidingLog(t, b) })
+			t.Run("Multi", func(t *testing.T) { testMulti(t, b) })
+			t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, b) })
+		})
+	}
+}
+
+// expect calls Allow and checks the decision, the remaining allowance and
+// the wait. The Redis clock runs on, so waits are compared loosely.
+func expect(t *testing.T, l RateLimiter, key string, allowed bool, remaining int, retryAfter time.Duration) Result {
+	t.Helper()
+	res, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed != allowed || res.Remaining != remaining || (res.RetryAfter-retryAfter).Abs() > 100*time.Millisecond {
+		t.Fatalf("Allow(%s) = %+v; want allowed %v, %d remaining, retry after %s", key, res, allowed, remaining, retryAfter)
+	}
+	return res
+}
+
+func testFixedWindow(t *testing.T, b backend) {
+	l, advance := b(t, Policy{Algorithm: FixedWindow, Limit: 3, Window: time.Minute})
+	expect(t, l, "a", true, 2, 0)
+	advance(40 * time.Second)
+	expect(t, l, "a", true, 1, 0)
+	expect(t, l, "a", true, 0, 0)
+	res := expect(t, l, "a", false, 0, 20*time.Second)
+	if res.Limit != 3 || (res.ResetAfter-20*time.Second).Abs() > 100*time.Millisecond {
+		t.Errorf("denied result = %+v; want limit 3, reset after 20s", res)
+	}
+	expect(t, l, "b", true, 2, 0)
+	advance(20 * time.Second)
+	expect(t, l, "a", true, 2, 0)
+}
+
+func testTokenBucket(t *testing.T, b backend) {
+	l, advance := b(t, Policy{Algorithm: TokenBucket, Limit: 3, Window: time.Minute})
+	expect(t, l, "a", true, 2, 0)
+	expect(t, l, "a", true, 1, 0)
+	expect(t, l, "a", true, 0, 0)
+	res := expect(t, l, "a", false, 0, 20*time.Second)
+	if (res.ResetAfter - time.Minute).Abs() > 100*time.Millisecond {
+		t.Errorf("ResetAfter = %s, want 1m until the bucket is full", res.ResetAfter)
+	}
+	// One token comes back every 20 seconds
+	advance(20 * time.Second)
+	expect(t, l, "a", true, 0, 0)
+	expect(t, l, "a", false, 0, 20*time.Second)
+	advance(time.Hour)
+	expect(t, l, "a", true, 2, 0)
+}
+
+func testSlidingLog(t *testing.T, b backend) {
+	l, advance := b(t, Policy{Algorithm: SlidingLog, Limit: 3, Window: time.Minute})
+	expect(t, l, "a", true, 2, 0)
+	advance(30 * time.Second)
+	expect(t, l, "a", true, 1, 0)
+	expect(t, l, "a", true, 0, 0)
+	// The first action leaves the window in 30s, the others in a minute
+	res := expect(t, l, "a", false, 0, 30*time.Second)
+	if (res.ResetAfter - time.Minute).Abs() > 100*time.Millisecond {
+		t.Errorf("ResetAfter = %s, want 1m", res.ResetAfter)
+	}
+	advance(30 * time.Second)
+	expect(t, l, "a", true, 0, 0)
+	expect(t, l, "a", false, 0, 30*time.Second)
+}
+
+func testMulti(t *testing.T, b backend) {
+	perSecond, advance := b(t, Policy{Algorithm: FixedWindow, Limit: 1, Window: time.Second})
+	perMinute, advanceMinute := b(t, Policy{Algorithm: SlidingLog, Limit: 2, Window: time.Minute})
+	l := NewMultiLimiter(perSecond, perMinute)
+	both := func(d time.Duration) { advance(d); advanceMinute(d) }
+
+	expect(t, l, "a", true, 0, 0)
+	// Denied by the first limiter, so not counted by the second
+	expect(t, l, "a", false, 0, time.Second)
+	both(time.Second)
+	expect(t, l, "a", true, 0, 0)
+	both(time.Second)
+	expect(t, l, "a", false, 0, 58*time.Second)
+}
+
+func testConcurrent(t *testing.T, b backend) {
+	for _, alg := range []Algorithm{FixedWindow, TokenBucket, SlidingLog} {
+		l, _ := b(t, Policy{Algorithm: alg, Limit: 5, Window: time.Minute})
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := l.Allow(context.Background(), "shared")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if allowed != 5 {
+			t.Errorf("%s allowed %d of 20 concurrent actions, want 5", alg, allowed)
+		}
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	got, err := ParsePolicies("1/1m, sliding_log:10/24h,fixed_window:5/1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shortest window first
+	want := []Policy{
+		{Algorithm: FixedWindow, Limit: 5, Window: time.Second},
+		{Algorithm: TokenBucket, Limit: 1, Window: time.Minute},
+		{Algorithm: SlidingLog, Limit: 10, Window: 24 * time.Hour},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePolicies = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("policy %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if got, err := ParsePolicies("none"); err != nil || got != nil {
+		t.Errorf("ParsePolicies(none) = %v, %v", got, err)
+	}
+	for _, bad := range []string{"5", "0/1m", "5/0s", "5/soon", "leaky:5/1m"} {
+		if _, err := ParsePolicies(bad); err == nil {
+			t.Errorf("ParsePolicies(%q) succeeded", bad)
+		}
+	}
+}
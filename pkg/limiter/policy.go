@@ -0,0 +1,125 @@
+package limiter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm selects how a policy counts actions
+type Algorithm string
+
+const (
+	// FixedWindow counts actions in consecutive windows. It is the
+	// cheapest, but allows up to twice the limit across a window boundary.
+	FixedWindow Algorithm = "fixed_window"
+	// TokenBucket allows bursts of up to Limit actions and refills at
+	// Limit per Window, spreading sustained traffic evenly
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingLog remembers each allowed action and allows at most Limit
+	// in any Window. It is exact, but keeps up to Limit entries per key.
+	SlidingLog Algorithm = "sliding_log"
+)
+
+// Policy is a rate limit: Limit actions per Window, counted by Algorithm
+type Policy struct {
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+}
+
+// String formats the policy as ParsePolicies reads it
+func (p Policy) String() string {
+	return fmt.Sprintf("%s:%d/%s", p.Algorithm, p.Limit, p.Window)
+}
+
+// ParsePolicies reads a comma separated list of policies written as
+// [algorithm:]limit/window, such as "1/1m,sliding_log:10/24h". The
+// algorithm defaults to token_bucket. Policies are returned shortest window
+// first, the order MultiLimiter wants. "none" disables limiting and
+// returns no policies.
+func ParsePolicies(s string) ([]Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+	var policies []Policy
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		p := Policy{Algorithm: TokenBucket}
+		if alg, rest, ok := strings.Cut(item, ":"); ok {
+			p.Algorithm, item = Algorithm(alg), rest
+		}
+		switch p.Algorithm {
+		case FixedWindow, TokenBucket, SlidingLog:
+		default:
+			return nil, fmt.Errorf("unknown rate limit algorithm %q", p.Algorithm)
+		}
+		limit, window, ok := strings.Cut(item, "/")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q is not limit/window", item)
+		}
+		var err error
+		if p.Limit, err = strconv.Atoi(limit); err != nil || p.Limit <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q", limit)
+		}
+		if p.Window, err = time.ParseDuration(window); err != nil || p.Window <= 0 {
+			return nil, fmt.Errorf("invalid rate limit window %q", window)
+		}
+		policies = append(policies, p)
+	}
+	sort.SliceStable(policies, func(i, j int) bool { return policies[i].Window < policies[j].Window })
+	return policies, nil
+}
+
+// The algorithms below decide from the state of a key at now; the memory
+// and Redis limiters differ only in where that state lives.
+
+// fixedWindow decides for the count'th action of a window ending in left
+func (p Policy) fixedWindow(count int, left time.Duration) Result {
+	res := Result{Allowed: count <= p.Limit, Limit: p.Limit, Remaining: max(p.Limit-count, 0), ResetAfter: left}
+	if !res.Allowed {
+		res.RetryAfter = left
+	}
+	return res
+}
+
+// tokenBucket implements the bucket as the generic cell rate algorithm:
+// tat, the theoretical arrival time, is when the bucket would be full
+// again. Each action moves it one interval (Window/Limit) later, and an
+// action is allowed if that leaves tat at most Window ahead of now. It
+// returns the new tat, unchanged when the action is denied.
+func (p Policy) tokenBucket(tat, now time.Time) (time.Time, Result) {
+	interval := p.Window / time.Duration(p.Limit)
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	res := Result{Limit: p.Limit}
+	if ahead := next.Sub(now); ahead <= p.Window {
+		res.Allowed = true
+		res.Remaining = int((p.Window - ahead) / interval)
+		res.ResetAfter = ahead
+		return next, res
+	}
+	res.RetryAfter = next.Sub(now) - p.Window
+	res.ResetAfter = tat.Sub(now)
+	return tat, res
+}
+
+// slidingLog decides from the times of the actions allowed within the
+// window before now, oldest first
+func (p Policy) slidingLog(log []time.Time, now time.Time) Result {
+	n := len(log)
+	if n < p.Limit {
+		return Result{Allowed: true, Limit: p.Limit, Remaining: p.Limit - n - 1, ResetAfter: p.Window}
+	}
+	// A slot frees up when the action Limit places back leaves the window
+	return Result{
+		Limit:      p.Limit,
+		RetryAfter: log[n-p.Limit].Add(p.Window).Sub(now),
+		ResetAfter: log[n-1].Add(p.Window).Sub(now),
+	}
+}
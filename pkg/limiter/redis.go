@@ -0,0 +1,181 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis"
+)
+
+// maxRetries bounds how often Allow retries a transaction aborted by a
+// concurrent update of the same key
+const maxRetries = 10
+
+// RedisLimiter implements RateLimiter on a Redis-protocol server so that
+// all instances share the counts. Times come from the server's clock, so
+// instances need not agree on theirs. Token bucket and sliding log updates
+// use optimistic transactions (WATCH), retried when another instance
+// updates the same key at the same moment.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+	policy Policy
+}
+
+// NewRedisLimiter limits keys stored under prefix. Limiters with different
+// policies need different prefixes.
+func NewRedisLimiter(client *redis.Client, prefix string, policy Policy) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix, policy: policy}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	key = l.prefix + key
+	switch l.policy.Algorithm {
+	case TokenBucket:
+		return l.retry(ctx, key, l.tokenBucket)
+	case SlidingLog:
+		return l.retry(ctx, key, l.slidingLog)
+	}
+	return l.fixedWindow(ctx, key)
+}
+
+// Stop does nothing; the client belongs to the caller
+func (l *RedisLimiter) Stop() {}
+
+func (l *RedisLimiter) fixedWindow(ctx context.Context, key string) (Result, error) {
+	// The first action of a window creates the counter with its expiry
+	replies, err := l.client.Exec(ctx,
+		[]any{"SET", key, "0", "PX", l.policy.Window, "NX"},
+		[]any{"INCR", key},
+		[]any{"PTTL", key})
+	if err != nil {
+		return Result{}, err
+	}
+	count, err := redis.Int(replies[1], replyErr(replies[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	ttl, err := redis.Int(replies[2], replyErr(replies[2]))
+	if err != nil {
+		return Result{}, err
+	}
+	return l.policy.fixedWindow(int(count), time.Duration(ttl)*time.Millisecond), nil
+}
+
+// retry runs a WATCH-guarded update until no other client interferes
+func (l *RedisLimiter) retry(ctx context.Context, key string, update func(ctx context.Context, cn *redis.Conn, key string) (Result, error)) (Result, error) {
+	for i := 0; i < maxRetries; i++ {
+		var res Result
+		err := l.client.WithConn(ctx, func(cn *redis.Conn) error {
+			var err error
+			res, err = update(ctx, cn, key)
+			return err
+		})
+		if !errors.Is(err, redis.ErrTxAborted) {
+			return res, err
+		}
+	}
+	return Result{}, fmt.Errorf("limiter: %s still contended after %d attempts", key, maxRetries)
+}
+
+// tokenBucket stores the bucket's theoretical arrival time in microseconds
+func (l *RedisLimiter) tokenBucket(ctx context.Context, cn *redis.Conn, key string) (Result, error) {
+	if _, err := cn.Do(ctx, "WATCH", key); err != nil {
+		return Result{}, err
+	}
+	stored, err := redis.Int(cn.Do(ctx, "GET", key))
+	if err != nil {
+		return Result{}, err
+	}
+	now, err := serverTime(ctx, cn)
+	if err != nil {
+		return Result{}, err
+	}
+	var tat time.Time
+	if stored > 0 {
+		tat = time.UnixMicro(stored)
+	}
+	next, res := l.policy.tokenBucket(tat, now)
+	if !res.Allowed {
+		_, err := cn.Do(ctx, "UNWATCH")
+		return res, err
+	}
+	_, err = cn.Exec(ctx, []any{"SET", key, next.UnixMicro(), "PX", expiry(res.ResetAfter)})
+	return res, err
+}
+
+// slidingLog keeps the allowed actions in a sorted set scored by their
+// time in microseconds
+func (l *RedisLimiter) slidingLog(ctx context.Context, cn *redis.Conn, key string) (Result, error) {
+	if _, err := cn.Do(ctx, "WATCH", key); err != nil {
+		return Result{}, err
+	}
+	now, err := serverTime(ctx, cn)
+	if err != nil {
+		return Result{}, err
+	}
+	cutoff := now.Add(-l.policy.Window).UnixMicro()
+	reply, err := cn.Do(ctx, "ZRANGEBYSCORE", key, "("+strconv.FormatInt(cutoff, 10), "+inf", "WITHSCORES")
+	if err != nil {
+		return Result{}, err
+	}
+	items, _ := reply.([]any)
+	log := make([]time.Time, 0, len(items)/2)
+	for i := 1; i < len(items); i += 2 {
+		us, err := redis.Int(items[i], nil)
+		if err != nil {
+			return Result{}, err
+		}
+		log = append(log, time.UnixMicro(us))
+	}
+	res := l.policy.slidingLog(log, now)
+	if !res.Allowed {
+		_, err := cn.Do(ctx, "UNWATCH")
+		return res, err
+	}
+	// Members only need to be unique; the score is the time
+	member := strconv.FormatInt(now.UnixMicro(), 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+	_, err = cn.Exec(ctx,
+		[]any{"ZREMRANGEBYSCORE", key, "-inf", cutoff},
+		[]any{"ZADD", key, now.UnixMicro(), member},
+		[]any{"PEXPIRE", key, expiry(l.policy.Window)})
+	return res, err
+}
+
+// serverTime reads the server's clock with TIME
+func serverTime(ctx context.Context, cn *redis.Conn) (time.Time, error) {
+	reply, err := cn.Do(ctx, "TIME")
+	if err != nil {
+		return time.Time{}, err
+	}
+	parts, _ := reply.([]any)
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("limiter: unexpected TIME reply %v", reply)
+	}
+	sec, err := redis.Int(parts[0], nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	us, err := redis.Int(parts[1], nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, us*1000), nil
+}
+
+// expiry rounds d up to the whole millisecond PX and PEXPIRE take
+func expiry(d time.Duration) time.Duration {
+	return max((d + time.Millisecond - 1).Truncate(time.Millisecond), time.Millisecond)
+}
+
+// replyErr returns reply if it is an error reply inside a transaction
+func replyErr(reply any) error {
+	if err, ok := reply.(redis.Error); ok {
+		return err
+	}
+	return nil
+}
@@ -10,7 +10,7 @@ import (
 )
 
 // Setup configures the global logger to write to both stdout and a timestamped file in logDir.
-// Caller should close the returned file when shutting down.
+// Entries pass through Redact first. Caller should close the returned file when shutting down.
 func Setup(logDir string) (*os.File, error) {
 	if err := os.MkdirAll(logDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create log dir: %w", err)
@@ -25,7 +25,7 @@ func Setup(logDir string) (*os.File, error) {
 	}
 
 	mw := io.MultiWriter(os.Stdout, f)
-	log.SetOutput(mw)
+	log.SetOutput(NewRedactWriter(mw))
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
 	return f, nil
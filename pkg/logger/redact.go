@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values in log lines
+const Redacted = "[REDACTED]"
+
+var (
+	// field matches key=value, with the value bare or double quoted
+	field = regexp.MustCompile(`(^|[\s(\[{,])([A-Za-z_][A-Za-z0-9_.-]*)=("(?:[^"\\]|\\.)*"|[^\s,)\]}]*)`)
+
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// digitRun matches whole runs of digits; phonePattern decides whether
+	// a run is a mainland mobile or E.164 number
+	digitRun     = regexp.MustCompile(`\+?[0-9]{8,}`)
+	phonePattern = regexp.MustCompile(`^(\+[0-9]{8,15}|1[3-9][0-9]{9})$`)
+	tokenPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*|\bchirp_pat_[A-Za-z0-9_-]+`)
+)
+
+// secretKeys are field names whose values are never logged. Keys ending in
+// _token, _secret or _password count too.
+var secretKeys = map[string]bool{
+	"code":          true,
+	"otp":           true,
+	"token":         true,
+	"secret":        true,
+	"password":      true,
+	"authorization": true,
+	"api_key":       true,
+}
+
+// contactKeys are field names holding a phone number or email address
+var contactKeys = map[string]bool{
+	"phone":  true,
+	"mobile": true,
+	"email":  true,
+	"to":     true,
+	"target": true,
+}
+
+// Redact masks personal data and secrets in a log line. Values of secret
+// fields such as code=, token= and password= are replaced whole; phone
+// numbers and emails are masked wherever they appear, keeping enough to
+// tell them apart (138****0000, a***@example.com); JWTs and personal API
+// tokens are replaced wherever they appear.
+func Redact(line string) string {
+	line = field.ReplaceAllStringFunc(line, func(m string) string {
+		sub := field.FindStringSubmatch(m)
+		lead, key, value := sub[1], sub[2], sub[3]
+		if value == "" {
+			return m
+		}
+		k := strings.ToLower(key)
+		switch {
+		case secretKeys[k] || strings.HasSuffix(k, "_token") || strings.HasSuffix(k, "_secret") || strings.HasSuffix(k, "_password"):
+			return lead + key + "=" + Redacted
+		case contactKeys[k]:
+			mask := MaskPhone
+			if strings.Contains(value, "@") {
+				mask = MaskEmail
+			}
+			if len(value) >= 2 && value[0] == '"' {
+				return lead + key + `="` + mask(value[1:len(value)-1]) + `"`
+			}
+			return lead + key + "=" + mask(value)
+		}
+		return m
+	})
+	line = tokenPattern.ReplaceAllString(line, Redacted)
+	line = emailPattern.ReplaceAllStringFunc(line, MaskEmail)
+	return digitRun.ReplaceAllStringFunc(line, func(m string) string {
+		if phonePattern.MatchString(m) {
+			return MaskPhone(m)
+		}
+		return m
+	})
+}
+
+// MaskPhone keeps the first 3 and last 4 characters of a phone number,
+// or only the last 2 of a short one
+func MaskPhone(s string) string {
+	r := []rune(s)
+	keepHead, keepTail := 3, 4
+	if len(r) < 10 {
+		keepHead, keepTail = 0, 2
+	}
+	if len(r) <= keepTail {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:keepHead]) + strings.Repeat("*", len(r)-keepHead-keepTail) + string(r[len(r)-keepTail:])
+}
+
+// MaskEmail keeps the first character of the local part and the domain
+func MaskEmail(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at <= 0 {
+		return MaskPhone(s)
+	}
+	return s[:1] + "***" + s[at:]
+}
+
+// redactWriter applies Redact to everything written through it. The log
+// package writes each entry in a single call.
+type redactWriter struct {
+	w io.Writer
+}
+
+// NewRedactWriter returns a writer that redacts each write before passing
+// it to w
+func NewRedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
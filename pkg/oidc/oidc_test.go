@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zuquanzhi/Chirp/backend/pkg/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.IdP, *Provider) {
+	idp := oidctest.New(t, "chirp")
+	p := NewProvider(Config{
+		Issuer:       idp.URL,
+		ClientID:     "chirp",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://chirp.example.com/auth/oidc/campus/callback",
+	})
+	return idp, p
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newTestProvider(t)
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL = %s; want the discovered authorization endpoint", authURL)
+	}
+	code, state, err := idp.Authorize(authURL, jwt.MapClaims{"sub": "alice", "email": "alice@example.edu", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "state-1" {
+		t.Errorf("state = %q; want state-1", state)
+	}
+
+	tokens, err := p.Exchange(ctx, code, "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.VerifyIDToken(ctx, tokens.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "alice" || claims["email"] != "alice@example.edu" {
+		t.Errorf("claims = %v", claims)
+	}
+	info, err := p.UserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info["sub"] != "alice" {
+		t.Errorf("userinfo = %v", info)
+	}
+
+	if _, err := p.Exchange(ctx, code, "verifier-1"); err == nil {
+		t.Error("code exchanged twice")
+	}
+}
+
+func TestExchangeChecksVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newTestProvider(t)
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := idp.Authorize(authURL, jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier-2"); err == nil || !strings.Contains(err.Error(), "PKCE") {
+		t.Errorf("exchange with another verifier = %v; want a PKCE error", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	idp, p := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", idp.IDToken(jwt.MapClaims{"sub": "alice", "nonce": "n"}), true},
+		{"nonce mismatch", idp.IDToken(jwt.MapClaims{"sub": "alice", "nonce": "other"}), false},
+		{"no nonce", idp.IDToken(jwt.MapClaims{"sub": "alice"}), false},
+		{"other audience", idp.IDToken(jwt.MapClaims{"sub": "alice", "nonce": "n", "aud": "someone-else"}), false},
+		{"other issuer", idp.IDToken(jwt.MapClaims{"sub": "alice", "nonce": "n", "iss": "https://evil.example.com"}), false},
+		{"expired", idp.IDToken(jwt.MapClaims{"sub": "alice", "nonce": "n", "exp": now.Add(-time.Minute).Unix()}), false},
+		{"no expiry", oidctest.Sign(idp.Key, jwt.MapClaims{"sub": "alice", "nonce": "n", "iss": idp.URL, "aud": "chirp"}), false},
+		{"wrong key", oidctest.Sign(otherKey, jwt.MapClaims{"sub": "alice", "nonce": "n", "iss": idp.URL, "aud": "chirp", "exp": now.Add(time.Hour).Unix()}), false},
+		{"hmac", hmacToken(t, jwt.MapClaims{"sub": "alice", "nonce": "n", "iss": idp.URL, "aud": "chirp", "exp": now.Add(time.Hour).Unix()}), false},
+	}
+	for _, tt := range tests {
+		_, err := p.VerifyIDToken(ctx, tt.token, "n")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v; want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+// hmacToken signs claims with HS256, keyed by something an attacker could
+// know, to check that only the provider's RSA keys are accepted
+func hmacToken(t *testing.T, claims jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tok.Header["kid"] = oidctest.KeyID
+	s, err := tok.SignedString([]byte("chirp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.New(t, "chirp")
+	// A proxy in front of the provider serves its metadata under another issuer
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, idp.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer proxy.Close()
+
+	p := NewProvider(Config{Issuer: proxy.URL, ClientID: "chirp"})
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Errorf("AuthCodeURL = %v; want an issuer mismatch", err)
+	}
+}
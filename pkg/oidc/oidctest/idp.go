@@ -0,0 +1,220 @@
+// Package oidctest runs a minimal OpenID Connect provider for tests. It
+// serves discovery, JWKS, token and userinfo endpoints, enforces PKCE (S256)
+// and single-use codes, and signs ID tokens with a fresh RSA key.
+//
+// A test points an oidc.Provider at the issuer URL, follows the login with
+// Authorize instead of a browser, and hands the returned code to Exchange:
+//
+//	idp := oidctest.New(t, "chirp")
+//	p := oidc.NewProvider(oidc.Config{Issuer: idp.URL, ClientID: "chirp"})
+//	authURL, _ := p.AuthCodeURL(ctx, state, nonce, verifier)
+//	code, _, _ := idp.Authorize(authURL, jwt.MapClaims{"sub": "alice"})
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID is the kid of the provider's signing key
+const KeyID = "test-key"
+
+// IdP is a running test provider. URL is its issuer.
+type IdP struct {
+	*httptest.Server
+	ClientID string
+	Key      *rsa.PrivateKey
+
+	mu       sync.Mutex
+	grants   map[string]grant
+	userinfo map[string]jwt.MapClaims
+}
+
+type grant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// New starts a provider for clientID; it is closed when the test ends
+func New(t testing.TB, clientID string) *IdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &IdP{
+		ClientID: clientID,
+		Key:      key,
+		grants:   map[string]grant{},
+		userinfo: map[string]jwt.MapClaims{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/userinfo", p.userInfo)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Authorize plays the user signing in at authURL and returns the code and
+// state the provider redirects back with. The ID token issued for the code
+// carries claims plus the request's nonce; claims may set "nonce", "aud",
+// "iss" or "exp" to override the defaults.
+func (p *IdP) Authorize(authURL string, claims jwt.MapClaims) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	switch {
+	case u.Path != "/authorize":
+		return "", "", errors.New("not the authorization endpoint")
+	case q.Get("response_type") != "code":
+		return "", "", errors.New("response_type must be code")
+	case q.Get("client_id") != p.ClientID:
+		return "", "", errors.New("unknown client_id")
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("PKCE S256 challenge required")
+	}
+
+	all := jwt.MapClaims{"nonce": q.Get("nonce")}
+	for k, v := range claims {
+		all[k] = v
+	}
+	code = randomString()
+	p.mu.Lock()
+	p.grants[code] = grant{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: all}
+	p.mu.Unlock()
+	return code, q.Get("state"), nil
+}
+
+// IDToken signs an ID token for claims, filling in iss, aud, iat and exp
+// unless claims sets them
+func (p *IdP) IDToken(claims jwt.MapClaims) string {
+	all := jwt.MapClaims{
+		"iss": p.URL,
+		"aud": p.ClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	return Sign(p.Key, all)
+}
+
+// Sign signs claims with key under KeyID
+func Sign(key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = KeyID
+	s, err := t.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (p *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"userinfo_endpoint":      p.URL + "/userinfo",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": KeyID,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code) // codes are single use, even after a failed exchange
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != p.ClientID:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+		return
+	case !ok || r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	access := randomString()
+	p.mu.Lock()
+	p.userinfo[access] = g.claims
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": access,
+		"id_token":     p.IDToken(g.claims),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (p *IdP) userInfo(w http.ResponseWriter, r *http.Request) {
+	access, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	claims, ok := p.userinfo[access]
+	p.mu.Unlock()
+	if !found || !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	info := jwt.MapClaims{}
+	for _, k := range []string{"sub", "name", "email", "email_verified", "phone_number", "phone_number_verified"} {
+		if v, ok := claims[k]; ok {
+			info[k] = v
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
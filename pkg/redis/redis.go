@@ -0,0 +1,437 @@
+// Package redis is a minimal client for servers speaking the Redis
+// protocol (RESP2): Redis, Valkey, KeyDB and the like. It sends one command
+// at a time over a small connection pool, which is all the cache and rate
+// limiter need.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error reply from the server, such as "WRONGTYPE ..."
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// ErrClosed is returned by Do after Close
+var ErrClosed = errors.New("redis: client closed")
+
+// Options configures a Client
+type Options struct {
+	Addr     string // host:port
+	Password string // sent with AUTH when set
+	DB       int    // selected with SELECT when not 0
+	// PoolSize is how many idle connections are kept (default 10)
+	PoolSize int
+	// DialTimeout bounds connecting and authenticating (default 5s)
+	DialTimeout time.Duration
+	// Timeout bounds a command whose context has no deadline (default 3s)
+	Timeout time.Duration
+}
+
+// Client sends commands to one server. It is safe for concurrent use.
+type Client struct {
+	opts Options
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	return &Client{opts: opts}
+}
+
+// Do sends a command and returns its reply: string for status replies,
+// int64 for integers, []byte for bulk strings, []any for arrays, and nil
+// for null replies. Error replies are returned as Error. Arguments may be
+// strings, byte slices, integers or durations (sent as milliseconds).
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.send(ctx, cn, args)
+	if err != nil && !isReplyError(err) {
+		// The connection may be mid-reply; never reuse it
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// send runs one command on cn, bounded by the default timeout when ctx has
+// no deadline
+func (c *Client) send(ctx context.Context, cn *conn, args []any) (any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	return cn.do(ctx, args)
+}
+
+func isReplyError(err error) bool {
+	var replyErr Error
+	return errors.As(err, &replyErr)
+}
+
+func firstArg(args []any) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	name, ok := args[0].(string)
+	return name, ok
+}
+
+// ErrTxAborted is returned by Conn.Exec when a watched key changed before
+// the transaction ran. Nothing was executed; the caller may retry.
+var ErrTxAborted = errors.New("redis: transaction aborted")
+
+// Conn is one connection held for commands that must share it, such as
+// WATCH followed by MULTI and EXEC
+type Conn struct {
+	c        *Client
+	cn       *conn
+	broken   bool
+	watching bool
+}
+
+// WithConn runs fn on a connection of its own. A connection left watching
+// keys, or that failed mid-reply, is closed rather than reused.
+func (c *Client) WithConn(ctx context.Context, fn func(cn *Conn) error) error {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+	conn := &Conn{c: c, cn: cn}
+	err = fn(conn)
+	if conn.broken || conn.watching {
+		cn.nc.Close()
+	} else {
+		c.put(cn)
+	}
+	return err
+}
+
+// Do sends a command on the connection, like Client.Do
+func (cn *Conn) Do(ctx context.Context, args ...any) (any, error) {
+	if cn.broken {
+		return nil, errors.New("redis: connection broken")
+	}
+	reply, err := cn.c.send(ctx, cn.cn, args)
+	if err != nil && !isReplyError(err) {
+		cn.broken = true
+		return nil, err
+	}
+	if name, ok := firstArg(args); ok && err == nil {
+		switch strings.ToUpper(name) {
+		case "WATCH":
+			cn.watching = true
+		case "UNWATCH", "EXEC", "DISCARD":
+			cn.watching = false
+		}
+	}
+	return reply, err
+}
+
+// Exec runs cmds atomically in a MULTI/EXEC transaction, sent in one round
+// trip, and returns their replies. Replies that are errors are returned as
+// Error values in the slice. If keys watched on the connection changed,
+// Exec returns ErrTxAborted.
+func (cn *Conn) Exec(ctx context.Context, cmds ...[]any) ([]any, error) {
+	if cn.broken {
+		return nil, errors.New("redis: connection broken")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cn.c.opts.Timeout)
+		defer cancel()
+	}
+	replies, err := cn.cn.exec(ctx, cmds)
+	if err != nil && !isReplyError(err) && !errors.Is(err, ErrTxAborted) {
+		cn.broken = true
+		return nil, err
+	}
+	cn.watching = false
+	return replies, err
+}
+
+// Exec runs cmds atomically on a connection of its own
+func (c *Client) Exec(ctx context.Context, cmds ...[]any) ([]any, error) {
+	var replies []any
+	err := c.WithConn(ctx, func(cn *Conn) error {
+		var err error
+		replies, err = cn.Exec(ctx, cmds...)
+		return err
+	})
+	return replies, err
+}
+
+// Ping checks that the server answers
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections; later calls to Do fail
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= c.opts.PoolSize {
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.DialTimeout)
+	defer cancel()
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.opts.Password != "" {
+		if _, err := cn.do(ctx, []any{"AUTH", c.opts.Password}); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis: auth: %w", err)
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.do(ctx, []any{"SELECT", c.opts.DB}); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis: select: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) do(ctx context.Context, args []any) (any, error) {
+	deadline, _ := ctx.Deadline()
+	cn.nc.SetDeadline(deadline)
+	if err := writeCommand(cn.w, args); err != nil {
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return ReadReply(cn.r)
+}
+
+// exec pipelines MULTI, cmds and EXEC, then reads the acknowledgements and
+// the EXEC reply
+func (cn *conn) exec(ctx context.Context, cmds [][]any) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	cn.nc.SetDeadline(deadline)
+	writeCommand(cn.w, []any{"MULTI"})
+	for _, cmd := range cmds {
+		if err := writeCommand(cn.w, cmd); err != nil {
+			return nil, err
+		}
+	}
+	writeCommand(cn.w, []any{"EXEC"})
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	// OK for MULTI, then QUEUED or an error for each command
+	var queueErr error
+	for i := 0; i <= len(cmds); i++ {
+		if _, err := ReadReply(cn.r); err != nil {
+			if !isReplyError(err) {
+				return nil, err
+			}
+			if queueErr == nil {
+				queueErr = err
+			}
+		}
+	}
+	reply, err := ReadReply(cn.r)
+	if queueErr != nil {
+		// EXEC answers EXECABORT; the queueing error says why
+		if err != nil && !isReplyError(err) {
+			return nil, err
+		}
+		return nil, queueErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrTxAborted
+	}
+	replies, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected %T reply to EXEC", reply)
+	}
+	return replies, nil
+}
+
+func writeCommand(w *bufio.Writer, args []any) error {
+	bulk := make([][]byte, len(args))
+	for i, a := range args {
+		var b []byte
+		switch v := a.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		case float64:
+			b = strconv.AppendFloat(nil, v, 'f', -1, 64)
+		case time.Duration:
+			b = strconv.AppendInt(nil, v.Milliseconds(), 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", a)
+		}
+		bulk[i] = b
+	}
+	fmt.Fprintf(w, "*%d\r\n", len(bulk))
+	for _, b := range bulk {
+		fmt.Fprintf(w, "$%d\r\n", len(b))
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	return nil
+}
+
+// ReadReply reads one RESP2 reply. Error replies are returned as the
+// error, with a nil reply.
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply line")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := ReadReply(r)
+			var replyErr Error
+			if errors.As(err, &replyErr) {
+				// errors inside arrays (EXEC) are values
+				items[i] = replyErr
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// Int converts an integer reply, or a bulk string holding one
+func Int(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected %T reply, want integer", reply)
+}
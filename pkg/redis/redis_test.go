@@ -0,0 +1,117 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis"
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis/redistest"
+)
+
+func TestClient(t *testing.T) {
+	srv := redistest.NewServer(t)
+	c := srv.Client(t)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := c.Do(ctx, "SET", "k", []byte("v\r\nwith crlf"), "PX", time.Minute); err != nil || reply != "OK" {
+		t.Fatalf("SET = %v, %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "GET", "k"); err != nil || string(reply.([]byte)) != "v\r\nwith crlf" {
+		t.Fatalf("GET = %q, %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "GET", "missing"); err != nil || reply != nil {
+		t.Fatalf("GET missing = %v, %v; want nil", reply, err)
+	}
+	if n, err := redis.Int(c.Do(ctx, "INCRBY", "n", 5)); err != nil || n != 5 {
+		t.Fatalf("INCRBY = %d, %v", n, err)
+	}
+
+	// An error reply leaves the connection usable
+	var replyErr redis.Error
+	if _, err := c.Do(ctx, "INCR", "k"); !errors.As(err, &replyErr) {
+		t.Fatalf("INCR on a string = %v, want an error reply", err)
+	}
+	if n, err := redis.Int(c.Do(ctx, "DEL", "k", "n", "missing")); err != nil || n != 2 {
+		t.Fatalf("DEL = %d, %v; want 2", n, err)
+	}
+
+	if _, err := c.Do(ctx, "SET", "k", struct{}{}); err == nil {
+		t.Error("SET with an unsupported argument succeeded")
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping after a rejected command: %v", err)
+	}
+
+	srv.Close()
+	if err := c.Ping(ctx); err == nil {
+		t.Error("Ping succeeded after the server stopped")
+	}
+	c.Close()
+	if err := c.Ping(ctx); !errors.Is(err, redis.ErrClosed) {
+		t.Errorf("Ping after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	srv := redistest.NewServer(t)
+	c := srv.Client(t)
+	ctx := context.Background()
+
+	replies, err := c.Exec(ctx, []any{"SET", "k", "0", "PX", time.Minute, "NX"}, []any{"INCR", "k"}, []any{"GET", "missing"})
+	if err != nil || len(replies) != 3 || replies[0] != "OK" || replies[1] != int64(1) || replies[2] != nil {
+		t.Fatalf("Exec = %v, %v", replies, err)
+	}
+	// A command failing at run time does not stop the others
+	replies, err = c.Exec(ctx, []any{"ZADD", "k", 1, "m"}, []any{"INCR", "k"})
+	if _, ok := replies[0].(redis.Error); err != nil || !ok || replies[1] != int64(2) {
+		t.Fatalf("Exec with a wrong type = %v, %v", replies, err)
+	}
+	// One rejected while queueing discards the transaction
+	var replyErr redis.Error
+	if _, err := c.Exec(ctx, []any{"INCR", "k"}, []any{"NOSUCHCOMMAND"}); !errors.As(err, &replyErr) {
+		t.Fatalf("Exec with an unknown command = %v, want an error reply", err)
+	}
+	if n, err := redis.Int(c.Do(ctx, "GET", "k")); err != nil || n != 2 {
+		t.Fatalf("GET after discarded transaction = %d, %v; want 2", n, err)
+	}
+
+	// WATCH aborts the transaction when another client writes the key
+	err = c.WithConn(ctx, func(cn *redis.Conn) error {
+		if _, err := cn.Do(ctx, "WATCH", "k"); err != nil {
+			return err
+		}
+		if _, err := c.Do(ctx, "INCR", "k"); err != nil {
+			return err
+		}
+		_, err := cn.Exec(ctx, []any{"SET", "k", "100"})
+		return err
+	})
+	if !errors.Is(err, redis.ErrTxAborted) {
+		t.Fatalf("Exec after a watched key changed = %v, want ErrTxAborted", err)
+	}
+	err = c.WithConn(ctx, func(cn *redis.Conn) error {
+		if _, err := cn.Do(ctx, "WATCH", "k"); err != nil {
+			return err
+		}
+		_, err := cn.Exec(ctx, []any{"SET", "k", "100"})
+		return err
+	})
+	if n, _ := redis.Int(c.Do(ctx, "GET", "k")); err != nil || n != 100 {
+		t.Fatalf("watched transaction = %d, %v; want 100", n, err)
+	}
+
+	// Sorted sets, as used by the sliding window rate limiter
+	c.Do(ctx, "ZADD", "z", 1, "a", 2, "b", 3, "c")
+	if n, err := redis.Int(c.Do(ctx, "ZREMRANGEBYSCORE", "z", "-inf", "(2")); err != nil || n != 1 {
+		t.Fatalf("ZREMRANGEBYSCORE = %d, %v; want 1", n, err)
+	}
+	reply, err := c.Do(ctx, "ZRANGEBYSCORE", "z", "-inf", "+inf", "WITHSCORES")
+	if items, _ := reply.([]any); err != nil || len(items) != 4 || string(items[0].([]byte)) != "b" || string(items[3].([]byte)) != "3" {
+		t.Fatalf("ZRANGEBYSCORE = %q, %v", reply, err)
+	}
+}
@@ -0,0 +1,540 @@
+// Package redistest runs an in-process server speaking enough of the Redis
+// protocol to test code built on pkg/redis without a real server.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zuquanzhi/Chirp/backend/pkg/redis"
+)
+
+// Server is a fake Redis holding strings and sorted sets with expiry. It
+// supports transactions (MULTI, EXEC and WATCH) and TIME, which follows
+// FastForward.
+type Server struct {
+	l net.Listener
+
+	mu       sync.Mutex
+	values   map[string]entry
+	versions map[string]int64 // bumped by every write, for WATCH
+	commands int
+	now      func() time.Time
+	conns    map[net.Conn]bool
+
+	wg sync.WaitGroup
+}
+
+type entry struct {
+	value   []byte
+	zset    map[string]float64 // set instead of value for sorted sets
+	expires time.Time          // zero when the key does not expire
+}
+
+// session is the transaction state of one connection
+type session struct {
+	queued  [][]string // commands after MULTI; nil outside a transaction
+	watched map[string]int64
+	failed  bool // a command was rejected while queueing; EXEC aborts
+}
+
+// NewServer starts a server on a free local port, stopped when the test ends
+func NewServer(t testing.TB) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		l:        l,
+		values:   make(map[string]entry),
+		versions: make(map[string]int64),
+		now:      time.Now,
+		conns:    make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr is the address to pass in redis.Options
+func (s *Server) Addr() string { return s.l.Addr().String() }
+
+// Client returns a client for the server, closed when the test ends
+func (s *Server) Client(t testing.TB) *redis.Client {
+	c := redis.NewClient(redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// Close stops the server and drops its connections
+func (s *Server) Close() {
+	s.l.Close()
+	s.mu.Lock()
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Commands returns how many commands the server has handled
+func (s *Server) Commands() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands
+}
+
+// FastForward moves the server's clock, expiring keys as if d had passed
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now
+	s.now = func() time.Time { return now().Add(d) }
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[nc] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(nc)
+	}
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		nc.Close()
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+	}()
+	r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+	var sess session
+	for {
+		cmd, err := redis.ReadReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := cmd.([]any)
+		args := make([]string, len(items))
+		for i, it := range items {
+			b, _ := it.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			writeReply(w, redis.Error("ERR empty command"))
+		} else {
+			writeReply(w, s.dispatch(&sess, args))
+		}
+		// Pipelined commands are answered together
+		if r.Buffered() > 0 {
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// commands lists the commands exec supports; true marks writes, which bump
+// the version of the keys they name
+var commands = map[string]bool{
+	"PING": false, "AUTH": false, "SELECT": false, "TIME": false,
+	"GET": false, "SET": true, "DEL": true, "INCR": true, "INCRBY": true,
+	"PEXPIRE": true, "PTTL": false, "FLUSHALL": true, "FLUSHDB": true,
+	"ZADD": true, "ZREM": true, "ZREMRANGEBYSCORE": true, "ZRANGEBYSCORE": false, "ZCARD": false,
+}
+
+// dispatch handles the transaction commands of a connection and queues
+// other commands inside MULTI
+func (s *Server) dispatch(sess *session, args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands++
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if sess.queued != nil {
+			return redis.Error("ERR MULTI calls can not be nested")
+		}
+		sess.queued = [][]string{}
+		return "OK"
+	case "EXEC":
+		if sess.queued == nil {
+			return redis.Error("ERR EXEC without MULTI")
+		}
+		queued, failed, watched := sess.queued, sess.failed, sess.watched
+		*sess = session{}
+		if failed {
+			return redis.Error("EXECABORT Transaction discarded because of previous errors.")
+		}
+		for k, v := range watched {
+			if s.versions[k] != v {
+				return nil
+			}
+		}
+		replies := make([]any, len(queued))
+		for i, cmd := range queued {
+			replies[i] = s.exec(cmd)
+		}
+		return replies
+	case "DISCARD":
+		if sess.queued == nil {
+			return redis.Error("ERR DISCARD without MULTI")
+		}
+		*sess = session{}
+		return "OK"
+	case "WATCH":
+		if sess.queued != nil {
+			return redis.Error("ERR WATCH inside MULTI is not allowed")
+		}
+		if sess.watched == nil {
+			sess.watched = make(map[string]int64)
+		}
+		for _, k := range args[1:] {
+			sess.watched[k] = s.versions[k]
+		}
+		return "OK"
+	case "UNWATCH":
+		sess.watched = nil
+		return "OK"
+	}
+	if sess.queued != nil {
+		if _, ok := commands[name]; !ok {
+			sess.failed = true
+			return unknownCommand(name)
+		}
+		sess.queued = append(sess.queued, args)
+		return "QUEUED"
+	}
+	return s.exec(args)
+}
+
+// exec runs one command with s.mu held
+func (s *Server) exec(args []string) any {
+	name, args := strings.ToUpper(args[0]), args[1:]
+	if commands[name] {
+		s.touch(name, args)
+	}
+	switch name {
+	case "PING":
+		return "PONG"
+	case "AUTH", "SELECT":
+		return "OK"
+	case "TIME":
+		now := s.now()
+		return []any{[]byte(strconv.FormatInt(now.Unix(), 10)), []byte(strconv.Itoa(now.Nanosecond() / 1000))}
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.get(args[0])
+		if !ok {
+			return nil
+		}
+		if e.zset != nil {
+			return wrongType
+		}
+		return e.value
+	case "SET":
+		return s.set(args)
+	case "DEL":
+		var n int64
+		for _, k := range args {
+			if _, ok := s.get(k); ok {
+				delete(s.values, k)
+				n++
+			}
+		}
+		return n
+	case "INCR", "INCRBY":
+		if len(args) < 1 {
+			return wrongArgs(name)
+		}
+		by := int64(1)
+		if name == "INCRBY" {
+			if len(args) != 2 {
+				return wrongArgs(name)
+			}
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return redis.Error("ERR value is not an integer or out of range")
+			}
+		}
+		e, _ := s.get(args[0])
+		if e.zset != nil {
+			return wrongType
+		}
+		n, err := strconv.ParseInt(string(e.value), 10, 64)
+		if e.value != nil && err != nil {
+			return redis.Error("ERR value is not an integer or out of range")
+		}
+		n += by
+		e.value = []byte(strconv.FormatInt(n, 10))
+		s.values[args[0]] = e
+		return n
+	case "PEXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return redis.Error("ERR value is not an integer or out of range")
+		}
+		e, ok := s.get(args[0])
+		if !ok {
+			return int64(0)
+		}
+		e.expires = s.now().Add(time.Duration(ms) * time.Millisecond)
+		s.values[args[0]] = e
+		return int64(1)
+	case "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.get(args[0])
+		switch {
+		case !ok:
+			return int64(-2)
+		case e.expires.IsZero():
+			return int64(-1)
+		}
+		return e.expires.Sub(s.now()).Milliseconds()
+	case "FLUSHALL", "FLUSHDB":
+		s.values = make(map[string]entry)
+		return "OK"
+	case "ZADD", "ZREM", "ZREMRANGEBYSCORE", "ZRANGEBYSCORE", "ZCARD":
+		return s.zset(name, args)
+	}
+	return unknownCommand(name)
+}
+
+// touch bumps the version of the keys a write names, failing transactions
+// that watch them
+func (s *Server) touch(name string, args []string) {
+	switch {
+	case name == "FLUSHALL" || name == "FLUSHDB":
+		for k := range s.values {
+			s.versions[k]++
+		}
+	case name == "DEL":
+		for _, k := range args {
+			s.versions[k]++
+		}
+	case len(args) > 0:
+		s.versions[args[0]]++
+	}
+}
+
+// get returns a live entry, dropping it if it has expired
+func (s *Server) get(key string) (entry, bool) {
+	e, ok := s.values[key]
+	if ok && !e.expires.IsZero() && !s.now().Before(e.expires) {
+		delete(s.values, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (s *Server) set(args []string) any {
+	if len(args) < 2 {
+		return wrongArgs("SET")
+	}
+	e := entry{value: []byte(args[1])}
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return redis.Error("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return redis.Error("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				unit = time.Second
+			}
+			e.expires = s.now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return redis.Error("ERR syntax error")
+		}
+	}
+	_, exists := s.get(args[0])
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.values[args[0]] = e
+	return "OK"
+}
+
+// zset handles ZADD key score member [score member ...], ZREM key member
+// [member ...], ZREMRANGEBYSCORE key min max, ZRANGEBYSCORE key min max
+// [WITHSCORES] and ZCARD key
+func (s *Server) zset(name string, args []string) any {
+	if len(args) < 1 {
+		return wrongArgs(name)
+	}
+	key := args[0]
+	e, ok := s.get(key)
+	if ok && e.zset == nil {
+		return wrongType
+	}
+	if !ok {
+		e.zset = make(map[string]float64)
+	}
+	// Sorted sets are removed with their last member
+	defer func() {
+		if len(e.zset) == 0 {
+			delete(s.values, key)
+		} else {
+			s.values[key] = e
+		}
+	}()
+
+	switch name {
+	case "ZCARD":
+		return int64(len(e.zset))
+	case "ZADD":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return wrongArgs(name)
+		}
+		var added int64
+		for i := 1; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return redis.Error("ERR value is not a valid float")
+			}
+			if _, ok := e.zset[args[i+1]]; !ok {
+				added++
+			}
+			e.zset[args[i+1]] = score
+		}
+		return added
+	case "ZREM":
+		var removed int64
+		for _, m := range args[1:] {
+			if _, ok := e.zset[m]; ok {
+				delete(e.zset, m)
+				removed++
+			}
+		}
+		return removed
+	}
+
+	if len(args) < 3 {
+		return wrongArgs(name)
+	}
+	min, minErr := parseBound(args[1])
+	max, maxErr := parseBound(args[2])
+	if minErr != nil || maxErr != nil {
+		return redis.Error("ERR min or max is not a float")
+	}
+	withScores := len(args) == 4 && strings.ToUpper(args[3]) == "WITHSCORES"
+	if len(args) > 3 && (name != "ZRANGEBYSCORE" || !withScores) {
+		return redis.Error("ERR syntax error")
+	}
+	var members []string
+	for m, score := range e.zset {
+		if min.atMost(score) && max.atLeast(score) {
+			members = append(members, m)
+		}
+	}
+	if name == "ZREMRANGEBYSCORE" {
+		for _, m := range members {
+			delete(e.zset, m)
+		}
+		return int64(len(members))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := e.zset[members[i]], e.zset[members[j]]
+		return a < b || a == b && members[i] < members[j]
+	})
+	reply := []any{}
+	for _, m := range members {
+		reply = append(reply, []byte(m))
+		if withScores {
+			reply = append(reply, []byte(strconv.FormatFloat(e.zset[m], 'f', -1, 64)))
+		}
+	}
+	return reply
+}
+
+// bound is one end of a score range: a number, a number after "(" to
+// exclude it, or -inf/+inf
+type bound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseBound(s string) (bound, error) {
+	var b bound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive, s = true, s[1:]
+	}
+	var err error
+	b.score, err = strconv.ParseFloat(s, 64)
+	return b, err
+}
+
+// atMost reports whether the minimum b admits score
+func (b bound) atMost(score float64) bool {
+	return score > b.score || !b.exclusive && score == b.score
+}
+
+// atLeast reports whether the maximum b admits score
+func (b bound) atLeast(score float64) bool {
+	return score < b.score || !b.exclusive && score == b.score
+}
+
+var wrongType = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+func unknownCommand(name string) redis.Error {
+	return redis.Error(fmt.Sprintf("ERR unknown command '%s'", name))
+}
+
+func wrongArgs(name string) redis.Error {
+	return redis.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+func writeReply(w *bufio.Writer, v any) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case redis.Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy picks which provider MultiSender tries first
+type Strategy string
+
+const (
+	// Failover always starts with the first provider
+	Failover Strategy = "failover"
+	// RoundRobin starts each send with the next provider in turn
+	RoundRobin Strategy = "round_robin"
+)
+
+// Delivery statuses
+const (
+	StatusSent   = "sent"
+	StatusFailed = "failed"
+)
+
+// Delivery records one attempt to send a code through a provider
+type Delivery struct {
+	Provider  string
+	Phone     string
+	Purpose   string
+	Status    string // StatusSent or StatusFailed
+	MessageID string
+	RequestID string
+	Error     string
+	Duration  time.Duration
+}
+
+// Recorder keeps delivery records for troubleshooting
+type Recorder interface {
+	RecordDelivery(ctx context.Context, d Delivery)
+}
+
+// MultiSender sends through several providers. When one fails, the code is
+// sent through the next, until one accepts it or all have failed. Every
+// attempt is passed to the recorder.
+type MultiSender struct {
+	providers []Provider
+	strategy  Strategy
+	recorder  Recorder
+	next      atomic.Uint64
+}
+
+// NewMultiSender tries providers in the given order, starting according to
+// strategy. recorder may be nil.
+func NewMultiSender(strategy Strategy, recorder Recorder, providers ...Provider) *MultiSender {
+	return &MultiSender{providers: providers, strategy: strategy, recorder: recorder}
+}
+
+func (m *MultiSender) Send(ctx context.Context, phone, code, purpose string) error {
+	n := len(m.providers)
+	if n == 0 {
+		return errors.New("no SMS providers configured")
+	}
+	start := 0
+	if m.strategy == RoundRobin {
+		start = int((m.next.Add(1) - 1) % uint64(n))
+	}
+
+	var errs []error
+	for i := 0; i < n; i++ {
+		p := m.providers[(start+i)%n]
+		began := time.Now()
+		receipt, err := p.Deliver(ctx, phone, code, purpose)
+		d := Delivery{
+			Provider:  p.Name(),
+			Phone:     phone,
+			Purpose:   purpose,
+			Status:    StatusSent,
+			MessageID: receipt.MessageID,
+			RequestID: receipt.RequestID,
+			Duration:  time.Since(began),
+		}
+		if err != nil {
+			d.Status, d.Error = StatusFailed, err.Error()
+		}
+		if m.recorder != nil {
+			// Record even when the caller has given up on the send
+			m.recorder.RecordDelivery(context.WithoutCancel(ctx), d)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+		if i < n-1 {
+			log.Printf("[SMS] provider failed, trying next: provider=%s purpose=%s err=%v", p.Name(), purpose, err)
+		}
+	}
+	return fmt.Errorf("all SMS providers failed: %w", errors.Join(errs...))
+}
@@ -2,11 +2,9 @@ package sms
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-
-	"github.com/aliyun/alibaba-cloud-sdk-go/services/dysmsapi"
+	"strings"
 )
 
 // Sender defines the interface for sending SMS
@@ -14,62 +12,78 @@ type Sender interface {
 	Send(ctx context.Context, phone, code, purpose string) error
 }
 
-// ConsoleSender is a mock sender that logs to console (for dev/test)
-type ConsoleSender struct{}
-
-func (s *ConsoleSender) Send(ctx context.Context, phone, code, purpose string) error {
-	log.Printf("[SMS] To: %s, Code: %s, Purpose: %s", phone, code, purpose)
-	return nil
+// Provider sends verification codes through one SMS vendor. MultiSender
+// turns one or more providers into a Sender.
+type Provider interface {
+	// Name identifies the provider in delivery records, e.g. "aliyun"
+	Name() string
+	// Deliver sends code to phone and returns the vendor's receipt. An
+	// error means the vendor did not accept the message; the receipt may
+	// still carry its RequestID.
+	Deliver(ctx context.Context, phone, code, purpose string) (Receipt, error)
 }
 
-// AliyunSender is a placeholder for Aliyun SMS implementation
-type AliyunSender struct {
-	AccessKeyID     string
-	AccessKeySecret string
-	SignName        string
-	TemplateCode    string
-	RegionID        string
+// Receipt is a vendor's acknowledgement of an accepted message
+type Receipt struct {
+	// MessageID is the vendor's ID for the message, used to look up its
+	// delivery status in the vendor console
+	MessageID string
+	// RequestID is the vendor's ID for the API call, asked for by their
+	// support
+	RequestID string
 }
 
-func NewAliyunSender(ak, sk, signName, templateCode string) *AliyunSender {
-	return &AliyunSender{
-		AccessKeyID:     ak,
-		AccessKeySecret: sk,
-		SignName:        signName,
-		TemplateCode:    templateCode,
-		RegionID:        "cn-hangzhou",
-	}
+// ConsoleSender is a mock sender that logs to console (for dev/test). It
+// logs codes only with EchoCodes set, which must stay off in production:
+// anyone who can read the logs could sign in as any user.
+type ConsoleSender struct {
+	EchoCodes bool
 }
 
-func (s *AliyunSender) Send(ctx context.Context, phone, code, purpose string) error {
-	log.Printf("[SMS] Aliyun sending phone=%s purpose=%s code=%s", phone, purpose, code)
-
-	client, err := dysmsapi.NewClientWithAccessKey(s.RegionID, s.AccessKeyID, s.AccessKeySecret)
-	if err != nil {
-		return fmt.Errorf("init aliyun client: %w", err)
+func (s *ConsoleSender) Send(ctx context.Context, phone, code, purpose string) error {
+	if s.EchoCodes {
+		// Not a key=value field, so the log redaction leaves the code alone
+		log.Printf("[SMS] phone=%s purpose=%s dev echo: %s", phone, purpose, code)
+		return nil
 	}
+	log.Printf("[SMS] phone=%s purpose=%s (code not sent; set DEV_ECHO_CODES=true to log it)", phone, purpose)
+	return nil
+}
 
-	request := dysmsapi.CreateSendSmsRequest()
-	request.Scheme = "https"
-	request.PhoneNumbers = phone
-	request.SignName = s.SignName
-	request.TemplateCode = s.TemplateCode
+// Templates maps the purpose of a code ("signup", "login", "bind_phone")
+// to a vendor template. The "default" entry covers the other purposes.
+type Templates map[string]string
 
-	// TemplateParam must be a JSON string, e.g., {"code":"123456"}
-	// Adjust the key "code" based on your actual Aliyun template variable name
-	params, _ := json.Marshal(map[string]string{"code": code})
-	request.TemplateParam = string(params)
+// DefaultTemplate is the Templates key used for purposes without their own
+const DefaultTemplate = "default"
 
-	response, err := client.SendSms(request)
-	if err != nil {
-		return fmt.Errorf("send sms: %w", err)
+// For returns the template for purpose
+func (t Templates) For(purpose string) (string, error) {
+	if id, ok := t[purpose]; ok {
+		return id, nil
 	}
-
-	if response.Code != "OK" {
-		return fmt.Errorf("aliyun sms error: %s - %s", response.Code, response.Message)
+	if id, ok := t[DefaultTemplate]; ok {
+		return id, nil
 	}
+	return "", fmt.Errorf("no SMS template for purpose %q", purpose)
+}
 
-	log.Printf("[SMS] Aliyun sent phone=%s purpose=%s requestId=%s bizId=%s", phone, purpose, response.RequestId, response.BizId)
-
-	return nil
+// ParseTemplates parses "purpose=template,..." e.g.
+// "signup=SMS_1,login=SMS_2,default=SMS_3". An empty string gives no
+// templates.
+func ParseTemplates(s string) (Templates, error) {
+	t := Templates{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		purpose, id, ok := strings.Cut(part, "=")
+		purpose, id = strings.TrimSpace(purpose), strings.TrimSpace(id)
+		if !ok || purpose == "" || id == "" {
+			return nil, fmt.Errorf("bad SMS template %q, want purpose=template", part)
+		}
+		t[purpose] = id
+	}
+	return t, nil
 }
@@ -0,0 +1,299 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	tpl, err := ParseTemplates(" signup=SMS_1, login = SMS_2 ,default=SMS_9,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for purpose, want := range map[string]string{"signup": "SMS_1", "login": "SMS_2", "bind_phone": "SMS_9"} {
+		if got, err := tpl.For(purpose); err != nil || got != want {
+			t.Errorf("For(%q) = %q, %v; want %q", purpose, got, err, want)
+		}
+	}
+	delete(tpl, DefaultTemplate)
+	if _, err := tpl.For("bind_phone"); err == nil {
+		t.Error("For without a default succeeded")
+	}
+	for _, bad := range []string{"signup", "signup=", "=SMS_1"} {
+		if _, err := ParseTemplates(bad); err == nil {
+			t.Errorf("ParseTemplates(%q) succeeded", bad)
+		}
+	}
+}
+
+// stub serves handler until the test ends
+func stub(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAliyunSender(t *testing.T) {
+	var mu sync.Mutex
+	var got []map[string]string
+	srv := stub(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		got = append(got, map[string]string{
+			"Action":        r.Form.Get("Action"),
+			"PhoneNumbers":  r.Form.Get("PhoneNumbers"),
+			"SignName":      r.Form.Get("SignName"),
+			"TemplateCode":  r.Form.Get("TemplateCode"),
+			"TemplateParam": r.Form.Get("TemplateParam"),
+		})
+		mu.Unlock()
+		if r.Form.Get("PhoneNumbers") == "13800000000" {
+			io.WriteString(w, `{"Code":"isv.MOBILE_NUMBER_ILLEGAL","Message":"invalid number","RequestId":"req-2"}`)
+			return
+		}
+		io.WriteString(w, `{"Code":"OK","Message":"OK","BizId":"biz-1","RequestId":"req-1"}`)
+	})
+
+	s, err := NewAliyunSender("ak", "sk", "Chirp", Templates{"login": "SMS_LOGIN", DefaultTemplate: "SMS_CODE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.domain, s.scheme = strings.TrimPrefix(srv.URL, "http://"), "http"
+
+	ctx := context.Background()
+	r, err := s.Deliver(ctx, "13900000000", "123456", "login")
+	if err != nil || r.MessageID != "biz-1" || r.RequestID != "req-1" {
+		t.Fatalf("Deliver = %+v, %v", r, err)
+	}
+	if _, err := s.Deliver(ctx, "13900000000", "654321", "signup"); err != nil {
+		t.Fatal(err)
+	}
+	r, err = s.Deliver(ctx, "13800000000", "111111", "login")
+	if err == nil || !strings.Contains(err.Error(), "MOBILE_NUMBER_ILLEGAL") || r.RequestID != "req-2" {
+		t.Fatalf("Deliver(rejected) = %+v, %v", r, err)
+	}
+
+	want := []map[string]string{
+		{"Action": "SendSms", "PhoneNumbers": "13900000000", "SignName": "Chirp", "TemplateCode": "SMS_LOGIN", "TemplateParam": `{"code":"123456"}`},
+		{"Action": "SendSms", "PhoneNumbers": "13900000000", "SignName": "Chirp", "TemplateCode": "SMS_CODE", "TemplateParam": `{"code":"654321"}`},
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if got[i][k] != v {
+				t.Errorf("request %d: %s = %q; want %q", i, k, got[i][k], v)
+			}
+		}
+	}
+}
+
+func TestTencentSender(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	srv := stub(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["TemplateId"] == "broken" {
+			io.WriteString(w, `{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"bad signature"},"RequestId":"req-2"}}`)
+			return
+		}
+		io.WriteString(w, `{"Response":{"SendStatusSet":[{"SerialNo":"serial-1","PhoneNumber":"+8613900000000","Code":"Ok","Message":"send success"}],"RequestId":"req-1"}}`)
+	})
+
+	s := NewTencentSender("sid", "skey", "1400000000", "Chirp", "ap-guangzhou", Templates{"signup": "1001", "login": "broken"})
+	s.endpoint = srv.URL
+
+	r, err := s.Deliver(context.Background(), "13900000000", "123456", "signup")
+	if err != nil || r.MessageID != "serial-1" || r.RequestID != "req-1" {
+		t.Fatalf("Deliver = %+v, %v", r, err)
+	}
+	if phones, _ := body["PhoneNumberSet"].([]any); len(phones) != 1 || phones[0] != "+8613900000000" {
+		t.Errorf("PhoneNumberSet = %v", body["PhoneNumberSet"])
+	}
+	if params, _ := body["TemplateParamSet"].([]any); len(params) != 1 || params[0] != "123456" {
+		t.Errorf("TemplateParamSet = %v", body["TemplateParamSet"])
+	}
+	if body["SmsSdkAppId"] != "1400000000" || body["SignName"] != "Chirp" || body["TemplateId"] != "1001" {
+		t.Errorf("body = %v", body)
+	}
+	if header.Get("X-TC-Action") != "SendSms" || header.Get("X-TC-Version") != tencentVersion || header.Get("X-TC-Region") != "ap-guangzhou" {
+		t.Errorf("headers = %v", header)
+	}
+	if auth := header.Get("Authorization"); !strings.HasPrefix(auth, "TC3-HMAC-SHA256 Credential=sid/") || !strings.Contains(auth, "/sms/tc3_request, SignedHeaders=content-type;host, Signature=") {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	if _, err := s.Deliver(context.Background(), "+447700900000", "123456", "login"); err == nil || !strings.Contains(err.Error(), "SignatureFailure") {
+		t.Errorf("Deliver(error) = %v", err)
+	}
+	if phones, _ := body["PhoneNumberSet"].([]any); len(phones) != 1 || phones[0] != "+447700900000" {
+		t.Errorf("PhoneNumberSet = %v; want the number kept as given", body["PhoneNumberSet"])
+	}
+	if _, err := s.Deliver(context.Background(), "13900000000", "123456", "bind_phone"); err == nil {
+		t.Error("Deliver without a template succeeded")
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	status := http.StatusOK
+	var got map[string]string
+	srv := stub(t, func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(raw)
+		if r.Header.Get("X-Chirp-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(raw, &got)
+		w.WriteHeader(status)
+		io.WriteString(w, `{"message_id":"m-1"}`)
+	})
+
+	s := NewWebhookSender(srv.URL, "s3cret")
+	r, err := s.Deliver(context.Background(), "13900000000", "123456", "login")
+	if err != nil || r.MessageID != "m-1" {
+		t.Fatalf("Deliver = %+v, %v", r, err)
+	}
+	if got["phone"] != "13900000000" || got["code"] != "123456" || got["purpose"] != "login" {
+		t.Errorf("payload = %v", got)
+	}
+
+	status = http.StatusBadGateway
+	if _, err := s.Deliver(context.Background(), "13900000000", "123456", "login"); err == nil {
+		t.Error("Deliver with status 502 succeeded")
+	}
+	if _, err := NewWebhookSender(srv.URL, "wrong").Deliver(context.Background(), "13900000000", "123456", "login"); err == nil {
+		t.Error("Deliver with a bad signature succeeded")
+	}
+}
+
+type fakeProvider struct {
+	name string
+	err  error
+	sent []string
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Deliver(ctx context.Context, phone, code, purpose string) (Receipt, error) {
+	p.sent = append(p.sent, code)
+	if p.err != nil {
+		return Receipt{RequestID: "req-" + p.name}, p.err
+	}
+	return Receipt{MessageID: p.name + "-" + code}, nil
+}
+
+type recorder []Delivery
+
+func (r *recorder) RecordDelivery(ctx context.Context, d Delivery) { *r = append(*r, d) }
+
+func TestMultiSenderFailover(t *testing.T) {
+	down := &fakeProvider{name: "a", err: errors.New("quota exceeded")}
+	up := &fakeProvider{name: "b"}
+	var rec recorder
+	m := NewMultiSender(Failover, &rec, down, up)
+
+	ctx := context.Background()
+	for _, code := range []string{"1", "2"} {
+		if err := m.Send(ctx, "13900000000", code, "login"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(down.sent) != 2 || len(up.sent) != 2 {
+		t.Errorf("sent = %v, %v; want both tried for each code", down.sent, up.sent)
+	}
+	if len(rec) != 4 {
+		t.Fatalf("recorded %d deliveries; want 4", len(rec))
+	}
+	if d := rec[0]; d.Provider != "a" || d.Status != StatusFailed || d.Error != "quota exceeded" || d.RequestID != "req-a" || d.Phone != "13900000000" || d.Purpose != "login" {
+		t.Errorf("failed delivery = %+v", d)
+	}
+	if d := rec[1]; d.Provider != "b" || d.Status != StatusSent || d.MessageID != "b-1" || d.Error != "" {
+		t.Errorf("sent delivery = %+v", d)
+	}
+
+	up.err = errors.New("unavailable")
+	err := m.Send(ctx, "13900000000", "3", "login")
+	if err == nil || !strings.Contains(err.Error(), "a: quota exceeded") || !strings.Contains(err.Error(), "b: unavailable") {
+		t.Errorf("Send with all down = %v", err)
+	}
+}
+
+func TestMultiSenderRoundRobin(t *testing.T) {
+	a, b, c := &fakeProvider{name: "a"}, &fakeProvider{name: "b"}, &fakeProvider{name: "c"}
+	m := NewMultiSender(RoundRobin, nil, a, b, c)
+	for _, code := range []string{"1", "2", "3", "4"} {
+		if err := m.Send(context.Background(), "13900000000", code, "signup"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(a.sent, ",") != "1,4" || strings.Join(b.sent, ",") != "2" || strings.Join(c.sent, ",") != "3" {
+		t.Errorf("sent = %v, %v, %v", a.sent, b.sent, c.sent)
+	}
+
+	// A failing provider passes its turn on to the next
+	b.err = errors.New("down")
+	if err := m.Send(context.Background(), "13900000000", "5", "signup"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(b.sent, ",") != "2,5" || strings.Join(c.sent, ",") != "3,5" {
+		t.Errorf("sent = %v, %v", b.sent, c.sent)
+	}
+}
+
+func TestMultiSenderStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := &fakeProvider{name: "a", err: context.Canceled}
+	b := &fakeProvider{name: "b"}
+	if err := NewMultiSender(Failover, nil, a, b).Send(ctx, "13900000000", "1", "login"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send = %v; want context.Canceled", err)
+	}
+	if len(b.sent) != 0 {
+		t.Error("tried the next provider after the caller gave up")
+	}
+}
+
+func TestCodesNotLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	srv := stub(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"limit","RequestId":"req-1"}`)
+	})
+	aliyun, err := NewAliyunSender("ak", "sk", "Chirp", Templates{DefaultTemplate: "SMS_CODE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliyun.domain, aliyun.scheme = strings.TrimPrefix(srv.URL, "http://"), "http"
+	m := NewMultiSender(Failover, nil, aliyun, &fakeProvider{name: "b", err: errors.New("down")})
+	if err := m.Send(context.Background(), "13900000000", "482913", "login"); err == nil {
+		t.Fatal("Send succeeded")
+	}
+	if err := (&ConsoleSender{}).Send(context.Background(), "13900000000", "482913", "login"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "482913") {
+		t.Errorf("code logged:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	(&ConsoleSender{EchoCodes: true}).Send(context.Background(), "13900000000", "482913", "login")
+	if !strings.Contains(buf.String(), "482913") {
+		t.Errorf("EchoCodes did not log the code: %q", buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSender hands codes to an HTTP endpoint, e.g. an in-house SMS
+// gateway. It POSTs {"phone","code","purpose"} as JSON; with a secret the
+// X-Chirp-Signature header carries "sha256=" and the hex HMAC-SHA256 of the
+// body. Any 2xx status is success, and a JSON reply may name the message
+// in "message_id".
+type WebhookSender struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookSender(url, secret string) *WebhookSender {
+	return &WebhookSender{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WebhookSender) Name() string { return "webhook" }
+
+func (s *WebhookSender) Deliver(ctx context.Context, phone, code, purpose string) (Receipt, error) {
+	payload, _ := json.Marshal(map[string]string{"phone": phone, "code": code, "purpose": purpose})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return Receipt{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set("X-Chirp-Signature", "sha256="+hex.EncodeToString(hmacSHA256([]byte(s.secret), string(payload))))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("send sms: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return Receipt{}, fmt.Errorf("sms webhook: status %d", resp.StatusCode)
+	}
+	var out struct {
+		MessageID string `json:"message_id"`
+	}
+	json.Unmarshal(body, &out)
+	return Receipt{MessageID: out.MessageID}, nil
+}
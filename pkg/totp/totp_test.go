@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238 appendix B, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAtRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; a 6-digit code is the last
+	// six of them
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		got, err := CodeAt(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.code[len(v.code)-Digits:]; got != want {
+			t.Errorf("CodeAt(T=%d) = %s; want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestCodeAtSecretFormat(t *testing.T) {
+	want, _ := CodeAt(rfcSecret, 1)
+	got, err := CodeAt(" "+strings.ToLower(rfcSecret)+" ", 1)
+	if err != nil || got != want {
+		t.Errorf("lower case secret = %q, %v; want %q", got, err, want)
+	}
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := CodeAt(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if step, ok := Validate(rfcSecret, code(current), now, 0); !ok || step != current {
+		t.Errorf("current code = %d, %v; want %d, true", step, ok, current)
+	}
+	for _, step := range []int64{current - Skew, current + Skew} {
+		if got, ok := Validate(rfcSecret, code(step), now, 0); !ok || got != step {
+			t.Errorf("code for step %d = %d, %v; want accepted", step, got, ok)
+		}
+	}
+	for _, step := range []int64{current - Skew - 1, current + Skew + 1} {
+		if _, ok := Validate(rfcSecret, code(step), now, 0); ok {
+			t.Errorf("code for step %d accepted outside the skew", step)
+		}
+	}
+	if _, ok := Validate(rfcSecret, code(current), now, current); ok {
+		t.Error("code accepted again after its step was used")
+	}
+	if _, ok := Validate(rfcSecret, code(current)[1:], now, 0); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Chirp", "a@example.com", rfcSecret)
+	for _, want := range []string{"otpauth://totp/Chirp:a@example.com?", "secret=" + rfcSecret, "issuer=Chirp", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI = %s; missing %s", uri, want)
+		}
+	}
+}